@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2/google"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"example.com/megamon/internal/backfill"
+)
+
+// backfillNodesMain implements the "backfill-nodes" subcommand which seeds the
+// JobSet Node event records with Node Ready/NotReady history from Cloud
+// Logging.
+func backfillNodesMain(args []string) int {
+	fs := flag.NewFlagSet("backfill-nodes", flag.ExitOnError)
+	var ref, project, filter, from, to string
+	fs.StringVar(&ref, "configmap", "megamon-system/megamon-jobset-node-events", "The JobSet Node events ConfigMap (namespace/name).")
+	fs.StringVar(&project, "project", "", "The Google Cloud project to read logs from.")
+	fs.StringVar(&filter, "filter", backfill.DefaultNodeReadyFilter, "The Cloud Logging filter selecting Node Ready/NotReady events.")
+	fs.StringVar(&from, "from", "", "Start of the time range (RFC3339).")
+	fs.StringVar(&to, "to", "", "End of the time range (RFC3339, defaults to now).")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cmRef, err := parseNamespacedName(ref)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if project == "" {
+		fmt.Fprintln(os.Stderr, "--project is required")
+		return 2
+	}
+	start, err := time.Parse(time.RFC3339, from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --from: %v\n", err)
+		return 2
+	}
+	end := time.Now()
+	if to != "" {
+		if end, err = time.Parse(time.RFC3339, to); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --to: %v\n", err)
+			return 2
+		}
+	}
+	if !start.Before(end) {
+		fmt.Fprintln(os.Stderr, "--from must be before --to")
+		return 2
+	}
+
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "creating client: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	httpClient, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/logging.read")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "finding default credentials: %v\n", err)
+		return 1
+	}
+	imp := &backfill.NodeImporter{
+		Client: c,
+		Logging: &backfill.RESTLoggingClient{
+			HTTPClient: httpClient,
+			Project:    project,
+		},
+		Filter:                       filter,
+		Start:                        start,
+		End:                          end,
+		JobSetNodeEventsConfigMapRef: cmRef,
+	}
+	if err := imp.Import(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "backfilling node events: %v\n", err)
+		return 1
+	}
+	return 0
+}
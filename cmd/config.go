@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"sigs.k8s.io/yaml"
+)
+
+// fileConfig is the YAML file passed with --config, e.g.
+//
+//	interval: 30s
+//	reportConfigMap: megamon-system/megamon-report
+//	exporters:
+//	- name: pushgateway
+//	  params:
+//	    url: http://pushgateway:9091
+//	- name: gcs
+//	  params:
+//	    bucket: megamon-reports
+//	    retention-days: 30
+//
+// Every value is applied as the corresponding flag, so it is parsed and
+// validated the same way, and flags set on the command line take precedence.
+type fileConfig struct {
+	Interval                  string           `json:"interval,omitempty"`
+	ReportConfigMap           string           `json:"reportConfigMap,omitempty"`
+	JobSetEventsConfigMap     string           `json:"jobSetEventsConfigMap,omitempty"`
+	JobSetNodeEventsConfigMap string           `json:"jobSetNodeEventsConfigMap,omitempty"`
+	JobEventsConfigMap        string           `json:"jobEventsConfigMap,omitempty"`
+	Exporters                 []ExporterConfig `json:"exporters,omitempty"`
+}
+
+// ExporterConfig enables an exporter in the config file. Its params are the
+// flags of the exporter without their prefix, e.g. url for --pushgateway-url.
+type ExporterConfig struct {
+	Name   string         `json:"name"`
+	Params map[string]any `json:"params,omitempty"`
+}
+
+// exporterFlags are the flag prefixes of the exporters that can be configured
+// in the config file, and the flag that enables them, if any. The others are
+// enabled by their params, e.g. url.
+var exporterFlags = map[string]struct {
+	prefix string
+	enable string
+}{
+	"opensearch":      {prefix: "opensearch-"},
+	"pushgateway":     {prefix: "pushgateway-"},
+	"webhook":         {prefix: "webhook-"},
+	"slack":           {prefix: "slack-"},
+	"gcs":             {prefix: "gcs-"},
+	"bigquery":        {prefix: "bigquery-"},
+	"cloudmonitoring": {prefix: "cloud-monitoring-", enable: "cloud-monitoring"},
+	"sqlite":          {prefix: "sqlite-"},
+	"file":            {prefix: "file-export-"},
+}
+
+func loadConfigFile(path string) (fileConfig, error) {
+	var fc fileConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fc, err
+	}
+	if err := yaml.UnmarshalStrict(data, &fc); err != nil {
+		return fc, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return fc, nil
+}
+
+// applyConfigFile sets the flags of fs from fc, except the ones that were set
+// on the command line. fs must have been parsed.
+func applyConfigFile(fs *flag.FlagSet, fc fileConfig) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	apply := func(name, value string) error {
+		if set[name] || value == "" {
+			return nil
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("--%s: %w", name, err)
+		}
+		return nil
+	}
+
+	for _, f := range []struct{ name, value string }{
+		{"aggregation-interval", fc.Interval},
+		{"report-configmap", fc.ReportConfigMap},
+		{"jobset-events-configmap", fc.JobSetEventsConfigMap},
+		{"jobset-node-events-configmap", fc.JobSetNodeEventsConfigMap},
+		{"job-events-configmap", fc.JobEventsConfigMap},
+	} {
+		if err := apply(f.name, f.value); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range fc.Exporters {
+		flags, ok := exporterFlags[e.Name]
+		if !ok {
+			return fmt.Errorf("unknown exporter %q", e.Name)
+		}
+		if flags.enable == "" && len(e.Params) == 0 {
+			return fmt.Errorf("exporter %s: no params, nothing would be enabled", e.Name)
+		}
+		if flags.enable != "" {
+			if err := apply(flags.enable, "true"); err != nil {
+				return err
+			}
+		}
+		// Sorted for deterministic errors.
+		params := make([]string, 0, len(e.Params))
+		for param := range e.Params {
+			params = append(params, param)
+		}
+		sort.Strings(params)
+		for _, param := range params {
+			name := flags.prefix + param
+			if fs.Lookup(name) == nil {
+				return fmt.Errorf("exporter %s: unknown param %q", e.Name, param)
+			}
+			if err := apply(name, formatParam(e.Params[param])); err != nil {
+				return fmt.Errorf("exporter %s: %w", e.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// formatParam formats a param value as a flag value. YAML numbers decode as
+// float64, which fmt would print in exponent form, e.g. 1e+06.
+func formatParam(v any) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyConfigFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+interval: 30s
+reportConfigMap: team/report
+exporters:
+- name: pushgateway
+  params:
+    url: http://pushgateway:9091
+    job: file
+- name: gcs
+  params:
+    bucket: reports
+    retention-days: 1000000
+- name: cloudmonitoring
+`), 0o644))
+	fc, err := loadConfigFile(path)
+	require.NoError(t, err)
+	require.Len(t, fc.Exporters, 3)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	interval := fs.Duration("aggregation-interval", 10*time.Second, "")
+	reportConfigMap := fs.String("report-configmap", "default/report", "")
+	fs.String("jobset-events-configmap", "", "")
+	fs.String("jobset-node-events-configmap", "", "")
+	fs.String("job-events-configmap", "", "")
+	pushgatewayURL := fs.String("pushgateway-url", "", "")
+	pushgatewayJob := fs.String("pushgateway-job", "megamon", "")
+	gcsBucket := fs.String("gcs-bucket", "", "")
+	gcsRetentionDays := fs.Int("gcs-retention-days", 0, "")
+	cloudMonitoring := fs.Bool("cloud-monitoring", false, "")
+	// Flags take precedence over the file.
+	require.NoError(t, fs.Parse([]string{"--pushgateway-job=flag"}))
+
+	require.NoError(t, applyConfigFile(fs, fc))
+	require.Equal(t, 30*time.Second, *interval)
+	require.Equal(t, "team/report", *reportConfigMap)
+	require.Equal(t, "http://pushgateway:9091", *pushgatewayURL)
+	require.Equal(t, "flag", *pushgatewayJob)
+	require.Equal(t, "reports", *gcsBucket)
+	require.Equal(t, 1000000, *gcsRetentionDays)
+	require.True(t, *cloudMonitoring)
+
+	// Unknown exporters and params are rejected.
+	require.ErrorContains(t, applyConfigFile(fs, fileConfig{Exporters: []ExporterConfig{{Name: "kafka"}}}), "unknown exporter")
+	require.ErrorContains(t, applyConfigFile(fs, fileConfig{Exporters: []ExporterConfig{{
+		Name:   "gcs",
+		Params: map[string]any{"region": "us"},
+	}}}), "unknown param")
+	require.ErrorContains(t, applyConfigFile(fs, fileConfig{Exporters: []ExporterConfig{{Name: "gcs"}}}), "nothing would be enabled")
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Duration("aggregation-interval", 10*time.Second, "")
+	require.NoError(t, fs.Parse(nil))
+	require.ErrorContains(t, applyConfigFile(fs, fileConfig{Interval: "soon"}), "--aggregation-interval")
+
+	// Unknown keys are rejected.
+	require.NoError(t, os.WriteFile(path, []byte("intervall: 30s\n"), 0o644))
+	_, err = loadConfigFile(path)
+	require.Error(t, err)
+}
@@ -21,15 +21,17 @@ import (
 	"crypto/tls"
 	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"k8s.io/apimachinery/pkg/fields"
@@ -49,7 +51,9 @@ import (
 
 	"example.com/megamon/internal/aggregator"
 	"example.com/megamon/internal/controller"
+	"example.com/megamon/internal/k8sutils"
 	"example.com/megamon/internal/metrics"
+	"example.com/megamon/internal/records"
 
 	// +kubebuilder:scaffold:imports
 
@@ -70,24 +74,183 @@ func init() {
 }
 
 type config struct {
-	AggregationInterval          time.Duration
-	ReportConfigMapRef           types.NamespacedName
-	JobSetEventsConfigMapRef     types.NamespacedName
-	JobSetNodeEventsConfigMapRef types.NamespacedName
+	AggregationInterval             time.Duration
+	AggregationAlign                bool
+	AggregationFreezeNow            bool
+	AggregationFailureBackoff       time.Duration
+	AggregationMaxFailureBackoff    time.Duration
+	AggregationTimeoutFraction      float64
+	IncidentCorrelationWindow       time.Duration
+	InterruptionCauseWindow         time.Duration
+	StepRangeWidth                  int64
+	EventRetention                  time.Duration
+	MinEntityLifetime               time.Duration
+	NodeDownRequiresUnreachablePods bool
+	DegradedNodeConditions          []corev1.NodeConditionType
+	NodeUpConditions                []k8sutils.NodeUpCondition
+	MinStateChangeInterval          map[records.Kind]time.Duration
+	StartupGracePeriod              time.Duration
+	ReportConfigMapRef              types.NamespacedName
+	ReportConfigMapCompress         bool
+	ReportConfigMapFullKey          string
+	JobSetEventsConfigMapRef        types.NamespacedName
+	JobSetNodeEventsConfigMapRef    types.NamespacedName
+	JobEventsConfigMapRef           types.NamespacedName
+
+	// DryRun only computes and prints reports, without writing anything.
+	DryRun bool
 
 	DisableNodePoolJobLabelling bool
+	PodReadinessContainer       string
+	JobSetLabelSelector         string
+	Namespaces                  []string
+	NamespaceSummaries          bool
+	NodePoolSummaries           bool
+
+	AvailabilityExcludeProvisioning bool
+	SettlePeriod                    time.Duration
+	ProvisioningSLA                 time.Duration
+	AtRisk                          records.AtRiskOptions
+	Alert                           records.AlertOptions
+	SLO                             records.SLO
+
+	AnnotateJobSetAvailability  bool
+	AnnotateJobSetInterruptions int
+
+	OpenSearchURL   string
+	OpenSearchIndex string
+
+	PushgatewayURL      string
+	PushgatewayJob      string
+	PushgatewayGrouping map[string]string
+
+	WebhookURL                 string
+	WebhookHeaders             map[string]string
+	WebhookTimeout             time.Duration
+	WebhookMinNewInterruptions int
+	WebhookOnProvisioningStuck bool
+
+	SlackWebhookURL  string
+	SlackMinInterval time.Duration
+
+	SQLitePath string
+
+	GCSBucket        string
+	GCSPrefix        string
+	GCSRetentionDays int
+
+	BigQueryProject string
+	BigQueryDataset string
+	BigQueryTable   string
+
+	CloudMonitoring         bool
+	CloudMonitoringProject  string
+	CloudMonitoringLocation string
+
+	FileExportLatest string
+	FileExportLog    string
+	FileExportSync   bool
+	FileExportKeep   int
+
+	// Exporters are the exporters enabled in the --config file, which are
+	// applied to the flags.
+	Exporters []ExporterConfig
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "report":
+			os.Exit(reportMain(os.Args[2:]))
+		case "backfill-nodes":
+			os.Exit(backfillNodesMain(os.Args[2:]))
+		}
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var shutdownTimeout time.Duration
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var availabilityExcludeProvisioning bool
+	var settlePeriod time.Duration
+	var provisioningSLA time.Duration
+	var aggregationInterval time.Duration
+	var reportConfigMap, jobSetEventsConfigMap, jobSetNodeEventsConfigMap, jobEventsConfigMap string
+	var reportConfigMapCompress bool
+	var reportConfigMapFullKey string
+	var aggregationAlign bool
+	var aggregationFreezeNow bool
+	var aggregationFailureBackoff, aggregationMaxFailureBackoff time.Duration
+	var aggregationTimeoutFraction float64
+	var incidentCorrelationWindow time.Duration
+	var interruptionCauseWindow time.Duration
+	var stepRangeWidth int64
+	var eventRetention time.Duration
+	var minEntityLifetime time.Duration
+	var nodeDownRequiresUnreachablePods bool
+	var degradedNodeConditions string
+	var nodeUpConditions string
+	var jobSetMinStateChangeInterval, jobSetNodesMinStateChangeInterval time.Duration
+	var startupGracePeriod time.Duration
+	var annotateJobSetAvailability bool
+	var annotateJobSetInterruptions int
+	var openSearchURL, openSearchIndex string
+	var pushgatewayURL, pushgatewayJob, pushgatewayGrouping string
+	var webhookURL, webhookHeaders string
+	var webhookTimeout time.Duration
+	var webhookMinNewInterruptions int
+	var webhookOnProvisioningStuck bool
+	var slackWebhookURL string
+	var slackMinInterval time.Duration
+	var gcsBucket, gcsPrefix string
+	var gcsRetentionDays int
+	var bigQueryProject, bigQueryDataset, bigQueryTable string
+	var cloudMonitoring bool
+	var cloudMonitoringProject, cloudMonitoringLocation string
+	var sqlitePath string
+	var fileExportLatest, fileExportLog string
+	var fileExportSync bool
+	var fileExportKeep int
+	var atRisk records.AtRiskOptions
+	var slo records.SLO
+	var alert records.AlertOptions
+	var podReadinessContainer string
+	var jobSetLabelSelector string
+	var namespaces string
+	var namespaceSummaries bool
+	var nodePoolSummaries bool
+	var metricsMaxEntities int
+	var metricsEvictOldestEntities bool
+	var metricsNamespace, metricsSubsystem string
+	var metricsTimeInState bool
+	var metricsCreatedTimestamps bool
+	var metricsDurationBuckets string
+	var metricsFleetReportInfoMaxBytes int
+	var metricsAllowlist string
+	var metricsOTLP metrics.OTLPOptions
+	var metricsOTLPHeaders string
+	var configConfigMap string
+	var configFile string
+	var exportBatchWindows string
+	var nodePoolVersionLabel string
+	var serveReport, serveReportWatch bool
+	var serveEvents bool
+	var reportHistorySize int
+	var replayEventsFile string
+	var dryRun bool
+	var clusterName string
+	var stdoutDedupe bool
+	var stdoutHeartbeat time.Duration
+	var stdoutFormat string
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 8*time.Second,
+		"How long the manager and the metrics server wait for in-flight work (e.g. scrapes) to finish on shutdown, "+
+			"which should be less than the Pod's termination grace period.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -95,31 +258,395 @@ func main() {
 		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.DurationVar(&settlePeriod, "settle-period", 0,
+		"The time after each recovery that is not counted towards the effective up time, e.g. to reload a checkpoint.")
+	flag.DurationVar(&provisioningSLA, "provisioning-sla", 0,
+		"If set, JobSets that never came up within this time are flagged as stuck provisioning (megamon_jobset_provisioning_stuck).")
+	flag.BoolVar(&availabilityExcludeProvisioning, "availability-exclude-provisioning", false,
+		"If set, the initial provisioning time is excluded from availability.")
+	flag.DurationVar(&aggregationInterval, "aggregation-interval", 10*time.Second,
+		"The interval between aggregations (at least 1s).")
+	flag.StringVar(&reportConfigMap, "report-configmap", "megamon-system/megamon-report",
+		"The ConfigMap (namespace/name) that the report is exported to.")
+	flag.BoolVar(&reportConfigMapCompress, "report-configmap-compress", false,
+		"If set, the report is stored gzip compressed and base64 encoded under the report.json.gz key of the report ConfigMap.")
+	flag.StringVar(&reportConfigMapFullKey, "report-configmap-full-key", "",
+		"If set, the full report including the event records is additionally written to this key of the report ConfigMap, next to the summary report.")
+	flag.StringVar(&jobSetEventsConfigMap, "jobset-events-configmap", aggregator.DefaultJobSetEventsConfigMapRef.String(),
+		"The ConfigMap (namespace/name) that JobSet events are recorded in.")
+	flag.StringVar(&jobSetNodeEventsConfigMap, "jobset-node-events-configmap", aggregator.DefaultJobSetNodeEventsConfigMapRef.String(),
+		"The ConfigMap (namespace/name) that JobSet Node events are recorded in.")
+	flag.StringVar(&jobEventsConfigMap, "job-events-configmap", "",
+		"If set, the up and down events of each replica of each replicated Job of every JobSet are recorded in this ConfigMap (namespace/name), e.g. "+aggregator.DefaultJobEventsConfigMapRef.String()+".")
+	flag.BoolVar(&aggregationAlign, "aggregation-align", false,
+		"If set, aggregations are aligned to wall-clock multiples of the aggregation interval.")
+	flag.BoolVar(&aggregationFreezeNow, "aggregation-freeze-now", false,
+		"If set, all exporters use the aggregation time as the current time so that they agree for a given tick.")
+	flag.DurationVar(&aggregationFailureBackoff, "aggregation-failure-backoff", 0,
+		"The delay of the next aggregation after a failure, doubled on every further consecutive failure. Defaults to the aggregation interval.")
+	flag.DurationVar(&aggregationMaxFailureBackoff, "aggregation-max-failure-backoff", 5*time.Minute,
+		"The maximum delay of the next aggregation after consecutive failures. Zero disables the backoff.")
+	flag.Float64Var(&aggregationTimeoutFraction, "aggregation-timeout-fraction", aggregator.DefaultTimeoutFraction,
+		"Each aggregation is cancelled after this fraction of the aggregation interval (0 < fraction <= 1).")
+	flag.DurationVar(&incidentCorrelationWindow, "incident-correlation-window", 5*time.Minute,
+		"Interruptions of a JobSet and its Nodes within this window are counted as a single fleet incident (0 disables).")
+	flag.DurationVar(&interruptionCauseWindow, "interruption-cause-window", 0,
+		"If set, JobSet interruptions are attributed to a Node of the JobSet that went down within this window of the interruption (0 disables).")
+	flag.Int64Var(&stepRangeWidth, "step-range-width", 0,
+		"If set, the report counts the interruptions of each JobSet by ranges of this many training steps, "+
+			"as reported by the "+k8sutils.JobSetStepAnnotation+" annotation (0 disables).")
+	flag.DurationVar(&eventRetention, "event-retention", 0,
+		"If set, recorded events older than this are compacted into carried-forward totals (0 keeps all events). "+
+			"Must be at least the SLO, alert and at-risk burst windows, which are computed from the remaining events, "+
+			"and should be at least any megamon.example.com/slo-window annotation.")
+	flag.DurationVar(&minEntityLifetime, "min-entity-lifetime", 0,
+		"If set, JobSets that have existed for less than this are excluded from per-JobSet metrics and fleet rollups.")
+	flag.BoolVar(&nodeDownRequiresUnreachablePods, "node-down-requires-unreachable-pods", false,
+		"If set, NotReady Nodes are only counted as down once none of their Pods are running.")
+	flag.StringVar(&degradedNodeConditions, "degraded-node-conditions", "",
+		"Comma separated Node condition types that signal unhealthy accelerators, e.g. GPUXIDError. While any is true on a Ready Node, its JobSet is recorded as degraded.")
+	flag.StringVar(&nodeUpConditions, "node-up-conditions", "",
+		"Comma separated type=status pairs of the Node conditions that must be met for a Node to be recorded as up, e.g. Ready=True,NetworkUnavailable=False. Defaults to Ready=True.")
+	flag.DurationVar(&jobSetMinStateChangeInterval, "jobset-min-state-change-interval", 0,
+		"If set, JobSet state changes are only recorded once at least this long has passed since the previous one.")
+	flag.DurationVar(&jobSetNodesMinStateChangeInterval, "jobset-nodes-min-state-change-interval", 0,
+		"If set, JobSet Nodes and Node state changes are only recorded once at least this long has passed since the previous one.")
+	flag.DurationVar(&startupGracePeriod, "startup-grace-period", 0,
+		"If set, entities without records that are first seen within this long of startup are recorded in their observed state instead of as provisioning, so that restarts do not record provisioning windows for entities that were already up.")
+	flag.BoolVar(&annotateJobSetAvailability, "annotate-jobset-availability", false,
+		"If set, JobSets are annotated with their current availability.")
+	flag.IntVar(&annotateJobSetInterruptions, "annotate-jobset-interruptions", 0,
+		"If set with --annotate-jobset-availability, JobSets are also annotated with the timestamps of up to this many of their most recent interruptions.")
+	flag.DurationVar(&atRisk.MinUpStreak, "at-risk-min-up-streak", time.Hour,
+		"Entities up for less than this since their last recovery are at risk (0 disables).")
+	flag.IntVar(&atRisk.BurstCount, "at-risk-burst-count", 3,
+		"Entities with at least this many interruptions within --at-risk-burst-window are at risk (0 disables).")
+	flag.DurationVar(&atRisk.BurstWindow, "at-risk-burst-window", 24*time.Hour,
+		"The window for --at-risk-burst-count.")
+	flag.DurationVar(&atRisk.SlowRecovery, "at-risk-slow-recovery", time.Hour,
+		"Entities whose latest recovery took longer than this are at risk (0 disables).")
+	flag.DurationVar(&alert.Window, "alert-window", 0,
+		"The window in which interruptions are counted for interruption alerting (0 disables).")
+	flag.IntVar(&alert.FireAbove, "alert-fire-above", 3,
+		"Entities start alerting once they had more than this many interruptions within --alert-window.")
+	flag.IntVar(&alert.ClearBelow, "alert-clear-below", 1,
+		"Alerting entities only stop alerting once they had fewer than this many interruptions within --alert-window.")
+	flag.Float64Var(&slo.Target, "slo-target", 0,
+		"The default availability SLO target for error budget reporting, e.g. 0.99 (0 disables). "+
+			"JobSets can override it with the megamon.example.com/slo-target annotation.")
+	flag.DurationVar(&slo.Window, "slo-window", 30*24*time.Hour,
+		"The default SLO window (0 applies the SLO to the whole run). JobSets can override it with the megamon.example.com/slo-window annotation.")
+	flag.StringVar(&podReadinessContainer, "pod-readiness-container", "",
+		"If set, only this container's readiness is considered when binding Jobs to node pools.")
+	flag.StringVar(&jobSetLabelSelector, "jobset-label-selector", "",
+		"If set, only JobSets matching this label selector are monitored, e.g. \"team=ml,!system\". Other JobSets produce no events and no metrics.")
+	flag.StringVar(&namespaces, "namespaces", "",
+		"If set, only JobSets in these comma separated namespaces are monitored.")
+	flag.BoolVar(&namespaceSummaries, "namespace-summaries", false,
+		"If set, the JobSets of each namespace are rolled up into the report and exported as per-namespace metrics.")
+	flag.BoolVar(&nodePoolSummaries, "nodepool-summaries", false,
+		"If set, all Nodes are rolled up by their node pool into the report and exported as per-node-pool metrics.")
+	flag.IntVar(&metricsMaxEntities, "metrics-max-entities", 0,
+		"If set, caps the number of JobSets exported with per-JobSet labels. Additional JobSets are summed into an overflow series.")
+	flag.BoolVar(&metricsEvictOldestEntities, "metrics-evict-oldest-entities", false,
+		"If set, JobSets beyond --metrics-max-entities evict the JobSets first seen earliest into the overflow series, instead of being summed into it themselves.")
+	flag.StringVar(&metricsAllowlist, "metrics-allowlist", "",
+		"If set, only these comma separated metric families are exported, named as exposed without --metrics-namespace, e.g. megamon_jobset_up.")
+	flag.BoolVar(&metricsTimeInState, "metrics-time-in-state", false,
+		"If set, the time each JobSet has been in its current state (up or down) is exported, computed as of each scrape.")
+	flag.StringVar(&metricsDurationBuckets, "metrics-duration-buckets", "",
+		"The comma separated upper bounds of the histograms of individual recovery and up times, e.g. 1m,5m,1h. Defaults to 1m up to 24h.")
+	flag.IntVar(&metricsFleetReportInfoMaxBytes, "metrics-fleet-report-info-max-bytes", 0,
+		"If set, the report is exported as JSON in the report label of megamon_fleet_report_info, reduced to the fleet summary if larger than this many bytes.")
+	flag.BoolVar(&metricsCreatedTimestamps, "metrics-created-timestamps", false,
+		"If set, OpenMetrics scrapes include a _created line for every counter, e.g. the time a JobSet was first seen.")
+	flag.StringVar(&metricsNamespace, "metrics-namespace", "",
+		"If set, all metric names are prefixed with this Prometheus namespace, e.g. company_megamon_jobset_up.")
+	flag.StringVar(&metricsOTLP.Endpoint, "metrics-otlp-endpoint", "",
+		"If set, metrics are additionally pushed to this OpenTelemetry Collector (host:port) over OTLP/gRPC.")
+	flag.BoolVar(&metricsOTLP.Insecure, "metrics-otlp-insecure", false,
+		"If set, TLS is disabled for the OTLP export.")
+	flag.StringVar(&metricsOTLPHeaders, "metrics-otlp-headers", "",
+		"Headers sent with every OTLP export, as comma separated name=value pairs.")
+	flag.DurationVar(&metricsOTLP.Interval, "metrics-otlp-interval", time.Minute,
+		"The interval at which metrics are pushed over OTLP.")
+	flag.StringVar(&metricsSubsystem, "metrics-subsystem", metrics.Prefix,
+		"The Prometheus subsystem that all metric names start with.")
+	flag.StringVar(&configConfigMap, "config-configmap", "",
+		"If set, aggregation settings are hot-reloaded from this ConfigMap (namespace/name).")
+	flag.StringVar(&configFile, "config", "",
+		"If set, the aggregation interval, the ConfigMaps and the enabled exporters with their parameters are read from this YAML file. "+
+			"Flags set on the command line take precedence.")
+	flag.StringVar(&openSearchURL, "opensearch-url", "",
+		"If set, summaries are bulk-indexed into this OpenSearch/Elasticsearch cluster.")
+	flag.StringVar(&openSearchIndex, "opensearch-index", "megamon",
+		"The OpenSearch index prefix, documents are written to daily <prefix>-YYYY.MM.DD indices.")
+	flag.StringVar(&pushgatewayURL, "pushgateway-url", "",
+		"If set, per-entity metrics are pushed to this Prometheus Pushgateway on every aggregation.")
+	flag.StringVar(&pushgatewayJob, "pushgateway-job", "megamon",
+		"The job name of the metrics pushed to the Pushgateway.")
+	flag.StringVar(&pushgatewayGrouping, "pushgateway-grouping", "",
+		"Additional grouping labels of the metrics pushed to the Pushgateway, as comma separated name=value pairs. Each JobSet is pushed as its own group with its UID as the jobset_uid label.")
+	flag.StringVar(&webhookURL, "webhook-url", "",
+		"If set, the report is POSTed as JSON to this URL on every aggregation.")
+	flag.StringVar(&webhookHeaders, "webhook-headers", "",
+		"Headers sent with every webhook request, as comma separated name=value pairs.")
+	flag.DurationVar(&webhookTimeout, "webhook-timeout", aggregator.DefaultWebhookTimeout,
+		"The timeout of each webhook request.")
+	flag.IntVar(&webhookMinNewInterruptions, "webhook-min-new-interruptions", 0,
+		"If set, the webhook only fires once at least this many new interruptions were recorded across the fleet since it last fired.")
+	flag.BoolVar(&webhookOnProvisioningStuck, "webhook-on-provisioning-stuck", false,
+		"If set, the webhook also fires when a JobSet becomes stuck provisioning (see --provisioning-sla), regardless of --webhook-min-new-interruptions.")
+	flag.StringVar(&slackWebhookURL, "slack-webhook-url", "",
+		"If set, interruptions and recoveries of JobSets are posted to this Slack or Microsoft Teams incoming webhook.")
+	flag.DurationVar(&slackMinInterval, "slack-min-interval", 5*time.Minute,
+		"The minimum time between Slack messages about the same JobSet, to avoid spamming while it is flapping.")
+	flag.StringVar(&gcsBucket, "gcs-bucket", "",
+		"If set, every report is written as a timestamped JSON object to this Google Cloud Storage bucket.")
+	flag.StringVar(&gcsPrefix, "gcs-prefix", "megamon",
+		"The prefix of the report objects written to --gcs-bucket.")
+	flag.IntVar(&gcsRetentionDays, "gcs-retention-days", 0,
+		"If set, report objects older than this many days are deleted from --gcs-prefix of --gcs-bucket, which must be set.")
+	flag.StringVar(&bigQueryProject, "bigquery-project", "",
+		"The project of --bigquery-table.")
+	flag.StringVar(&bigQueryDataset, "bigquery-dataset", "",
+		"The dataset of --bigquery-table.")
+	flag.StringVar(&bigQueryTable, "bigquery-table", "",
+		"If set, every recorded up and down event is streamed to this BigQuery table.")
+	flag.BoolVar(&cloudMonitoring, "cloud-monitoring", false,
+		"If set, the summary gauges are written as custom metrics to Google Cloud Monitoring, at most every 10s.")
+	flag.StringVar(&cloudMonitoringProject, "cloud-monitoring-project", "",
+		"The project that --cloud-monitoring writes to, detected from the metadata server if not set.")
+	flag.StringVar(&cloudMonitoringLocation, "cloud-monitoring-location", "global",
+		"The location label of the resources that --cloud-monitoring writes.")
+	flag.StringVar(&sqlitePath, "sqlite-path", "",
+		"If set, summaries are appended to this local SQLite database file for ad-hoc analysis.")
+	flag.StringVar(&fileExportLatest, "file-export-latest", "",
+		"If set, the latest report is atomically written to this file, e.g. on a volume shared with a sidecar.")
+	flag.StringVar(&fileExportLog, "file-export-log", "",
+		"If set, every report is appended to this file as a line of JSON.")
+	flag.BoolVar(&fileExportSync, "file-export-fsync", false,
+		"If set, exported files are fsynced after every write.")
+	flag.IntVar(&fileExportKeep, "file-export-keep", 0,
+		"If set, every report is also written next to --file-export-latest under a timestamped name, keeping this many of the most recent ones.")
+	flag.StringVar(&clusterName, "cluster-name", "",
+		"The GKE cluster name, included in reports. If set, the node pool of Nodes missing the node pool label is derived from their provider ID.")
+	flag.BoolVar(&serveEvents, "serve-events", false,
+		"If set, state transitions are streamed as Server-Sent Events at /events on the metrics endpoint.")
+	flag.BoolVar(&serveReport, "serve-report", false,
+		"If set, the current report is served at /report, the state of a single JobSet at /report/jobsets/<name> and the health of each exporter at /report/exporters on the metrics endpoint.")
+	flag.BoolVar(&serveReportWatch, "serve-report-watch", false,
+		"If set, the report is served to long-polling clients at /report/watch on the metrics endpoint.")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"If set, reports are only printed by the stdout exporter: the event ConfigMaps are not updated (events are kept in memory), "+
+			"Jobs are not labelled and all other exporters are skipped, e.g. to try megamon against a real cluster.")
+	flag.StringVar(&replayEventsFile, "replay-events", "",
+		"If set, the synthetic events in this JSON file are reported as if observed instead of watching the cluster, "+
+			"e.g. to build dashboards (see aggregator.ReplayEvents). For development only.")
+	flag.IntVar(&reportHistorySize, "report-history-size", 0,
+		"If set, this many past reports are kept in memory and the change between two of them is served at /report/diff?from=<RFC 3339>&to=<RFC 3339> on the metrics endpoint.")
+	flag.StringVar(&nodePoolVersionLabel, "node-pool-version-label", "",
+		"The Node label holding the node pool version, used to count Node interruptions by version. Defaults to the kubelet version.")
+	flag.StringVar(&exportBatchWindows, "export-batch-windows", "",
+		"If set, reports exported within a window are coalesced into a single export of the latest report, "+
+			"per exporter as comma separated exporter=duration pairs, e.g. opensearch=30s,file=5s.")
+	flag.BoolVar(&stdoutDedupe, "stdout-dedupe", false,
+		"If set, the stdout exporter only prints reports whose state changed since the last printed report.")
+	flag.DurationVar(&stdoutHeartbeat, "stdout-heartbeat", 5*time.Minute,
+		"With --stdout-dedupe, the interval at which a heartbeat line is printed while reports are unchanged. 0 disables heartbeats.")
+	flag.StringVar(&stdoutFormat, "stdout-format", string(aggregator.StdoutFormatText),
+		"The output format of the stdout exporter: text prints each report as a line of JSON, jsonl prints a line of JSON per entity for log-based ingestion.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
+	flag.Usage = usageWithout("replay-events")
 	flag.Parse()
 
-	// TODO: Expose as configuration.
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+
+	var fileCfg fileConfig
+	if configFile != "" {
+		var err error
+		fileCfg, err = loadConfigFile(configFile)
+		if err != nil {
+			setupLog.Error(err, "unable to load config file")
+			os.Exit(1)
+		}
+		if err := applyConfigFile(flag.CommandLine, fileCfg); err != nil {
+			setupLog.Error(err, "invalid config file", "path", configFile)
+			os.Exit(1)
+		}
+	}
+
+	var replay *aggregator.ReplayEvents
+	if replayEventsFile != "" {
+		var err error
+		replay, err = aggregator.LoadReplayEvents(replayEventsFile)
+		if err != nil {
+			setupLog.Error(err, "unable to load replay events")
+			os.Exit(1)
+		}
+		setupLog.Info("replaying events instead of watching the cluster", "path", replayEventsFile)
+	}
+
 	cfg := config{
-		AggregationInterval: 10 * time.Second,
-		ReportConfigMapRef: types.NamespacedName{
-			Namespace: "megamon-system",
-			Name:      "megamon-report",
-		},
-		JobSetNodeEventsConfigMapRef: types.NamespacedName{
-			Namespace: "megamon-system",
-			Name:      "megamon-jobset-node-events",
+		AggregationInterval:             aggregationInterval,
+		AggregationAlign:                aggregationAlign,
+		AggregationFreezeNow:            aggregationFreezeNow,
+		AggregationFailureBackoff:       aggregationFailureBackoff,
+		AggregationTimeoutFraction:      aggregationTimeoutFraction,
+		AggregationMaxFailureBackoff:    aggregationMaxFailureBackoff,
+		IncidentCorrelationWindow:       incidentCorrelationWindow,
+		InterruptionCauseWindow:         interruptionCauseWindow,
+		StepRangeWidth:                  stepRangeWidth,
+		EventRetention:                  eventRetention,
+		MinEntityLifetime:               minEntityLifetime,
+		NodeDownRequiresUnreachablePods: nodeDownRequiresUnreachablePods,
+		DegradedNodeConditions:          parseNodeConditionTypes(degradedNodeConditions),
+		MinStateChangeInterval: map[records.Kind]time.Duration{
+			records.KindJobSet:      jobSetMinStateChangeInterval,
+			records.KindJobSetNodes: jobSetNodesMinStateChangeInterval,
+			// Single Nodes toggle at the cadence of the Nodes of a JobSet.
+			records.KindNode: jobSetNodesMinStateChangeInterval,
+			// Replicated Jobs toggle at the cadence of their JobSet.
+			records.KindJob: jobSetMinStateChangeInterval,
 		},
-		JobSetEventsConfigMapRef: types.NamespacedName{
-			Namespace: "megamon-system",
-			Name:      "megamon-jobset-events",
-		},
-		DisableNodePoolJobLabelling: true,
+		StartupGracePeriod:              startupGracePeriod,
+		ReportConfigMapCompress:         reportConfigMapCompress,
+		ReportConfigMapFullKey:          reportConfigMapFullKey,
+		DryRun:                          dryRun,
+		DisableNodePoolJobLabelling:     true,
+		PodReadinessContainer:           podReadinessContainer,
+		JobSetLabelSelector:             jobSetLabelSelector,
+		Namespaces:                      parseNamespaces(namespaces),
+		NamespaceSummaries:              namespaceSummaries,
+		NodePoolSummaries:               nodePoolSummaries,
+		AvailabilityExcludeProvisioning: availabilityExcludeProvisioning,
+		SettlePeriod:                    settlePeriod,
+		ProvisioningSLA:                 provisioningSLA,
+		AtRisk:                          atRisk,
+		Alert:                           alert,
+		SLO:                             slo,
+		AnnotateJobSetAvailability:      annotateJobSetAvailability,
+		AnnotateJobSetInterruptions:     annotateJobSetInterruptions,
+		OpenSearchURL:                   openSearchURL,
+		OpenSearchIndex:                 openSearchIndex,
+		PushgatewayURL:                  pushgatewayURL,
+		PushgatewayJob:                  pushgatewayJob,
+		WebhookURL:                      webhookURL,
+		WebhookTimeout:                  webhookTimeout,
+		WebhookMinNewInterruptions:      webhookMinNewInterruptions,
+		WebhookOnProvisioningStuck:      webhookOnProvisioningStuck,
+		SlackWebhookURL:                 slackWebhookURL,
+		SlackMinInterval:                slackMinInterval,
+		SQLitePath:                      sqlitePath,
+		GCSBucket:                       gcsBucket,
+		GCSPrefix:                       gcsPrefix,
+		GCSRetentionDays:                gcsRetentionDays,
+		BigQueryProject:                 bigQueryProject,
+		BigQueryDataset:                 bigQueryDataset,
+		BigQueryTable:                   bigQueryTable,
+		CloudMonitoring:                 cloudMonitoring,
+		CloudMonitoringProject:          cloudMonitoringProject,
+		CloudMonitoringLocation:         cloudMonitoringLocation,
+		FileExportLatest:                fileExportLatest,
+		FileExportLog:                   fileExportLog,
+		FileExportSync:                  fileExportSync,
+		FileExportKeep:                  fileExportKeep,
+		Exporters:                       fileCfg.Exporters,
 	}
 
-	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	if cfg.AggregationTimeoutFraction <= 0 || cfg.AggregationTimeoutFraction > 1 {
+		setupLog.Error(fmt.Errorf("got %v", cfg.AggregationTimeoutFraction), "aggregation timeout fraction must be in (0, 1]")
+		os.Exit(1)
+	}
+	if shutdownTimeout <= 0 {
+		setupLog.Error(fmt.Errorf("got %v", shutdownTimeout), "shutdown timeout must be positive")
+		os.Exit(1)
+	}
+	if cfg.EventRetention < 0 {
+		setupLog.Error(fmt.Errorf("got %v", cfg.EventRetention), "event retention must not be negative")
+		os.Exit(1)
+	}
+	if cfg.EventRetention > 0 {
+		window := max(cfg.SLO.Window, cfg.Alert.Window)
+		if cfg.AtRisk.BurstCount > 0 {
+			window = max(window, cfg.AtRisk.BurstWindow)
+		}
+		if cfg.EventRetention < window {
+			setupLog.Error(fmt.Errorf("got %v, want at least %v", cfg.EventRetention, window),
+				"event retention must cover the SLO, alert and at-risk burst windows")
+			os.Exit(1)
+		}
+	}
+	if cfg.ProvisioningSLA < 0 {
+		setupLog.Error(fmt.Errorf("got %v", cfg.ProvisioningSLA), "provisioning SLA must not be negative")
+		os.Exit(1)
+	}
+	var jobSetSelector labels.Selector
+	if cfg.JobSetLabelSelector != "" {
+		sel, err := labels.Parse(cfg.JobSetLabelSelector)
+		if err != nil {
+			setupLog.Error(err, "invalid --jobset-label-selector")
+			os.Exit(1)
+		}
+		jobSetSelector = sel
+	}
+	stdoutFmt, err := aggregator.ParseStdoutFormat(stdoutFormat)
+	if err != nil {
+		setupLog.Error(err, "invalid --stdout-format")
+		os.Exit(1)
+	}
+
+	for _, ref := range []struct {
+		flag, val string
+		dst       *types.NamespacedName
+	}{
+		{"report-configmap", reportConfigMap, &cfg.ReportConfigMapRef},
+		{"jobset-events-configmap", jobSetEventsConfigMap, &cfg.JobSetEventsConfigMapRef},
+		{"jobset-node-events-configmap", jobSetNodeEventsConfigMap, &cfg.JobSetNodeEventsConfigMapRef},
+	} {
+		nn, err := parseNamespacedName(ref.val)
+		if err != nil {
+			setupLog.Error(err, "invalid --"+ref.flag)
+			os.Exit(1)
+		}
+		*ref.dst = nn
+	}
+	if jobEventsConfigMap != "" {
+		nn, err := parseNamespacedName(jobEventsConfigMap)
+		if err != nil {
+			setupLog.Error(err, "invalid --job-events-configmap")
+			os.Exit(1)
+		}
+		cfg.JobEventsConfigMapRef = nn
+	}
+
+	if pushgatewayGrouping != "" {
+		grouping, err := parseKeyValues(pushgatewayGrouping)
+		if err != nil {
+			setupLog.Error(err, "invalid pushgateway grouping")
+			os.Exit(1)
+		}
+		cfg.PushgatewayGrouping = grouping
+	}
+	if nodeUpConditions != "" {
+		conditions, err := parseNodeUpConditions(nodeUpConditions)
+		if err != nil {
+			setupLog.Error(err, "invalid node up conditions")
+			os.Exit(1)
+		}
+		cfg.NodeUpConditions = conditions
+	}
+	if webhookHeaders != "" {
+		headers, err := parseKeyValues(webhookHeaders)
+		if err != nil {
+			setupLog.Error(err, "invalid webhook headers")
+			os.Exit(1)
+		}
+		cfg.WebhookHeaders = headers
+	}
 
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
@@ -184,12 +711,13 @@ func main() {
 	}
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
-		Metrics:                metricsServerOptions,
-		WebhookServer:          webhookServer,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "fd0479f1.example.com",
+		Scheme:                  scheme,
+		Metrics:                 metricsServerOptions,
+		WebhookServer:           webhookServer,
+		HealthProbeBindAddress:  probeAddr,
+		GracefulShutdownTimeout: &shutdownTimeout,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionID:        "fd0479f1.example.com",
 		Cache: cache.Options{
 			ByObject: map[client.Object]cache.ByObject{
 				&corev1.Pod{}: {
@@ -215,49 +743,304 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controller.JobSetReconciler{
-		Disabled: false,
-		//JobSetEventsConfigMapRef: cfg.JobSetEventsConfigMapRef,
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "JobSet")
-		os.Exit(1)
-	}
-	if err = (&controller.NodeReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Node")
-		os.Exit(1)
-	}
-	if !cfg.DisableNodePoolJobLabelling {
-		if err = (&controller.PodReconciler{
+	var nodeReconciler *controller.NodeReconciler
+	var podReconciler *controller.PodReconciler
+	// Replayed events bypass the reconcilers entirely.
+	if replay == nil {
+		if err = (&controller.JobSetReconciler{
+			Disabled:   false,
+			Selector:   jobSetSelector,
+			Namespaces: cfg.Namespaces,
+			//JobSetEventsConfigMapRef: cfg.JobSetEventsConfigMapRef,
 			Client: mgr.GetClient(),
 			Scheme: mgr.GetScheme(),
 		}).SetupWithManager(mgr); err != nil {
-			setupLog.Error(err, "unable to create controller", "controller", "Pod")
+			setupLog.Error(err, "unable to create controller", "controller", "JobSet")
+			os.Exit(1)
+		}
+		nodeReconciler = &controller.NodeReconciler{
+			Client:       mgr.GetClient(),
+			Scheme:       mgr.GetScheme(),
+			VersionLabel: nodePoolVersionLabel,
+			ClusterName:  clusterName,
+			UpConditions: cfg.NodeUpConditions,
+			// Interruptions are attributed to Nodes that went down within
+			// the window, including by being deleted.
+			DeletedNodeRetention:   cfg.InterruptionCauseWindow,
+			MinStateChangeInterval: cfg.MinStateChangeInterval[records.KindNode],
+		}
+		if err = nodeReconciler.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Node")
 			os.Exit(1)
 		}
+		// Interruption causes need the Nodes of each JobSet.
+		if !cfg.DisableNodePoolJobLabelling || cfg.InterruptionCauseWindow > 0 {
+			podReconciler = &controller.PodReconciler{
+				Client:        mgr.GetClient(),
+				Scheme:        mgr.GetScheme(),
+				ContainerName: cfg.PodReadinessContainer,
+				ClusterName:   clusterName,
+			}
+			if err = podReconciler.SetupWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "Pod")
+				os.Exit(1)
+			}
+		}
 	}
 	// +kubebuilder:scaffold:builder
 
-	ctx := ctrl.SetupSignalHandler()
+	// ctx is also cancelled if the manager stops on its own, so that
+	// everything shuts down together.
+	ctx, stop := context.WithCancel(ctrl.SetupSignalHandler())
+	defer stop()
 
 	agg := &aggregator.Aggregator{
-		JobSetEventsConfigMapRef:     cfg.JobSetEventsConfigMapRef,
-		JobSetNodeEventsConfigMapRef: cfg.JobSetNodeEventsConfigMapRef,
-		Interval:                     cfg.AggregationInterval,
-		Client:                       mgr.GetClient(),
+		JobSetEventsConfigMapRef:        cfg.JobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef:    cfg.JobSetNodeEventsConfigMapRef,
+		JobEventsConfigMapRef:           cfg.JobEventsConfigMapRef,
+		Interval:                        cfg.AggregationInterval,
+		AlignInterval:                   cfg.AggregationAlign,
+		FreezeNow:                       cfg.AggregationFreezeNow,
+		FailureBackoff:                  cfg.AggregationFailureBackoff,
+		TimeoutFraction:                 cfg.AggregationTimeoutFraction,
+		MaxFailureBackoff:               cfg.AggregationMaxFailureBackoff,
+		JobSetSelector:                  jobSetSelector,
+		Namespaces:                      cfg.Namespaces,
+		NamespaceSummaries:              cfg.NamespaceSummaries,
+		NodePoolSummaries:               cfg.NodePoolSummaries,
+		IncidentCorrelationWindow:       cfg.IncidentCorrelationWindow,
+		InterruptionCauseWindow:         cfg.InterruptionCauseWindow,
+		StepRangeWidth:                  cfg.StepRangeWidth,
+		EventRetention:                  cfg.EventRetention,
+		MinEntityLifetime:               cfg.MinEntityLifetime,
+		NodeDownRequiresUnreachablePods: cfg.NodeDownRequiresUnreachablePods,
+		NodeUpConditions:                cfg.NodeUpConditions,
+		DegradedNodeConditions:          cfg.DegradedNodeConditions,
+		MinStateChangeInterval:          cfg.MinStateChangeInterval,
+		StartupGracePeriod:              cfg.StartupGracePeriod,
+		ClusterName:                     clusterName,
+		HistorySize:                     reportHistorySize,
+		DryRun:                          cfg.DryRun,
+		Replay:                          replay,
+		Client:                          mgr.GetClient(),
+		SummaryOptions: records.SummaryOptions{
+			ExcludeProvisioning: cfg.AvailabilityExcludeProvisioning,
+			SettlePeriod:        cfg.SettlePeriod,
+			ProvisioningSLA:     cfg.ProvisioningSLA,
+			AtRisk:              cfg.AtRisk,
+			Alert:               cfg.Alert,
+			SLO:                 cfg.SLO,
+		},
 		Exporters: map[string]aggregator.Exporter{
 			"configmap": &aggregator.ConfigMapExporter{
-				Client: mgr.GetClient(),
-				Ref:    cfg.ReportConfigMapRef,
-				Key:    "report",
+				Client:   mgr.GetClient(),
+				Ref:      cfg.ReportConfigMapRef,
+				Key:      "report",
+				Compress: cfg.ReportConfigMapCompress,
 			},
-			"stdout": &aggregator.StdoutExporter{},
+			"stdout": &aggregator.StdoutExporter{Format: stdoutFmt, Dedupe: stdoutDedupe, Heartbeat: stdoutHeartbeat},
 		},
 	}
+	if err := agg.Settings().Validate(); err != nil {
+		setupLog.Error(err, "invalid aggregation settings")
+		os.Exit(1)
+	}
+	if nodeReconciler != nil {
+		agg.NodeEvents = nodeReconciler
+	}
+	if podReconciler != nil {
+		agg.NodePools = podReconciler
+		agg.JobSetNodes = podReconciler
+	}
+	if cfg.ReportConfigMapFullKey != "" {
+		agg.Exporters["configmap-full"] = &aggregator.ConfigMapExporter{
+			Client:   mgr.GetClient(),
+			Ref:      cfg.ReportConfigMapRef,
+			Key:      cfg.ReportConfigMapFullKey,
+			Profile:  records.RenderProfileFull,
+			Compress: cfg.ReportConfigMapCompress,
+		}
+	}
+	if cfg.AnnotateJobSetAvailability {
+		agg.Exporters["jobset-annotations"] = &aggregator.JobSetAnnotationExporter{
+			Client:              mgr.GetClient(),
+			MinInterval:         time.Minute,
+			RecentInterruptions: cfg.AnnotateJobSetInterruptions,
+		}
+	}
+	if cfg.OpenSearchURL != "" {
+		agg.Exporters["opensearch"] = &aggregator.OpenSearchExporter{
+			URL:      cfg.OpenSearchURL,
+			Index:    cfg.OpenSearchIndex,
+			Username: os.Getenv("OPENSEARCH_USERNAME"),
+			Password: os.Getenv("OPENSEARCH_PASSWORD"),
+		}
+	}
+	if cfg.PushgatewayURL != "" {
+		agg.Exporters["pushgateway"] = &aggregator.PushgatewayExporter{
+			URL:      cfg.PushgatewayURL,
+			Job:      cfg.PushgatewayJob,
+			Grouping: cfg.PushgatewayGrouping,
+		}
+	}
+	if cfg.WebhookURL != "" {
+		agg.Exporters["webhook"] = &aggregator.WebhookExporter{
+			URL:                 cfg.WebhookURL,
+			Headers:             cfg.WebhookHeaders,
+			Timeout:             cfg.WebhookTimeout,
+			MinNewInterruptions: cfg.WebhookMinNewInterruptions,
+			OnProvisioningStuck: cfg.WebhookOnProvisioningStuck,
+		}
+	}
+	if cfg.SlackWebhookURL != "" {
+		slack := &aggregator.SlackExporter{
+			URL:         cfg.SlackWebhookURL,
+			MinInterval: cfg.SlackMinInterval,
+		}
+		// Diff against the last report from before a restart, so that
+		// interruptions are notified exactly once. The cache is not started
+		// yet, so read from the API server directly.
+		var cm corev1.ConfigMap
+		if err := mgr.GetAPIReader().Get(ctx, cfg.ReportConfigMapRef, &cm); err != nil {
+			setupLog.Info("not seeding slack exporter", "reason", err.Error())
+		} else if report, err := k8sutils.GetReportFromConfigMap(&cm, "report"); err != nil {
+			setupLog.Info("not seeding slack exporter", "reason", err.Error())
+		} else {
+			slack.Seed(report)
+		}
+		agg.Exporters["slack"] = slack
+	}
+	if cfg.GCSBucket != "" {
+		if cfg.GCSRetentionDays > 0 && strings.Trim(cfg.GCSPrefix, "/") == "" {
+			setupLog.Error(errors.New("--gcs-prefix is required with --gcs-retention-days"), "invalid gcs retention")
+			os.Exit(1)
+		}
+		agg.Exporters["gcs"] = &aggregator.GCSExporter{
+			Bucket:    cfg.GCSBucket,
+			Prefix:    cfg.GCSPrefix,
+			Retention: time.Duration(cfg.GCSRetentionDays) * 24 * time.Hour,
+		}
+	}
+	if cfg.BigQueryTable != "" {
+		if cfg.BigQueryProject == "" || cfg.BigQueryDataset == "" {
+			setupLog.Error(errors.New("--bigquery-project and --bigquery-dataset are required"), "invalid bigquery table")
+			os.Exit(1)
+		}
+		agg.Exporters["bigquery"] = &aggregator.BigQueryExporter{
+			Project: cfg.BigQueryProject,
+			Dataset: cfg.BigQueryDataset,
+			Table:   cfg.BigQueryTable,
+		}
+	}
+	if cfg.CloudMonitoring {
+		agg.Exporters["cloudmonitoring"] = &aggregator.CloudMonitoringExporter{
+			Project:  cfg.CloudMonitoringProject,
+			Location: cfg.CloudMonitoringLocation,
+		}
+	}
+	if cfg.SQLitePath != "" {
+		sqliteExporter := &aggregator.SQLiteExporter{Path: cfg.SQLitePath}
+		defer sqliteExporter.Close()
+		agg.Exporters["sqlite"] = sqliteExporter
+	}
+	if cfg.FileExportKeep > 0 && cfg.FileExportLatest == "" {
+		setupLog.Error(errors.New("--file-export-latest is required"), "invalid file export keep")
+		os.Exit(1)
+	}
+	if cfg.FileExportLatest != "" || cfg.FileExportLog != "" {
+		agg.Exporters["file"] = &aggregator.FileExporter{
+			LatestPath: cfg.FileExportLatest,
+			LogPath:    cfg.FileExportLog,
+			Sync:       cfg.FileExportSync,
+			Keep:       cfg.FileExportKeep,
+		}
+	}
+	if exportBatchWindows != "" {
+		windows, err := parseExportBatchWindows(exportBatchWindows)
+		if err != nil {
+			setupLog.Error(err, "invalid export batch windows")
+			os.Exit(1)
+		}
+		for name, window := range windows {
+			exporter, ok := agg.Exporters[name]
+			if !ok {
+				setupLog.Error(fmt.Errorf("unknown exporter %q", name), "invalid export batch windows")
+				os.Exit(1)
+			}
+			batching := &aggregator.BatchingExporter{
+				Exporter: exporter,
+				Window:   window,
+				// Like the exports of each aggregation.
+				Timeout: time.Duration(cfg.AggregationTimeoutFraction * float64(cfg.AggregationInterval)),
+			}
+			defer batching.Flush()
+			agg.Exporters[name] = batching
+		}
+	}
+	for _, e := range cfg.Exporters {
+		if _, ok := agg.Exporters[e.Name]; !ok {
+			setupLog.Error(fmt.Errorf("exporter %q is not enabled by its params", e.Name), "invalid config file", "path", configFile)
+			os.Exit(1)
+		}
+		setupLog.Info("exporter enabled by config file", "exporter", e.Name, "path", configFile)
+	}
+	if cfg.DryRun {
+		for name := range agg.Exporters {
+			if name != "stdout" {
+				setupLog.Info("dry run, skipping exporter", "exporter", name)
+				delete(agg.Exporters, name)
+			}
+		}
+	}
+	if configConfigMap != "" {
+		ref, err := parseNamespacedName(configConfigMap)
+		if err != nil {
+			setupLog.Error(err, "invalid config configmap")
+			os.Exit(1)
+		}
+		if err := (&controller.ConfigReconciler{
+			Client:   mgr.GetClient(),
+			Ref:      ref,
+			Defaults: agg.Settings(),
+			Target:   agg,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Config")
+			os.Exit(1)
+		}
+	}
+
+	metrics.MaxEntities = metricsMaxEntities
+	metrics.EvictOldestEntities = metricsEvictOldestEntities
+	metrics.MinLifetime = cfg.MinEntityLifetime
+	metrics.Namespace = metricsNamespace
+	metrics.TimeInState = metricsTimeInState
+	metrics.CreatedTimestamps = metricsCreatedTimestamps
+	metrics.FleetReportInfoMaxBytes = metricsFleetReportInfoMaxBytes
+	if metricsDurationBuckets != "" {
+		buckets, err := parseDurationBuckets(metricsDurationBuckets)
+		if err != nil {
+			setupLog.Error(err, "invalid metrics duration buckets")
+			os.Exit(1)
+		}
+		metrics.DurationBuckets = buckets
+	}
+	if metricsAllowlist != "" {
+		metrics.Allowlist = parseList(metricsAllowlist)
+	}
+	if metricsOTLPHeaders != "" {
+		headers, err := parseKeyValues(metricsOTLPHeaders)
+		if err != nil {
+			setupLog.Error(err, "invalid OTLP headers")
+			os.Exit(1)
+		}
+		metricsOTLP.Headers = headers
+	}
+	if cfg.DryRun && metricsOTLP.Endpoint != "" {
+		setupLog.Info("dry run, skipping OTLP metrics export", "endpoint", metricsOTLP.Endpoint)
+	} else {
+		metrics.OTLP = metricsOTLP
+	}
+	metrics.Prefix = metricsSubsystem
 	shutdownMetrics := metrics.Init(agg)
 	//mgr.Add(agg)
 
@@ -271,21 +1054,32 @@ func main() {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
 	}
-	// Add readiness check that makes sure that the aggregator is ready.
+	// Add readiness check that makes sure that the aggregator is ready. The
+	// reason is served at /readyz/readyz.
 	// TODO: Validate that GMP waits for Readiness before scraping.
-	if err := mgr.AddReadyzCheck("readyz", func(req *http.Request) error {
-		if !agg.ReportReady() {
-			return errors.New("aggregator report not ready")
-		}
-		return nil
-	}); err != nil {
+	if err := mgr.AddReadyzCheck("readyz", agg.ReadyCheck); err != nil {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
 
 	defer shutdownMetrics()
 	metricsMux := http.NewServeMux()
-	metricsMux.Handle("/metrics", promhttp.Handler())
+	metricsMux.Handle("/metrics", metrics.Handler())
+	if serveReport {
+		reportHandler := agg.ReportHandler()
+		metricsMux.Handle("/report", reportHandler)
+		metricsMux.Handle("/report/jobsets/", reportHandler)
+		metricsMux.Handle("/report/exporters", reportHandler)
+	}
+	if serveReportWatch {
+		metricsMux.Handle("/report/watch", agg.WatchHandler())
+	}
+	if serveEvents {
+		metricsMux.Handle("/events", agg.EventsHandler())
+	}
+	if reportHistorySize > 0 {
+		metricsMux.Handle("/report/diff", agg.DiffHandler())
+	}
 	metricsServer := http.Server{Handler: metricsMux, Addr: metricsAddr}
 
 	var wg sync.WaitGroup
@@ -313,13 +1107,143 @@ func main() {
 		}
 	}()
 
+	// The metrics server is shut down as soon as a signal is received,
+	// concurrently with the manager, and within the shutdown timeout.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			setupLog.Error(err, "metrics server did not shut down gracefully")
+			metricsServer.Close()
+		}
+	}()
+
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "problem running manager")
 	}
-	metricsServer.Shutdown(context.Background())
+	stop()
 
 	setupLog.Info("waiting for all goroutines to stop")
 	wg.Wait()
 	setupLog.Info("all goroutines stopped, exiting")
 }
+
+// parseExportBatchWindows parses comma separated exporter=duration pairs.
+func parseExportBatchWindows(s string) (map[string]time.Duration, error) {
+	windows := map[string]time.Duration{}
+	for _, pair := range strings.Split(s, ",") {
+		name, val, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid batch window %q, expected exporter=duration", pair)
+		}
+		window, err := time.ParseDuration(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid batch window for %s: %w", name, err)
+		}
+		windows[name] = window
+	}
+	return windows, nil
+}
+
+// usageWithout returns a flag.Usage that hides the given development flags.
+func usageWithout(hidden ...string) func() {
+	return func() {
+		visible := flag.NewFlagSet(flag.CommandLine.Name(), flag.ContinueOnError)
+		visible.SetOutput(flag.CommandLine.Output())
+		flag.VisitAll(func(f *flag.Flag) {
+			for _, name := range hidden {
+				if f.Name == name {
+					return
+				}
+			}
+			visible.Var(f.Value, f.Name, f.Usage)
+		})
+		fmt.Fprintf(visible.Output(), "Usage of %s:\n", os.Args[0])
+		visible.PrintDefaults()
+	}
+}
+
+// parseKeyValues parses comma separated name=value pairs.
+func parseKeyValues(s string) (map[string]string, error) {
+	kvs := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		name, val, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid pair %q, expected name=value", pair)
+		}
+		kvs[name] = val
+	}
+	return kvs, nil
+}
+
+// parseDurationBuckets parses comma separated durations into histogram
+// bucket upper bounds in seconds.
+func parseDurationBuckets(s string) ([]float64, error) {
+	var buckets []float64
+	for _, val := range strings.Split(s, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket %q: %w", val, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("invalid bucket %q, must be positive", val)
+		}
+		buckets = append(buckets, d.Seconds())
+	}
+	return buckets, nil
+}
+
+// parseNodeUpConditions parses comma separated type=status pairs of Node
+// conditions.
+func parseNodeUpConditions(s string) ([]k8sutils.NodeUpCondition, error) {
+	kvs, err := parseKeyValues(s)
+	if err != nil {
+		return nil, err
+	}
+	conditions := make([]k8sutils.NodeUpCondition, 0, len(kvs))
+	for typ, status := range kvs {
+		conditions = append(conditions, k8sutils.NodeUpCondition{
+			Type:   corev1.NodeConditionType(typ),
+			Status: corev1.ConditionStatus(status),
+		})
+	}
+	slices.SortFunc(conditions, func(a, b k8sutils.NodeUpCondition) int { return strings.Compare(string(a.Type), string(b.Type)) })
+	return conditions, nil
+}
+
+// parseList parses a comma separated list, ignoring spaces and empty entries.
+func parseList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// parseNamespaces parses comma separated namespaces.
+func parseNamespaces(s string) []string {
+	var namespaces []string
+	for _, ns := range strings.Split(s, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
+// parseNodeConditionTypes parses comma separated Node condition types.
+func parseNodeConditionTypes(s string) []corev1.NodeConditionType {
+	var types []corev1.NodeConditionType
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, corev1.NodeConditionType(t))
+		}
+	}
+	return types
+}
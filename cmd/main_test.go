@@ -0,0 +1,14 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseList(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, []string{"megamon_jobset_up", "megamon_jobset_availability"}, parseList("megamon_jobset_up, megamon_jobset_availability,"))
+	require.Nil(t, parseList(" , "))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"example.com/megamon/internal/k8sutils"
+	"example.com/megamon/internal/records"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// reportMain implements the "report" subcommand which reads the report
+// ConfigMap from the cluster, validates it and pretty-prints the summaries.
+func reportMain(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	var ref, key, output string
+	fs.StringVar(&ref, "configmap", "megamon-system/megamon-report", "The report ConfigMap (namespace/name).")
+	fs.StringVar(&key, "key", "report", "The ConfigMap key holding the report.")
+	fs.StringVar(&output, "output", "text", "Output format: text or json.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cmRef, err := parseNamespacedName(ref)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "creating client: %v\n", err)
+		return 1
+	}
+
+	if err := printReport(context.Background(), c, cmRef, key, output, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func parseNamespacedName(s string) (types.NamespacedName, error) {
+	ns, name, ok := strings.Cut(s, "/")
+	if !ok || ns == "" || name == "" {
+		return types.NamespacedName{}, fmt.Errorf("invalid reference %q, expected namespace/name", s)
+	}
+	return types.NamespacedName{Namespace: ns, Name: name}, nil
+}
+
+func printReport(ctx context.Context, c client.Client, ref types.NamespacedName, key, output string, w io.Writer) error {
+	var cm corev1.ConfigMap
+	if err := c.Get(ctx, ref, &cm); err != nil {
+		return fmt.Errorf("getting report configmap: %w", err)
+	}
+	report, err := k8sutils.GetReportFromConfigMap(&cm, key)
+	if err != nil {
+		return fmt.Errorf("decoding report: %w", err)
+	}
+	if err := validateReport(report); err != nil {
+		return fmt.Errorf("invalid report: %w", err)
+	}
+
+	switch output {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case "text":
+		return printSummaries(w, report)
+	default:
+		return fmt.Errorf("unknown output format %q", output)
+	}
+}
+
+func validateReport(report records.Report) error {
+	var errs []error
+	if report.SchemaVersion > records.ReportSchemaVersion {
+		errs = append(errs, fmt.Errorf("schema version %d is newer than the supported %d", report.SchemaVersion, records.ReportSchemaVersion))
+	}
+	for key := range report.JobSetsUpSummaries {
+		if _, ok := report.JobSetsUp[key]; !ok {
+			errs = append(errs, fmt.Errorf("jobset summary %q has no upness entry", key))
+		}
+	}
+	for key := range report.JobSetNodesUpSummaries {
+		if _, ok := report.JobSetNodesUp[key]; !ok {
+			errs = append(errs, fmt.Errorf("jobset nodes summary %q has no upness entry", key))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func printSummaries(w io.Writer, report records.Report) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAMESPACE\tNAME\tUP\tINTERRUPTIONS\tRECOVERIES\tUPTIME\tDOWNTIME\tAVAILABILITY")
+	for _, section := range []struct {
+		kind      string
+		ups       map[string]records.Upness
+		summaries map[string]records.UpnessSummaryWithAttrs
+	}{
+		{string(records.KindJobSet), report.JobSetsUp, report.JobSetsUpSummaries},
+		{string(records.KindJobSetNodes), report.JobSetNodesUp, report.JobSetNodesUpSummaries},
+		{string(records.KindJob), report.JobsUp, report.JobsUpSummaries},
+	} {
+		keys := make([]string, 0, len(section.summaries))
+		for key := range section.summaries {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := section.summaries[keys[i]].Attrs, section.summaries[keys[j]].Attrs
+			if a.JobSetNamespace != b.JobSetNamespace {
+				return a.JobSetNamespace < b.JobSetNamespace
+			}
+			if a.JobSetName != b.JobSetName {
+				return a.JobSetName < b.JobSetName
+			}
+			if a.ReplicatedJobName != b.ReplicatedJobName {
+				return a.ReplicatedJobName < b.ReplicatedJobName
+			}
+			// Job indexes are numeric.
+			if len(a.JobIndex) != len(b.JobIndex) {
+				return len(a.JobIndex) < len(b.JobIndex)
+			}
+			return a.JobIndex < b.JobIndex
+		})
+		for _, key := range keys {
+			s := section.summaries[key]
+			name := s.JobSetName
+			if s.ReplicatedJobName != "" {
+				name += "/" + s.ReplicatedJobName
+			}
+			if s.JobIndex != "" {
+				name += "/" + s.JobIndex
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%d\t%d\t%s\t%s\t%.4f\n",
+				section.kind, s.JobSetNamespace, name, section.ups[key].Up(),
+				s.InterruptionCount, s.RecoveryCount,
+				s.UpTime.Round(time.Second), s.DownTime.Round(time.Second), s.Availability)
+		}
+	}
+	return tw.Flush()
+}
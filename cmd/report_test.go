@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"example.com/megamon/internal/k8sutils"
+	"example.com/megamon/internal/records"
+)
+
+func TestPrintReport(t *testing.T) {
+	t.Parallel()
+
+	report := records.NewReport()
+	attrs := records.Attrs{JobSetName: "train", JobSetNamespace: "team-a"}
+	report.JobSetsUp["uid-1"] = records.Upness{ReadyCount: 1, ExpectedCount: 1, Attrs: attrs}
+	report.JobSetsUpSummaries["uid-1"] = records.UpnessSummaryWithAttrs{
+		Attrs: attrs,
+		EventSummary: records.EventSummary{
+			InterruptionCount: 2,
+			RecoveryCount:     2,
+			UpTime:            3 * time.Hour,
+			DownTime:          time.Hour,
+			Availability:      0.75,
+		},
+	}
+	jsn, err := json.Marshal(report)
+	require.NoError(t, err)
+
+	ref := types.NamespacedName{Namespace: "megamon-system", Name: "megamon-report"}
+	c := fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name},
+		Data:       map[string]string{"report": string(jsn)},
+	}).Build()
+
+	t.Run("text", func(t *testing.T) {
+		t.Parallel()
+		var out bytes.Buffer
+		require.NoError(t, printReport(context.Background(), c, ref, "report", "text", &out))
+		require.Contains(t, out.String(), "KIND")
+		require.Regexp(t, `jobset\s+team-a\s+train\s+true\s+2\s+2\s+3h0m0s\s+1h0m0s\s+0\.7500`, out.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+		var out bytes.Buffer
+		require.NoError(t, printReport(context.Background(), c, ref, "report", "json", &out))
+		var got records.Report
+		require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+		require.Equal(t, report, got)
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		t.Parallel()
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: "megamon-report-compressed"}}
+		require.NoError(t, k8sutils.SetReportJSONInConfigMap(cm, "report", jsn, true))
+		c := fake.NewClientBuilder().WithObjects(cm).Build()
+		var out bytes.Buffer
+		require.NoError(t, printReport(context.Background(), c, types.NamespacedName{Namespace: cm.Namespace, Name: cm.Name}, "report", "json", &out))
+		var got records.Report
+		require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+		require.Equal(t, report, got)
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		t.Parallel()
+		var out bytes.Buffer
+		require.Error(t, printReport(context.Background(), c, ref, "other", "text", &out))
+	})
+}
+
+func TestPrintReportInvalid(t *testing.T) {
+	t.Parallel()
+
+	report := records.NewReport()
+	report.JobSetsUpSummaries["orphan"] = records.UpnessSummaryWithAttrs{}
+	jsn, err := json.Marshal(report)
+	require.NoError(t, err)
+
+	ref := types.NamespacedName{Namespace: "megamon-system", Name: "megamon-report"}
+	c := fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name},
+		Data:       map[string]string{"report": string(jsn)},
+	}).Build()
+
+	var out bytes.Buffer
+	err = printReport(context.Background(), c, ref, "report", "text", &out)
+	require.ErrorContains(t, err, "orphan")
+}
+
+func TestPrintReportNewerSchemaVersion(t *testing.T) {
+	t.Parallel()
+
+	report := records.NewReport()
+	report.SchemaVersion = records.ReportSchemaVersion + 1
+	jsn, err := json.Marshal(report)
+	require.NoError(t, err)
+
+	ref := types.NamespacedName{Namespace: "megamon-system", Name: "megamon-report"}
+	c := fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name},
+		Data:       map[string]string{"report": string(jsn)},
+	}).Build()
+
+	var out bytes.Buffer
+	err = printReport(context.Background(), c, ref, "report", "text", &out)
+	require.ErrorContains(t, err, "schema version")
+}
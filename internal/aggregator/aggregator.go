@@ -2,15 +2,25 @@ package aggregator
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
 	"example.com/megamon/internal/k8sutils"
 	"example.com/megamon/internal/metrics"
 	"example.com/megamon/internal/records"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
@@ -21,50 +31,565 @@ type Aggregator struct {
 
 	JobSetEventsConfigMapRef     types.NamespacedName
 	JobSetNodeEventsConfigMapRef types.NamespacedName
+	// JobEventsConfigMapRef, if set, tracks the upness of each replicated
+	// Job of every JobSet as well (see records.KindJob), recording its
+	// events in this ConfigMap.
+	JobEventsConfigMapRef types.NamespacedName
 
+	// Interval, AlignInterval and SummaryOptions are the initial settings.
+	// Use Settings and UpdateSettings to access them once started.
 	Interval time.Duration
+	// AlignInterval aligns aggregations to wall-clock multiples of Interval
+	// (e.g. on the minute) so that all replicas aggregate at the same times.
+	AlignInterval bool
+
+	SummaryOptions records.SummaryOptions
+
+	// FailureBackoff and MaxFailureBackoff back off aggregations while they
+	// keep failing, e.g. due to API server throttling: after consecutive
+	// failures, the next aggregation is delayed by FailureBackoff (defaults
+	// to the interval), doubled on every further failure up to
+	// MaxFailureBackoff. The first success resets the regular schedule.
+	// Zero MaxFailureBackoff disables the backoff.
+	FailureBackoff    time.Duration
+	MaxFailureBackoff time.Duration
+
+	// TimeoutFraction bounds each aggregation, and then each export, to
+	// this fraction of the interval, so that an aggregation stuck on a slow
+	// API server or sink is cancelled rather than overlapping the next tick.
+	// Defaults to DefaultTimeoutFraction.
+	TimeoutFraction float64
+
+	// FreezeNow makes exporters use the aggregation time as the current time
+	// instead of the time they are called at, so that all sinks agree on e.g.
+	// the open up interval for a given tick.
+	FreezeNow bool
+
+	// JobSetSelector, if set, restricts monitoring to the JobSets matching
+	// it. Other JobSets produce no events and no metrics.
+	JobSetSelector labels.Selector
+	// Namespaces, if set, restricts monitoring to the JobSets in these
+	// namespaces.
+	Namespaces []string
+
+	// NamespaceSummaries rolls up the JobSets of each namespace into the
+	// report, see records.Report.SummarizeNamespaces.
+	NamespaceSummaries bool
+
+	// NodePoolSummaries, if set with NodeEvents, rolls up all Nodes by
+	// their node pool into the report, see records.SummarizeNodePools.
+	NodePoolSummaries bool
+
+	// IncidentCorrelationWindow is the window within which interruptions of
+	// a JobSet and its Nodes are counted as a single fleet incident (see
+	// records.Incidents). Zero counts every interruption as an incident.
+	IncidentCorrelationWindow time.Duration
+
+	// MinEntityLifetime excludes entities that have existed for less than
+	// this from the fleet rollup (see records.Report.WithoutShortLived).
+	MinEntityLifetime time.Duration
+
+	// NodeDownRequiresUnreachablePods only counts a NotReady Node as down
+	// once none of its Pods are running, so that transient kubelet issues
+	// that leave the workload running are not recorded as downtime.
+	NodeDownRequiresUnreachablePods bool
+
+	// NodeUpConditions decide whether a Node is ready, see
+	// controller.NodeReconciler.UpConditions. Defaults to
+	// k8sutils.DefaultNodeUpConditions.
+	NodeUpConditions []k8sutils.NodeUpCondition
+
+	// DegradedNodeConditions are Node conditions that signal unhealthy
+	// accelerators (e.g. GPU XID errors). While any is true on a Ready Node,
+	// its JobSet and JobSet Nodes are recorded as degraded (see
+	// records.Upness.Degraded).
+	DegradedNodeConditions []corev1.NodeConditionType
+
+	// MinStateChangeInterval debounces state changes per entity kind (see
+	// records.ReconcileOptions), since e.g. the Nodes of a JobSet toggle at
+	// a different cadence than the JobSet itself.
+	MinStateChangeInterval map[records.Kind]time.Duration
+
+	// StartupGracePeriod records entities first seen within this long of
+	// the first aggregation in their observed state instead of as freshly
+	// provisioning (see records.ReconcileOptions.InitializeFromObserved),
+	// so that a restart does not record a provisioning window for every
+	// entity that was already up. Zero disables it.
+	StartupGracePeriod time.Duration
+
+	// ClusterName is included in every report, see records.Report.
+	ClusterName string
+
+	// NodePools, if set, provides the node pools that the Pods of each
+	// JobSet have run on, see records.Report.JobSetNodePools.
+	NodePools NodePoolRecorder
+
+	// StepRangeWidth, if set, counts the interruptions of each JobSet by
+	// training step ranges of this width, see
+	// records.Report.JobSetInterruptionsByStepRange.
+	StepRangeWidth int64
+
+	// InterruptionCauseWindow, if set with NodeEvents and JobSetNodes,
+	// attributes each JobSet interruption to a Node of the JobSet that went
+	// down within this long of it (see records.UpEvent.Cause).
+	InterruptionCauseWindow time.Duration
+	NodeEvents              NodeEventRecorder
+	JobSetNodes             JobSetNodeRecorder
+
+	// EventRetention, if set, compacts recorded events older than this into
+	// carried-forward totals, see records.Compact.
+	EventRetention time.Duration
+
+	// DryRun keeps the event records in memory, seeded from the event
+	// ConfigMaps, instead of updating the ConfigMaps, e.g. to try out
+	// settings against a real cluster.
+	DryRun bool
+
+	// Replay, if set, reports these synthetic events instead of observing
+	// the cluster and recording events, see ReplayEvents.
+	Replay *ReplayEvents
+
+	// HistorySize is the number of past reports kept in memory for
+	// DiffHandler. Zero disables the history.
+	HistorySize int
+
+	settingsMtx     sync.RWMutex
+	settingsUpdated chan struct{}
 
 	reportMtx   sync.RWMutex
 	report      records.Report
 	reportReady bool
+	// lastErr is the error of the last aggregation, see Status.
+	lastErr error
+	// reportHash identifies the report content, see WatchReport.
+	reportHash string
+	// reportChanged is closed when the report hash changes.
+	reportChanged chan struct{}
+	// history holds the last HistorySize reports, oldest first.
+	history []records.Report
+
+	transitionsMtx sync.Mutex
+	// transitionSubs are the subscribers to state transitions, see
+	// SubscribeTransitions.
+	transitionSubs map[chan Transition]struct{}
 
 	Exporters map[string]Exporter
+
+	exportersMtx sync.RWMutex
+	// exporterHealth is the outcome of the last exports by exporter, see
+	// ExporterHealth.
+	exporterHealth map[string]ExporterHealth
+
+	// summarizers incrementally summarize each entity's events across
+	// aggregations. Only accessed from Aggregate.
+	summarizers map[string]*records.Summarizer
+	// dryRunEvents are the event records by ConfigMap with DryRun. Only
+	// accessed from Aggregate.
+	dryRunEvents map[types.NamespacedName]map[string]records.EventRecords
+	// replayedCounts are the number of replayed events of each entity by
+	// kind at the last aggregation, see Replay. Only accessed from
+	// Aggregate.
+	replayedCounts map[records.Kind]map[string]int
+	// firstAggregation is the time of the first aggregation, see
+	// StartupGracePeriod. Only accessed from Aggregate.
+	firstAggregation time.Time
 }
 
+// DefaultTimeoutFraction is the default Aggregator.TimeoutFraction.
+const DefaultTimeoutFraction = 0.8
+
 type Exporter interface {
 	Export(context.Context, records.Report) error
 }
 
+// DeferredExporter is implemented by Exporters that export in the
+// background, see BatchingExporter, so that their health and export
+// durations are recorded once the export completes rather than when it is
+// scheduled.
+type DeferredExporter interface {
+	Exporter
+	// Deferred returns whether exports are deferred, otherwise Export is
+	// used.
+	Deferred() bool
+	// ExportDeferred schedules the export of the report and calls done with
+	// its outcome once it completes.
+	ExportDeferred(ctx context.Context, r records.Report, done func(start time.Time, err error))
+}
+
+// NodePoolRecorder records the node pools that the Pods of each JobSet have
+// run on, see controller.PodReconciler.
+type NodePoolRecorder interface {
+	// JobSetNodePools returns the node pools of the given JobSets by UID.
+	JobSetNodePools(keys []string) map[string][]string
+}
+
+// NodeEventRecorder records the up and down events of each Node, see
+// controller.NodeReconciler.
+type NodeEventRecorder interface {
+	// NodeEvents returns the events by Node name.
+	NodeEvents() map[string]records.EventRecords
+	// NodePools returns the node pool of each Node in NodeEvents, by Node
+	// name.
+	NodePools() map[string]string
+}
+
+// JobSetNodeRecorder records the Nodes that the Pods of each JobSet have run
+// on, see controller.PodReconciler.
+type JobSetNodeRecorder interface {
+	// JobSetNodes returns the node pool of each Node of the given JobSets by
+	// UID, by Node name.
+	JobSetNodes(keys []string) map[string]map[string]string
+}
+
+// JobSetPruner is implemented by NodePoolRecorders and JobSetNodeRecorders
+// that keep state per JobSet, see controller.PodReconciler.
+type JobSetPruner interface {
+	// Prune forgets all JobSets but the given ones (by UID), e.g. deleted
+	// ones. It is idempotent.
+	Prune(keys []string)
+}
+
+// ProfiledExporter is implemented by Exporters that select how much detail
+// they receive. Exporters default to records.RenderProfileSummary.
+type ProfiledExporter interface {
+	RenderProfile() records.RenderProfile
+}
+
+// Settings are the tunable Aggregator settings that can be changed at runtime.
+type Settings struct {
+	Interval       time.Duration
+	AlignInterval  bool
+	SummaryOptions records.SummaryOptions
+}
+
+// Validate returns an error if the settings can not be applied.
+func (s Settings) Validate() error {
+	var errs []error
+	if s.Interval < time.Second {
+		errs = append(errs, fmt.Errorf("interval must be at least 1s, got %v", s.Interval))
+	}
+	if s.SummaryOptions.SettlePeriod < 0 {
+		errs = append(errs, fmt.Errorf("settle period must not be negative, got %v", s.SummaryOptions.SettlePeriod))
+	}
+	r := s.SummaryOptions.AtRisk
+	if r.MinUpStreak < 0 || r.BurstWindow < 0 || r.SlowRecovery < 0 {
+		errs = append(errs, errors.New("at-risk durations must not be negative"))
+	}
+	if r.BurstCount < 0 {
+		errs = append(errs, errors.New("at-risk burst count must not be negative"))
+	}
+	if r.BurstCount > 0 && r.BurstWindow == 0 {
+		errs = append(errs, errors.New("at-risk burst window must be set with a burst count"))
+	}
+	if err := s.SummaryOptions.Alert.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := s.SummaryOptions.SLO.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Settings returns the current settings.
+func (a *Aggregator) Settings() Settings {
+	a.settingsMtx.RLock()
+	defer a.settingsMtx.RUnlock()
+	return Settings{
+		Interval:       a.Interval,
+		AlignInterval:  a.AlignInterval,
+		SummaryOptions: a.SummaryOptions,
+	}
+}
+
+// UpdateSettings validates and applies new settings. A changed interval
+// reschedules the next aggregation.
+func (a *Aggregator) UpdateSettings(s Settings) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	a.settingsMtx.Lock()
+	a.Interval = s.Interval
+	a.AlignInterval = s.AlignInterval
+	a.SummaryOptions = s.SummaryOptions
+	a.settingsMtx.Unlock()
+
+	select {
+	case a.settingsUpdatedCh() <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (a *Aggregator) settingsUpdatedCh() chan struct{} {
+	a.settingsMtx.Lock()
+	defer a.settingsMtx.Unlock()
+	if a.settingsUpdated == nil {
+		a.settingsUpdated = make(chan struct{}, 1)
+	}
+	return a.settingsUpdated
+}
+
 func (a *Aggregator) ReportReady() bool {
 	a.reportMtx.RLock()
 	defer a.reportMtx.RUnlock()
 	return a.reportReady
 }
 
+// Status is the state of the aggregation loop, to diagnose readiness.
+type Status struct {
+	Ready bool `json:"ready"`
+	// LastAggregation is the time of the last successful aggregation.
+	LastAggregation time.Time `json:"lastAggregation"`
+	// LastError is the error of the last aggregation, if it failed.
+	LastError string `json:"lastError,omitempty"`
+	// Entities is the number of JobSets in the report.
+	Entities int `json:"entities"`
+	// Exporters is the health of each exporter that has exported.
+	Exporters map[string]ExporterHealth `json:"exporters,omitempty"`
+}
+
+func (a *Aggregator) Status() Status {
+	a.reportMtx.RLock()
+	defer a.reportMtx.RUnlock()
+	s := Status{
+		Ready:           a.reportReady,
+		LastAggregation: a.report.Timestamp,
+		Entities:        len(a.report.JobSetsUp),
+	}
+	if a.lastErr != nil {
+		s.LastError = a.lastErr.Error()
+	}
+	s.Exporters = a.ExporterHealth()
+	return s
+}
+
+// ExporterHealth is the outcome of the last exports of an exporter, to tell
+// a single failing sink apart from stale metrics overall.
+type ExporterHealth struct {
+	// Up is whether the last export succeeded.
+	Up bool `json:"up"`
+	// LastSuccess is the time of the last successful export, zero if there
+	// was none.
+	LastSuccess time.Time `json:"lastSuccess"`
+	// LastError is the error of the last failed export, and LastErrorTime
+	// when it failed.
+	LastError     string    `json:"lastError,omitempty"`
+	LastErrorTime time.Time `json:"lastErrorTime"`
+}
+
+// ExporterHealth returns the health of each exporter that has exported, by
+// name. Only the instance that aggregates (the leader) exports.
+func (a *Aggregator) ExporterHealth() map[string]ExporterHealth {
+	a.exportersMtx.RLock()
+	defer a.exportersMtx.RUnlock()
+	if len(a.exporterHealth) == 0 {
+		return nil
+	}
+	health := make(map[string]ExporterHealth, len(a.exporterHealth))
+	for name, h := range a.exporterHealth {
+		health[name] = h
+	}
+	return health
+}
+
+// recordExport records the outcome of an export for ExporterHealth.
+func (a *Aggregator) recordExport(ctx context.Context, name string, at time.Time, err error) {
+	a.exportersMtx.Lock()
+	defer a.exportersMtx.Unlock()
+	if a.exporterHealth == nil {
+		a.exporterHealth = map[string]ExporterHealth{}
+	}
+	h := a.exporterHealth[name]
+	h.Up = err == nil
+	if err != nil {
+		h.LastError = err.Error()
+		h.LastErrorTime = at
+	} else {
+		h.LastSuccess = at
+	}
+	a.exporterHealth[name] = h
+
+	var up int64
+	if h.Up {
+		up = 1
+	}
+	metrics.ExporterUp.Record(ctx, up, metric.WithAttributes(attribute.String("exporter", name)))
+}
+
+// ReadyCheck is a readiness check that fails until the report is ready. The
+// error includes the Status as JSON, which controller-runtime only serves on
+// the endpoint of the individual check, e.g. /readyz/readyz.
+func (a *Aggregator) ReadyCheck(*http.Request) error {
+	if a.ReportReady() {
+		return nil
+	}
+	status, err := json.Marshal(a.Status())
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("aggregator report not ready: %s", status)
+}
+
 func (a *Aggregator) Start(ctx context.Context) error {
-	t := time.NewTicker(a.Interval)
+	var prev time.Time
+	var failures int
+	next := a.nextTick(time.Now(), prev)
+	t := time.NewTimer(time.Until(next))
 	defer t.Stop()
+	updated := a.settingsUpdatedCh()
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
+		case <-updated:
+			// Reschedule using the new settings.
+			if !t.Stop() {
+				<-t.C
+			}
+			next = a.nextTick(time.Now(), prev)
+			t.Reset(time.Until(next))
+			continue
 		case <-t.C:
 			log.Println("aggregating")
 		}
+		prev = next
+		next = a.nextTick(time.Now(), prev)
+		t.Reset(time.Until(next))
 
 		start := time.Now()
-		if err := a.Aggregate(ctx); err != nil {
+		if err := a.aggregateWithTimeout(ctx); err != nil {
 			log.Printf("failed to aggregate: %v", err)
+			metrics.AggregationFailureCount.Add(ctx, 1)
+			failures++
+			if backoff := a.failureBackoff(failures); backoff > 0 {
+				if !t.Stop() {
+					<-t.C
+				}
+				next = time.Now().Add(backoff)
+				t.Reset(backoff)
+			}
 			continue
 		}
+		failures = 0
 		metrics.AggregationDuration.Record(ctx, time.Since(start).Seconds())
+		metrics.LastAggregationTimestamp.Record(ctx, float64(time.Now().UnixNano())/1e9)
 
-		for name, exporter := range a.Exporters {
-			if err := exporter.Export(ctx, a.Report()); err != nil {
-				log.Printf("failed to export %s: %v", name, err)
-			}
+		a.export(ctx)
+	}
+}
+
+// export runs the exporters concurrently, so that a stuck sink does not hold
+// up the others, bounded by TimeoutFraction of the interval like Aggregate.
+func (a *Aggregator) export(ctx context.Context) {
+	timeout := a.timeout()
+	exportCtx, cancel := ctx, context.CancelFunc(func() {})
+	if timeout > 0 {
+		exportCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	report := a.Report()
+	var wg sync.WaitGroup
+	for name, exporter := range a.Exporters {
+		profile := records.RenderProfileSummary
+		if p, ok := exporter.(ProfiledExporter); ok && p.RenderProfile() != "" {
+			profile = p.RenderProfile()
 		}
+		rendered := report.Render(profile)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !a.FreezeNow {
+				rendered.Timestamp = time.Now()
+			}
+			if d, ok := exporter.(DeferredExporter); ok && d.Deferred() {
+				// The deferred export outlives this aggregation, so it is
+				// recorded against the long-lived ctx.
+				d.ExportDeferred(exportCtx, rendered, func(start time.Time, err error) {
+					a.exported(ctx, name, start, err)
+				})
+				return
+			}
+			start := time.Now()
+			err := exporter.Export(exportCtx, rendered)
+			if err != nil && errors.Is(exportCtx.Err(), context.DeadlineExceeded) {
+				err = fmt.Errorf("timed out after %v: %w", timeout, err)
+			}
+			a.exported(ctx, name, start, err)
+		}()
+	}
+	wg.Wait()
+}
+
+// exported records the outcome of an export that started at start.
+func (a *Aggregator) exported(ctx context.Context, name string, start time.Time, err error) {
+	if err != nil {
+		log.Printf("failed to export %s: %v", name, err)
 	}
+	metrics.ExporterDuration.Record(ctx, time.Since(start).Seconds(),
+		metric.WithAttributes(attribute.String("exporter", name)))
+	a.recordExport(ctx, name, time.Now(), err)
+}
+
+// nextTick returns the time of the next aggregation given the previous one.
+func (a *Aggregator) nextTick(now, prev time.Time) time.Time {
+	settings := a.Settings()
+	if settings.AlignInterval {
+		return nextAlignedTick(now, settings.Interval)
+	}
+	// Like a time.Ticker, skip ticks that were missed by a slow aggregation.
+	if next := prev.Add(settings.Interval); next.After(now) {
+		return next
+	}
+	return now.Add(settings.Interval)
+}
+
+// aggregateWithTimeout runs Aggregate bounded by TimeoutFraction of the
+// interval.
+func (a *Aggregator) aggregateWithTimeout(ctx context.Context) error {
+	timeout := a.timeout()
+	aggCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := a.Aggregate(aggCtx)
+	if err != nil && errors.Is(aggCtx.Err(), context.DeadlineExceeded) {
+		metrics.AggregationTimeoutCount.Add(ctx, 1)
+		err = fmt.Errorf("timed out after %v: %w", timeout, err)
+	}
+
+	a.reportMtx.Lock()
+	a.lastErr = err
+	a.reportMtx.Unlock()
+	return err
+}
+
+// timeout returns TimeoutFraction of the interval.
+func (a *Aggregator) timeout() time.Duration {
+	fraction := a.TimeoutFraction
+	if fraction <= 0 {
+		fraction = DefaultTimeoutFraction
+	}
+	return time.Duration(float64(a.Settings().Interval) * fraction)
+}
+
+// failureBackoff returns the delay of the next aggregation after the given
+// number of consecutive failures, or zero to keep the regular schedule.
+func (a *Aggregator) failureBackoff(failures int) time.Duration {
+	if failures == 0 || a.MaxFailureBackoff <= 0 {
+		return 0
+	}
+	backoff := a.FailureBackoff
+	if backoff <= 0 {
+		backoff = a.Settings().Interval
+	}
+	for i := 1; i < failures && backoff < a.MaxFailureBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, a.MaxFailureBackoff)
+}
+
+func nextAlignedTick(now time.Time, interval time.Duration) time.Time {
+	return now.Truncate(interval).Add(interval)
 }
 
 func (a *Aggregator) Report() records.Report {
@@ -74,16 +599,169 @@ func (a *Aggregator) Report() records.Report {
 }
 
 func (a *Aggregator) Aggregate(ctx context.Context) error {
+	now := time.Now()
 	report := records.NewReport()
+	report.Timestamp = now
+	report.ClusterName = a.ClusterName
+	report.MegamonVersion = megamonVersion
 
-	var jobsetList jobset.JobSetList
-	if err := a.List(ctx, &jobsetList); err != nil {
-		return fmt.Errorf("listing jobsets: %w", err)
+	trackJobs := a.JobEventsConfigMapRef != (types.NamespacedName{})
+	if trackJobs {
+		report.JobsUp = map[string]records.Upness{}
+		report.JobsUpSummaries = map[string]records.UpnessSummaryWithAttrs{}
+		report.JobSetJobsUpSummaries = map[string]records.UpnessSummaryWithAttrs{}
 	}
 
-	//	expectedCMEventKeys := make(map[string]struct{})
+	// With Replay, the entities are those of the replayed events.
+	if a.Replay == nil {
+		if err := a.observe(ctx, &report, trackJobs); err != nil {
+			return err
+		}
+	}
+	a.prune(report.JobSetsUp)
 
-	now := time.Now()
+	if a.firstAggregation.IsZero() {
+		a.firstAggregation = now
+	}
+	initFromObserved := a.StartupGracePeriod > 0 && now.Sub(a.firstAggregation) < a.StartupGracePeriod
+	summaryOpts := a.Settings().SummaryOptions
+	jsOpts := records.ReconcileOptions{
+		MinStateChangeInterval: a.MinStateChangeInterval[records.KindJobSet],
+		InitializeFromObserved: initFromObserved,
+		Retention:              a.EventRetention,
+		Outages:                summaryOpts.Outages,
+	}
+	if a.InterruptionCauseWindow > 0 && a.NodeEvents != nil && a.JobSetNodes != nil {
+		jsOpts.AttributeCause = a.nodeInterruptionCauses(report.JobSetsUp)
+		jsOpts.CauseWindow = a.InterruptionCauseWindow
+	}
+	jsEvents, jsAppended, err := a.reconcileEvents(ctx, now, a.JobSetEventsConfigMapRef, report.JobSetsUp, jsOpts)
+	if err != nil {
+		return fmt.Errorf("reconciling jobset events: %w", err)
+	}
+	jsNodeEvents, jsNodeAppended, err := a.reconcileEvents(ctx, now, a.JobSetNodeEventsConfigMapRef, report.JobSetNodesUp,
+		records.ReconcileOptions{
+			MinStateChangeInterval: a.MinStateChangeInterval[records.KindJobSetNodes],
+			InitializeFromObserved: initFromObserved,
+			Retention:              a.EventRetention,
+			Outages:                summaryOpts.Outages,
+		})
+	if err != nil {
+		return fmt.Errorf("reconciling jobset events: %w", err)
+	}
+	var jobEvents map[string]records.EventRecords
+	if trackJobs {
+		jobEvents, _, err = a.reconcileEvents(ctx, now, a.JobEventsConfigMapRef, report.JobsUp,
+			records.ReconcileOptions{
+				MinStateChangeInterval: a.MinStateChangeInterval[records.KindJob],
+				InitializeFromObserved: initFromObserved,
+				Retention:              a.EventRetention,
+				Outages:                summaryOpts.Outages,
+			})
+		if err != nil {
+			return fmt.Errorf("reconciling job events: %w", err)
+		}
+	}
+	a.publishTransitions(jsAppended, jsEvents, report.JobSetsUp)
+	a.publishTransitions(jsNodeAppended, jsNodeEvents, report.JobSetNodesUp)
+
+	summarizers := make(map[string]*records.Summarizer, len(jsEvents)+len(jsNodeEvents)+len(jobEvents))
+	summarize := func(key string, rec records.EventRecords, up records.Upness) records.EventSummary {
+		s, ok := a.summarizers[key]
+		if !ok {
+			s = &records.Summarizer{}
+		}
+		s.Update(&rec)
+		summarizers[key] = s
+		opts := summaryOpts
+		opts.SLO = up.SLO.WithDefaults(summaryOpts.SLO)
+		return s.Summary(now, opts)
+	}
+
+	for key, events := range jsEvents {
+		eventSummary := summarize("jobset/"+key, events, report.JobSetsUp[key])
+		report.JobSetsUpSummaries[key] = records.UpnessSummaryWithAttrs{
+			Attrs:        report.JobSetsUp[key].Attrs,
+			EventSummary: eventSummary,
+		}
+	}
+	for key, events := range jsNodeEvents {
+		eventSummary := summarize("jobset-nodes/"+key, events, report.JobSetNodesUp[key])
+		report.JobSetNodesUpSummaries[key] = records.UpnessSummaryWithAttrs{
+			Attrs:        report.JobSetNodesUp[key].Attrs,
+			EventSummary: eventSummary,
+		}
+	}
+
+	jobSummaries := map[string][]records.EventSummary{}
+	for key, events := range jobEvents {
+		eventSummary := summarize("job/"+key, events, report.JobsUp[key])
+		report.JobsUpSummaries[key] = records.UpnessSummaryWithAttrs{
+			Attrs:        report.JobsUp[key].Attrs,
+			EventSummary: eventSummary,
+		}
+		uid := records.JobSetKeyOfJob(key)
+		jobSummaries[uid] = append(jobSummaries[uid], eventSummary)
+	}
+	for uid, summaries := range jobSummaries {
+		report.JobSetJobsUpSummaries[uid] = records.UpnessSummaryWithAttrs{
+			Attrs:        report.JobSetsUp[uid].Attrs,
+			EventSummary: records.RollUp(summaries...),
+		}
+	}
+
+	// Summarizers for entities that no longer exist are dropped.
+	a.summarizers = summarizers
+
+	if a.NodePools != nil {
+		keys := make([]string, 0, len(report.JobSetsUp))
+		for key := range report.JobSetsUp {
+			keys = append(keys, key)
+		}
+		report.JobSetNodePools = a.NodePools.JobSetNodePools(keys)
+	}
+
+	if a.StepRangeWidth > 0 {
+		report.JobSetInterruptionsByStepRange = make(map[string]map[int64]int, len(jsEvents))
+		for key, events := range jsEvents {
+			if counts := events.InterruptionsByStepRange(a.StepRangeWidth); len(counts) > 0 {
+				report.JobSetInterruptionsByStepRange[key] = counts
+			}
+		}
+	}
+
+	report.JobSetEvents = jsEvents
+	report.JobSetNodeEvents = jsNodeEvents
+	report.JobEvents = jobEvents
+	fleet := report.WithoutShortLived(a.MinEntityLifetime)
+	report.Fleet = records.SummarizeFleet(fleet.JobSetEvents, fleet.JobSetNodeEvents, a.IncidentCorrelationWindow)
+	if a.NamespaceSummaries {
+		report.Namespaces = fleet.SummarizeNamespaces(a.IncidentCorrelationWindow)
+	}
+	if a.NodePoolSummaries && a.NodeEvents != nil {
+		report.NodePools = records.SummarizeNodePools(now, a.NodeEvents.NodePools(), a.NodeEvents.NodeEvents(), summaryOpts)
+	}
+
+	a.setReport(report)
+	return nil
+}
+
+// observe sets the upness of the monitored JobSets, their Nodes and, if
+// trackJobs, their Jobs in the report.
+func (a *Aggregator) observe(ctx context.Context, report *records.Report, trackJobs bool) error {
+	jobsetList, err := a.listJobSets(ctx)
+	if err != nil {
+		return err
+	}
+
+	var jobs map[string][]batchv1.Job
+	if trackJobs {
+		if jobs, err = a.listJobs(ctx); err != nil {
+			return err
+		}
+	}
+
+	//	expectedCMEventKeys := make(map[string]struct{})
 
 	uidMapKey := func(ns, name string) string {
 		return fmt.Sprintf("%s/%s", ns, name)
@@ -99,16 +777,19 @@ func (a *Aggregator) Aggregate(ctx context.Context) error {
 		uid := string(js.UID)
 		uidMap[uidMapKey(js.Namespace, js.Name)] = uid
 
-		attrs := extractJobSetAttrs(&js)
-		specReplicas, readyReplicas := k8sutils.GetJobSetReplicas(&js)
-		report.JobSetsUp[uid] = records.Upness{
-			ExpectedCount: specReplicas,
-			ReadyCount:    readyReplicas,
-			Attrs:         attrs,
-		}
+		report.JobSetsUp[uid] = jobSetUpness(&js)
+		nodeAttrs := extractJobSetAttrs(&js)
+		nodeAttrs.Kind = records.KindJobSetNodes
 		report.JobSetNodesUp[uid] = records.Upness{
 			ExpectedCount: k8sutils.GetExpectedNodeCount(&js),
-			Attrs:         attrs,
+			Attrs:         nodeAttrs,
+			Pending:       !k8sutils.IsJobSetExpectedToRun(&js),
+			SLO:           report.JobSetsUp[uid].SLO,
+		}
+		if trackJobs {
+			for key, up := range jobUpness(&js, jobs[uidMapKey(js.Namespace, js.Name)], report.JobSetsUp[uid]) {
+				report.JobsUp[key] = up
+			}
 		}
 	}
 
@@ -117,6 +798,11 @@ func (a *Aggregator) Aggregate(ctx context.Context) error {
 		return fmt.Errorf("listing nodes: %w", err)
 	}
 
+	isNodeReady, err := a.nodeReadyFunc(ctx)
+	if err != nil {
+		return err
+	}
+
 	for _, node := range nodeList.Items {
 		jsNS, jsName := k8sutils.GetJobSetForNode(&node)
 		if jsNS == "" || jsName == "" {
@@ -131,65 +817,330 @@ func (a *Aggregator) Aggregate(ctx context.Context) error {
 		if !ok {
 			continue
 		}
-		if !k8sutils.IsNodeReady(&node) {
+		if !isNodeReady(&node) {
 			continue
 		}
 		up.ReadyCount++
+		if k8sutils.IsNodeDegraded(&node, a.DegradedNodeConditions) {
+			up.Degraded = true
+		}
 		report.JobSetNodesUp[uid] = up
 	}
+	// A JobSet is degraded when its Nodes are.
+	for uid, nodesUp := range report.JobSetNodesUp {
+		if js := report.JobSetsUp[uid]; nodesUp.Degraded {
+			js.Degraded = true
+			report.JobSetsUp[uid] = js
+		}
+	}
+	return nil
+}
 
-	jsEvents, err := reconcileEvents(ctx, a.Client, a.JobSetEventsConfigMapRef, report.JobSetsUp)
-	if err != nil {
-		return fmt.Errorf("reconciling jobset events: %w", err)
+// listJobSets lists the monitored JobSets, see JobSetSelector and
+// Namespaces.
+func (a *Aggregator) listJobSets(ctx context.Context) (jobset.JobSetList, error) {
+	var opts []client.ListOption
+	if a.JobSetSelector != nil {
+		opts = append(opts, client.MatchingLabelsSelector{Selector: a.JobSetSelector})
 	}
-	jsNodeEvents, err := reconcileEvents(ctx, a.Client, a.JobSetNodeEventsConfigMapRef, report.JobSetNodesUp)
-	if err != nil {
-		return fmt.Errorf("reconciling jobset events: %w", err)
+	var list jobset.JobSetList
+	if len(a.Namespaces) == 0 {
+		if err := a.List(ctx, &list, opts...); err != nil {
+			return list, fmt.Errorf("listing jobsets: %w", err)
+		}
+		return list, nil
+	}
+	for _, ns := range a.Namespaces {
+		var nsList jobset.JobSetList
+		if err := a.List(ctx, &nsList, append(opts, client.InNamespace(ns))...); err != nil {
+			return list, fmt.Errorf("listing jobsets in namespace %s: %w", ns, err)
+		}
+		list.Items = append(list.Items, nsList.Items...)
 	}
+	return list, nil
+}
 
-	for key, events := range jsEvents {
-		eventSummary := events.Summarize(now)
-		report.JobSetsUpSummaries[key] = records.UpnessSummaryWithAttrs{
-			Attrs:        report.JobSetsUp[key].Attrs,
-			EventSummary: eventSummary,
+// listJobs lists the Jobs of JobSets in the monitored namespaces, keyed by
+// the namespace and name of their JobSet.
+func (a *Aggregator) listJobs(ctx context.Context) (map[string][]batchv1.Job, error) {
+	opts := []client.ListOption{client.HasLabels{jobset.JobSetNameKey}}
+	var list batchv1.JobList
+	if len(a.Namespaces) == 0 {
+		if err := a.List(ctx, &list, opts...); err != nil {
+			return nil, fmt.Errorf("listing jobs: %w", err)
 		}
 	}
-	for key, events := range jsNodeEvents {
-		eventSummary := events.Summarize(now)
-		report.JobSetNodesUpSummaries[key] = records.UpnessSummaryWithAttrs{
-			Attrs:        report.JobSetNodesUp[key].Attrs,
-			EventSummary: eventSummary,
+	for _, ns := range a.Namespaces {
+		var nsList batchv1.JobList
+		if err := a.List(ctx, &nsList, append(opts, client.InNamespace(ns))...); err != nil {
+			return nil, fmt.Errorf("listing jobs in namespace %s: %w", ns, err)
 		}
+		list.Items = append(list.Items, nsList.Items...)
+	}
+	jobs := map[string][]batchv1.Job{}
+	for _, job := range list.Items {
+		key := job.Namespace + "/" + job.Labels[jobset.JobSetNameKey]
+		jobs[key] = append(jobs[key], job)
 	}
+	return jobs, nil
+}
 
-	a.reportMtx.Lock()
-	a.report = report
-	a.reportReady = true
-	a.reportMtx.Unlock()
+// monitored returns whether js is monitored, see JobSetSelector and
+// Namespaces.
+func (a *Aggregator) monitored(js *jobset.JobSet) bool {
+	if a.JobSetSelector != nil && !a.JobSetSelector.Matches(labels.Set(js.Labels)) {
+		return false
+	}
+	if len(a.Namespaces) == 0 {
+		return true
+	}
+	for _, ns := range a.Namespaces {
+		if ns == js.Namespace {
+			return true
+		}
+	}
+	return false
+}
 
-	return nil
+// nodeReadyFunc returns the function that decides whether a Node counts as
+// ready, see NodeUpConditions and NodeDownRequiresUnreachablePods.
+func (a *Aggregator) nodeReadyFunc(ctx context.Context) (func(*corev1.Node) bool, error) {
+	upConditions := a.NodeUpConditions
+	if upConditions == nil {
+		upConditions = k8sutils.DefaultNodeUpConditions
+	}
+	isNodeUp := func(node *corev1.Node) bool {
+		return k8sutils.IsNodeUp(node, upConditions)
+	}
+	if !a.NodeDownRequiresUnreachablePods {
+		return isNodeUp, nil
+	}
+	var podList corev1.PodList
+	if err := a.List(ctx, &podList); err != nil {
+		return nil, fmt.Errorf("listing pods: %w", err)
+	}
+	running := map[string]bool{}
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.Spec.NodeName != "" && k8sutils.IsPodRunning(pod) {
+			running[pod.Spec.NodeName] = true
+		}
+	}
+	return func(node *corev1.Node) bool {
+		return isNodeUp(node) || running[node.Name]
+	}, nil
+}
+
+func jobSetUpness(js *jobset.JobSet) records.Upness {
+	specReplicas, readyReplicas := k8sutils.GetJobSetReplicas(js)
+	checkpoint, _ := k8sutils.GetJobSetLastCheckpoint(js)
+	attrs := extractJobSetAttrs(js)
+	attrs.Kind = records.KindJobSet
+	up := records.Upness{
+		ExpectedCount:  specReplicas,
+		ReadyCount:     readyReplicas,
+		Attrs:          attrs,
+		LastCheckpoint: checkpoint,
+		Pending:        !k8sutils.IsJobSetExpectedToRun(js),
+	}
+	if step, ok := k8sutils.GetJobSetStep(js); ok {
+		up.Step = &step
+	}
+	if ready, ok := k8sutils.GetJobSetCoordinatorReady(js); ok {
+		up.Severity = records.SeverityWorker
+		if !ready {
+			up.Severity = records.SeverityCoordinator
+		}
+	}
+	if remaining, ok := k8sutils.GetJobSetRestartBudget(js); ok {
+		up.RestartBudgetRemaining = &remaining
+	}
+	if slo, err := k8sutils.GetJobSetSLO(js); err != nil {
+		log.Printf("jobset %s/%s: %v, using the default SLO", js.Namespace, js.Name, err)
+	} else {
+		up.SLO = slo
+	}
+	return up
+}
+
+// nodeInterruptionCauses returns a records.ReconcileOptions.AttributeCause
+// that attributes a JobSet interruption to the Node of the JobSet with the
+// closest down event within InterruptionCauseWindow of the interruption.
+func (a *Aggregator) nodeInterruptionCauses(ups map[string]records.Upness) func(string, time.Time) *records.InterruptionCause {
+	keys := make([]string, 0, len(ups))
+	for key := range ups {
+		keys = append(keys, key)
+	}
+	jobSetNodes := a.JobSetNodes.JobSetNodes(keys)
+	nodeEvents := a.NodeEvents.NodeEvents()
+
+	return func(key string, at time.Time) *records.InterruptionCause {
+		nodes := make([]string, 0, len(jobSetNodes[key]))
+		for node := range jobSetNodes[key] {
+			nodes = append(nodes, node)
+		}
+		sort.Strings(nodes)
+
+		var cause *records.InterruptionCause
+		var closest time.Duration
+		for _, node := range nodes {
+			for _, e := range nodeEvents[node].UpEvents {
+				if e.Up {
+					continue
+				}
+				d := e.Timestamp.Sub(at)
+				if d < 0 {
+					d = -d
+				}
+				if d <= a.InterruptionCauseWindow && (cause == nil || d < closest) {
+					cause = &records.InterruptionCause{Node: node, NodePool: jobSetNodes[key][node]}
+					closest = d
+				}
+			}
+		}
+		return cause
+	}
+}
+
+// prune forgets the JobSets that are no longer monitored in the NodePools and
+// JobSetNodes recorders, once per aggregation, so that reading them has no
+// side effects.
+func (a *Aggregator) prune(ups map[string]records.Upness) {
+	keys := make([]string, 0, len(ups))
+	for key := range ups {
+		keys = append(keys, key)
+	}
+	if p, ok := a.NodePools.(JobSetPruner); ok {
+		p.Prune(keys)
+	}
+	if p, ok := a.JobSetNodes.(JobSetPruner); ok {
+		p.Prune(keys)
+	}
+}
+
+// jobUpness returns the upness of each replica of each replicated Job of the
+// JobSet, keyed by records.JobKey, given its Jobs and the upness of the
+// JobSet itself. A replica is up while its Job is ready, see
+// k8sutils.IsJobReady, so that a single flaky replica stands out.
+func jobUpness(js *jobset.JobSet, jobs []batchv1.Job, jsUp records.Upness) map[string]records.Upness {
+	ready := map[string]bool{}
+	for i := range jobs {
+		job := &jobs[i]
+		// Skip the Jobs of a previous JobSet of the same name.
+		if owner := metav1.GetControllerOf(job); owner != nil && owner.UID != js.UID {
+			continue
+		}
+		key := job.Labels[jobset.ReplicatedJobNameKey] + "/" + job.Labels[jobset.JobIndexKey]
+		ready[key] = k8sutils.IsJobReady(job)
+	}
+
+	specified, _ := k8sutils.GetReplicatedJobReplicas(js)
+	ups := map[string]records.Upness{}
+	for name, replicas := range specified {
+		for index := 0; index < int(replicas); index++ {
+			attrs := jsUp.Attrs
+			attrs.Kind = records.KindJob
+			attrs.ReplicatedJobName = name
+			attrs.JobIndex = strconv.Itoa(index)
+			up := records.Upness{
+				ExpectedCount: 1,
+				Attrs:         attrs,
+				// The checkpoint and step are reported for the whole JobSet.
+				LastCheckpoint: jsUp.LastCheckpoint,
+				Step:           jsUp.Step,
+				Pending:        jsUp.Pending,
+				SLO:            jsUp.SLO,
+			}
+			if ready[name+"/"+attrs.JobIndex] {
+				up.ReadyCount = 1
+			}
+			ups[records.JobKey(string(js.UID), name, index)] = up
+		}
+	}
+	return ups
 }
 
-func reconcileEvents(ctx context.Context, client client.Client, cmRef types.NamespacedName, ups map[string]records.Upness) (map[string]records.EventRecords, error) {
+// reconcileEvents records events for changes in upness and returns all
+// records, along with the keys of the entities that had an event appended.
+// With DryRun, the records are kept in memory instead of the ConfigMap. With
+// Replay, the replayed events are returned instead, see replayEvents.
+func (a *Aggregator) reconcileEvents(ctx context.Context, now time.Time, cmRef types.NamespacedName, ups map[string]records.Upness, opts records.ReconcileOptions) (map[string]records.EventRecords, []string, error) {
+	if a.Replay != nil {
+		recs, appended := a.replayEvents(now, cmRef, ups)
+		return recs, appended, nil
+	}
+	if !a.DryRun {
+		return reconcileEvents(ctx, a.Client, now, cmRef, ups, opts)
+	}
+	recs, ok := a.dryRunEvents[cmRef]
+	if !ok {
+		var cm corev1.ConfigMap
+		if err := a.Get(ctx, cmRef, &cm); err != nil {
+			return nil, nil, fmt.Errorf("failed to get event records configmap: %w", err)
+		}
+		var err error
+		recs, err = k8sutils.GetEventRecordsFromConfigMap(&cm)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get event records from configmap: %w", err)
+		}
+		if a.dryRunEvents == nil {
+			a.dryRunEvents = map[types.NamespacedName]map[string]records.EventRecords{}
+		}
+		a.dryRunEvents[cmRef] = recs
+	}
+	_, appended := reconcileRecords(now, ups, recs, opts)
+	// Exporters must not share the records that the next aggregation
+	// appends to.
+	out := make(map[string]records.EventRecords, len(recs))
+	for key, rec := range recs {
+		rec.UpEvents = append([]records.UpEvent(nil), rec.UpEvents...)
+		out[key] = rec
+	}
+	return out, appended, nil
+}
+
+// reconcileEvents records events for changes in upness in the ConfigMap and
+// returns all records, along with the keys of the entities that had an event
+// appended.
+func reconcileEvents(ctx context.Context, client client.Client, now time.Time, cmRef types.NamespacedName, ups map[string]records.Upness, opts records.ReconcileOptions) (map[string]records.EventRecords, []string, error) {
 	var cm corev1.ConfigMap
 	if err := client.Get(ctx, cmRef, &cm); err != nil {
-		return nil, fmt.Errorf("failed to get event records configmap: %w", err)
+		return nil, nil, fmt.Errorf("failed to get event records configmap: %w", err)
 	}
 
 	recs, err := k8sutils.GetEventRecordsFromConfigMap(&cm)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get event records from configmap: %w", err)
+		return nil, nil, fmt.Errorf("failed to get event records from configmap: %w", err)
 	}
 
-	if changed := records.ReconcileEvents(time.Now(), ups, recs); changed {
+	changed, appended := reconcileRecords(now, ups, recs, opts)
+	if changed {
 		if err := k8sutils.SetEventRecordsInConfigMap(&cm, recs); err != nil {
-			return nil, fmt.Errorf("failed to set event records in configmap: %w", err)
+			return nil, nil, fmt.Errorf("failed to set event records in configmap: %w", err)
 		}
 
 		if err := client.Update(ctx, &cm); err != nil {
-			return nil, fmt.Errorf("failed to update events configmap: %w", err)
+			return nil, nil, fmt.Errorf("failed to update events configmap: %w", err)
 		}
 	}
+	return recs, appended, nil
+}
+
+// reconcileRecords reconciles recs in place and returns whether they changed,
+// along with the sorted keys of the entities that had an event appended.
+func reconcileRecords(now time.Time, ups map[string]records.Upness, recs map[string]records.EventRecords, opts records.ReconcileOptions) (bool, []string) {
+	counts := make(map[string]int, len(recs))
+	for key, rec := range recs {
+		counts[key] = rec.EventCount()
+	}
+	changed := records.ReconcileEventsWithOptions(now, ups, recs, opts)
 
-	return recs, nil
+	var appended []string
+	for key, rec := range recs {
+		if rec.EventCount() > counts[key] {
+			appended = append(appended, key)
+		}
+	}
+	sort.Strings(appended)
+	return changed, appended
 }
@@ -0,0 +1,1543 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/k8sutils"
+	"example.com/megamon/internal/metrics"
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/metric"
+	metricsdk "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestNextTick(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]struct {
+		align    bool
+		interval time.Duration
+		now      time.Time
+		prev     time.Time
+		exp      time.Time
+	}{
+		"first tick relative to start": {
+			interval: time.Minute,
+			now:      t0.Add(17 * time.Second),
+			exp:      t0.Add(77 * time.Second),
+		},
+		"next tick relative to previous": {
+			interval: time.Minute,
+			now:      t0.Add(80 * time.Second),
+			prev:     t0.Add(77 * time.Second),
+			exp:      t0.Add(137 * time.Second),
+		},
+		"missed tick after slow aggregation": {
+			interval: time.Minute,
+			now:      t0.Add(150 * time.Second),
+			prev:     t0.Add(77 * time.Second),
+			exp:      t0.Add(210 * time.Second),
+		},
+		"first tick aligned": {
+			align:    true,
+			interval: time.Minute,
+			now:      t0.Add(17 * time.Second),
+			exp:      t0.Add(time.Minute),
+		},
+		"aligned tick on boundary": {
+			align:    true,
+			interval: 10 * time.Second,
+			now:      t0.Add(time.Minute),
+			prev:     t0.Add(50 * time.Second),
+			exp:      t0.Add(70 * time.Second),
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			a := &Aggregator{Interval: c.interval, AlignInterval: c.align}
+			require.Equal(t, c.exp, a.nextTick(c.now, c.prev))
+		})
+	}
+}
+
+type recordingExporter struct {
+	profile records.RenderProfile
+	reports []records.Report
+}
+
+func (e *recordingExporter) RenderProfile() records.RenderProfile {
+	return e.profile
+}
+
+func (e *recordingExporter) Export(_ context.Context, r records.Report) error {
+	e.reports = append(e.reports, r)
+	return nil
+}
+
+func TestFailureBackoff(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		backoff, max time.Duration
+		failures     int
+		exp          time.Duration
+	}{
+		"healthy": {
+			max: time.Minute,
+			exp: 0,
+		},
+		"disabled": {
+			backoff:  time.Second,
+			failures: 3,
+			exp:      0,
+		},
+		"first failure": {
+			backoff:  time.Second,
+			max:      time.Minute,
+			failures: 1,
+			exp:      time.Second,
+		},
+		"doubled": {
+			backoff:  time.Second,
+			max:      time.Minute,
+			failures: 4,
+			exp:      8 * time.Second,
+		},
+		"capped": {
+			backoff:  time.Second,
+			max:      time.Minute,
+			failures: 100,
+			exp:      time.Minute,
+		},
+		"defaults to the interval": {
+			max:      time.Hour,
+			failures: 2,
+			exp:      20 * time.Second,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			a := &Aggregator{Interval: 10 * time.Second, FailureBackoff: c.backoff, MaxFailureBackoff: c.max}
+			require.Equal(t, c.exp, a.failureBackoff(c.failures))
+		})
+	}
+}
+
+func TestExportRenderProfiles(t *testing.T) {
+	t.Parallel()
+
+	report := records.NewReport()
+	report.JobSetsUp["abc"] = records.Upness{ReadyCount: 1, ExpectedCount: 1}
+	report.JobSetEvents = map[string]records.EventRecords{
+		"abc": {UpEvents: []records.UpEvent{{Up: false}, {Up: true}}},
+	}
+	report.JobSetNodeEvents = map[string]records.EventRecords{
+		"abc": {UpEvents: []records.UpEvent{{Up: false}}},
+	}
+
+	summary := &recordingExporter{}
+	full := &recordingExporter{profile: records.RenderProfileFull}
+	a := &Aggregator{
+		Exporters: map[string]Exporter{"summary": summary, "full": full},
+		FreezeNow: true,
+		report:    report,
+	}
+	a.export(context.Background())
+
+	require.Len(t, summary.reports, 1)
+	require.Equal(t, report.JobSetsUp, summary.reports[0].JobSetsUp)
+	require.Nil(t, summary.reports[0].JobSetEvents)
+	require.Nil(t, summary.reports[0].JobSetNodeEvents)
+
+	require.Len(t, full.reports, 1)
+	require.Equal(t, report, full.reports[0])
+}
+
+func TestExportFreezeNow(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	require.NoError(t, err)
+	report := records.NewReport()
+	report.Timestamp = t0
+
+	first, second := &recordingExporter{}, &recordingExporter{profile: records.RenderProfileFull}
+	a := &Aggregator{
+		Exporters: map[string]Exporter{"first": first, "second": second},
+		FreezeNow: true,
+		report:    report,
+	}
+	a.export(context.Background())
+
+	require.Len(t, first.reports, 1)
+	require.Len(t, second.reports, 1)
+	require.Equal(t, t0, first.reports[0].Timestamp)
+	require.Equal(t, t0, second.reports[0].Timestamp)
+
+	// Without FreezeNow each exporter sees the time it was called at.
+	a.FreezeNow = false
+	a.export(context.Background())
+	require.True(t, first.reports[1].Timestamp.After(t0))
+	require.True(t, second.reports[1].Timestamp.After(t0))
+}
+
+// Not parallel as it replaces the global metrics.ExporterDuration.
+func TestExportDuration(t *testing.T) {
+	reader := metricsdk.NewManualReader()
+	provider := metricsdk.NewMeterProvider(metricsdk.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+	hist, err := provider.Meter("test").Float64Histogram("exporter.duration")
+	require.NoError(t, err)
+	defer func(h metric.Float64Histogram) { metrics.ExporterDuration = h }(metrics.ExporterDuration)
+	metrics.ExporterDuration = hist
+
+	a := &Aggregator{
+		Exporters: map[string]Exporter{"a": &recordingExporter{}, "b": &recordingExporter{}},
+		report:    records.NewReport(),
+	}
+	for i := 0; i < 3; i++ {
+		a.export(context.Background())
+	}
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	require.Len(t, rm.ScopeMetrics[0].Metrics, 1)
+	data := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Histogram[float64])
+	got := map[string]uint64{}
+	for _, dp := range data.DataPoints {
+		name, _ := dp.Attributes.Value("exporter")
+		got[name.AsString()] = dp.Count
+	}
+	require.Equal(t, map[string]uint64{"a": 3, "b": 3}, got)
+}
+
+func TestAggregateTimeout(t *testing.T) {
+	reader := metricsdk.NewManualReader()
+	provider := metricsdk.NewMeterProvider(metricsdk.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+	counter, err := provider.Meter("test").Int64Counter("aggregation.timeout.count")
+	require.NoError(t, err)
+	defer func(c metric.Int64Counter) { metrics.AggregationTimeoutCount = c }(metrics.AggregationTimeoutCount)
+	metrics.AggregationTimeoutCount = counter
+
+	// The API server hangs until the request is cancelled.
+	cl := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		List: func(ctx context.Context, _ client.WithWatch, _ client.ObjectList, _ ...client.ListOption) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}).Build()
+	a := &Aggregator{Client: cl, Interval: 100 * time.Millisecond, TimeoutFraction: 0.5}
+
+	start := time.Now()
+	err = a.aggregateWithTimeout(context.Background())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorContains(t, err, "timed out after 50ms")
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	data := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Sum[int64])
+	require.Equal(t, int64(1), data.DataPoints[0].Value)
+}
+
+type failingExporter struct {
+	err error
+}
+
+func (e *failingExporter) Export(context.Context, records.Report) error {
+	return e.err
+}
+
+type hangingExporter struct{}
+
+func (hangingExporter) Export(ctx context.Context, _ records.Report) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestExportTimeout(t *testing.T) {
+	t.Parallel()
+
+	configmap := &recordingExporter{}
+	a := &Aggregator{
+		Exporters:       map[string]Exporter{"configmap": configmap, "gcs": hangingExporter{}},
+		Interval:        100 * time.Millisecond,
+		TimeoutFraction: 0.5,
+		report:          records.NewReport(),
+	}
+
+	start := time.Now()
+	a.export(context.Background())
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	// The hanging exporter does not hold up the others.
+	require.Len(t, configmap.reports, 1)
+	health := a.ExporterHealth()
+	require.True(t, health["configmap"].Up)
+	require.False(t, health["gcs"].Up)
+	require.Contains(t, health["gcs"].LastError, "timed out after 50ms")
+}
+
+func TestExportDeferredHealth(t *testing.T) {
+	t.Parallel()
+
+	a := &Aggregator{
+		Exporters: map[string]Exporter{
+			"gcs": &BatchingExporter{Exporter: hangingExporter{}, Window: time.Hour, Timeout: 10 * time.Millisecond},
+		},
+		report: records.NewReport(),
+	}
+	a.export(context.Background())
+	// Scheduling the batch is not a successful export.
+	require.NotContains(t, a.ExporterHealth(), "gcs")
+
+	a.Exporters["gcs"].(*BatchingExporter).Flush()
+	health := a.ExporterHealth()
+	require.False(t, health["gcs"].Up)
+	require.Contains(t, health["gcs"].LastError, "timed out after 10ms")
+}
+
+// Not parallel as it replaces the global metrics.ExporterUp.
+func TestExportHealth(t *testing.T) {
+	reader := metricsdk.NewManualReader()
+	provider := metricsdk.NewMeterProvider(metricsdk.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+	gauge, err := provider.Meter("test").Int64Gauge("exporter.up")
+	require.NoError(t, err)
+	defer func(g metric.Int64Gauge) { metrics.ExporterUp = g }(metrics.ExporterUp)
+	metrics.ExporterUp = gauge
+
+	pushgateway := &failingExporter{}
+	a := &Aggregator{
+		Exporters: map[string]Exporter{"configmap": &recordingExporter{}, "pushgateway": pushgateway},
+		report:    records.NewReport(),
+	}
+	require.Nil(t, a.ExporterHealth())
+
+	a.export(context.Background())
+	pushgateway.err = errors.New("connection refused")
+	a.export(context.Background())
+
+	health := a.ExporterHealth()
+	require.True(t, health["configmap"].Up)
+	require.Empty(t, health["configmap"].LastError)
+	require.False(t, health["pushgateway"].Up)
+	require.Equal(t, "connection refused", health["pushgateway"].LastError)
+	require.False(t, health["pushgateway"].LastSuccess.IsZero(), "the first export succeeded")
+	require.False(t, health["pushgateway"].LastErrorTime.Before(health["pushgateway"].LastSuccess))
+	require.Equal(t, health, a.Status().Exporters)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	data := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Gauge[int64])
+	got := map[string]int64{}
+	for _, dp := range data.DataPoints {
+		name, _ := dp.Attributes.Value("exporter")
+		got[name.AsString()] = dp.Value
+	}
+	require.Equal(t, map[string]int64{"configmap": 1, "pushgateway": 0}, got)
+
+	// Recovering clears the outage but keeps the last error.
+	pushgateway.err = nil
+	a.export(context.Background())
+	require.True(t, a.ExporterHealth()["pushgateway"].Up)
+	require.Equal(t, "connection refused", a.ExporterHealth()["pushgateway"].LastError)
+}
+
+func TestStatus(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	js := &jobset.JobSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "train", UID: "uid-1"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(js).Build()
+	a := &Aggregator{
+		Client:                       cl,
+		Interval:                     time.Minute,
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+	}
+
+	// The event ConfigMaps are missing.
+	require.Error(t, a.aggregateWithTimeout(context.Background()))
+	status := a.Status()
+	require.False(t, status.Ready)
+	require.Contains(t, status.LastError, "not found")
+	err := a.ReadyCheck(nil)
+	require.ErrorContains(t, err, "not ready")
+	require.ErrorContains(t, err, `"lastError":`)
+
+	for _, ref := range []types.NamespacedName{DefaultJobSetEventsConfigMapRef, DefaultJobSetNodeEventsConfigMapRef} {
+		require.NoError(t, cl.Create(context.Background(), &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name}}))
+	}
+	require.NoError(t, a.aggregateWithTimeout(context.Background()))
+	status = a.Status()
+	require.True(t, status.Ready)
+	require.Empty(t, status.LastError)
+	require.Equal(t, 1, status.Entities)
+	require.Equal(t, a.Report().Timestamp, status.LastAggregation)
+	require.NoError(t, a.ReadyCheck(nil))
+}
+
+type countingExporter struct {
+	mtx   sync.Mutex
+	count int
+}
+
+func (e *countingExporter) Export(context.Context, records.Report) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.count++
+	return nil
+}
+
+func (e *countingExporter) Count() int {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.count
+}
+
+func TestStartIntervalUpdate(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetEventsConfigMapRef.Name,
+		}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+		}},
+	).Build()
+
+	exporter := &countingExporter{}
+	a := &Aggregator{
+		Client:                       c,
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+		Interval:                     time.Hour,
+		Exporters:                    map[string]Exporter{"counting": exporter},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- a.Start(ctx) }()
+
+	// Without the update, the first aggregation would be an hour away.
+	require.NoError(t, a.UpdateSettings(Settings{Interval: time.Second}))
+	require.Eventually(t, func() bool { return exporter.Count() >= 1 }, 5*time.Second, 10*time.Millisecond)
+
+	require.Error(t, a.UpdateSettings(Settings{Interval: 0}))
+	require.Equal(t, time.Second, a.Settings().Interval)
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestAggregatePendingJobSets(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	suspend := true
+	newJobSet := func(name string, replicas int32, suspend *bool) *jobset.JobSet {
+		return &jobset.JobSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID("uid-" + name)},
+			Spec: jobset.JobSetSpec{
+				Suspend:        suspend,
+				ReplicatedJobs: []jobset.ReplicatedJob{{Name: "rj", Replicas: replicas}},
+			},
+		}
+	}
+	suspended := newJobSet("suspended", 2, &suspend)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		suspended,
+		newJobSet("zero", 0, nil),
+		newJobSet("running", 2, nil),
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetEventsConfigMapRef.Name,
+		}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+		}},
+	).Build()
+
+	a := &Aggregator{
+		Client:                       c,
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+	}
+	require.NoError(t, a.Aggregate(context.Background()))
+
+	report := a.Report()
+	for _, events := range []map[string]records.EventRecords{report.JobSetEvents, report.JobSetNodeEvents} {
+		require.Contains(t, events, "uid-running")
+		require.NotContains(t, events, "uid-suspended")
+		require.NotContains(t, events, "uid-zero")
+	}
+	require.NotContains(t, report.JobSetsUpSummaries, "uid-suspended")
+	require.NotContains(t, report.JobSetsUpSummaries, "uid-zero")
+	require.Equal(t, records.KindJobSet, report.JobSetsUpSummaries["uid-running"].Kind)
+	require.Equal(t, records.KindJobSetNodes, report.JobSetNodesUpSummaries["uid-running"].Kind)
+
+	// Events are recorded once the JobSet is resumed.
+	suspended.Spec.Suspend = nil
+	require.NoError(t, c.Update(context.Background(), suspended))
+	require.NoError(t, a.Aggregate(context.Background()))
+	report = a.Report()
+	require.Len(t, report.JobSetEvents["uid-suspended"].UpEvents, 1)
+	require.Zero(t, report.JobSetsUpSummaries["uid-suspended"].DownTime)
+}
+
+func TestAggregateReportIdentity(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetEventsConfigMapRef.Name,
+		}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+		}},
+	).Build()
+
+	a := &Aggregator{
+		Client:                       c,
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+		ClusterName:                  "cluster-a",
+	}
+	require.NoError(t, a.Aggregate(context.Background()))
+
+	report := a.Report()
+	require.Equal(t, "cluster-a", report.ClusterName)
+	require.NotEmpty(t, report.MegamonVersion)
+
+	var exported map[string]any
+	data, err := json.Marshal(report.Render(records.RenderProfileSummary))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &exported))
+	require.Equal(t, "cluster-a", exported["clusterName"])
+	require.Equal(t, report.MegamonVersion, exported["megamonVersion"])
+}
+
+func TestAggregateNodeDownRequiresUnreachablePods(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	parallelism := int32(2)
+	js := &jobset.JobSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "train", UID: "uid-1"},
+		Spec: jobset.JobSetSpec{
+			ReplicatedJobs: []jobset.ReplicatedJob{{Name: "rj", Replicas: 1}},
+		},
+	}
+	js.Spec.ReplicatedJobs[0].Template.Spec.Parallelism = &parallelism
+	node := func(name string, ready corev1.ConditionStatus) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{
+				"google.com/tpu-provisioner-jobset-namespace": "default",
+				"google.com/tpu-provisioner-jobset-name":      "train",
+			}},
+			Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: ready},
+				{Type: corev1.NodeNetworkUnavailable, Status: corev1.ConditionTrue},
+			}},
+		}
+	}
+	pod := func(name, nodeName string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec:       corev1.PodSpec{NodeName: nodeName},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+
+	cases := map[string]struct {
+		requireUnreachable bool
+		upConditions       []k8sutils.NodeUpCondition
+		podPhase           corev1.PodPhase
+		expReady           int32
+	}{
+		"not ready is down": {
+			podPhase: corev1.PodRunning,
+			expReady: 1,
+		},
+		"ready without the up conditions is down": {
+			upConditions: []k8sutils.NodeUpCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+				{Type: corev1.NodeNetworkUnavailable, Status: corev1.ConditionFalse},
+			},
+			podPhase: corev1.PodRunning,
+			expReady: 0,
+		},
+		"not ready with running pods is up": {
+			requireUnreachable: true,
+			podPhase:           corev1.PodRunning,
+			expReady:           2,
+		},
+		"not ready without running pods is down": {
+			requireUnreachable: true,
+			podPhase:           corev1.PodFailed,
+			expReady:           1,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				js.DeepCopy(),
+				node("node-a", corev1.ConditionTrue),
+				node("node-b", corev1.ConditionFalse),
+				pod("pod-a", "node-a", corev1.PodRunning),
+				pod("pod-b", "node-b", c.podPhase),
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+					Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+					Name:      DefaultJobSetEventsConfigMapRef.Name,
+				}},
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+					Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+					Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+				}},
+			).Build()
+			a := &Aggregator{
+				Client:                          cl,
+				JobSetEventsConfigMapRef:        DefaultJobSetEventsConfigMapRef,
+				JobSetNodeEventsConfigMapRef:    DefaultJobSetNodeEventsConfigMapRef,
+				NodeDownRequiresUnreachablePods: c.requireUnreachable,
+				NodeUpConditions:                c.upConditions,
+			}
+			require.NoError(t, a.Aggregate(context.Background()))
+
+			report := a.Report()
+			require.Equal(t, c.expReady, report.JobSetNodesUp["uid-1"].ReadyCount)
+			// Only the initial down event is recorded unless all Nodes count as ready.
+			events := report.JobSetNodeEvents["uid-1"].UpEvents
+			require.Equal(t, c.expReady == 2, events[len(events)-1].Up)
+			require.Zero(t, report.JobSetNodesUpSummaries["uid-1"].InterruptionCount)
+		})
+	}
+}
+
+func TestAggregatePerJobSetSLO(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	newJobSet := func(name string, annotations map[string]string) *jobset.JobSet {
+		return &jobset.JobSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID("uid-" + name), Annotations: annotations},
+			Spec: jobset.JobSetSpec{
+				ReplicatedJobs: []jobset.ReplicatedJob{{Name: "rj", Replicas: 1}},
+			},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newJobSet("annotated", map[string]string{
+			k8sutils.JobSetSLOTargetAnnotation: "0.9",
+			k8sutils.JobSetSLOWindowAnnotation: "24h",
+		}),
+		newJobSet("target-only", map[string]string{k8sutils.JobSetSLOTargetAnnotation: "0.95"}),
+		newJobSet("unannotated", nil),
+		newJobSet("invalid", map[string]string{k8sutils.JobSetSLOTargetAnnotation: "2"}),
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetEventsConfigMapRef.Name,
+		}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+		}},
+	).Build()
+
+	defaultSLO := records.SLO{Target: 0.99, Window: 720 * time.Hour}
+	a := &Aggregator{
+		Client:                       c,
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+		SummaryOptions:               records.SummaryOptions{SLO: defaultSLO},
+	}
+	require.NoError(t, a.Aggregate(context.Background()))
+
+	report := a.Report()
+	for uid, exp := range map[string]records.SLO{
+		"uid-annotated":   {Target: 0.9, Window: 24 * time.Hour},
+		"uid-target-only": {Target: 0.95, Window: 720 * time.Hour},
+		"uid-unannotated": defaultSLO,
+		"uid-invalid":     defaultSLO,
+	} {
+		require.Equal(t, exp, report.JobSetsUpSummaries[uid].SLO, uid)
+		require.Equal(t, exp, report.JobSetNodesUpSummaries[uid].SLO, uid)
+	}
+}
+
+func TestAggregateCoordinatorInterruptions(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	js := &jobset.JobSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "train",
+			UID:         "uid-train",
+			Annotations: map[string]string{k8sutils.JobSetCoordinatorAnnotation: "head"},
+		},
+		Spec: jobset.JobSetSpec{
+			ReplicatedJobs: []jobset.ReplicatedJob{
+				{Name: "head", Replicas: 1},
+				{Name: "workers", Replicas: 2},
+			},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		js,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetEventsConfigMapRef.Name,
+		}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+		}},
+	).Build()
+	a := &Aggregator{
+		Client:                       c,
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+	}
+
+	setReady := func(head, workers int32) {
+		t.Helper()
+		require.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(js), js))
+		js.Status.ReplicatedJobsStatus = []jobset.ReplicatedJobStatus{
+			{Name: "head", Ready: head},
+			{Name: "workers", Ready: workers},
+		}
+		require.NoError(t, c.Update(context.Background(), js))
+		require.NoError(t, a.Aggregate(context.Background()))
+	}
+	setReady(1, 2)
+	setReady(1, 1) // Worker interruption.
+	setReady(1, 2)
+	setReady(0, 2) // Coordinator interruption.
+
+	report := a.Report()
+	var severities []records.Severity
+	for _, e := range report.JobSetEvents["uid-train"].UpEvents {
+		if !e.Up {
+			severities = append(severities, e.Severity)
+		}
+	}
+	// The initial down event is not an interruption and has no severity.
+	require.Equal(t, []records.Severity{"", records.SeverityWorker, records.SeverityCoordinator}, severities)
+	summary := report.JobSetsUpSummaries["uid-train"]
+	require.Equal(t, 2, summary.InterruptionCount)
+	require.Equal(t, 1, summary.CoordinatorInterruptionCount)
+}
+
+func TestAggregateMinStateChangeIntervalPerKind(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	cases := map[string]struct {
+		intervals     map[records.Kind]time.Duration
+		expJobSetUp   bool
+		expJobSetNode bool
+	}{
+		"jobset debounced": {
+			intervals: map[records.Kind]time.Duration{records.KindJobSet: time.Hour},
+			// The JobSet keeps its recorded state, its Nodes do not.
+			expJobSetUp:   true,
+			expJobSetNode: false,
+		},
+		"jobset nodes debounced": {
+			intervals:     map[records.Kind]time.Duration{records.KindJobSetNodes: time.Hour},
+			expJobSetUp:   false,
+			expJobSetNode: true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			js := &jobset.JobSet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "train", UID: "uid-1"},
+				Spec: jobset.JobSetSpec{
+					ReplicatedJobs: []jobset.ReplicatedJob{{Name: "rj", Replicas: 1}},
+				},
+				Status: jobset.JobSetStatus{
+					ReplicatedJobsStatus: []jobset.ReplicatedJobStatus{{Name: "rj", Ready: 1}},
+				},
+			}
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node", Labels: map[string]string{
+					"google.com/tpu-provisioner-jobset-namespace": "default",
+					"google.com/tpu-provisioner-jobset-name":      "train",
+				}},
+				Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+					{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+				}},
+			}
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				js,
+				node,
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+					Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+					Name:      DefaultJobSetEventsConfigMapRef.Name,
+				}},
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+					Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+					Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+				}},
+			).Build()
+			a := &Aggregator{
+				Client:                       cl,
+				JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+				JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+				MinStateChangeInterval:       c.intervals,
+			}
+			require.NoError(t, a.Aggregate(context.Background()))
+			report := a.Report()
+			require.True(t, report.JobSetsUp["uid-1"].Up())
+			require.True(t, report.JobSetNodesUp["uid-1"].Up())
+
+			// Both the JobSet and its Node go down right after coming up.
+			js.Status.ReplicatedJobsStatus[0].Ready = 0
+			require.NoError(t, cl.Update(context.Background(), js))
+			node.Status.Conditions[0].Status = corev1.ConditionFalse
+			require.NoError(t, cl.Status().Update(context.Background(), node))
+			require.NoError(t, a.Aggregate(context.Background()))
+
+			report = a.Report()
+			last := func(rec records.EventRecords) bool { return rec.UpEvents[len(rec.UpEvents)-1].Up }
+			require.Equal(t, c.expJobSetUp, last(report.JobSetEvents["uid-1"]))
+			require.Equal(t, c.expJobSetNode, last(report.JobSetNodeEvents["uid-1"]))
+		})
+	}
+}
+
+func TestAggregateStartupGracePeriod(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	cases := map[string]struct {
+		gracePeriod time.Duration
+		expUpEvents []bool
+	}{
+		"disabled": {
+			// Recorded as provisioning at the process start.
+			expUpEvents: []bool{false, true},
+		},
+		"enabled": {
+			gracePeriod: time.Hour,
+			expUpEvents: []bool{true},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// The JobSet is already up when megamon starts.
+			js := &jobset.JobSet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "train", UID: "uid-1"},
+				Spec: jobset.JobSetSpec{
+					ReplicatedJobs: []jobset.ReplicatedJob{{Name: "rj", Replicas: 1}},
+				},
+				Status: jobset.JobSetStatus{
+					ReplicatedJobsStatus: []jobset.ReplicatedJobStatus{{Name: "rj", Ready: 1}},
+				},
+			}
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				js,
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+					Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+					Name:      DefaultJobSetEventsConfigMapRef.Name,
+				}},
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+					Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+					Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+				}},
+			).Build()
+			a := &Aggregator{
+				Client:                       cl,
+				JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+				JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+				StartupGracePeriod:           c.gracePeriod,
+			}
+			require.NoError(t, a.Aggregate(context.Background()))
+
+			report := a.Report()
+			var ups []bool
+			for _, e := range report.JobSetEvents["uid-1"].UpEvents {
+				ups = append(ups, e.Up)
+			}
+			require.Equal(t, c.expUpEvents, ups)
+			summary := report.JobSetsUpSummaries["uid-1"]
+			require.Zero(t, summary.InterruptionCount)
+			if c.gracePeriod > 0 {
+				require.Zero(t, summary.DownTimeInitial)
+				require.Equal(t, 1.0, summary.DataQuality.Confidence)
+			}
+
+			// A JobSet created after the grace period is provisioning.
+			a.firstAggregation = a.firstAggregation.Add(-2 * time.Hour)
+			js2 := js.DeepCopy()
+			js2.ResourceVersion = ""
+			js2.Name, js2.UID = "train2", "uid-2"
+			require.NoError(t, cl.Create(context.Background(), js2))
+			require.NoError(t, a.Aggregate(context.Background()))
+			events := a.Report().JobSetEvents["uid-2"].UpEvents
+			require.Len(t, events, 2)
+			require.False(t, events[0].Up)
+		})
+	}
+}
+
+func TestAggregateDegradedNodeConditions(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	js := &jobset.JobSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "train", UID: "uid-1"},
+		Spec: jobset.JobSetSpec{
+			ReplicatedJobs: []jobset.ReplicatedJob{{Name: "rj", Replicas: 1}},
+		},
+		Status: jobset.JobSetStatus{
+			ReplicatedJobsStatus: []jobset.ReplicatedJobStatus{{Name: "rj", Ready: 1}},
+		},
+	}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node", Labels: map[string]string{
+			"google.com/tpu-provisioner-jobset-namespace": "default",
+			"google.com/tpu-provisioner-jobset-name":      "train",
+		}},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+			{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+			{Type: "GPUXIDError", Status: corev1.ConditionFalse},
+		}},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		js,
+		node,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetEventsConfigMapRef.Name,
+		}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+		}},
+	).Build()
+	a := &Aggregator{
+		Client:                       cl,
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+		DegradedNodeConditions:       []corev1.NodeConditionType{"GPUXIDError"},
+	}
+	require.NoError(t, a.Aggregate(context.Background()))
+	report := a.Report()
+	require.False(t, report.JobSetsUp["uid-1"].Degraded)
+	require.False(t, report.JobSetNodesUp["uid-1"].Degraded)
+
+	node.Status.Conditions[1].Status = corev1.ConditionTrue
+	require.NoError(t, cl.Status().Update(context.Background(), node))
+	require.NoError(t, a.Aggregate(context.Background()))
+
+	// The JobSet stays up, but is recorded as degraded along with its Nodes.
+	report = a.Report()
+	require.True(t, report.JobSetsUp["uid-1"].Up())
+	require.True(t, report.JobSetsUp["uid-1"].Degraded)
+	require.True(t, report.JobSetNodesUp["uid-1"].Degraded)
+	for _, events := range []map[string]records.EventRecords{report.JobSetEvents, report.JobSetNodeEvents} {
+		rec := events["uid-1"]
+		require.Len(t, rec.DegradedEvents, 1)
+		require.True(t, rec.DegradedEvents[0].Degraded)
+		require.True(t, rec.UpEvents[len(rec.UpEvents)-1].Up)
+	}
+}
+
+// staticNodePools records the JobSets it was asked for and pruned to.
+type staticNodePools struct {
+	nodePools map[string][]string
+	keys      []string
+	pruned    [][]string
+}
+
+func (s *staticNodePools) Prune(keys []string) {
+	s.pruned = append(s.pruned, keys)
+}
+
+func (s *staticNodePools) JobSetNodePools(keys []string) map[string][]string {
+	s.keys = keys
+	out := map[string][]string{}
+	for _, key := range keys {
+		if pools, ok := s.nodePools[key]; ok {
+			out[key] = pools
+		}
+	}
+	return out
+}
+
+func TestAggregateNodePools(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	js := &jobset.JobSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "train", UID: "uid-1"},
+		Spec: jobset.JobSetSpec{
+			ReplicatedJobs: []jobset.ReplicatedJob{{Name: "rj", Replicas: 1}},
+		},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		js,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetEventsConfigMapRef.Name,
+		}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+		}},
+	).Build()
+	nodePools := &staticNodePools{nodePools: map[string][]string{
+		"uid-1":   {"pool-a", "pool-b"},
+		"deleted": {"pool-c"},
+	}}
+	a := &Aggregator{
+		Client:                       cl,
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+		NodePools:                    nodePools,
+	}
+	require.NoError(t, a.Aggregate(context.Background()))
+
+	require.Equal(t, []string{"uid-1"}, nodePools.keys)
+	require.Equal(t, [][]string{{"uid-1"}}, nodePools.pruned)
+	require.Equal(t, map[string][]string{"uid-1": {"pool-a", "pool-b"}}, a.Report().JobSetNodePools)
+}
+
+func TestAggregateJobs(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	js := &jobset.JobSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "train", UID: "uid-1"},
+		Spec: jobset.JobSetSpec{
+			ReplicatedJobs: []jobset.ReplicatedJob{{Name: "driver", Replicas: 1}, {Name: "workers", Replicas: 2}},
+		},
+		Status: jobset.JobSetStatus{
+			ReplicatedJobsStatus: []jobset.ReplicatedJobStatus{{Name: "driver", Ready: 1}, {Name: "workers", Ready: 2}},
+		},
+	}
+	newJob := func(rj string, index int, ready int32, owner types.UID) *batchv1.Job {
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      fmt.Sprintf("train-%s-%d-%s", rj, index, owner),
+				Labels: map[string]string{
+					jobset.JobSetNameKey:        "train",
+					jobset.ReplicatedJobNameKey: rj,
+					jobset.JobIndexKey:          fmt.Sprint(index),
+				},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: jobset.GroupVersion.String(),
+					Kind:       "JobSet",
+					Name:       "train",
+					UID:        owner,
+					Controller: ptr.To(true),
+				}},
+			},
+			Spec:   batchv1.JobSpec{Parallelism: ptr.To(int32(2))},
+			Status: batchv1.JobStatus{Ready: ptr.To(ready)},
+		}
+	}
+	worker1 := newJob("workers", 1, 2, "uid-1")
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		js,
+		newJob("driver", 0, 2, "uid-1"),
+		newJob("workers", 0, 2, "uid-1"),
+		worker1,
+		// The Jobs of a previous JobSet of the same name are ignored.
+		newJob("workers", 1, 0, "uid-0"),
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetEventsConfigMapRef.Name,
+		}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+		}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobEventsConfigMapRef.Namespace,
+			Name:      DefaultJobEventsConfigMapRef.Name,
+		}},
+	).Build()
+	a := &Aggregator{
+		Client:                       cl,
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+		JobEventsConfigMapRef:        DefaultJobEventsConfigMapRef,
+	}
+	ctx := context.Background()
+	require.NoError(t, a.Aggregate(ctx))
+
+	// The second worker replica goes down.
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(js), js))
+	js.Status.ReplicatedJobsStatus[1].Ready = 1
+	require.NoError(t, cl.Update(ctx, js))
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(worker1), worker1))
+	worker1.Status.Ready = ptr.To(int32(1))
+	require.NoError(t, cl.Status().Update(ctx, worker1))
+	require.NoError(t, a.Aggregate(ctx))
+
+	report := a.Report()
+	driver := records.JobKey("uid-1", "driver", 0)
+	worker0, worker1Key := records.JobKey("uid-1", "workers", 0), records.JobKey("uid-1", "workers", 1)
+	require.Equal(t, records.Attrs{
+		Kind:              records.KindJob,
+		JobSetName:        "train",
+		JobSetNamespace:   "default",
+		ReplicatedJobName: "workers",
+		JobIndex:          "1",
+	}, report.JobsUp[worker1Key].Attrs)
+	require.True(t, report.JobsUp[driver].Up())
+	require.True(t, report.JobsUp[worker0].Up())
+	require.False(t, report.JobsUp[worker1Key].Up())
+	require.Equal(t, 0, report.JobsUpSummaries[driver].InterruptionCount)
+	require.Equal(t, 0, report.JobsUpSummaries[worker0].InterruptionCount)
+	require.Equal(t, 1, report.JobsUpSummaries[worker1Key].InterruptionCount)
+	require.Equal(t, 1, report.JobSetJobsUpSummaries["uid-1"].InterruptionCount)
+	require.Equal(t, 1, report.JobSetsUpSummaries["uid-1"].InterruptionCount)
+	require.Len(t, report.JobEvents, 3)
+
+	// The events are only included in full reports.
+	require.Nil(t, report.Render(records.RenderProfileSummary).JobEvents)
+}
+
+type staticNodeEvents map[string]records.EventRecords
+
+func (s staticNodeEvents) NodeEvents() map[string]records.EventRecords { return s }
+
+func (s staticNodeEvents) NodePools() map[string]string { return nil }
+
+// staticNodePoolEvents are staticNodeEvents with node pools.
+type staticNodePoolEvents struct {
+	staticNodeEvents
+	pools map[string]string
+}
+
+func (s staticNodePoolEvents) NodePools() map[string]string { return s.pools }
+
+type staticJobSetNodes map[string]map[string]string
+
+func (s staticJobSetNodes) JobSetNodes(keys []string) map[string]map[string]string {
+	out := map[string]map[string]string{}
+	for _, key := range keys {
+		if nodes, ok := s[key]; ok {
+			out[key] = nodes
+		}
+	}
+	return out
+}
+
+func TestAggregateInterruptionCause(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	js := &jobset.JobSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "train", UID: "uid-1"},
+		Spec: jobset.JobSetSpec{
+			ReplicatedJobs: []jobset.ReplicatedJob{{Name: "rj", Replicas: 1}},
+		},
+		Status: jobset.JobSetStatus{
+			ReplicatedJobsStatus: []jobset.ReplicatedJobStatus{{Name: "rj", Ready: 1}},
+		},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		js,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetEventsConfigMapRef.Name,
+		}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+		}},
+	).Build()
+	now := time.Now()
+	a := &Aggregator{
+		Client:                       cl,
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+		InterruptionCauseWindow:      time.Minute,
+		NodeEvents: staticNodeEvents{
+			"node-a": {UpEvents: []records.UpEvent{{Up: true, Timestamp: now.Add(-time.Hour)}, {Up: false, Timestamp: now}}},
+			// Down too long ago to be the cause.
+			"node-b": {UpEvents: []records.UpEvent{{Up: false, Timestamp: now.Add(-time.Hour)}}},
+			// Not a Node of the JobSet.
+			"node-c": {UpEvents: []records.UpEvent{{Up: false, Timestamp: now}}},
+		},
+		JobSetNodes: staticJobSetNodes{"uid-1": {"node-a": "pool-a", "node-b": "pool-b"}},
+	}
+	ctx := context.Background()
+	require.NoError(t, a.Aggregate(ctx))
+
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(js), js))
+	js.Status.ReplicatedJobsStatus[0].Ready = 0
+	require.NoError(t, cl.Update(ctx, js))
+	require.NoError(t, a.Aggregate(ctx))
+
+	report := a.Report()
+	events := report.JobSetEvents["uid-1"].UpEvents
+	require.False(t, events[len(events)-1].Up)
+	require.Equal(t, &records.InterruptionCause{Node: "node-a", NodePool: "pool-a"}, events[len(events)-1].Cause)
+	require.Equal(t, 1, report.JobSetsUpSummaries["uid-1"].NodeInterruptionCount)
+}
+
+func TestAggregateDryRun(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	js := &jobset.JobSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "train", UID: "uid-1"},
+		Spec: jobset.JobSetSpec{
+			ReplicatedJobs: []jobset.ReplicatedJob{{Name: "rj", Replicas: 1}},
+		},
+	}
+	jsEventsCM := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+		Name:      DefaultJobSetEventsConfigMapRef.Name,
+	}}
+	provisioned := time.Now().Add(-time.Hour)
+	require.NoError(t, k8sutils.SetEventRecordsInConfigMap(jsEventsCM, map[string]records.EventRecords{
+		"uid-1": {UpEvents: []records.UpEvent{{Up: false, Timestamp: provisioned}}},
+	}))
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		js,
+		jsEventsCM.DeepCopy(),
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+		}},
+	).Build()
+	a := &Aggregator{
+		Client:                       cl,
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+		DryRun:                       true,
+	}
+	ctx := context.Background()
+	require.NoError(t, a.Aggregate(ctx))
+	first := a.Report()
+
+	// The JobSet comes up.
+	require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(js), js))
+	js.Status.ReplicatedJobsStatus = []jobset.ReplicatedJobStatus{{Name: "rj", Ready: 1}}
+	require.NoError(t, cl.Update(ctx, js))
+	require.NoError(t, a.Aggregate(ctx))
+
+	// The events accumulate in memory, starting from the ConfigMap.
+	events := a.Report().JobSetEvents["uid-1"].UpEvents
+	require.Len(t, events, 2)
+	require.True(t, events[0].Timestamp.Equal(provisioned))
+	require.True(t, events[1].Up)
+	require.InDelta(t, time.Hour.Seconds(), a.Report().JobSetsUpSummaries["uid-1"].DownTimeInitial.Seconds(), 5)
+	// Earlier reports are not modified.
+	require.Len(t, first.JobSetEvents["uid-1"].UpEvents, 1)
+
+	// The ConfigMaps are not written.
+	var got corev1.ConfigMap
+	require.NoError(t, cl.Get(ctx, DefaultJobSetEventsConfigMapRef, &got))
+	require.Equal(t, jsEventsCM.Data, got.Data)
+	require.NoError(t, cl.Get(ctx, DefaultJobSetNodeEventsConfigMapRef, &got))
+	require.Empty(t, got.Data)
+}
+
+func TestAggregateAcrossRestarts(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	js := &jobset.JobSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "train", UID: "uid-1"},
+		Spec: jobset.JobSetSpec{
+			ReplicatedJobs: []jobset.ReplicatedJob{{Name: "rj", Replicas: 1}},
+		},
+		Status: jobset.JobSetStatus{
+			ReplicatedJobsStatus: []jobset.ReplicatedJobStatus{{Name: "rj", Ready: 1}},
+		},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		js,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetEventsConfigMapRef.Name,
+		}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+		}},
+	).Build()
+	newAggregator := func() *Aggregator {
+		return &Aggregator{
+			Client:                       cl,
+			JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+			JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+			// Records are kept, not initialized from the observed state.
+			StartupGracePeriod: time.Hour,
+		}
+	}
+	ctx := context.Background()
+	setReady := func(ready int32) {
+		require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(js), js))
+		js.Status.ReplicatedJobsStatus[0].Ready = ready
+		require.NoError(t, cl.Update(ctx, js))
+	}
+
+	a := newAggregator()
+	require.NoError(t, a.Aggregate(ctx))
+	setReady(0)
+	require.NoError(t, a.Aggregate(ctx))
+	require.Equal(t, 1, a.Report().JobSetsUpSummaries["uid-1"].InterruptionCount)
+
+	// The events are reloaded from the ConfigMaps after a restart.
+	a = newAggregator()
+	setReady(1)
+	require.NoError(t, a.Aggregate(ctx))
+	summary := a.Report().JobSetsUpSummaries["uid-1"]
+	require.Equal(t, 1, summary.InterruptionCount)
+	require.Equal(t, 1, summary.RecoveryCount)
+	require.Len(t, a.Report().JobSetEvents["uid-1"].UpEvents, 3)
+}
+
+func TestAggregateJobSetSelector(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	newJobSet := func(name, uid string, jsLabels map[string]string) *jobset.JobSet {
+		return &jobset.JobSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(uid), Labels: jsLabels},
+			Spec: jobset.JobSetSpec{
+				ReplicatedJobs: []jobset.ReplicatedJob{{Name: "rj", Replicas: 1}},
+			},
+		}
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newJobSet("train", "uid-1", map[string]string{"team": "ml"}),
+		newJobSet("system", "uid-2", nil),
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetEventsConfigMapRef.Name,
+		}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+		}},
+	).Build()
+	selector, err := labels.Parse("team=ml")
+	require.NoError(t, err)
+	a := &Aggregator{
+		Client:                       cl,
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+		JobSetSelector:               selector,
+	}
+	ctx := context.Background()
+	require.NoError(t, a.Aggregate(ctx))
+
+	report := a.Report()
+	require.Contains(t, report.JobSetsUp, "uid-1")
+	require.NotContains(t, report.JobSetsUp, "uid-2")
+	require.NotContains(t, report.JobSetsUpSummaries, "uid-2")
+	require.NotContains(t, report.JobSetNodesUp, "uid-2")
+
+	var cm corev1.ConfigMap
+	require.NoError(t, cl.Get(ctx, DefaultJobSetEventsConfigMapRef, &cm))
+	recs, err := k8sutils.GetEventRecordsFromConfigMap(&cm)
+	require.NoError(t, err)
+	require.Contains(t, recs, "uid-1")
+	require.NotContains(t, recs, "uid-2")
+
+	_, err = a.SummaryFor(ctx, EntityKey{Kind: EntityJobSet, NamespacedName: types.NamespacedName{Namespace: "default", Name: "system"}})
+	require.ErrorContains(t, err, "not monitored")
+	_, err = a.SummaryFor(ctx, EntityKey{Kind: EntityJobSet, NamespacedName: types.NamespacedName{Namespace: "default", Name: "train"}})
+	require.NoError(t, err)
+}
+
+func TestAggregateNamespaces(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	objs := []client.Object{
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetEventsConfigMapRef.Name,
+		}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+		}},
+	}
+	for uid, ns := range map[string]string{"uid-1": "team-a", "uid-2": "team-a", "uid-3": "team-b", "uid-4": "kube-system"} {
+		objs = append(objs, &jobset.JobSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "js-" + uid, UID: types.UID(uid)},
+			Spec: jobset.JobSetSpec{
+				ReplicatedJobs: []jobset.ReplicatedJob{{Name: "rj", Replicas: 1}},
+			},
+		})
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	a := &Aggregator{
+		Client:                       cl,
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+		Namespaces:                   []string{"team-a", "team-b"},
+		NamespaceSummaries:           true,
+	}
+	ctx := context.Background()
+	require.NoError(t, a.Aggregate(ctx))
+
+	report := a.Report()
+	require.Len(t, report.JobSetsUp, 3)
+	require.NotContains(t, report.JobSetsUp, "uid-4")
+	require.Len(t, report.Namespaces, 2)
+	require.Equal(t, 2, report.Namespaces["team-a"].JobSetCount)
+	require.Equal(t, 1, report.Namespaces["team-b"].JobSetCount)
+
+	_, err := a.SummaryFor(ctx, EntityKey{Kind: EntityJobSet, NamespacedName: types.NamespacedName{Namespace: "kube-system", Name: "js-uid-4"}})
+	require.ErrorContains(t, err, "not monitored")
+}
+
+func TestAggregateNodePoolSummaries(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	t0 := time.Now().Add(-2 * time.Hour)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetEventsConfigMapRef.Name,
+		}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+		}},
+		&jobset.JobSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "js", UID: types.UID("uid-1")},
+			Spec: jobset.JobSetSpec{
+				ReplicatedJobs: []jobset.ReplicatedJob{{Name: "rj", Replicas: 1}},
+			},
+		},
+	).Build()
+	a := &Aggregator{
+		Client:                       cl,
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+		NodeEvents: staticNodePoolEvents{
+			staticNodeEvents: staticNodeEvents{
+				"node-a": {UpEvents: []records.UpEvent{
+					{Up: true, Timestamp: t0},
+					{Up: false, Timestamp: t0.Add(time.Hour)},
+				}},
+				// Not run on by a monitored JobSet, but rolled up all the same.
+				"node-b": {UpEvents: []records.UpEvent{{Up: true, Timestamp: t0}}},
+				// Without a node pool.
+				"node-c": {UpEvents: []records.UpEvent{{Up: true, Timestamp: t0}}},
+			},
+			pools: map[string]string{"node-a": "pool-1", "node-b": "pool-1", "node-c": ""},
+		},
+		NodePoolSummaries: true,
+	}
+	require.NoError(t, a.Aggregate(context.Background()))
+
+	report := a.Report()
+	require.Len(t, report.NodePools, 1)
+	pool := report.NodePools["pool-1"]
+	require.Equal(t, 2, pool.NodeCount)
+	require.Equal(t, 1, pool.Nodes.InterruptionCount)
+}
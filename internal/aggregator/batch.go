@@ -0,0 +1,106 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// BatchingExporter coalesces the reports exported within Window into a
+// single export of the latest report, for exporters that would otherwise
+// receive a burst of updates while many entities change state at once, e.g.
+// during a mass interruption. The first report after a quiet period opens the
+// window, and reports exported while it is open replace the pending report.
+//
+// Batched exports happen in the background. The Aggregator schedules them
+// with ExportDeferred so that their outcome is recorded in ExporterHealth
+// once they complete. Errors of batches scheduled with Export are logged.
+type BatchingExporter struct {
+	Exporter Exporter
+	Window   time.Duration
+	// Timeout bounds each batched export. Defaults to Window.
+	Timeout time.Duration
+
+	mtx     sync.Mutex
+	pending *records.Report
+	done    func(start time.Time, err error)
+	timer   *time.Timer
+
+	// flushMtx serializes exports of the wrapped Exporter.
+	flushMtx sync.Mutex
+}
+
+func (e *BatchingExporter) RenderProfile() records.RenderProfile {
+	if p, ok := e.Exporter.(ProfiledExporter); ok {
+		return p.RenderProfile()
+	}
+	return ""
+}
+
+// Deferred returns whether exports are batched, see DeferredExporter.
+func (e *BatchingExporter) Deferred() bool {
+	return e.Window > 0
+}
+
+func (e *BatchingExporter) Export(ctx context.Context, r records.Report) error {
+	if e.Window <= 0 {
+		e.flushMtx.Lock()
+		defer e.flushMtx.Unlock()
+		return e.Exporter.Export(ctx, r)
+	}
+	e.ExportDeferred(ctx, r, nil)
+	return nil
+}
+
+// ExportDeferred schedules the export of r at the end of the window, and
+// calls done with its outcome unless r is replaced by a later report first.
+func (e *BatchingExporter) ExportDeferred(_ context.Context, r records.Report, done func(start time.Time, err error)) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.pending = &r
+	e.done = done
+	if e.timer == nil {
+		e.timer = time.AfterFunc(e.Window, e.Flush)
+	}
+}
+
+// Flush immediately exports the pending report, if any, e.g. on shutdown.
+func (e *BatchingExporter) Flush() {
+	e.flushMtx.Lock()
+	defer e.flushMtx.Unlock()
+
+	e.mtx.Lock()
+	r, done := e.pending, e.done
+	e.pending, e.done = nil, nil
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+	e.mtx.Unlock()
+
+	if r == nil {
+		return
+	}
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = e.Window
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := e.Exporter.Export(ctx, *r)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %v: %w", timeout, err)
+	}
+	if done != nil {
+		done(start, err)
+	} else if err != nil {
+		log.FromContext(ctx).Error(err, "failed to export batch")
+	}
+}
@@ -0,0 +1,84 @@
+package aggregator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+)
+
+type chanExporter chan records.Report
+
+func (e chanExporter) Export(_ context.Context, r records.Report) error {
+	e <- r
+	return nil
+}
+
+func TestBatchingExporter(t *testing.T) {
+	t.Parallel()
+
+	exported := make(chanExporter, 10)
+	e := &BatchingExporter{Exporter: exported, Window: 50 * time.Millisecond}
+
+	t0 := time.Now()
+	for i := 0; i < 3; i++ {
+		r := records.NewReport()
+		r.Timestamp = t0.Add(time.Duration(i) * time.Second)
+		require.NoError(t, e.Export(context.Background(), r))
+	}
+
+	select {
+	case r := <-exported:
+		require.Equal(t, t0.Add(2*time.Second), r.Timestamp)
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch was not exported")
+	}
+	select {
+	case r := <-exported:
+		t.Fatalf("unexpected export of %v", r.Timestamp)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// A report after the window opens a new batch.
+	r := records.NewReport()
+	r.Timestamp = t0.Add(time.Minute)
+	require.NoError(t, e.Export(context.Background(), r))
+	select {
+	case r := <-exported:
+		require.Equal(t, t0.Add(time.Minute), r.Timestamp)
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch was not exported")
+	}
+}
+
+func TestBatchingExporterFlush(t *testing.T) {
+	t.Parallel()
+
+	exported := make(chanExporter, 10)
+	e := &BatchingExporter{Exporter: exported, Window: time.Hour}
+
+	e.Flush()
+	require.Empty(t, exported)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, e.Export(context.Background(), records.NewReport()))
+	}
+	e.Flush()
+	require.Len(t, exported, 1)
+	e.Flush()
+	require.Len(t, exported, 1)
+}
+
+func TestBatchingExporterNoWindow(t *testing.T) {
+	t.Parallel()
+
+	exported := &recordingExporter{profile: records.RenderProfileFull}
+	e := &BatchingExporter{Exporter: exported}
+	require.Equal(t, records.RenderProfileFull, e.RenderProfile())
+
+	require.NoError(t, e.Export(context.Background(), records.NewReport()))
+	require.NoError(t, e.Export(context.Background(), records.NewReport()))
+	require.Len(t, exported.reports, 2)
+}
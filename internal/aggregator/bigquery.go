@@ -0,0 +1,218 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"example.com/megamon/internal/records"
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/option"
+)
+
+// bigQueryMaxRows is the number of rows streamed per insertAll request, as
+// recommended by BigQuery.
+const bigQueryMaxRows = 500
+
+// bigQueryQueryTimeout bounds the query for the last streamed events.
+const bigQueryQueryTimeout = time.Minute
+
+// BigQueryExporter streams the individual up and down events of every JobSet
+// and JobSet Nodes into a BigQuery table with the insertAll streaming API, to
+// preserve the event granularity for long-term analysis. The table must have
+// the columns:
+//
+//	cluster STRING, kind STRING, key STRING, jobset_namespace STRING,
+//	jobset_name STRING, up BOOL, timestamp TIMESTAMP
+//
+// Only events recorded after the last streamed event of an entity are
+// streamed. Every row has an insertId derived from the event, so that rows
+// retried after a failure are deduplicated by BigQuery. Since that
+// deduplication only lasts about a minute, the last streamed event of every
+// entity of the cluster is read back from the table before the first export,
+// e.g. after a restart, which requires permission to run queries.
+type BigQueryExporter struct {
+	// Service defaults to a service using Application Default Credentials.
+	Service *bigquery.Service
+
+	Project string
+	Dataset string
+	Table   string
+
+	mtx sync.Mutex
+	// streamed is the time of the last streamed event, by bigQueryEntity,
+	// truncated to the microsecond precision of BigQuery timestamps.
+	streamed map[string]time.Time
+	// seeded is set once streamed was read from the table.
+	seeded bool
+}
+
+// RenderProfile requests the event records, which are streamed.
+func (e *BigQueryExporter) RenderProfile() records.RenderProfile {
+	return records.RenderProfileFull
+}
+
+func (e *BigQueryExporter) Export(ctx context.Context, r records.Report) error {
+	svc, err := e.service(ctx)
+	if err != nil {
+		return err
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if !e.seeded {
+		streamed, err := e.lastStreamed(ctx, svc, r.ClusterName)
+		if err != nil {
+			return fmt.Errorf("reading the last streamed events from %s.%s.%s: %w", e.Project, e.Dataset, e.Table, err)
+		}
+		e.streamed, e.seeded = streamed, true
+	}
+
+	var rows []*bigquery.TableDataInsertAllRequestRows
+	streamed := make(map[string]time.Time, len(e.streamed))
+	for _, layer := range []struct {
+		kind   records.Kind
+		events map[string]records.EventRecords
+		ups    map[string]records.Upness
+	}{
+		{records.KindJobSet, r.JobSetEvents, r.JobSetsUp},
+		{records.KindJobSetNodes, r.JobSetNodeEvents, r.JobSetNodesUp},
+	} {
+		keys := make([]string, 0, len(layer.events))
+		for key := range layer.events {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			entity := bigQueryEntity(layer.kind, key)
+			last, ok := e.streamed[entity]
+			attrs := layer.ups[key].Attrs
+			for _, ev := range layer.events[key].UpEvents {
+				at := ev.Timestamp.Truncate(time.Microsecond)
+				if ok && !at.After(last) {
+					continue
+				}
+				rows = append(rows, &bigquery.TableDataInsertAllRequestRows{
+					InsertId: entity + "/" + strconv.FormatInt(ev.Timestamp.UnixNano(), 10) + "/" + strconv.FormatBool(ev.Up),
+					Json: map[string]bigquery.JsonValue{
+						"cluster":          r.ClusterName,
+						"kind":             string(layer.kind),
+						"key":              key,
+						"jobset_namespace": attrs.JobSetNamespace,
+						"jobset_name":      attrs.JobSetName,
+						"up":               ev.Up,
+						"timestamp":        ev.Timestamp.UTC().Format(time.RFC3339Nano),
+					},
+				})
+				last, ok = at, true
+			}
+			if ok {
+				streamed[entity] = last
+			}
+		}
+	}
+
+	for start := 0; start < len(rows); start += bigQueryMaxRows {
+		batch := rows[start:min(start+bigQueryMaxRows, len(rows))]
+		resp, err := svc.Tabledata.InsertAll(e.Project, e.Dataset, e.Table, &bigquery.TableDataInsertAllRequest{
+			Rows: batch,
+		}).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("streaming events to %s.%s.%s: %w", e.Project, e.Dataset, e.Table, err)
+		}
+		if len(resp.InsertErrors) > 0 {
+			return fmt.Errorf("streaming events to %s.%s.%s: %w", e.Project, e.Dataset, e.Table, insertErrors(resp.InsertErrors))
+		}
+	}
+
+	// Only advance once all rows were inserted, so that failed rows are
+	// retried with the next report. Deleted entities are forgotten.
+	e.streamed = streamed
+	return nil
+}
+
+// lastStreamed queries the time of the last streamed event of every entity
+// of the cluster, by bigQueryEntity.
+func (e *BigQueryExporter) lastStreamed(ctx context.Context, svc *bigquery.Service, cluster string) (map[string]time.Time, error) {
+	useLegacySQL := false
+	resp, err := svc.Jobs.Query(e.Project, &bigquery.QueryRequest{
+		Query: fmt.Sprintf("SELECT kind, key, UNIX_MICROS(MAX(timestamp)) FROM `%s.%s.%s` WHERE cluster = @cluster GROUP BY kind, key",
+			e.Project, e.Dataset, e.Table),
+		UseLegacySql:  &useLegacySQL,
+		ParameterMode: "NAMED",
+		QueryParameters: []*bigquery.QueryParameter{{
+			Name:           "cluster",
+			ParameterType:  &bigquery.QueryParameterType{Type: "STRING"},
+			ParameterValue: &bigquery.QueryParameterValue{Value: cluster},
+		}},
+		TimeoutMs: bigQueryQueryTimeout.Milliseconds(),
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	if !resp.JobComplete {
+		return nil, fmt.Errorf("query did not complete within %v", bigQueryQueryTimeout)
+	}
+
+	streamed := map[string]time.Time{}
+	rows, pageToken := resp.Rows, resp.PageToken
+	for {
+		for _, row := range rows {
+			if len(row.F) != 3 {
+				return nil, fmt.Errorf("unexpected row with %d columns", len(row.F))
+			}
+			kind, _ := row.F[0].V.(string)
+			key, _ := row.F[1].V.(string)
+			// INT64 values are returned as strings.
+			micros, _ := row.F[2].V.(string)
+			last, err := strconv.ParseInt(micros, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parsing last timestamp of %s/%s: %w", kind, key, err)
+			}
+			streamed[bigQueryEntity(records.Kind(kind), key)] = time.UnixMicro(last).UTC()
+		}
+		if pageToken == "" || resp.JobReference == nil {
+			return streamed, nil
+		}
+		page, err := svc.Jobs.GetQueryResults(e.Project, resp.JobReference.JobId).
+			Location(resp.JobReference.Location).PageToken(pageToken).Context(ctx).Do()
+		if err != nil {
+			return nil, err
+		}
+		rows, pageToken = page.Rows, page.PageToken
+	}
+}
+
+func (e *BigQueryExporter) service(ctx context.Context) (*bigquery.Service, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if e.Service == nil {
+		svc, err := bigquery.NewService(ctx, option.WithScopes(bigquery.BigqueryScope))
+		if err != nil {
+			return nil, fmt.Errorf("creating bigquery service: %w", err)
+		}
+		e.Service = svc
+	}
+	return e.Service, nil
+}
+
+func bigQueryEntity(kind records.Kind, key string) string {
+	return string(kind) + "/" + key
+}
+
+func insertErrors(errs []*bigquery.TableDataInsertAllResponseInsertErrors) error {
+	var joined []error
+	for _, rowErr := range errs {
+		if len(rowErr.Errors) == 0 {
+			joined = append(joined, fmt.Errorf("row %d failed", rowErr.Index))
+		}
+		for _, err := range rowErr.Errors {
+			joined = append(joined, fmt.Errorf("row %d: %s: %s", rowErr.Index, err.Reason, err.Message))
+		}
+	}
+	return errors.Join(joined...)
+}
@@ -0,0 +1,173 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/option"
+)
+
+// fakeBigQuery serves the insertAll streaming API used by BigQueryExporter,
+// and the query for the last streamed events.
+type fakeBigQuery struct {
+	mtx sync.Mutex
+	// rows are the inserted rows by insertId.
+	rows     map[string]map[string]any
+	requests int
+	queries  int
+	// fail makes the next request report an insert error.
+	fail bool
+}
+
+func (f *fakeBigQuery) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if r.Method == http.MethodPost && r.URL.Path == "/bigquery/v2/projects/proj/queries" {
+		f.query(w, r)
+		return
+	}
+	if r.Method != http.MethodPost || r.URL.Path != "/bigquery/v2/projects/proj/datasets/ds/tables/events/insertAll" {
+		http.Error(w, "unexpected request "+r.Method+" "+r.URL.String(), http.StatusNotImplemented)
+		return
+	}
+	var req struct {
+		Rows []struct {
+			InsertID string         `json:"insertId"`
+			JSON     map[string]any `json:"json"`
+		} `json:"rows"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.requests++
+	if f.fail {
+		f.fail = false
+		json.NewEncoder(w).Encode(bigquery.TableDataInsertAllResponse{
+			InsertErrors: []*bigquery.TableDataInsertAllResponseInsertErrors{{
+				Index:  0,
+				Errors: []*bigquery.ErrorProto{{Reason: "invalid", Message: "no such field"}},
+			}},
+		})
+		return
+	}
+	for _, row := range req.Rows {
+		f.rows[row.InsertID] = row.JSON
+	}
+	json.NewEncoder(w).Encode(bigquery.TableDataInsertAllResponse{})
+}
+
+// query returns the last timestamp of the rows of the requested cluster by
+// kind and key.
+func (f *fakeBigQuery) query(w http.ResponseWriter, r *http.Request) {
+	var req bigquery.QueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.queries++
+	last := map[[2]string]time.Time{}
+	for _, row := range f.rows {
+		if row["cluster"] != req.QueryParameters[0].ParameterValue.Value {
+			continue
+		}
+		ts, err := time.Parse(time.RFC3339Nano, row["timestamp"].(string))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entity := [2]string{row["kind"].(string), row["key"].(string)}
+		if ts.After(last[entity]) {
+			last[entity] = ts
+		}
+	}
+	resp := bigquery.QueryResponse{JobComplete: true}
+	for entity, ts := range last {
+		resp.Rows = append(resp.Rows, &bigquery.TableRow{F: []*bigquery.TableCell{
+			{V: entity[0]}, {V: entity[1]}, {V: strconv.FormatInt(ts.UnixMicro(), 10)},
+		}})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestBigQueryExporter(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	require.NoError(t, err)
+	f := &fakeBigQuery{rows: map[string]map[string]any{}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	svc, err := bigquery.NewService(context.Background(),
+		option.WithEndpoint(srv.URL+"/bigquery/v2/"),
+		option.WithoutAuthentication(),
+		option.WithHTTPClient(srv.Client()),
+	)
+	require.NoError(t, err)
+	e := &BigQueryExporter{Service: svc, Project: "proj", Dataset: "ds", Table: "events"}
+	require.Equal(t, records.RenderProfileFull, e.RenderProfile())
+
+	report := records.NewReport()
+	report.ClusterName = "cluster"
+	report.JobSetsUp["uid"] = records.Upness{Attrs: records.Attrs{Kind: records.KindJobSet, JobSetNamespace: "ns", JobSetName: "js"}}
+	report.JobSetNodesUp["uid"] = records.Upness{Attrs: records.Attrs{Kind: records.KindJobSetNodes, JobSetNamespace: "ns", JobSetName: "js"}}
+	report.JobSetEvents = map[string]records.EventRecords{"uid": {UpEvents: []records.UpEvent{
+		{Up: false, Timestamp: t0},
+		{Up: true, Timestamp: t0.Add(time.Minute)},
+	}}}
+	report.JobSetNodeEvents = map[string]records.EventRecords{"uid": {UpEvents: []records.UpEvent{
+		{Up: false, Timestamp: t0},
+	}}}
+	require.NoError(t, e.Export(context.Background(), report))
+	require.Len(t, f.rows, 3)
+	require.Equal(t, map[string]any{
+		"cluster":          "cluster",
+		"kind":             "jobset",
+		"key":              "uid",
+		"jobset_namespace": "ns",
+		"jobset_name":      "js",
+		"up":               true,
+		"timestamp":        "2021-01-01T00:01:00Z",
+	}, f.rows["jobset/uid/1609459260000000000/true"])
+
+	// Events that were already streamed are not streamed again, nor are
+	// empty requests sent.
+	require.NoError(t, e.Export(context.Background(), report))
+	require.Equal(t, 1, f.requests)
+
+	// Failed rows are retried with the next report.
+	report.JobSetEvents["uid"] = records.EventRecords{UpEvents: append(report.JobSetEvents["uid"].UpEvents,
+		records.UpEvent{Up: false, Timestamp: t0.Add(2 * time.Minute)},
+	)}
+	f.fail = true
+	require.ErrorContains(t, e.Export(context.Background(), report), "no such field")
+	require.Len(t, f.rows, 3)
+	require.NoError(t, e.Export(context.Background(), report))
+	require.Len(t, f.rows, 4)
+	require.Equal(t, false, f.rows["jobset/uid/1609459320000000000/false"]["up"])
+	require.Equal(t, 3, f.requests)
+	require.Equal(t, 1, f.queries)
+
+	// After a restart, the events streamed before are not streamed again.
+	e = &BigQueryExporter{Service: svc, Project: "proj", Dataset: "ds", Table: "events"}
+	require.NoError(t, e.Export(context.Background(), report))
+	require.Equal(t, 2, f.queries)
+	require.Equal(t, 3, f.requests)
+	report.JobSetNodeEvents["uid"] = records.EventRecords{UpEvents: append(report.JobSetNodeEvents["uid"].UpEvents,
+		records.UpEvent{Up: true, Timestamp: t0.Add(3 * time.Minute)},
+	)}
+	require.NoError(t, e.Export(context.Background(), report))
+	require.Len(t, f.rows, 5)
+	require.Equal(t, true, f.rows["jobset-nodes/uid/1609459380000000000/true"]["up"])
+	require.Equal(t, 4, f.requests)
+	require.Equal(t, 2, f.queries)
+}
@@ -0,0 +1,233 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"example.com/megamon/internal/records"
+	monitoring "google.golang.org/api/monitoring/v3"
+	"google.golang.org/api/option"
+)
+
+const (
+	// CloudMonitoringMinWriteInterval is the minimum time between points of
+	// a time series accepted by Cloud Monitoring, resources exported more
+	// often are skipped.
+	CloudMonitoringMinWriteInterval = 10 * time.Second
+
+	// DefaultCloudMonitoringMetricPrefix is the default prefix of the
+	// metric types written to Cloud Monitoring.
+	DefaultCloudMonitoringMetricPrefix = "custom.googleapis.com/megamon"
+
+	// cloudMonitoringMaxTimeSeries is the maximum number of time series per
+	// CreateTimeSeries request, each with a single point.
+	cloudMonitoringMaxTimeSeries = 200
+)
+
+// CloudMonitoringExporter writes the summary gauges of every JobSet and JobSet
+// Nodes as custom metrics to Google Cloud Monitoring, e.g.
+// custom.googleapis.com/megamon/jobset/availability, as an alternative to
+// scraping the Prometheus endpoint. Every entity is written as a generic_task
+// resource with the JobSet namespace and name as namespace and job, and the
+// kind (jobset or jobset_nodes) as task_id. Like BigQueryExporter it uses the
+// REST client of google.golang.org/api.
+type CloudMonitoringExporter struct {
+	// Service defaults to a service using Application Default Credentials.
+	Service *monitoring.Service
+
+	// Project defaults to the project of the metadata server.
+	Project string
+	// Location is the location label of the resources, defaults to
+	// "global".
+	Location string
+	// MetricPrefix defaults to DefaultCloudMonitoringMetricPrefix.
+	MetricPrefix string
+
+	mtx sync.Mutex
+	// lastWritten is the time each resource was last written at, so that a
+	// write that failed partway through does not rewrite the resources
+	// written before the failure within the minimum write interval.
+	lastWritten map[string]time.Time
+}
+
+func (e *CloudMonitoringExporter) RenderProfile() records.RenderProfile {
+	return records.RenderProfileSummary
+}
+
+func (e *CloudMonitoringExporter) Export(ctx context.Context, r records.Report) error {
+	svc, project, err := e.service(ctx)
+	if err != nil {
+		return err
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	now := reportTime(r)
+
+	// Time series are grouped per resource, i.e. per entity.
+	type batch struct {
+		resource string
+		series   []*monitoring.TimeSeries
+	}
+	var batches []batch
+	for _, layer := range []struct {
+		kind      records.Kind
+		summaries map[string]records.UpnessSummaryWithAttrs
+		ups       map[string]records.Upness
+	}{
+		{records.KindJobSet, r.JobSetsUpSummaries, r.JobSetsUp},
+		{records.KindJobSetNodes, r.JobSetNodesUpSummaries, r.JobSetNodesUp},
+	} {
+		keys := make([]string, 0, len(layer.summaries))
+		for key := range layer.summaries {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			up, ok := layer.ups[key]
+			var upPtr *records.Upness
+			if ok {
+				upPtr = &up
+			}
+			batches = append(batches, batch{
+				resource: string(layer.kind) + "/" + key,
+				series:   e.timeSeries(project, r.ClusterName, layer.kind, layer.summaries[key], upPtr, now),
+			})
+		}
+	}
+
+	// Forget the resources that are gone.
+	lastWritten := make(map[string]time.Time, len(batches))
+	for _, b := range batches {
+		if t, ok := e.lastWritten[b.resource]; ok {
+			lastWritten[b.resource] = t
+		}
+	}
+	e.lastWritten = lastWritten
+
+	// Due resources are written in as few requests as possible, without
+	// splitting a resource across requests so that it is either written or
+	// retried as a whole.
+	name := "projects/" + project
+	var series []*monitoring.TimeSeries
+	var resources []string
+	write := func() error {
+		if len(series) == 0 {
+			return nil
+		}
+		_, err := svc.Projects.TimeSeries.Create(name, &monitoring.CreateTimeSeriesRequest{TimeSeries: series}).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("writing time series to %s: %w", name, err)
+		}
+		for _, resource := range resources {
+			e.lastWritten[resource] = now
+		}
+		series, resources = nil, nil
+		return nil
+	}
+	for _, b := range batches {
+		if t, ok := e.lastWritten[b.resource]; ok && now.Sub(t) < CloudMonitoringMinWriteInterval {
+			continue
+		}
+		if len(series)+len(b.series) > cloudMonitoringMaxTimeSeries {
+			if err := write(); err != nil {
+				return err
+			}
+		}
+		series = append(series, b.series...)
+		resources = append(resources, b.resource)
+	}
+	return write()
+}
+
+// timeSeries returns the gauges of an entity, without up if its upness (up)
+// is unknown.
+func (e *CloudMonitoringExporter) timeSeries(project, cluster string, kind records.Kind, summary records.UpnessSummaryWithAttrs, up *records.Upness, now time.Time) []*monitoring.TimeSeries {
+	location := e.Location
+	if location == "" {
+		location = "global"
+	}
+	prefix := e.MetricPrefix
+	if prefix == "" {
+		prefix = DefaultCloudMonitoringMetricPrefix
+	}
+	// Metric types may not contain hyphens.
+	kindName := strings.ReplaceAll(string(kind), "-", "_")
+	resource := &monitoring.MonitoredResource{
+		Type: "generic_task",
+		Labels: map[string]string{
+			"project_id": project,
+			"location":   location,
+			"namespace":  summary.JobSetNamespace,
+			"job":        summary.JobSetName,
+			"task_id":    kindName,
+		},
+	}
+	interval := &monitoring.TimeInterval{EndTime: now.UTC().Format(time.RFC3339Nano)}
+	series := func(name string, value *monitoring.TypedValue) *monitoring.TimeSeries {
+		return &monitoring.TimeSeries{
+			Metric: &monitoring.Metric{
+				Type:   prefix + "/" + kindName + "/" + name,
+				Labels: map[string]string{"cluster": cluster},
+			},
+			Resource:   resource,
+			MetricKind: "GAUGE",
+			Points:     []*monitoring.Point{{Interval: interval, Value: value}},
+		}
+	}
+	int64Value := func(v int64) *monitoring.TypedValue {
+		return &monitoring.TypedValue{Int64Value: &v}
+	}
+	doubleValue := func(v float64) *monitoring.TypedValue {
+		return &monitoring.TypedValue{DoubleValue: &v}
+	}
+
+	ts := []*monitoring.TimeSeries{
+		series("availability", doubleValue(summary.Availability)),
+		series("up_time", doubleValue(summary.UpTime.Seconds())),
+		series("down_time", doubleValue(summary.DownTime.Seconds())),
+		series("provisioning", doubleValue(summary.DownTimeInitial.Seconds())),
+		series("interruptions", int64Value(int64(summary.InterruptionCount))),
+		series("recoveries", int64Value(int64(summary.RecoveryCount))),
+		series("mtbf", doubleValue(summary.MeanUpTimeBetweenInterruption.Seconds())),
+		series("mttr", doubleValue(summary.MeanDownTimeBetweenRecovery.Seconds())),
+		series("at_risk", int64Value(boolToInt64(summary.AtRisk))),
+		series("provisioning_stuck", int64Value(boolToInt64(summary.ProvisioningStuck))),
+	}
+	if up != nil {
+		ts = append(ts, series("up", int64Value(boolToInt64(up.Up()))))
+	}
+	return ts
+}
+
+func (e *CloudMonitoringExporter) service(ctx context.Context) (*monitoring.Service, string, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if e.Project == "" {
+		project, err := metadata.ProjectIDWithContext(ctx)
+		if err != nil {
+			return nil, "", fmt.Errorf("detecting cloud monitoring project: %w", err)
+		}
+		e.Project = project
+	}
+	if e.Service == nil {
+		svc, err := monitoring.NewService(ctx, option.WithScopes(monitoring.MonitoringWriteScope))
+		if err != nil {
+			return nil, "", fmt.Errorf("creating cloud monitoring service: %w", err)
+		}
+		e.Service = svc
+	}
+	return e.Service, e.Project, nil
+}
+
+func boolToInt64(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
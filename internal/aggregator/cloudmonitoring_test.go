@@ -0,0 +1,154 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+	monitoring "google.golang.org/api/monitoring/v3"
+	"google.golang.org/api/option"
+)
+
+// fakeCloudMonitoring serves the CreateTimeSeries API used by
+// CloudMonitoringExporter.
+type fakeCloudMonitoring struct {
+	mtx sync.Mutex
+	// requests are the time series of each request.
+	requests [][]*monitoring.TimeSeries
+	// failAfter, if positive, makes the request after this many requests
+	// fail.
+	failAfter int
+}
+
+func (f *fakeCloudMonitoring) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if r.Method != http.MethodPost || r.URL.Path != "/v3/projects/proj/timeSeries" {
+		http.Error(w, "unexpected request "+r.Method+" "+r.URL.String(), http.StatusNotImplemented)
+		return
+	}
+	var req monitoring.CreateTimeSeriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if f.failAfter > 0 && len(f.requests) == f.failAfter {
+		f.failAfter = 0
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+		return
+	}
+	f.requests = append(f.requests, req.TimeSeries)
+	json.NewEncoder(w).Encode(monitoring.Empty{})
+}
+
+func TestCloudMonitoringExporter(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	require.NoError(t, err)
+	f := &fakeCloudMonitoring{}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	svc, err := monitoring.NewService(context.Background(),
+		option.WithEndpoint(srv.URL+"/"),
+		option.WithoutAuthentication(),
+		option.WithHTTPClient(srv.Client()),
+	)
+	require.NoError(t, err)
+	e := &CloudMonitoringExporter{Service: svc, Project: "proj"}
+
+	report := records.NewReport()
+	report.Timestamp = t0
+	report.ClusterName = "cluster"
+	attrs := records.Attrs{JobSetNamespace: "ns", JobSetName: "js"}
+	report.JobSetsUp["uid"] = records.Upness{Attrs: attrs, ExpectedCount: 1, ReadyCount: 1}
+	report.JobSetsUpSummaries["uid"] = records.UpnessSummaryWithAttrs{Attrs: attrs, EventSummary: records.EventSummary{
+		Availability:      0.5,
+		InterruptionCount: 2,
+	}}
+	report.JobSetNodesUpSummaries["uid"] = records.UpnessSummaryWithAttrs{Attrs: attrs}
+	require.NoError(t, e.Export(context.Background(), report))
+
+	// The resources share a request.
+	require.Len(t, f.requests, 1)
+	require.Len(t, f.requests[0], 21)
+	byType := map[string]*monitoring.TimeSeries{}
+	for _, ts := range f.requests[0][:11] {
+		require.Equal(t, map[string]string{
+			"project_id": "proj",
+			"location":   "global",
+			"namespace":  "ns",
+			"job":        "js",
+			"task_id":    "jobset",
+		}, ts.Resource.Labels)
+		require.Equal(t, "cluster", ts.Metric.Labels["cluster"])
+		require.Len(t, ts.Points, 1)
+		require.Equal(t, "2021-01-01T00:00:00Z", ts.Points[0].Interval.EndTime)
+		byType[ts.Metric.Type] = ts
+	}
+	require.Equal(t, int64(1), *byType["custom.googleapis.com/megamon/jobset/up"].Points[0].Value.Int64Value)
+	require.Equal(t, 0.5, *byType["custom.googleapis.com/megamon/jobset/availability"].Points[0].Value.DoubleValue)
+	require.Equal(t, int64(2), *byType["custom.googleapis.com/megamon/jobset/interruptions"].Points[0].Value.Int64Value)
+	require.Equal(t, "jobset_nodes", f.requests[0][11].Resource.Labels["task_id"])
+
+	// Reports within the minimum write interval are skipped.
+	report.Timestamp = t0.Add(CloudMonitoringMinWriteInterval - time.Second)
+	require.NoError(t, e.Export(context.Background(), report))
+	require.Len(t, f.requests, 1)
+}
+
+func TestCloudMonitoringExporterBatches(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	require.NoError(t, err)
+	f := &fakeCloudMonitoring{}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	svc, err := monitoring.NewService(context.Background(),
+		option.WithEndpoint(srv.URL+"/"),
+		option.WithoutAuthentication(),
+		option.WithHTTPClient(srv.Client()),
+	)
+	require.NoError(t, err)
+	e := &CloudMonitoringExporter{Service: svc, Project: "proj"}
+
+	// 20 JobSets with 11 time series each and their Nodes with 10 each.
+	report := records.NewReport()
+	report.Timestamp = t0
+	for i := 0; i < 20; i++ {
+		uid := fmt.Sprintf("uid-%02d", i)
+		attrs := records.Attrs{JobSetNamespace: "ns", JobSetName: "js-" + uid}
+		report.JobSetsUp[uid] = records.Upness{Attrs: attrs, ExpectedCount: 1, ReadyCount: 1}
+		report.JobSetsUpSummaries[uid] = records.UpnessSummaryWithAttrs{Attrs: attrs}
+		report.JobSetNodesUpSummaries[uid] = records.UpnessSummaryWithAttrs{Attrs: attrs}
+	}
+	sizes := func(requests [][]*monitoring.TimeSeries) []int {
+		var sizes []int
+		for _, series := range requests {
+			sizes = append(sizes, len(series))
+		}
+		return sizes
+	}
+	require.NoError(t, e.Export(context.Background(), report))
+	// 18 JobSets, then 2 JobSets and 17 Nodes, then 3 Nodes, without
+	// splitting a resource.
+	require.Equal(t, []int{198, 192, 30}, sizes(f.requests))
+
+	// Failed writes are retried with the next report, without rewriting the
+	// resources written before the failure within the minimum interval.
+	report.Timestamp = t0.Add(CloudMonitoringMinWriteInterval)
+	f.failAfter = 4
+	require.ErrorContains(t, e.Export(context.Background(), report), "quota exceeded")
+	require.Equal(t, []int{198}, sizes(f.requests[3:]))
+	report.Timestamp = t0.Add(CloudMonitoringMinWriteInterval + time.Second)
+	require.NoError(t, e.Export(context.Background(), report))
+	require.Equal(t, []int{198, 192, 30}, sizes(f.requests[3:]))
+}
@@ -1,44 +1,374 @@
 package aggregator
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"example.com/megamon/internal/k8sutils"
 	"example.com/megamon/internal/records"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
 )
 
-type StdoutExporter struct{}
+type StdoutExporter struct {
+	Profile records.RenderProfile
+
+	// Format is the output format, defaults to StdoutFormatText.
+	Format StdoutFormat
+
+	// Dedupe only prints reports whose state changed since the last printed
+	// one (see stateHash), to keep steady-state logs quiet.
+	Dedupe bool
+	// Heartbeat, if set with Dedupe, prints a heartbeat line with the hash
+	// of the unchanged report at most this often, to show liveness.
+	Heartbeat time.Duration
+
+	mtx         sync.Mutex
+	lastHash    string
+	lastPrinted time.Time
+
+	// out and now are overridden in tests.
+	out io.Writer
+	now func() time.Time
+}
+
+// StdoutFormat is the output format of the StdoutExporter.
+type StdoutFormat string
+
+const (
+	// StdoutFormatText prints each report as a single line of JSON.
+	StdoutFormatText StdoutFormat = "text"
+	// StdoutFormatJSONL prints one line of JSON per entity (see
+	// stdoutEntity), for log pipelines such as Fluentd or Cloud Logging
+	// that parse each line as a separate record.
+	StdoutFormatJSONL StdoutFormat = "jsonl"
+)
+
+// ParseStdoutFormat parses a StdoutFormat, where empty is StdoutFormatText.
+func ParseStdoutFormat(s string) (StdoutFormat, error) {
+	switch f := StdoutFormat(s); f {
+	case "", StdoutFormatText:
+		return StdoutFormatText, nil
+	case StdoutFormatJSONL:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid stdout format %q, expected %q or %q", s, StdoutFormatText, StdoutFormatJSONL)
+	}
+}
+
+// stdoutEntity is a line printed by the StdoutExporter for each entity in
+// StdoutFormatJSONL.
+type stdoutEntity struct {
+	Timestamp   time.Time `json:"timestamp"`
+	ClusterName string    `json:"clusterName,omitempty"`
+	Key         string    `json:"key"`
+	Up          bool      `json:"up"`
+	records.UpnessSummaryWithAttrs
+}
+
+// stdoutHeartbeat is printed by the StdoutExporter in place of unchanged
+// reports.
+type stdoutHeartbeat struct {
+	Heartbeat  time.Time `json:"heartbeat"`
+	ReportHash string    `json:"reportHash"`
+}
+
+// stateHash hashes the state of the entities in the report, i.e. their
+// upness and event counts, but not the durations derived from it, which
+// change every interval. Any transition changes the event counts, so a
+// changed state is always detected.
+func stateHash(r records.Report) (string, error) {
+	eventCounts := func(events map[string]records.EventRecords) map[string]int {
+		counts := make(map[string]int, len(events))
+		for key, rec := range events {
+			counts[key] = rec.EventCount()
+		}
+		return counts
+	}
+	jsn, err := json.Marshal(struct {
+		JobSetsUp             map[string]records.Upness `json:"jobSetsUp"`
+		JobSetNodesUp         map[string]records.Upness `json:"jobSetNodesUp"`
+		JobSetEventCounts     map[string]int            `json:"jobSetEventCounts"`
+		JobSetNodeEventCounts map[string]int            `json:"jobSetNodeEventCounts"`
+		Fleet                 records.FleetSummary      `json:"fleet"`
+	}{r.JobSetsUp, r.JobSetNodesUp, eventCounts(r.JobSetEvents), eventCounts(r.JobSetNodeEvents), r.Fleet})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(jsn)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (e *StdoutExporter) RenderProfile() records.RenderProfile {
+	return e.Profile
+}
 
 func (e *StdoutExporter) Export(_ context.Context, r records.Report) error {
-	return json.NewEncoder(os.Stdout).Encode(r)
+	out := e.out
+	if out == nil {
+		out = os.Stdout
+	}
+	if !e.Dedupe {
+		return e.print(out, r)
+	}
+
+	now := time.Now()
+	if e.now != nil {
+		now = e.now()
+	}
+	hash, err := stateHash(r)
+	if err != nil {
+		return err
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if hash != e.lastHash {
+		if err := e.print(out, r); err != nil {
+			return err
+		}
+		e.lastHash = hash
+		e.lastPrinted = now
+		return nil
+	}
+	if e.Heartbeat > 0 && now.Sub(e.lastPrinted) >= e.Heartbeat {
+		if err := json.NewEncoder(out).Encode(stdoutHeartbeat{Heartbeat: now, ReportHash: hash}); err != nil {
+			return err
+		}
+		e.lastPrinted = now
+	}
+	return nil
+}
+
+// print prints the report in the exporter's Format.
+func (e *StdoutExporter) print(out io.Writer, r records.Report) error {
+	if e.Format != StdoutFormatJSONL {
+		return json.NewEncoder(out).Encode(r)
+	}
+
+	ts := reportTime(r)
+	var lines []stdoutEntity
+	for _, layer := range []struct {
+		kind      records.Kind
+		ups       map[string]records.Upness
+		summaries map[string]records.UpnessSummaryWithAttrs
+	}{
+		{records.KindJobSet, r.JobSetsUp, r.JobSetsUpSummaries},
+		{records.KindJobSetNodes, r.JobSetNodesUp, r.JobSetNodesUpSummaries},
+		{records.KindJob, r.JobsUp, r.JobsUpSummaries},
+	} {
+		keys := make([]string, 0, len(layer.summaries))
+		for key := range layer.summaries {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			summary := layer.summaries[key]
+			if summary.Kind == "" {
+				summary.Kind = layer.kind
+			}
+			lines = append(lines, stdoutEntity{
+				Timestamp:              ts,
+				ClusterName:            r.ClusterName,
+				Key:                    key,
+				Up:                     layer.ups[key].Up(),
+				UpnessSummaryWithAttrs: summary,
+			})
+		}
+	}
+
+	// Write all lines at once, so that lines of concurrent writers to
+	// stdout do not interleave.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, line := range lines {
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	_, err := out.Write(buf.Bytes())
+	return err
 }
 
+// ConfigMapExporter writes the report to Key of the ConfigMap Ref. Several
+// exporters may share a ConfigMap with different keys, e.g. to write a
+// summary and a full report: every export only updates its own key, and is
+// retried on conflicting writes.
 type ConfigMapExporter struct {
-	Ref types.NamespacedName
-	Key string
+	Ref     types.NamespacedName
+	Key     string
+	Profile records.RenderProfile
+	// Compress stores the report gzip compressed, for clusters whose reports
+	// approach the ConfigMap size limit (see
+	// k8sutils.SetReportJSONInConfigMap).
+	Compress bool
 	client.Client
 }
 
+func (e *ConfigMapExporter) RenderProfile() records.RenderProfile {
+	return e.Profile
+}
+
 func (e *ConfigMapExporter) Export(ctx context.Context, r records.Report) error {
-	cm := &corev1.ConfigMap{}
-	if err := e.Get(ctx, e.Ref, cm); err != nil {
-		return err
-	}
-	if cm.Data == nil {
-		cm.Data = make(map[string]string)
-	}
+	r.SchemaVersion = records.ReportSchemaVersion
 	jsn, err := json.Marshal(r)
 	if err != nil {
 		return err
 	}
-	cm.Data[e.Key] = string(jsn)
-	if err := e.Update(ctx, cm); err != nil {
-		return err
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm := &corev1.ConfigMap{}
+		if err := e.Get(ctx, e.Ref, cm); err != nil {
+			return err
+		}
+		// During rolling upgrades, an older megamon must not replace the
+		// report of a newer one with a shape its consumers may not parse.
+		if data, err := k8sutils.GetReportJSONFromConfigMap(cm, e.Key); err == nil {
+			var existing struct {
+				SchemaVersion int `json:"schemaVersion"`
+			}
+			if err := json.Unmarshal(data, &existing); err == nil && existing.SchemaVersion > records.ReportSchemaVersion {
+				return fmt.Errorf("refusing to overwrite report with schema version %d, newer than %d", existing.SchemaVersion, records.ReportSchemaVersion)
+			}
+		}
+		if err := k8sutils.SetReportJSONInConfigMap(cm, e.Key, jsn, e.Compress); err != nil {
+			return err
+		}
+		return e.Update(ctx, cm)
+	})
+}
+
+// maxRecentInterruptionsAnnotationSize bounds the size of the
+// k8sutils.JobSetRecentInterruptionsAnnotation value, well below the 256KiB
+// limit on the total size of an object's annotations.
+const maxRecentInterruptionsAnnotationSize = 512
+
+// JobSetAnnotationExporter annotates each JobSet with its availability (see
+// k8sutils.JobSetAvailabilityAnnotation) for at-a-glance status.
+type JobSetAnnotationExporter struct {
+	client.Client
+
+	// MinInterval is the minimum time between updates of a single JobSet.
+	MinInterval time.Duration
+
+	// RecentInterruptions, if set, additionally annotates each JobSet with
+	// the timestamps of up to this many of its most recent interruptions
+	// (see k8sutils.JobSetRecentInterruptionsAnnotation).
+	RecentInterruptions int
+
+	// lastUpdate holds the last update time by JobSet UID. Only accessed from
+	// Export, which is not called concurrently.
+	lastUpdate map[string]time.Time
+}
+
+// RenderProfile requests the event records when recent interruptions are
+// annotated.
+func (e *JobSetAnnotationExporter) RenderProfile() records.RenderProfile {
+	if e.RecentInterruptions > 0 {
+		return records.RenderProfileFull
 	}
+	return records.RenderProfileSummary
+}
 
-	return nil
+func (e *JobSetAnnotationExporter) Export(ctx context.Context, r records.Report) error {
+	now := reportTime(r)
+	lastUpdate := make(map[string]time.Time, len(r.JobSetsUpSummaries))
+
+	var errs []error
+	for uid, summary := range r.JobSetsUpSummaries {
+		last, ok := e.lastUpdate[uid]
+		if ok {
+			lastUpdate[uid] = last
+			if now.Sub(last) < e.MinInterval {
+				continue
+			}
+		}
+
+		var js jobset.JobSet
+		if err := e.Get(ctx, types.NamespacedName{Namespace: summary.JobSetNamespace, Name: summary.JobSetName}, &js); err != nil {
+			if !apierrors.IsNotFound(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if string(js.UID) != uid {
+			// Recreated under the same name.
+			continue
+		}
+
+		want := map[string]string{
+			k8sutils.JobSetAvailabilityAnnotation: strconv.FormatFloat(summary.Availability, 'f', 4, 64),
+		}
+		if e.RecentInterruptions > 0 {
+			rec := r.JobSetEvents[uid]
+			want[k8sutils.JobSetRecentInterruptionsAnnotation] = formatRecentInterruptions(rec.RecentInterruptions(e.RecentInterruptions))
+		}
+		changed := false
+		for k, v := range want {
+			if js.Annotations[k] != v {
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		patch := client.MergeFrom(js.DeepCopy())
+		if js.Annotations == nil {
+			js.Annotations = map[string]string{}
+		}
+		for k, v := range want {
+			js.Annotations[k] = v
+		}
+		if err := e.Patch(ctx, &js, patch); err != nil {
+			errs = append(errs, fmt.Errorf("annotating jobset %s/%s: %w", js.Namespace, js.Name, err))
+			continue
+		}
+		lastUpdate[uid] = now
+	}
+	e.lastUpdate = lastUpdate
+
+	return errors.Join(errs...)
+}
+
+// formatRecentInterruptions formats interruption times for the
+// k8sutils.JobSetRecentInterruptionsAnnotation, dropping the oldest times
+// that do not fit in maxRecentInterruptionsAnnotationSize.
+func formatRecentInterruptions(times []time.Time) string {
+	var b strings.Builder
+	for _, t := range times {
+		ts := t.UTC().Format(time.RFC3339)
+		if b.Len() > 0 {
+			ts = "," + ts
+		}
+		if b.Len()+len(ts) > maxRecentInterruptionsAnnotationSize {
+			break
+		}
+		b.WriteString(ts)
+	}
+	return b.String()
+}
+
+// reportTime returns the time exporters should consider current for r.
+func reportTime(r records.Report) time.Time {
+	if r.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return r.Timestamp
 }
@@ -0,0 +1,383 @@
+package aggregator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/k8sutils"
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestJobSetAnnotationExporter(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	ref := types.NamespacedName{Namespace: "default", Name: "train"}
+	reportWith := func(availability float64) records.Report {
+		report := records.NewReport()
+		report.JobSetsUpSummaries["uid-1"] = records.UpnessSummaryWithAttrs{
+			Attrs:        records.Attrs{JobSetNamespace: ref.Namespace, JobSetName: ref.Name},
+			EventSummary: records.EventSummary{Availability: availability},
+		}
+		// Deleted JobSets are skipped.
+		report.JobSetsUpSummaries["uid-2"] = records.UpnessSummaryWithAttrs{
+			Attrs: records.Attrs{JobSetNamespace: "default", JobSetName: "deleted"},
+		}
+		return report
+	}
+	get := func(t *testing.T, e *JobSetAnnotationExporter) *jobset.JobSet {
+		var js jobset.JobSet
+		require.NoError(t, e.Get(context.Background(), ref, &js))
+		return &js
+	}
+	newExporter := func(minInterval time.Duration) *JobSetAnnotationExporter {
+		return &JobSetAnnotationExporter{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(&jobset.JobSet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name, UID: "uid-1"},
+			}).Build(),
+			MinInterval: minInterval,
+		}
+	}
+
+	t.Run("set and updated", func(t *testing.T) {
+		t.Parallel()
+		e := newExporter(0)
+
+		require.NoError(t, e.Export(context.Background(), reportWith(0.5)))
+		js := get(t, e)
+		require.Equal(t, "0.5000", js.Annotations[k8sutils.JobSetAvailabilityAnnotation])
+
+		// Unchanged values are not written.
+		require.NoError(t, e.Export(context.Background(), reportWith(0.50001)))
+		require.Equal(t, js.ResourceVersion, get(t, e).ResourceVersion)
+
+		require.NoError(t, e.Export(context.Background(), reportWith(0.75)))
+		require.Equal(t, "0.7500", get(t, e).Annotations[k8sutils.JobSetAvailabilityAnnotation])
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		t.Parallel()
+		e := newExporter(time.Hour)
+
+		require.NoError(t, e.Export(context.Background(), reportWith(0.5)))
+		require.NoError(t, e.Export(context.Background(), reportWith(0.75)))
+		require.Equal(t, "0.5000", get(t, e).Annotations[k8sutils.JobSetAvailabilityAnnotation])
+	})
+
+	t.Run("recent interruptions", func(t *testing.T) {
+		t.Parallel()
+		e := newExporter(0)
+		e.RecentInterruptions = 2
+		require.Equal(t, records.RenderProfileFull, e.RenderProfile())
+
+		t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+		require.NoError(t, err)
+		report := reportWith(0.5)
+		report.JobSetEvents = map[string]records.EventRecords{
+			"uid-1": {UpEvents: []records.UpEvent{
+				{Up: false, Timestamp: t0},
+				{Up: true, Timestamp: t0.Add(1 * time.Hour)},
+				{Up: false, Timestamp: t0.Add(2 * time.Hour)},
+				{Up: true, Timestamp: t0.Add(3 * time.Hour)},
+				{Up: false, Timestamp: t0.Add(4 * time.Hour)},
+				{Up: true, Timestamp: t0.Add(5 * time.Hour)},
+				{Up: false, Timestamp: t0.Add(6 * time.Hour)},
+			}},
+		}
+		require.NoError(t, e.Export(context.Background(), report))
+		js := get(t, e)
+		require.Equal(t, "2021-01-01T06:00:00Z,2021-01-01T04:00:00Z", js.Annotations[k8sutils.JobSetRecentInterruptionsAnnotation])
+		require.Equal(t, "0.5000", js.Annotations[k8sutils.JobSetAvailabilityAnnotation])
+
+		// A new interruption is written even if the availability is unchanged.
+		rec := report.JobSetEvents["uid-1"]
+		rec.UpEvents = append(rec.UpEvents,
+			records.UpEvent{Up: true, Timestamp: t0.Add(7 * time.Hour)},
+			records.UpEvent{Up: false, Timestamp: t0.Add(8 * time.Hour)},
+		)
+		report.JobSetEvents["uid-1"] = rec
+		require.NoError(t, e.Export(context.Background(), report))
+		require.Equal(t, "2021-01-01T08:00:00Z,2021-01-01T06:00:00Z", get(t, e).Annotations[k8sutils.JobSetRecentInterruptionsAnnotation])
+	})
+}
+
+func TestFormatRecentInterruptions(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	require.NoError(t, err)
+	require.Empty(t, formatRecentInterruptions(nil))
+
+	var times []time.Time
+	for i := 0; i < 100; i++ {
+		times = append(times, t0.Add(-time.Duration(i)*time.Hour))
+	}
+	val := formatRecentInterruptions(times)
+	require.LessOrEqual(t, len(val), maxRecentInterruptionsAnnotationSize)
+	parts := strings.Split(val, ",")
+	require.Less(t, len(parts), len(times))
+	// The newest times are kept.
+	require.Equal(t, "2021-01-01T00:00:00Z", parts[0])
+	require.Equal(t, "2020-12-31T23:00:00Z", parts[1])
+}
+
+func TestStdoutExporterDedupe(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-02T03:04:05Z")
+	require.NoError(t, err)
+	now := t0
+	var out bytes.Buffer
+	e := &StdoutExporter{Dedupe: true, Heartbeat: time.Minute, out: &out, now: func() time.Time { return now }}
+
+	newReport := func(ready int32, upTime time.Duration) records.Report {
+		r := records.NewReport()
+		r.Timestamp = now
+		r.JobSetsUp["abc"] = records.Upness{ReadyCount: ready, ExpectedCount: 1}
+		r.JobSetsUpSummaries["abc"] = records.UpnessSummaryWithAttrs{EventSummary: records.EventSummary{UpTime: upTime}}
+		return r
+	}
+	lines := func() []string {
+		defer out.Reset()
+		return strings.Split(strings.TrimSpace(out.String()), "\n")
+	}
+
+	require.NoError(t, e.Export(context.Background(), newReport(1, 0)))
+	require.Len(t, lines(), 1)
+
+	// Unchanged state is suppressed, even though durations grew.
+	now = t0.Add(10 * time.Second)
+	require.NoError(t, e.Export(context.Background(), newReport(1, 10*time.Second)))
+	require.Empty(t, out.String())
+
+	// A heartbeat is printed once the heartbeat interval has passed.
+	now = t0.Add(time.Minute)
+	require.NoError(t, e.Export(context.Background(), newReport(1, time.Minute)))
+	got := lines()
+	require.Len(t, got, 1)
+	var hb stdoutHeartbeat
+	require.NoError(t, json.Unmarshal([]byte(got[0]), &hb))
+	require.Equal(t, now, hb.Heartbeat)
+	require.NotEmpty(t, hb.ReportHash)
+	now = t0.Add(70 * time.Second)
+	require.NoError(t, e.Export(context.Background(), newReport(1, 70*time.Second)))
+	require.Empty(t, out.String())
+
+	// A change is printed.
+	now = t0.Add(80 * time.Second)
+	require.NoError(t, e.Export(context.Background(), newReport(0, 70*time.Second)))
+	got = lines()
+	require.Len(t, got, 1)
+	var r records.Report
+	require.NoError(t, json.Unmarshal([]byte(got[0]), &r))
+	require.Equal(t, int32(0), r.JobSetsUp["abc"].ReadyCount)
+}
+
+func TestStdoutExporterFormat(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-02T03:04:05Z")
+	require.NoError(t, err)
+	r := records.NewReport()
+	r.Timestamp = t0
+	r.ClusterName = "cluster"
+	attrs := records.Attrs{Kind: records.KindJobSet, JobSetNamespace: "ns", JobSetName: "js"}
+	r.JobSetsUp["abc"] = records.Upness{ReadyCount: 1, ExpectedCount: 2, Attrs: attrs}
+	r.JobSetsUpSummaries["abc"] = records.UpnessSummaryWithAttrs{
+		Attrs:        attrs,
+		EventSummary: records.EventSummary{InterruptionCount: 2, UpTime: time.Hour},
+	}
+	r.JobSetNodesUp["abc"] = records.Upness{ReadyCount: 2, ExpectedCount: 2}
+	r.JobSetNodesUpSummaries["abc"] = records.UpnessSummaryWithAttrs{
+		EventSummary: records.EventSummary{InterruptionCount: 1},
+	}
+	lines := func(format StdoutFormat) []string {
+		var out bytes.Buffer
+		e := &StdoutExporter{Format: format, out: &out}
+		require.NoError(t, e.Export(context.Background(), r))
+		return strings.Split(strings.TrimSpace(out.String()), "\n")
+	}
+
+	t.Run("text", func(t *testing.T) {
+		t.Parallel()
+		got := lines("")
+		require.Len(t, got, 1)
+		var report records.Report
+		require.NoError(t, json.Unmarshal([]byte(got[0]), &report))
+		require.Equal(t, 2, report.JobSetsUpSummaries["abc"].InterruptionCount)
+	})
+
+	t.Run("jsonl", func(t *testing.T) {
+		t.Parallel()
+		got := lines(StdoutFormatJSONL)
+		require.Len(t, got, 2)
+		var entities []map[string]any
+		for _, line := range got {
+			var entity map[string]any
+			require.NoError(t, json.Unmarshal([]byte(line), &entity), line)
+			entities = append(entities, entity)
+		}
+		for _, entity := range entities {
+			require.Equal(t, "2021-01-02T03:04:05Z", entity["timestamp"])
+			require.Equal(t, "cluster", entity["clusterName"])
+			require.Equal(t, "abc", entity["key"])
+		}
+		require.Equal(t, "jobset", entities[0]["kind"])
+		require.Equal(t, "js", entities[0]["jobsetName"])
+		require.Equal(t, false, entities[0]["up"])
+		require.Equal(t, 2.0, entities[0]["interruptionCount"])
+		require.Equal(t, float64(time.Hour), entities[0]["upTime"])
+		// The kind is filled in from the layer when unset.
+		require.Equal(t, "jobset-nodes", entities[1]["kind"])
+		require.Equal(t, true, entities[1]["up"])
+		require.Equal(t, 1.0, entities[1]["interruptionCount"])
+	})
+}
+
+func TestParseStdoutFormat(t *testing.T) {
+	t.Parallel()
+
+	for in, exp := range map[string]StdoutFormat{"": StdoutFormatText, "text": StdoutFormatText, "jsonl": StdoutFormatJSONL} {
+		got, err := ParseStdoutFormat(in)
+		require.NoError(t, err)
+		require.Equal(t, exp, got)
+	}
+	_, err := ParseStdoutFormat("yaml")
+	require.Error(t, err)
+}
+
+func TestConfigMapExporterSchemaVersion(t *testing.T) {
+	t.Parallel()
+
+	ref := types.NamespacedName{Namespace: "megamon-system", Name: "megamon-report"}
+	cases := map[string]struct {
+		existing string
+		expErr   bool
+	}{
+		"empty": {},
+		"older": {
+			existing: `{"jobSetsUp":{}}`,
+		},
+		"same": {
+			existing: fmt.Sprintf(`{"schemaVersion":%d}`, records.ReportSchemaVersion),
+		},
+		"newer": {
+			existing: fmt.Sprintf(`{"schemaVersion":%d}`, records.ReportSchemaVersion+1),
+			expErr:   true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name}}
+			if c.existing != "" {
+				cm.Data = map[string]string{"report": c.existing}
+			}
+			cl := fake.NewClientBuilder().WithObjects(cm).Build()
+			e := &ConfigMapExporter{Ref: ref, Key: "report", Client: cl}
+
+			err := e.Export(context.Background(), records.Report{ClusterName: "cluster"})
+			require.NoError(t, cl.Get(context.Background(), ref, cm))
+			if c.expErr {
+				require.ErrorContains(t, err, "newer")
+				require.Equal(t, c.existing, cm.Data["report"])
+				return
+			}
+			require.NoError(t, err)
+			got, err := k8sutils.GetReportFromConfigMap(cm, "report")
+			require.NoError(t, err)
+			require.Equal(t, records.ReportSchemaVersion, got.SchemaVersion)
+			require.Equal(t, "cluster", got.ClusterName)
+		})
+	}
+}
+
+func TestConfigMapExporterCompress(t *testing.T) {
+	t.Parallel()
+
+	ref := types.NamespacedName{Namespace: "megamon-system", Name: "megamon-report"}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name},
+		Data:       map[string]string{"report": `{"clusterName":"old"}`},
+	}
+	cl := fake.NewClientBuilder().WithObjects(cm).Build()
+	e := &ConfigMapExporter{Ref: ref, Key: "report", Compress: true, Client: cl}
+
+	require.NoError(t, e.Export(context.Background(), records.Report{ClusterName: "compressed"}))
+	require.NoError(t, cl.Get(context.Background(), ref, cm))
+	require.NotContains(t, cm.Data, "report")
+	require.Equal(t, k8sutils.ReportCompressionGzip, cm.Data["report"+k8sutils.ReportCompressionKeySuffix])
+	require.NotEmpty(t, cm.Data["report"+k8sutils.CompressedReportKeySuffix])
+	got, err := k8sutils.GetReportFromConfigMap(cm, "report")
+	require.NoError(t, err)
+	require.Equal(t, "compressed", got.ClusterName)
+
+	// Switching back to uncompressed removes the compressed report.
+	e.Compress = false
+	require.NoError(t, e.Export(context.Background(), records.Report{ClusterName: "plain"}))
+	require.NoError(t, cl.Get(context.Background(), ref, cm))
+	require.NotContains(t, cm.Data, "report"+k8sutils.CompressedReportKeySuffix)
+	require.NotContains(t, cm.Data, "report"+k8sutils.ReportCompressionKeySuffix)
+	got, err = k8sutils.GetReportFromConfigMap(cm, "report")
+	require.NoError(t, err)
+	require.Equal(t, "plain", got.ClusterName)
+}
+
+func TestConfigMapExporterSharedConfigMap(t *testing.T) {
+	t.Parallel()
+
+	ref := types.NamespacedName{Namespace: "megamon-system", Name: "megamon-report"}
+	summary := &ConfigMapExporter{Ref: ref, Key: "report"}
+	full := &ConfigMapExporter{Ref: ref, Key: "report.full", Profile: records.RenderProfileFull}
+
+	// The full report is written between the read and the write of the
+	// summary report, as by a concurrent export.
+	var interleaved bool
+	cl := fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name},
+		Data:       map[string]string{"other": "kept"},
+	}).WithInterceptorFuncs(interceptor.Funcs{
+		Update: func(ctx context.Context, cl client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			if !interleaved {
+				interleaved = true
+				full.Client = cl
+				if err := full.Export(ctx, records.Report{ClusterName: full.Key}); err != nil {
+					return err
+				}
+			}
+			return cl.Update(ctx, obj, opts...)
+		},
+	}).Build()
+	summary.Client = cl
+
+	require.NoError(t, summary.Export(context.Background(), records.Report{ClusterName: summary.Key}))
+	require.True(t, interleaved)
+
+	cm := &corev1.ConfigMap{}
+	require.NoError(t, cl.Get(context.Background(), ref, cm))
+	require.Equal(t, "kept", cm.Data["other"])
+	for _, e := range []*ConfigMapExporter{summary, full} {
+		got, err := k8sutils.GetReportFromConfigMap(cm, e.Key)
+		require.NoError(t, err)
+		require.Equal(t, e.Key, got.ClusterName)
+	}
+}
@@ -0,0 +1,168 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/megamon/internal/records"
+)
+
+// FileExporter writes the report to local files, e.g. on a volume shared with
+// a log-shipping sidecar. The latest report is replaced atomically at
+// LatestPath, so readers never observe partial writes, and every report is
+// appended as a line of JSON to LogPath for tailing. Either path may be empty.
+type FileExporter struct {
+	LatestPath string
+	LogPath    string
+
+	// Keep, if positive, additionally writes every report next to LatestPath
+	// under a timestamped name (e.g. report-20210101T000000.000000000Z.json
+	// for report.json) and removes all but the Keep most recent of them.
+	Keep int
+
+	// Sync fsyncs the written files (and the directory of LatestPath after
+	// the rename) before returning, trading latency for durability.
+	Sync bool
+
+	Profile records.RenderProfile
+}
+
+func (e *FileExporter) RenderProfile() records.RenderProfile {
+	return e.Profile
+}
+
+func (e *FileExporter) Export(_ context.Context, r records.Report) error {
+	jsn, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	jsn = append(jsn, '\n')
+
+	var errs []error
+	if e.LatestPath != "" {
+		if err := e.writeAtomic(e.LatestPath, jsn); err != nil {
+			errs = append(errs, fmt.Errorf("writing latest report: %w", err))
+		}
+		if e.Keep > 0 {
+			if err := e.rotate(reportTime(r), jsn); err != nil {
+				errs = append(errs, fmt.Errorf("rotating reports: %w", err))
+			}
+		}
+	}
+	if e.LogPath != "" {
+		if err := e.appendLog(jsn); err != nil {
+			errs = append(errs, fmt.Errorf("appending report log: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writeAtomic writes to a temporary file in the same directory and renames it
+// over path.
+func (e *FileExporter) writeAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if e.Sync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	if e.Sync {
+		return syncDir(dir)
+	}
+	return nil
+}
+
+// rotatedTimeFormat has a fixed width, so that rotated file names sort in
+// time order.
+const rotatedTimeFormat = "20060102T150405.000000000Z"
+
+// rotate writes the timestamped copy of the report and removes the oldest
+// copies beyond Keep.
+func (e *FileExporter) rotate(ts time.Time, data []byte) error {
+	dir := filepath.Dir(e.LatestPath)
+	ext := filepath.Ext(e.LatestPath)
+	prefix := strings.TrimSuffix(filepath.Base(e.LatestPath), ext) + "-"
+	if err := e.writeAtomic(filepath.Join(dir, prefix+ts.UTC().Format(rotatedTimeFormat)+ext), data); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var rotated []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		if _, err := time.Parse(rotatedTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)); err != nil {
+			continue
+		}
+		rotated = append(rotated, name)
+	}
+	sort.Strings(rotated)
+
+	var errs []error
+	for _, name := range rotated[:max(len(rotated)-e.Keep, 0)] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *FileExporter) appendLog(data []byte) error {
+	f, err := os.OpenFile(e.LogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if e.Sync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,97 @@
+package aggregator
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileExporter(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	e := &FileExporter{
+		LatestPath: filepath.Join(dir, "report.json"),
+		LogPath:    filepath.Join(dir, "report.log"),
+		Sync:       true,
+	}
+
+	reportWith := func(ready int32) records.Report {
+		report := records.NewReport()
+		report.JobSetsUp["uid-1"] = records.Upness{ReadyCount: ready, ExpectedCount: 2}
+		return report
+	}
+	for _, ready := range []int32{0, 1, 2} {
+		require.NoError(t, e.Export(context.Background(), reportWith(ready)))
+	}
+
+	// The latest file holds only the last report.
+	data, err := os.ReadFile(e.LatestPath)
+	require.NoError(t, err)
+	var latest records.Report
+	require.NoError(t, json.Unmarshal(data, &latest))
+	require.Equal(t, int32(2), latest.JobSetsUp["uid-1"].ReadyCount)
+
+	// The log holds one line per report, in order.
+	f, err := os.Open(e.LogPath)
+	require.NoError(t, err)
+	defer f.Close()
+	var readyCounts []int32
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r records.Report
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		readyCounts = append(readyCounts, r.JobSetsUp["uid-1"].ReadyCount)
+	}
+	require.NoError(t, scanner.Err())
+	require.Equal(t, []int32{0, 1, 2}, readyCounts)
+
+	// No temporary files are left behind.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
+
+func TestFileExporterKeep(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	require.NoError(t, err)
+	dir := t.TempDir()
+	e := &FileExporter{LatestPath: filepath.Join(dir, "report.json"), Keep: 2}
+
+	// Unrelated files next to the latest file are left alone.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "report-notes.json"), nil, 0o644))
+
+	for i := 0; i < 3; i++ {
+		report := records.NewReport()
+		report.Timestamp = t0.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, e.Export(context.Background(), report))
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	require.Equal(t, []string{
+		"report-20210101T000100.000000000Z.json",
+		"report-20210101T000200.000000000Z.json",
+		"report-notes.json",
+		"report.json",
+	}, names)
+
+	data, err := os.ReadFile(filepath.Join(dir, "report-20210101T000200.000000000Z.json"))
+	require.NoError(t, err)
+	latest, err := os.ReadFile(e.LatestPath)
+	require.NoError(t, err)
+	require.Equal(t, latest, data)
+}
@@ -0,0 +1,152 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"example.com/megamon/internal/records"
+	"google.golang.org/api/iterator"
+)
+
+// DefaultGCSPruneInterval is how often expired snapshots are pruned.
+const DefaultGCSPruneInterval = time.Hour
+
+// GCSExporter writes every report as a JSON object named after its timestamp
+// to a Google Cloud Storage bucket, e.g.
+// gs://bucket/prefix/2021-01-01T00:00:00Z.json, to retain a history of
+// reports beyond the latest one.
+type GCSExporter struct {
+	// Client defaults to a client using Application Default Credentials.
+	Client *storage.Client
+
+	Bucket string
+	// Prefix is the "directory" that objects are written to, if any.
+	Prefix string
+
+	// Retention, if set, deletes the reports under Prefix that were created
+	// more than Retention ago, see isReportObject. Pruning happens at most once per
+	// PruneInterval (defaults to DefaultGCSPruneInterval).
+	Retention     time.Duration
+	PruneInterval time.Duration
+
+	Profile records.RenderProfile
+
+	mtx        sync.Mutex
+	lastPruned time.Time
+
+	// now is overridden in tests.
+	now func() time.Time
+}
+
+func (e *GCSExporter) RenderProfile() records.RenderProfile {
+	return e.Profile
+}
+
+func (e *GCSExporter) Export(ctx context.Context, r records.Report) error {
+	c, err := e.client(ctx)
+	if err != nil {
+		return err
+	}
+	jsn, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	name := e.objectPrefix() + reportTime(r).UTC().Format(time.RFC3339) + ".json"
+	w := c.Bucket(e.Bucket).Object(name).NewWriter(ctx)
+	w.ContentType = "application/json"
+	// Reports are small, so upload them in a single request.
+	w.ChunkSize = 0
+	if _, err := w.Write(jsn); err != nil {
+		w.Close()
+		return fmt.Errorf("writing gs://%s/%s: %w", e.Bucket, name, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("writing gs://%s/%s: %w", e.Bucket, name, err)
+	}
+
+	if e.Retention > 0 {
+		if err := e.prune(ctx, c); err != nil {
+			return fmt.Errorf("pruning gs://%s/%s: %w", e.Bucket, e.objectPrefix(), err)
+		}
+	}
+	return nil
+}
+
+func (e *GCSExporter) client(ctx context.Context) (*storage.Client, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if e.Client == nil {
+		c, err := storage.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("creating storage client: %w", err)
+		}
+		e.Client = c
+	}
+	return e.Client, nil
+}
+
+func (e *GCSExporter) objectPrefix() string {
+	if p := strings.Trim(e.Prefix, "/"); p != "" {
+		return p + "/"
+	}
+	return ""
+}
+
+// isReportObject returns whether the object is a report written by Export,
+// i.e. named <RFC3339 timestamp>.json directly under Prefix, so that pruning
+// never deletes other objects sharing the bucket.
+func (e *GCSExporter) isReportObject(name string) bool {
+	ts, ok := strings.CutSuffix(strings.TrimPrefix(name, e.objectPrefix()), ".json")
+	if !ok {
+		return false
+	}
+	_, err := time.Parse(time.RFC3339, ts)
+	return err == nil
+}
+
+// prune deletes the reports created before the retention period.
+func (e *GCSExporter) prune(ctx context.Context, c *storage.Client) error {
+	now := time.Now()
+	if e.now != nil {
+		now = e.now()
+	}
+	interval := e.PruneInterval
+	if interval <= 0 {
+		interval = DefaultGCSPruneInterval
+	}
+	e.mtx.Lock()
+	if now.Sub(e.lastPruned) < interval {
+		e.mtx.Unlock()
+		return nil
+	}
+	e.lastPruned = now
+	e.mtx.Unlock()
+
+	cutoff := now.Add(-e.Retention)
+	bucket := c.Bucket(e.Bucket)
+	it := bucket.Objects(ctx, &storage.Query{Prefix: e.objectPrefix()})
+	var errs []error
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !attrs.Created.Before(cutoff) || !e.isReportObject(attrs.Name) {
+			continue
+		}
+		if err := bucket.Object(attrs.Name).Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,150 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+// fakeGCS serves the parts of the GCS JSON API used by GCSExporter.
+type fakeGCS struct {
+	mtx     sync.Mutex
+	objects map[string]fakeGCSObject
+}
+
+type fakeGCSObject struct {
+	Name        string    `json:"name"`
+	Bucket      string    `json:"bucket"`
+	TimeCreated time.Time `json:"timeCreated"`
+	data        []byte
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/upload/storage/v1/b/bucket/o"):
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		var obj fakeGCSObject
+		for i := 0; i < 2; i++ {
+			p, err := mr.NextPart()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			data, _ := io.ReadAll(p)
+			if i == 0 {
+				json.Unmarshal(data, &obj)
+			} else {
+				obj.data = data
+			}
+		}
+		obj.Bucket = "bucket"
+		obj.TimeCreated = time.Now()
+		f.objects[obj.Name] = obj
+		json.NewEncoder(w).Encode(obj)
+	case r.Method == http.MethodGet && r.URL.Path == "/storage/v1/b/bucket/o":
+		var items []fakeGCSObject
+		for name, obj := range f.objects {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				items = append(items, obj)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"kind": "storage#objects", "items": items})
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/storage/v1/b/bucket/o/"):
+		delete(f.objects, strings.TrimPrefix(r.URL.Path, "/storage/v1/b/bucket/o/"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected request "+r.Method+" "+r.URL.String(), http.StatusNotImplemented)
+	}
+}
+
+func newFakeGCSClient(t *testing.T, f *fakeGCS) *storage.Client {
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	c, err := storage.NewClient(context.Background(),
+		option.WithEndpoint(srv.URL+"/storage/v1/"),
+		option.WithoutAuthentication(),
+		option.WithHTTPClient(srv.Client()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestGCSExporter(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-02T03:04:05Z")
+	require.NoError(t, err)
+	f := &fakeGCS{objects: map[string]fakeGCSObject{}}
+	e := &GCSExporter{Client: newFakeGCSClient(t, f), Bucket: "bucket", Prefix: "reports/"}
+
+	report := records.NewReport()
+	report.Timestamp = t0
+	report.JobSetsUp["abc"] = records.Upness{ReadyCount: 1, ExpectedCount: 1}
+	require.NoError(t, e.Export(context.Background(), report))
+
+	require.Contains(t, f.objects, "reports/2021-01-02T03:04:05Z.json")
+	var got records.Report
+	require.NoError(t, json.Unmarshal(f.objects["reports/2021-01-02T03:04:05Z.json"].data, &got))
+	require.Equal(t, report.JobSetsUp, got.JobSetsUp)
+}
+
+func TestGCSExporterRetention(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	old, young := now.Add(-72*time.Hour), now.Add(-time.Hour)
+	oldName := "reports/" + old.UTC().Format(time.RFC3339) + ".json"
+	youngName := "reports/" + young.UTC().Format(time.RFC3339) + ".json"
+	f := &fakeGCS{objects: map[string]fakeGCSObject{
+		oldName:   {Name: oldName, Bucket: "bucket", TimeCreated: old},
+		youngName: {Name: youngName, Bucket: "bucket", TimeCreated: young},
+		// Only reports are pruned.
+		"reports/notes.json":                    {Name: "reports/notes.json", Bucket: "bucket", TimeCreated: old},
+		"reports/sub/2021-01-01T00:00:00Z.json": {Name: "reports/sub/2021-01-01T00:00:00Z.json", Bucket: "bucket", TimeCreated: old},
+		"other/old.json":                        {Name: "other/old.json", Bucket: "bucket", TimeCreated: old},
+	}}
+	e := &GCSExporter{
+		Client:    newFakeGCSClient(t, f),
+		Bucket:    "bucket",
+		Prefix:    "reports",
+		Retention: 48 * time.Hour,
+		now:       func() time.Time { return now },
+	}
+
+	report := records.NewReport()
+	report.Timestamp = now
+	require.NoError(t, e.Export(context.Background(), report))
+
+	var names []string
+	for name := range f.objects {
+		names = append(names, name)
+	}
+	require.ElementsMatch(t, []string{
+		youngName,
+		"reports/" + now.UTC().Format(time.RFC3339) + ".json",
+		"reports/notes.json",
+		"reports/sub/2021-01-01T00:00:00Z.json",
+		"other/old.json",
+	}, names)
+}
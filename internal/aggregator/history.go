@@ -0,0 +1,163 @@
+package aggregator
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"example.com/megamon/internal/records"
+)
+
+// recordHistory appends the report to the history ring buffer, dropping the
+// oldest report once HistorySize is exceeded. Must be called with reportMtx
+// held.
+func (a *Aggregator) recordHistory(report records.Report) {
+	if a.HistorySize <= 0 {
+		return
+	}
+	// The raw event records would make every snapshot grow with the
+	// entities' lifetime and are not needed for diffs.
+	report = report.Render(records.RenderProfileSummary)
+	if len(a.history) >= a.HistorySize {
+		a.history = append(a.history[:0], a.history[len(a.history)-a.HistorySize+1:]...)
+	}
+	a.history = append(a.history, report)
+}
+
+// ReportAt returns the latest report in the history that was computed at or
+// before t, or false if there is none.
+func (a *Aggregator) ReportAt(t time.Time) (records.Report, bool) {
+	a.reportMtx.RLock()
+	defer a.reportMtx.RUnlock()
+	for i := len(a.history) - 1; i >= 0; i-- {
+		if !a.history[i].Timestamp.After(t) {
+			return a.history[i], true
+		}
+	}
+	return records.Report{}, false
+}
+
+// ReportDiff is the change in key metrics of every entity between two
+// reports.
+type ReportDiff struct {
+	From        time.Time     `json:"from"`
+	To          time.Time     `json:"to"`
+	JobSets     []EntityDelta `json:"jobSets"`
+	JobSetNodes []EntityDelta `json:"jobSetNodes"`
+}
+
+// EntityDelta is the change in an entity's key metrics between two reports.
+// Entities missing from one of the reports are diffed against a zero summary.
+type EntityDelta struct {
+	// Key is the entity's key in the report (the JobSet UID).
+	Key string `json:"key"`
+	records.Attrs
+
+	WasUp bool `json:"wasUp"`
+	Up    bool `json:"up"`
+
+	InterruptionCount int           `json:"interruptionCount"`
+	RecoveryCount     int           `json:"recoveryCount"`
+	UpTime            time.Duration `json:"upTime"`
+	DownTime          time.Duration `json:"downTime"`
+	Availability      float64       `json:"availability"`
+}
+
+// DiffReports returns the per-entity deltas from one report to another.
+func DiffReports(from, to records.Report) ReportDiff {
+	return ReportDiff{
+		From:        from.Timestamp,
+		To:          to.Timestamp,
+		JobSets:     diffEntities(from.JobSetsUp, to.JobSetsUp, from.JobSetsUpSummaries, to.JobSetsUpSummaries),
+		JobSetNodes: diffEntities(from.JobSetNodesUp, to.JobSetNodesUp, from.JobSetNodesUpSummaries, to.JobSetNodesUpSummaries),
+	}
+}
+
+func diffEntities(fromUps, toUps map[string]records.Upness, fromSummaries, toSummaries map[string]records.UpnessSummaryWithAttrs) []EntityDelta {
+	keys := map[string]struct{}{}
+	for _, m := range []map[string]records.UpnessSummaryWithAttrs{fromSummaries, toSummaries} {
+		for key := range m {
+			keys[key] = struct{}{}
+		}
+	}
+	for _, m := range []map[string]records.Upness{fromUps, toUps} {
+		for key := range m {
+			keys[key] = struct{}{}
+		}
+	}
+
+	deltas := make([]EntityDelta, 0, len(keys))
+	for key := range keys {
+		before, after := fromSummaries[key].EventSummary, toSummaries[key].EventSummary
+		attrs := toSummaries[key].Attrs
+		if _, ok := toSummaries[key]; !ok {
+			attrs = fromSummaries[key].Attrs
+		}
+		_, wasPresent := fromUps[key]
+		_, present := toUps[key]
+		deltas = append(deltas, EntityDelta{
+			Key:               key,
+			Attrs:             attrs,
+			WasUp:             wasPresent && fromUps[key].Up(),
+			Up:                present && toUps[key].Up(),
+			InterruptionCount: after.InterruptionCount - before.InterruptionCount,
+			RecoveryCount:     after.RecoveryCount - before.RecoveryCount,
+			UpTime:            after.UpTime - before.UpTime,
+			DownTime:          after.DownTime - before.DownTime,
+			Availability:      after.Availability - before.Availability,
+		})
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i].Key < deltas[j].Key })
+	return deltas
+}
+
+// DiffHandler serves the ReportDiff between the reports in the history at
+// the from and to query parameters (RFC 3339 timestamps). Each resolves to the
+// latest report computed at or before it, and to defaults to the latest
+// report.
+func (a *Aggregator) DiffHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		parse := func(name string, def time.Time) (time.Time, bool) {
+			val := req.URL.Query().Get(name)
+			if val == "" && !def.IsZero() {
+				return def, true
+			}
+			t, err := time.Parse(time.RFC3339, val)
+			if err != nil {
+				http.Error(w, "invalid "+name+", expected an RFC 3339 timestamp", http.StatusBadRequest)
+				return time.Time{}, false
+			}
+			return t, true
+		}
+		fromTime, ok := parse("from", time.Time{})
+		if !ok {
+			return
+		}
+		toTime, ok := parse("to", time.Now())
+		if !ok {
+			return
+		}
+		if toTime.Before(fromTime) {
+			http.Error(w, "to must not be before from", http.StatusBadRequest)
+			return
+		}
+
+		from, ok := a.ReportAt(fromTime)
+		if !ok {
+			http.Error(w, "no report in history at or before from", http.StatusNotFound)
+			return
+		}
+		to, _ := a.ReportAt(toTime)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(DiffReports(from, to)); err != nil {
+			log.Printf("failed to write report diff: %v", err)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package aggregator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffHandler(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	attrs := records.Attrs{JobSetNamespace: "ns", JobSetName: "js"}
+	snapshot := func(at time.Time, up bool, summary records.EventSummary) records.Report {
+		r := records.NewReport()
+		r.Timestamp = at
+		ready := int32(0)
+		if up {
+			ready = 1
+		}
+		r.JobSetsUp["abc"] = records.Upness{Attrs: attrs, ExpectedCount: 1, ReadyCount: ready}
+		r.JobSetsUpSummaries["abc"] = records.UpnessSummaryWithAttrs{Attrs: attrs, EventSummary: summary}
+		return r
+	}
+
+	a := &Aggregator{HistorySize: 2}
+	// The first snapshot falls out of the history.
+	a.setReport(snapshot(t0, true, records.EventSummary{}))
+	a.setReport(snapshot(t0.Add(time.Hour), true, records.EventSummary{
+		InterruptionCount: 1,
+		RecoveryCount:     1,
+		UpTime:            50 * time.Minute,
+		DownTime:          10 * time.Minute,
+		Availability:      0.75,
+	}))
+	later := snapshot(t0.Add(2*time.Hour), false, records.EventSummary{
+		InterruptionCount: 3,
+		RecoveryCount:     2,
+		UpTime:            80 * time.Minute,
+		DownTime:          40 * time.Minute,
+		Availability:      0.5,
+	})
+	later.JobSetsUp["def"] = records.Upness{ExpectedCount: 1, ReadyCount: 1}
+	a.setReport(later)
+
+	srv := httptest.NewServer(a.DiffHandler())
+	defer srv.Close()
+
+	get := func(query string) (int, ReportDiff) {
+		resp, err := http.Get(srv.URL + "?" + query)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var d ReportDiff
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&d))
+		}
+		return resp.StatusCode, d
+	}
+
+	// Timestamps resolve to the latest snapshot at or before them.
+	code, diff := get("from=" + t0.Add(90*time.Minute).Format(time.RFC3339) + "&to=" + t0.Add(3*time.Hour).Format(time.RFC3339))
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, diff.From.Equal(t0.Add(time.Hour)))
+	require.True(t, diff.To.Equal(t0.Add(2*time.Hour)))
+	require.Len(t, diff.JobSets, 2)
+	require.Equal(t, EntityDelta{
+		Key:               "abc",
+		Attrs:             attrs,
+		WasUp:             true,
+		Up:                false,
+		InterruptionCount: 2,
+		RecoveryCount:     1,
+		UpTime:            30 * time.Minute,
+		DownTime:          30 * time.Minute,
+		Availability:      -0.25,
+	}, diff.JobSets[0])
+	// Entities that did not exist before are diffed against nothing.
+	require.Equal(t, EntityDelta{Key: "def", Up: true}, diff.JobSets[1])
+
+	// To defaults to the latest snapshot.
+	code, diff = get("from=" + t0.Add(time.Hour).Format(time.RFC3339))
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, diff.To.Equal(t0.Add(2*time.Hour)))
+
+	// The first snapshot was dropped from the history.
+	code, _ = get("from=" + t0.Format(time.RFC3339))
+	require.Equal(t, http.StatusNotFound, code)
+
+	code, _ = get("from=yesterday")
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = get("from=" + t0.Add(2*time.Hour).Format(time.RFC3339) + "&to=" + t0.Add(time.Hour).Format(time.RFC3339))
+	require.Equal(t, http.StatusBadRequest, code)
+}
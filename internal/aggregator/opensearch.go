@@ -0,0 +1,151 @@
+package aggregator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/megamon/internal/records"
+)
+
+// OpenSearchExporter bulk-indexes one summary document per entity per
+// aggregation into OpenSearch (or Elasticsearch).
+type OpenSearchExporter struct {
+	// URL is the base URL of the cluster, e.g. https://opensearch:9200.
+	URL string
+	// Index is the index name prefix. Documents are written to
+	// <Index>-<date> where the date is formatted with IndexDateLayout.
+	Index string
+	// IndexDateLayout is a Go time layout, defaults to "2006.01.02".
+	IndexDateLayout string
+
+	Username, Password string
+
+	HTTPClient *http.Client
+
+	// now is overridden in tests.
+	now func() time.Time
+}
+
+type openSearchDoc struct {
+	Timestamp time.Time `json:"@timestamp"`
+	Kind      string    `json:"kind"`
+	UID       string    `json:"uid"`
+	Up        bool      `json:"up"`
+	records.Attrs
+	records.EventSummary
+}
+
+func (e *OpenSearchExporter) Export(ctx context.Context, r records.Report) error {
+	now := reportTime(r)
+	if e.now != nil {
+		now = e.now()
+	}
+	layout := e.IndexDateLayout
+	if layout == "" {
+		layout = "2006.01.02"
+	}
+	action, err := json.Marshal(map[string]any{
+		"index": map[string]string{"_index": e.Index + "-" + now.UTC().Format(layout)},
+	})
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	for _, section := range []struct {
+		kind      string
+		ups       map[string]records.Upness
+		summaries map[string]records.UpnessSummaryWithAttrs
+	}{
+		{string(records.KindJobSet), r.JobSetsUp, r.JobSetsUpSummaries},
+		{string(records.KindJobSetNodes), r.JobSetNodesUp, r.JobSetNodesUpSummaries},
+	} {
+		keys := make([]string, 0, len(section.summaries))
+		for key := range section.summaries {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := section.summaries[key]
+			doc, err := json.Marshal(openSearchDoc{
+				Timestamp:    now,
+				Kind:         section.kind,
+				UID:          key,
+				Up:           section.ups[key].Up(),
+				Attrs:        s.Attrs,
+				EventSummary: s.EventSummary,
+			})
+			if err != nil {
+				return err
+			}
+			body.Write(action)
+			body.WriteByte('\n')
+			body.Write(doc)
+			body.WriteByte('\n')
+		}
+	}
+	if body.Len() == 0 {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(e.URL, "/")+"/_bulk", &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if e.Username != "" {
+		req.SetBasicAuth(e.Username, e.Password)
+	}
+
+	c := e.HTTPClient
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("bulk indexing: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("bulk indexing: unexpected status %s: %s", resp.Status, msg)
+	}
+
+	// The bulk API reports per-document failures in the response body.
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("decoding bulk response: %w", err)
+	}
+	if result.Errors {
+		var failed int
+		var first string
+		for _, item := range result.Items {
+			for _, res := range item {
+				if res.Status >= 300 {
+					if failed == 0 {
+						first = res.Error.Type + ": " + res.Error.Reason
+					}
+					failed++
+				}
+			}
+		}
+		return fmt.Errorf("bulk indexing: %d documents failed, first error: %s", failed, first)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenSearchExporter(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-02T03:04:05Z")
+	require.NoError(t, err)
+
+	report := records.NewReport()
+	attrs := records.Attrs{JobSetName: "train", JobSetNamespace: "team-a"}
+	report.JobSetsUp["uid-1"] = records.Upness{ReadyCount: 1, ExpectedCount: 1, Attrs: attrs}
+	report.JobSetsUpSummaries["uid-1"] = records.UpnessSummaryWithAttrs{
+		Attrs:        attrs,
+		EventSummary: records.EventSummary{InterruptionCount: 2, UpTime: time.Second, Availability: 0.5},
+	}
+	report.JobSetNodesUp["uid-1"] = records.Upness{ReadyCount: 1, ExpectedCount: 2, Attrs: attrs}
+	report.JobSetNodesUpSummaries["uid-1"] = records.UpnessSummaryWithAttrs{Attrs: attrs}
+
+	var gotBody, gotContentType, gotUser string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/_bulk", r.URL.Path)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		gotBody = string(body)
+		gotContentType = r.Header.Get("Content-Type")
+		gotUser, _, _ = r.BasicAuth()
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer srv.Close()
+
+	e := &OpenSearchExporter{
+		URL:        srv.URL + "/",
+		Index:      "megamon",
+		Username:   "user",
+		Password:   "pass",
+		HTTPClient: srv.Client(),
+		now:        func() time.Time { return t0 },
+	}
+	require.NoError(t, e.Export(context.Background(), report))
+
+	require.Equal(t, "application/x-ndjson", gotContentType)
+	require.Equal(t, "user", gotUser)
+	lines := strings.Split(strings.TrimSuffix(gotBody, "\n"), "\n")
+	require.Len(t, lines, 4)
+	action := `{"index":{"_index":"megamon-2021.01.02"}}`
+	require.Equal(t, action, lines[0])
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &doc))
+	require.Equal(t, "2021-01-02T03:04:05Z", doc["@timestamp"])
+	require.Equal(t, "jobset", doc["kind"])
+	require.Equal(t, "uid-1", doc["uid"])
+	require.Equal(t, true, doc["up"])
+	require.Equal(t, "train", doc["jobsetName"])
+	require.Equal(t, "team-a", doc["jobsetNamespace"])
+	require.Equal(t, 2.0, doc["interruptionCount"])
+	require.Equal(t, float64(time.Second), doc["upTime"])
+	require.Equal(t, 0.5, doc["availability"])
+	require.Equal(t, action, lines[2])
+	require.Contains(t, lines[3], `"kind":"jobset-nodes"`)
+	require.Contains(t, lines[3], `"up":false`)
+}
+
+func TestOpenSearchExporterItemErrors(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errors":true,"items":[{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"bad"}}}]}`))
+	}))
+	defer srv.Close()
+
+	report := records.NewReport()
+	report.JobSetsUpSummaries["uid-1"] = records.UpnessSummaryWithAttrs{}
+	e := &OpenSearchExporter{URL: srv.URL, Index: "megamon", HTTPClient: srv.Client()}
+	err := e.Export(context.Background(), report)
+	require.ErrorContains(t, err, "1 documents failed")
+	require.ErrorContains(t, err, "mapper_parsing_exception")
+}
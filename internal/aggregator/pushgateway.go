@@ -0,0 +1,162 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"example.com/megamon/internal/metrics"
+	"example.com/megamon/internal/records"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// PushgatewayExporter pushes per-entity metrics derived from the report to a
+// Prometheus Pushgateway, for short-lived runs that may exit before they are
+// scraped. The metrics are named as those of the metrics package, e.g.
+// megamon_jobset_up and megamon_jobset_nodes_interruption_count_total, so
+// that the same queries work on both.
+//
+// Every JobSet is pushed as its own group, with its UID as the jobset_uid
+// grouping label, so that a JobSet recreated under the same name does not
+// overwrite its predecessor. Every push replaces all metrics of the group,
+// and the groups of JobSets that no longer exist are deleted.
+type PushgatewayExporter struct {
+	// URL is the base URL of the Pushgateway, e.g. http://pushgateway:9091.
+	URL string
+	// Job is the job label of the pushed metrics.
+	Job string
+	// Grouping are additional grouping labels, e.g. the instance.
+	Grouping map[string]string
+
+	HTTPClient *http.Client
+
+	mtx sync.Mutex
+	// pushed are the UIDs of the JobSets of the last export, whose groups
+	// are deleted once the JobSets no longer exist.
+	pushed map[string]bool
+}
+
+// PushgatewayUIDLabel is the grouping label holding the JobSet UID.
+const PushgatewayUIDLabel = "jobset_uid"
+
+var pushgatewayLabels = []string{"kind", "jobset_namespace", "jobset_name", "tpu_topology", "tpu_accelerator", "spot"}
+
+func (e *PushgatewayExporter) Export(ctx context.Context, r records.Report) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	uids := map[string]bool{}
+	for _, m := range []map[string]records.Upness{r.JobSetsUp, r.JobSetNodesUp} {
+		for uid := range m {
+			uids[uid] = true
+		}
+	}
+	for _, m := range []map[string]records.UpnessSummaryWithAttrs{r.JobSetsUpSummaries, r.JobSetNodesUpSummaries} {
+		for uid := range m {
+			uids[uid] = true
+		}
+	}
+	keys := make([]string, 0, len(uids))
+	for uid := range uids {
+		keys = append(keys, uid)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, uid := range keys {
+		if err := e.pusher(uid).Collector(pushgatewayMetrics(r, uid)).PushContext(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("pushing %s to %s: %w", uid, e.URL, err))
+		}
+	}
+	for uid := range e.pushed {
+		if uids[uid] {
+			continue
+		}
+		if err := e.pusher(uid).Delete(); err != nil {
+			errs = append(errs, fmt.Errorf("deleting %s from %s: %w", uid, e.URL, err))
+			// Retried with the next export.
+			uids[uid] = true
+		}
+	}
+	e.pushed = uids
+	return errors.Join(errs...)
+}
+
+// pusher returns the Pusher of the group of the JobSet with the given UID.
+func (e *PushgatewayExporter) pusher(uid string) *push.Pusher {
+	pusher := push.New(e.URL, e.Job)
+	for name, value := range e.Grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	pusher = pusher.Grouping(PushgatewayUIDLabel, uid)
+	if e.HTTPClient != nil {
+		pusher = pusher.Client(e.HTTPClient)
+	}
+	return pusher
+}
+
+// pushgatewayMetrics returns the metrics of the JobSet with the given UID and
+// of its Nodes.
+func pushgatewayMetrics(r records.Report, uid string) pushgatewayCollector {
+	var ms pushgatewayCollector
+	for _, section := range []struct {
+		name      string
+		ups       map[string]records.Upness
+		summaries map[string]records.UpnessSummaryWithAttrs
+	}{
+		{"jobset", r.JobSetsUp, r.JobSetsUpSummaries},
+		{"jobset_nodes", r.JobSetNodesUp, r.JobSetNodesUpSummaries},
+	} {
+		metric := func(name, help string, typ prometheus.ValueType, value float64, attrs records.Attrs) {
+			desc := prometheus.NewDesc(
+				prometheus.BuildFQName(metrics.Namespace, metrics.Prefix, section.name+"_"+name),
+				help, pushgatewayLabels, nil)
+			ms = append(ms, prometheus.MustNewConstMetric(desc, typ, value, pushgatewayLabelValues(attrs)...))
+		}
+		if u, ok := section.ups[uid]; ok {
+			val := 0.0
+			if u.Up() {
+				val = 1
+			}
+			metric("up", "Whether an entity is up (0 or 1).", prometheus.GaugeValue, val, u.Attrs)
+		}
+		if s, ok := section.summaries[uid]; ok {
+			metric("interruption_count_total", "Total number of interruptions of an entity.", prometheus.CounterValue, float64(s.InterruptionCount), s.Attrs)
+			metric("recovery_count_total", "Total number of recoveries of an entity.", prometheus.CounterValue, float64(s.RecoveryCount), s.Attrs)
+			metric("up_time_seconds_total", "Total time an entity has been up.", prometheus.CounterValue, s.UpTime.Seconds(), s.Attrs)
+			metric("down_time_seconds", "Total time an entity has been down.", prometheus.GaugeValue, s.DownTime.Seconds(), s.Attrs)
+			metric("availability", "Fraction of time an entity has been up (0 to 1).", prometheus.GaugeValue, s.Availability, s.Attrs)
+		}
+	}
+	return ms
+}
+
+// pushgatewayCollector collects a fixed set of metrics.
+type pushgatewayCollector []prometheus.Metric
+
+func (c pushgatewayCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c pushgatewayCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c {
+		ch <- m
+	}
+}
+
+// pushgatewayLabelValues returns the values of pushgatewayLabels.
+func pushgatewayLabelValues(attrs records.Attrs) []string {
+	return []string{
+		string(attrs.Kind),
+		attrs.JobSetNamespace,
+		attrs.JobSetName,
+		attrs.TPUTopology,
+		attrs.TPUAccelerator,
+		strconv.FormatBool(attrs.Spot),
+	}
+}
@@ -0,0 +1,109 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/records"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushgatewayExporter(t *testing.T) {
+	t.Parallel()
+
+	report := records.NewReport()
+	attrs := records.Attrs{Kind: records.KindJobSet, JobSetName: "train", JobSetNamespace: "team-a"}
+	report.JobSetsUp["uid-1"] = records.Upness{ReadyCount: 1, ExpectedCount: 1, Attrs: attrs}
+	report.JobSetsUpSummaries["uid-1"] = records.UpnessSummaryWithAttrs{
+		Attrs:        attrs,
+		EventSummary: records.EventSummary{InterruptionCount: 2, UpTime: time.Minute, Availability: 0.5},
+	}
+	nodeAttrs := attrs
+	nodeAttrs.Kind = records.KindJobSetNodes
+	report.JobSetNodesUp["uid-1"] = records.Upness{ExpectedCount: 1, Attrs: nodeAttrs}
+
+	var mtx sync.Mutex
+	var requests []string
+	got := map[string]*dto.MetricFamily{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		dec := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+		for r.Method == http.MethodPut {
+			var mf dto.MetricFamily
+			if err := dec.Decode(&mf); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			got[mf.GetName()] = &mf
+		}
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	e := &PushgatewayExporter{
+		URL:        srv.URL,
+		Job:        "megamon",
+		Grouping:   map[string]string{"cluster": "c1"},
+		HTTPClient: srv.Client(),
+	}
+	require.NoError(t, e.Export(context.Background(), report))
+
+	// Each JobSet is pushed as its own group.
+	require.Equal(t, []string{"PUT /metrics/job/megamon/cluster/c1/jobset_uid/uid-1"}, requests)
+	metric := func(name string) *dto.Metric {
+		mf, ok := got[name]
+		require.True(t, ok, "missing %s", name)
+		require.Len(t, mf.GetMetric(), 1)
+		labels := map[string]string{}
+		for _, l := range mf.GetMetric()[0].GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		require.Equal(t, "team-a", labels["jobset_namespace"])
+		require.Equal(t, "train", labels["jobset_name"])
+		return mf.GetMetric()[0]
+	}
+	// The names and types match those of the metrics package.
+	require.Equal(t, 1.0, metric("megamon_jobset_up").GetGauge().GetValue())
+	require.Equal(t, 0.0, metric("megamon_jobset_nodes_up").GetGauge().GetValue())
+	require.Equal(t, 2.0, metric("megamon_jobset_interruption_count_total").GetCounter().GetValue())
+	require.Equal(t, 60.0, metric("megamon_jobset_up_time_seconds_total").GetCounter().GetValue())
+	require.Equal(t, 0.5, metric("megamon_jobset_availability").GetGauge().GetValue())
+
+	// The groups of JobSets that no longer exist are deleted.
+	requests = nil
+	require.NoError(t, e.Export(context.Background(), records.NewReport()))
+	require.Equal(t, []string{"DELETE /metrics/job/megamon/cluster/c1/jobset_uid/uid-1"}, requests)
+	requests = nil
+	require.NoError(t, e.Export(context.Background(), records.NewReport()))
+	require.Empty(t, requests)
+}
+
+func TestPushgatewayExporterError(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	report := records.NewReport()
+	report.JobSetsUp["uid-1"] = records.Upness{ExpectedCount: 1}
+	e := &PushgatewayExporter{URL: srv.URL, Job: "megamon", HTTPClient: srv.Client()}
+	require.Error(t, e.Export(context.Background(), report))
+}
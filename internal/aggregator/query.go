@@ -0,0 +1,117 @@
+package aggregator
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"example.com/megamon/internal/records"
+)
+
+// JobSetReport is the state of a single JobSet in the report, at both the
+// JobSet and the JobSet Nodes layer.
+type JobSetReport struct {
+	// Key is the JobSet UID.
+	Key    string       `json:"key"`
+	JobSet EntityReport `json:"jobSet"`
+	Nodes  EntityReport `json:"nodes"`
+}
+
+// EntityReport is the state of an entity at one layer.
+type EntityReport struct {
+	Upness  records.Upness       `json:"upness"`
+	Events  records.EventRecords `json:"events"`
+	Summary records.EventSummary `json:"summary"`
+}
+
+// ReportHandler serves the current report for debugging, without hitting the
+// API server:
+//
+//   - /report: the report as pretty JSON, with the raw event records if the
+//     profile query parameter is "full".
+//   - /report/jobsets/{name}: the JobSetReport of the named JobSet. The
+//     namespace query parameter selects between JobSets of the same name.
+//   - /report/exporters: the ExporterHealth of each exporter, by name.
+func (a *Aggregator) ReportHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /report", func(w http.ResponseWriter, req *http.Request) {
+		report, ok := a.readyReport(w)
+		if !ok {
+			return
+		}
+		profile := records.RenderProfile(req.URL.Query().Get("profile"))
+		switch profile {
+		case "":
+			profile = records.RenderProfileSummary
+		case records.RenderProfileSummary, records.RenderProfileFull:
+		default:
+			http.Error(w, "invalid profile", http.StatusBadRequest)
+			return
+		}
+		writePrettyJSON(w, report.Render(profile))
+	})
+	mux.HandleFunc("GET /report/jobsets/{name}", func(w http.ResponseWriter, req *http.Request) {
+		report, ok := a.readyReport(w)
+		if !ok {
+			return
+		}
+		name, namespace := req.PathValue("name"), req.URL.Query().Get("namespace")
+		var keys []string
+		for key, up := range report.JobSetsUp {
+			if up.JobSetName == name && (namespace == "" || up.JobSetNamespace == namespace) {
+				keys = append(keys, key)
+			}
+		}
+		switch len(keys) {
+		case 0:
+			http.Error(w, "jobset not found", http.StatusNotFound)
+			return
+		case 1:
+		default:
+			http.Error(w, "jobset name is ambiguous, set the namespace query parameter", http.StatusConflict)
+			return
+		}
+
+		key := keys[0]
+		writePrettyJSON(w, JobSetReport{
+			Key: key,
+			JobSet: EntityReport{
+				Upness:  report.JobSetsUp[key],
+				Events:  report.JobSetEvents[key],
+				Summary: report.JobSetsUpSummaries[key].EventSummary,
+			},
+			Nodes: EntityReport{
+				Upness:  report.JobSetNodesUp[key],
+				Events:  report.JobSetNodeEvents[key],
+				Summary: report.JobSetNodesUpSummaries[key].EventSummary,
+			},
+		})
+	})
+	mux.HandleFunc("GET /report/exporters", func(w http.ResponseWriter, req *http.Request) {
+		health := a.ExporterHealth()
+		if health == nil {
+			health = map[string]ExporterHealth{}
+		}
+		writePrettyJSON(w, health)
+	})
+	return mux
+}
+
+// readyReport returns the current report, or responds with 503 Service
+// Unavailable if there is none yet.
+func (a *Aggregator) readyReport(w http.ResponseWriter) (records.Report, bool) {
+	if !a.ReportReady() {
+		http.Error(w, "report not ready", http.StatusServiceUnavailable)
+		return records.Report{}, false
+	}
+	return a.Report(), true
+}
+
+func writePrettyJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("failed to write report: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportHandler(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := &Aggregator{}
+	srv := httptest.NewServer(a.ReportHandler())
+	defer srv.Close()
+	get := func(path string) *http.Response {
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	require.Equal(t, http.StatusServiceUnavailable, get("/report").StatusCode)
+	resp := get("/report/exporters")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var health map[string]ExporterHealth
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&health))
+	require.Empty(t, health)
+	a.recordExport(context.Background(), "pushgateway", t0, errors.New("connection refused"))
+	require.NoError(t, json.NewDecoder(get("/report/exporters").Body).Decode(&health))
+	require.Equal(t, map[string]ExporterHealth{
+		"pushgateway": {LastError: "connection refused", LastErrorTime: t0},
+	}, health)
+
+	report := records.NewReport()
+	report.Timestamp = t0
+	for key, ns := range map[string]string{"uid-1": "ns1", "uid-2": "ns2"} {
+		attrs := records.Attrs{JobSetNamespace: ns, JobSetName: "js"}
+		report.JobSetsUp[key] = records.Upness{Attrs: attrs, ExpectedCount: 1, ReadyCount: 1}
+		report.JobSetNodesUp[key] = records.Upness{Attrs: attrs, ExpectedCount: 2, ReadyCount: 1}
+		report.JobSetsUpSummaries[key] = records.UpnessSummaryWithAttrs{Attrs: attrs, EventSummary: records.EventSummary{RecoveryCount: 1}}
+		report.JobSetNodesUpSummaries[key] = records.UpnessSummaryWithAttrs{Attrs: attrs, EventSummary: records.EventSummary{InterruptionCount: 1}}
+	}
+	report.JobSetEvents = map[string]records.EventRecords{
+		"uid-1": {UpEvents: []records.UpEvent{{Up: false, Timestamp: t0}, {Up: true, Timestamp: t0.Add(time.Minute)}}},
+	}
+	a.setReport(report)
+
+	resp = get("/report")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var got records.Report
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	require.Equal(t, report.JobSetsUp, got.JobSetsUp)
+	require.Nil(t, got.JobSetEvents)
+
+	resp = get("/report?profile=full")
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	require.Equal(t, report.JobSetEvents, got.JobSetEvents)
+	require.Equal(t, http.StatusBadRequest, get("/report?profile=other").StatusCode)
+
+	require.Equal(t, http.StatusNotFound, get("/report/jobsets/other").StatusCode)
+	require.Equal(t, http.StatusConflict, get("/report/jobsets/js").StatusCode)
+	resp = get("/report/jobsets/js?namespace=ns1")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var js JobSetReport
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&js))
+	require.Equal(t, "uid-1", js.Key)
+	require.Equal(t, report.JobSetsUp["uid-1"], js.JobSet.Upness)
+	require.Equal(t, report.JobSetEvents["uid-1"], js.JobSet.Events)
+	require.Equal(t, 1, js.JobSet.Summary.RecoveryCount)
+	require.Equal(t, int32(1), js.Nodes.Upness.ReadyCount)
+	require.Equal(t, 1, js.Nodes.Summary.InterruptionCount)
+}
@@ -0,0 +1,135 @@
+package aggregator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ReplayEvents are synthetic events that the aggregator reports as if
+// observed, e.g. to build dashboards against interruptions that can't be
+// caused on demand, e.g.
+//
+//	{
+//	  "jobSets": {
+//	    "uid-1": {
+//	      "jobsetNamespace": "default",
+//	      "jobsetName": "js-1",
+//	      "upEvents": [
+//	        {"up": false, "ts": "2021-01-01T00:00:00Z"},
+//	        {"up": true, "ts": "2021-01-01T00:10:00Z"},
+//	        {"up": false, "ts": "2021-01-01T03:00:00Z"}
+//	      ]
+//	    }
+//	  }
+//	}
+//
+// Entities are keyed by JobSet UID as in the report. Events are only visible
+// once their timestamp has passed, so events in the future are replayed as
+// time goes by.
+type ReplayEvents struct {
+	JobSets     map[string]ReplayEntity `json:"jobSets,omitempty"`
+	JobSetNodes map[string]ReplayEntity `json:"jobSetNodes,omitempty"`
+}
+
+// ReplayEntity is an entity of ReplayEvents. Its Kind is set by the
+// aggregator.
+type ReplayEntity struct {
+	records.Attrs
+	UpEvents []records.UpEvent `json:"upEvents"`
+}
+
+// LoadReplayEvents reads ReplayEvents from a JSON file, with the events of
+// every entity sorted by time. The events of each entity must alternate
+// between down and up at distinct timestamps, as recorded ones do.
+func LoadReplayEvents(path string) (*ReplayEvents, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var r ReplayEvents
+	if err := dec.Decode(&r); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for field, entities := range map[string]map[string]ReplayEntity{"jobSets": r.JobSets, "jobSetNodes": r.JobSetNodes} {
+		for key, e := range entities {
+			sort.SliceStable(e.UpEvents, func(i, j int) bool {
+				return e.UpEvents[i].Timestamp.Before(e.UpEvents[j].Timestamp)
+			})
+			if err := validateReplayEvents(e.UpEvents); err != nil {
+				return nil, fmt.Errorf("parsing %s: %s %q: %w", path, field, key, err)
+			}
+		}
+	}
+	return &r, nil
+}
+
+// validateReplayEvents returns an error unless the sorted events alternate
+// between down and up at distinct timestamps.
+func validateReplayEvents(events []records.UpEvent) error {
+	for i := 1; i < len(events); i++ {
+		prev, e := events[i-1], events[i]
+		if e.Timestamp.Equal(prev.Timestamp) {
+			return fmt.Errorf("duplicate timestamp %s", e.Timestamp.Format(time.RFC3339Nano))
+		}
+		if e.Up == prev.Up {
+			return fmt.Errorf("event at %s repeats up=%t instead of alternating", e.Timestamp.Format(time.RFC3339Nano), e.Up)
+		}
+	}
+	return nil
+}
+
+// replayEvents returns the events of Replay that are visible at now for the
+// kind recorded in the ConfigMap, along with the keys of the entities that
+// had an event appended since the last aggregation, and sets the upness of
+// each entity to that of its last visible event. Entities without visible
+// events don't exist yet.
+func (a *Aggregator) replayEvents(now time.Time, cmRef types.NamespacedName, ups map[string]records.Upness) (map[string]records.EventRecords, []string) {
+	var kind records.Kind
+	var entities map[string]ReplayEntity
+	switch cmRef {
+	case a.JobSetEventsConfigMapRef:
+		kind, entities = records.KindJobSet, a.Replay.JobSets
+	case a.JobSetNodeEventsConfigMapRef:
+		kind, entities = records.KindJobSetNodes, a.Replay.JobSetNodes
+	}
+
+	if a.replayedCounts == nil {
+		a.replayedCounts = map[records.Kind]map[string]int{}
+	}
+	counts := make(map[string]int, len(entities))
+	recs := make(map[string]records.EventRecords, len(entities))
+	var appended []string
+	for key, e := range entities {
+		n := sort.Search(len(e.UpEvents), func(i int) bool {
+			return e.UpEvents[i].Timestamp.After(now)
+		})
+		if n == 0 {
+			continue
+		}
+		attrs := e.Attrs
+		attrs.Kind = kind
+		up := records.Upness{Attrs: attrs, ExpectedCount: 1}
+		if e.UpEvents[n-1].Up {
+			up.ReadyCount = 1
+		}
+		ups[key] = up
+		// Exporters must not share the replayed events.
+		recs[key] = records.EventRecords{UpEvents: append([]records.UpEvent(nil), e.UpEvents[:n]...)}
+		counts[key] = n
+		if n > a.replayedCounts[kind][key] {
+			appended = append(appended, key)
+		}
+	}
+	a.replayedCounts[kind] = counts
+	sort.Strings(appended)
+	return recs, appended
+}
@@ -0,0 +1,150 @@
+package aggregator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAggregateReplay(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UTC()
+	ts := func(d time.Duration) string { return now.Add(d).Format(time.RFC3339Nano) }
+	path := filepath.Join(t.TempDir(), "events.json")
+	// The events are out of order, the last one is in the future.
+	require.NoError(t, os.WriteFile(path, []byte(`{
+  "jobSets": {
+    "uid-1": {
+      "jobsetNamespace": "default",
+      "jobsetName": "js-1",
+      "upEvents": [
+        {"up": true, "ts": "`+ts(-2*time.Hour)+`"},
+        {"up": false, "ts": "`+ts(-3*time.Hour)+`"},
+        {"up": false, "ts": "`+ts(-time.Hour)+`"},
+        {"up": true, "ts": "`+ts(time.Hour)+`"}
+      ]
+    },
+    "uid-2": {
+      "jobsetNamespace": "default",
+      "jobsetName": "js-2",
+      "upEvents": [{"up": false, "ts": "`+ts(time.Hour)+`"}]
+    }
+  },
+  "jobSetNodes": {
+    "uid-1": {
+      "jobsetNamespace": "default",
+      "jobsetName": "js-1",
+      "upEvents": [{"up": true, "ts": "`+ts(-3*time.Hour)+`"}]
+    }
+  }
+}`), 0o644))
+	replay, err := LoadReplayEvents(path)
+	require.NoError(t, err)
+
+	// No objects: the cluster is not observed.
+	a := &Aggregator{
+		Client:                       fake.NewClientBuilder().WithScheme(runtime.NewScheme()).Build(),
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+		Replay:                       replay,
+	}
+	transitions, unsubscribe := a.SubscribeTransitions()
+	defer unsubscribe()
+	require.NoError(t, a.Aggregate(context.Background()))
+
+	report := a.Report()
+	// uid-2 has no events yet.
+	require.Len(t, report.JobSetsUp, 1)
+	up := report.JobSetsUp["uid-1"]
+	require.False(t, up.Up())
+	require.Equal(t, records.KindJobSet, up.Kind)
+	require.Equal(t, "js-1", up.JobSetName)
+	require.Len(t, report.JobSetEvents["uid-1"].UpEvents, 3)
+	require.Equal(t, 1, report.JobSetsUpSummaries["uid-1"].InterruptionCount)
+	require.True(t, report.JobSetNodesUp["uid-1"].Up())
+	require.Equal(t, records.KindJobSetNodes, report.JobSetNodesUp["uid-1"].Kind)
+
+	select {
+	case tr := <-transitions:
+		require.Equal(t, "uid-1", tr.Key)
+	case <-time.After(time.Second):
+		t.Fatal("no transition published")
+	}
+
+	_, err = LoadReplayEvents(filepath.Join(t.TempDir(), "missing.json"))
+	require.Error(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(`{"nodes": {}}`), 0o644))
+	_, err = LoadReplayEvents(path)
+	require.ErrorContains(t, err, "unknown field")
+}
+
+func TestAggregateInterruptionsByStepRange(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UTC()
+	step := func(n int64) *int64 { return &n }
+	a := &Aggregator{
+		Client:                       fake.NewClientBuilder().WithScheme(runtime.NewScheme()).Build(),
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+		StepRangeWidth:               1000,
+		Replay: &ReplayEvents{JobSets: map[string]ReplayEntity{
+			"uid-1": {UpEvents: []records.UpEvent{
+				{Up: false, Timestamp: now.Add(-5 * time.Hour)},
+				{Up: true, Timestamp: now.Add(-4 * time.Hour)},
+				{Up: false, Timestamp: now.Add(-3 * time.Hour), Step: step(1500)},
+				{Up: true, Timestamp: now.Add(-150 * time.Minute)},
+				{Up: false, Timestamp: now.Add(-2 * time.Hour), Step: step(1900)},
+				{Up: true, Timestamp: now.Add(-90 * time.Minute)},
+				{Up: false, Timestamp: now.Add(-time.Hour), Step: step(2100)},
+			}},
+			// JobSets without interruptions at a known step are omitted.
+			"uid-2": {UpEvents: []records.UpEvent{
+				{Up: false, Timestamp: now.Add(-5 * time.Hour)},
+				{Up: true, Timestamp: now.Add(-4 * time.Hour)},
+				{Up: false, Timestamp: now.Add(-3 * time.Hour)},
+			}},
+		}},
+	}
+	require.NoError(t, a.Aggregate(context.Background()))
+	require.Equal(t, map[string]map[int64]int{"uid-1": {1000: 2, 2000: 1}}, a.Report().JobSetInterruptionsByStepRange)
+}
+
+func TestLoadReplayEventsInvalid(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		upEvents string
+		expErr   string
+	}{
+		"repeated state": {
+			upEvents: `[{"up": false, "ts": "2021-01-01T00:00:00Z"}, {"up": false, "ts": "2021-01-01T01:00:00Z"}]`,
+			expErr:   `jobSets "uid-1": event at 2021-01-01T01:00:00Z repeats up=false instead of alternating`,
+		},
+		"repeated state out of order": {
+			upEvents: `[{"up": true, "ts": "2021-01-01T02:00:00Z"}, {"up": false, "ts": "2021-01-01T00:00:00Z"}, {"up": true, "ts": "2021-01-01T01:00:00Z"}]`,
+			expErr:   `jobSets "uid-1": event at 2021-01-01T02:00:00Z repeats up=true instead of alternating`,
+		},
+		"duplicate timestamp": {
+			upEvents: `[{"up": false, "ts": "2021-01-01T00:00:00Z"}, {"up": true, "ts": "2021-01-01T00:00:00Z"}]`,
+			expErr:   `jobSets "uid-1": duplicate timestamp 2021-01-01T00:00:00Z`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "events.json")
+			require.NoError(t, os.WriteFile(path, []byte(`{"jobSets": {"uid-1": {"upEvents": `+c.upEvents+`}}}`), 0o644))
+			_, err := LoadReplayEvents(path)
+			require.ErrorContains(t, err, c.expErr)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package aggregator
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"example.com/megamon/internal/records"
+)
+
+// Settings ConfigMap keys. Keys that are not set keep their base value.
+const (
+	SettingsKeyInterval                        = "interval"
+	SettingsKeyAlignInterval                   = "alignInterval"
+	SettingsKeyAvailabilityExcludeProvisioning = "availabilityExcludeProvisioning"
+	SettingsKeySettlePeriod                    = "settlePeriod"
+	SettingsKeyAtRiskMinUpStreak               = "atRiskMinUpStreak"
+	SettingsKeyAtRiskBurstCount                = "atRiskBurstCount"
+	SettingsKeyAtRiskBurstWindow               = "atRiskBurstWindow"
+	SettingsKeyAtRiskSlowRecovery              = "atRiskSlowRecovery"
+	SettingsKeyAlertWindow                     = "alertWindow"
+	SettingsKeyAlertFireAbove                  = "alertFireAbove"
+	SettingsKeyAlertClearBelow                 = "alertClearBelow"
+	SettingsKeySLOTarget                       = "sloTarget"
+	SettingsKeySLOWindow                       = "sloWindow"
+	SettingsKeyProvisioningSLA                 = "provisioningSLA"
+	// SettingsKeyOutages lists global outage windows, see
+	// records.ParseOutages. It can be maintained manually or by automation
+	// that detects outages of shared dependencies.
+	SettingsKeyOutages = "outages"
+)
+
+// ParseSettings overrides base with the values set in data (e.g. the data of
+// a config ConfigMap) and validates the result.
+func ParseSettings(data map[string]string, base Settings) (Settings, error) {
+	s := base
+	var errs []error
+
+	duration := func(key string, dst *time.Duration) {
+		val, ok := data[key]
+		if !ok {
+			return
+		}
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			return
+		}
+		*dst = d
+	}
+	boolean := func(key string, dst *bool) {
+		val, ok := data[key]
+		if !ok {
+			return
+		}
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			return
+		}
+		*dst = b
+	}
+	integer := func(key string, dst *int) {
+		val, ok := data[key]
+		if !ok {
+			return
+		}
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			return
+		}
+		*dst = n
+	}
+
+	duration(SettingsKeyInterval, &s.Interval)
+	boolean(SettingsKeyAlignInterval, &s.AlignInterval)
+	boolean(SettingsKeyAvailabilityExcludeProvisioning, &s.SummaryOptions.ExcludeProvisioning)
+	duration(SettingsKeySettlePeriod, &s.SummaryOptions.SettlePeriod)
+	duration(SettingsKeyProvisioningSLA, &s.SummaryOptions.ProvisioningSLA)
+	duration(SettingsKeyAtRiskMinUpStreak, &s.SummaryOptions.AtRisk.MinUpStreak)
+	duration(SettingsKeyAtRiskBurstWindow, &s.SummaryOptions.AtRisk.BurstWindow)
+	duration(SettingsKeyAtRiskSlowRecovery, &s.SummaryOptions.AtRisk.SlowRecovery)
+	integer(SettingsKeyAtRiskBurstCount, &s.SummaryOptions.AtRisk.BurstCount)
+
+	duration(SettingsKeyAlertWindow, &s.SummaryOptions.Alert.Window)
+	integer(SettingsKeyAlertFireAbove, &s.SummaryOptions.Alert.FireAbove)
+	integer(SettingsKeyAlertClearBelow, &s.SummaryOptions.Alert.ClearBelow)
+
+	duration(SettingsKeySLOWindow, &s.SummaryOptions.SLO.Window)
+	if val, ok := data[SettingsKeySLOTarget]; ok {
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", SettingsKeySLOTarget, err))
+		} else {
+			s.SummaryOptions.SLO.Target = f
+		}
+	}
+
+	if val, ok := data[SettingsKeyOutages]; ok {
+		outages, err := records.ParseOutages(val)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", SettingsKeyOutages, err))
+		} else {
+			s.SummaryOptions.Outages = outages
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return base, err
+	}
+	if err := s.Validate(); err != nil {
+		return base, err
+	}
+	return s, nil
+}
@@ -0,0 +1,183 @@
+package aggregator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/megamon/internal/records"
+)
+
+// SlackExporter posts a message to a Slack (or Microsoft Teams) incoming
+// webhook whenever entities are interrupted or recover, i.e. their
+// InterruptionCount or RecoveryCount grew since the previous report.
+//
+// The first report only sets the baseline, unless Seed was called with the
+// report from before a restart, so that changes are notified once across
+// restarts.
+type SlackExporter struct {
+	URL string
+	// Timeout bounds each request, defaults to DefaultWebhookTimeout.
+	Timeout time.Duration
+	// MinInterval rate limits the messages about each entity while it is
+	// flapping: changes within MinInterval of the last message about the
+	// entity are included in the next message once MinInterval passed.
+	MinInterval time.Duration
+
+	HTTPClient *http.Client
+
+	mtx      sync.Mutex
+	baseline bool
+	// notified are the counts of the last notified (or baseline) summary,
+	// and lastSent the time of the last message, by slackEntity.
+	notified map[string]slackCounts
+	lastSent map[string]time.Time
+}
+
+type slackCounts struct {
+	interruptions, recoveries int
+}
+
+// Seed sets the report that the first exported report is diffed against.
+func (e *SlackExporter) Seed(r records.Report) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.notified = slackSummaryCounts(r)
+	e.baseline = true
+}
+
+func (e *SlackExporter) Export(ctx context.Context, r records.Report) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	counts := slackSummaryCounts(r)
+	if !e.baseline {
+		e.notified, e.baseline = counts, true
+		return nil
+	}
+	if e.lastSent == nil {
+		e.lastSent = map[string]time.Time{}
+	}
+
+	now := reportTime(r)
+	notified := make(map[string]slackCounts, len(counts))
+	var lines, sent []string
+	for _, layer := range []struct {
+		kind      records.Kind
+		name      string
+		summaries map[string]records.UpnessSummaryWithAttrs
+	}{
+		{records.KindJobSet, "JobSet", r.JobSetsUpSummaries},
+		{records.KindJobSetNodes, "JobSet Nodes of", r.JobSetNodesUpSummaries},
+	} {
+		for key, summary := range layer.summaries {
+			entity := slackEntity(layer.kind, key)
+			cur, prev := counts[entity], e.notified[entity]
+			notified[entity] = prev
+			switch {
+			case cur.interruptions < prev.interruptions || cur.recoveries < prev.recoveries:
+				// Truncated events, start over.
+				notified[entity] = cur
+				continue
+			case cur == prev:
+				continue
+			case now.Sub(e.lastSent[entity]) < e.MinInterval:
+				continue
+			}
+			notified[entity] = cur
+			sent = append(sent, entity)
+
+			state := "recovered"
+			if cur.interruptions > prev.interruptions {
+				state = "was interrupted"
+			}
+			lines = append(lines, fmt.Sprintf("%s %s/%s %s: %d interruptions, down %v so far",
+				layer.name, summary.JobSetNamespace, summary.JobSetName, state,
+				summary.InterruptionCount, summary.DownTime.Round(time.Second)))
+		}
+	}
+
+	if len(lines) > 0 {
+		sort.Strings(lines)
+		if r.ClusterName != "" {
+			lines = append([]string{"Cluster " + r.ClusterName + ":"}, lines...)
+		}
+		if err := e.post(ctx, strings.Join(lines, "\n")); err != nil {
+			return err
+		}
+	}
+
+	// Only advance once the message was delivered, so that a failed post is
+	// retried with the next report. Deleted entities are forgotten.
+	for _, entity := range sent {
+		e.lastSent[entity] = now
+	}
+	for entity := range e.lastSent {
+		if _, ok := notified[entity]; !ok {
+			delete(e.lastSent, entity)
+		}
+	}
+	e.notified = notified
+	return nil
+}
+
+func (e *SlackExporter) post(ctx context.Context, text string) error {
+	jsn, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(jsn))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	c := e.HTTPClient
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting slack message: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("posting slack message: unexpected status %s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+func slackSummaryCounts(r records.Report) map[string]slackCounts {
+	counts := map[string]slackCounts{}
+	for _, layer := range []struct {
+		kind      records.Kind
+		summaries map[string]records.UpnessSummaryWithAttrs
+	}{
+		{records.KindJobSet, r.JobSetsUpSummaries},
+		{records.KindJobSetNodes, r.JobSetNodesUpSummaries},
+	} {
+		for key, s := range layer.summaries {
+			counts[slackEntity(layer.kind, key)] = slackCounts{interruptions: s.InterruptionCount, recoveries: s.RecoveryCount}
+		}
+	}
+	return counts
+}
+
+func slackEntity(kind records.Kind, key string) string {
+	return string(kind) + "/" + key
+}
@@ -0,0 +1,101 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlackExporter(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	require.NoError(t, err)
+
+	var mtx sync.Mutex
+	var messages []string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		var msg struct {
+			Text string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if status != http.StatusOK {
+			http.Error(w, "unavailable", status)
+			return
+		}
+		messages = append(messages, msg.Text)
+	}))
+	defer srv.Close()
+	posted := func() []string {
+		mtx.Lock()
+		defer mtx.Unlock()
+		defer func() { messages = nil }()
+		return messages
+	}
+
+	report := func(ts time.Time, interruptions, recoveries int) records.Report {
+		r := records.NewReport()
+		r.Timestamp = ts
+		r.ClusterName = "cluster"
+		r.JobSetsUpSummaries["uid"] = records.UpnessSummaryWithAttrs{
+			Attrs: records.Attrs{JobSetNamespace: "ns", JobSetName: "js"},
+			EventSummary: records.EventSummary{
+				InterruptionCount: interruptions,
+				RecoveryCount:     recoveries,
+				DownTime:          time.Duration(interruptions) * time.Minute,
+			},
+		}
+		return r
+	}
+
+	e := &SlackExporter{URL: srv.URL, MinInterval: 10 * time.Minute, HTTPClient: srv.Client()}
+
+	// The first report only sets the baseline.
+	require.NoError(t, e.Export(context.Background(), report(t0, 1, 1)))
+	require.Empty(t, posted())
+
+	require.NoError(t, e.Export(context.Background(), report(t0.Add(time.Minute), 2, 1)))
+	require.Equal(t, []string{"Cluster cluster:\nJobSet ns/js was interrupted: 2 interruptions, down 2m0s so far"}, posted())
+	require.NoError(t, e.Export(context.Background(), report(t0.Add(2*time.Minute), 2, 1)))
+	require.Empty(t, posted())
+
+	// Flapping is rate limited, and the changes are included in the next
+	// message.
+	require.NoError(t, e.Export(context.Background(), report(t0.Add(3*time.Minute), 2, 2)))
+	require.NoError(t, e.Export(context.Background(), report(t0.Add(4*time.Minute), 3, 2)))
+	require.Empty(t, posted())
+	require.NoError(t, e.Export(context.Background(), report(t0.Add(11*time.Minute), 3, 3)))
+	require.Equal(t, []string{"Cluster cluster:\nJobSet ns/js was interrupted: 3 interruptions, down 3m0s so far"}, posted())
+
+	// Failed posts are retried with the next report.
+	mtx.Lock()
+	status = http.StatusServiceUnavailable
+	mtx.Unlock()
+	require.ErrorContains(t, e.Export(context.Background(), report(t0.Add(30*time.Minute), 4, 3)), "503")
+	mtx.Lock()
+	status = http.StatusOK
+	mtx.Unlock()
+	require.NoError(t, e.Export(context.Background(), report(t0.Add(31*time.Minute), 4, 3)))
+	require.Len(t, posted(), 1)
+
+	// After a restart, changes since the seeded report are notified once.
+	e = &SlackExporter{URL: srv.URL, HTTPClient: srv.Client()}
+	e.Seed(report(t0.Add(31*time.Minute), 4, 3))
+	require.NoError(t, e.Export(context.Background(), report(t0.Add(40*time.Minute), 4, 4)))
+	require.Equal(t, []string{"Cluster cluster:\nJobSet ns/js recovered: 4 interruptions, down 4m0s so far"}, posted())
+	require.NoError(t, e.Export(context.Background(), report(t0.Add(41*time.Minute), 4, 4)))
+	require.Empty(t, posted())
+}
@@ -0,0 +1,154 @@
+package aggregator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"example.com/megamon/internal/records"
+
+	// Registers the pure-Go "sqlite" database/sql driver.
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema is applied every time the database is opened.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS summaries (
+	ts                        TEXT    NOT NULL,
+	kind                      TEXT    NOT NULL,
+	uid                       TEXT    NOT NULL,
+	up                        INTEGER NOT NULL,
+	jobset_name               TEXT    NOT NULL,
+	jobset_namespace          TEXT    NOT NULL,
+	tpu_topology              TEXT    NOT NULL,
+	tpu_accelerator           TEXT    NOT NULL,
+	spot                      INTEGER NOT NULL,
+	node_pool_name            TEXT    NOT NULL,
+	availability              REAL    NOT NULL,
+	interruption_count        INTEGER NOT NULL,
+	recovery_count            INTEGER NOT NULL,
+	up_time_seconds           REAL    NOT NULL,
+	down_time_seconds         REAL    NOT NULL,
+	down_time_initial_seconds REAL    NOT NULL,
+	at_risk                   INTEGER NOT NULL,
+	summary                   TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS summaries_uid_ts ON summaries (uid, ts);
+`
+
+// SQLiteExporter appends one summary row per entity per aggregation to a
+// local SQLite database, for ad-hoc analysis with SQL. The schema is created
+// if it does not exist. Timestamps are stored as UTC RFC 3339 text so that
+// they work with SQLite's date and time functions, and the full summary is
+// stored as JSON in the summary column for use with json_extract.
+type SQLiteExporter struct {
+	// Path is the database file, created if it does not exist.
+	Path string
+
+	mtx sync.Mutex
+	db  *sql.DB
+
+	// now is overridden in tests.
+	now func() time.Time
+}
+
+func (e *SQLiteExporter) Export(ctx context.Context, r records.Report) error {
+	now := reportTime(r)
+	if e.now != nil {
+		now = e.now()
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.db == nil {
+		db, err := openSQLite(ctx, e.Path)
+		if err != nil {
+			return err
+		}
+		e.db = db
+	}
+
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO summaries (
+		ts, kind, uid, up,
+		jobset_name, jobset_namespace, tpu_topology, tpu_accelerator, spot, node_pool_name,
+		availability, interruption_count, recovery_count,
+		up_time_seconds, down_time_seconds, down_time_initial_seconds,
+		at_risk, summary
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("preparing insert: %w", err)
+	}
+	defer stmt.Close()
+
+	ts := now.UTC().Format(time.RFC3339Nano)
+	for _, section := range []struct {
+		kind      string
+		ups       map[string]records.Upness
+		summaries map[string]records.UpnessSummaryWithAttrs
+	}{
+		{string(records.KindJobSet), r.JobSetsUp, r.JobSetsUpSummaries},
+		{string(records.KindJobSetNodes), r.JobSetNodesUp, r.JobSetNodesUpSummaries},
+	} {
+		keys := make([]string, 0, len(section.summaries))
+		for key := range section.summaries {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := section.summaries[key]
+			summary, err := json.Marshal(s.EventSummary)
+			if err != nil {
+				return err
+			}
+			if _, err := stmt.ExecContext(ctx,
+				ts, section.kind, key, section.ups[key].Up(),
+				s.JobSetName, s.JobSetNamespace, s.TPUTopology, s.TPUAccelerator, s.Spot, s.NodePoolName,
+				s.Availability, s.InterruptionCount, s.RecoveryCount,
+				s.UpTime.Seconds(), s.DownTime.Seconds(), s.DownTimeInitial.Seconds(),
+				s.AtRisk, string(summary),
+			); err != nil {
+				return fmt.Errorf("inserting summary for %s/%s: %w", section.kind, key, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database if it was opened.
+func (e *SQLiteExporter) Close() error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if e.db == nil {
+		return nil
+	}
+	err := e.db.Close()
+	e.db = nil
+	return err
+}
+
+func openSQLite(ctx context.Context, path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("opening sqlite database: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating sqlite schema: %w", err)
+	}
+	return db, nil
+}
@@ -0,0 +1,78 @@
+package aggregator
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteExporter(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-02T03:04:05Z")
+	require.NoError(t, err)
+
+	report := records.NewReport()
+	attrs := records.Attrs{JobSetName: "train", JobSetNamespace: "team-a", Spot: true}
+	report.JobSetsUp["uid-1"] = records.Upness{ReadyCount: 1, ExpectedCount: 1, Attrs: attrs}
+	report.JobSetsUpSummaries["uid-1"] = records.UpnessSummaryWithAttrs{
+		Attrs:        attrs,
+		EventSummary: records.EventSummary{InterruptionCount: 2, UpTime: time.Minute, Availability: 0.5},
+	}
+	report.JobSetNodesUp["uid-1"] = records.Upness{ReadyCount: 1, ExpectedCount: 2, Attrs: attrs}
+	report.JobSetNodesUpSummaries["uid-1"] = records.UpnessSummaryWithAttrs{Attrs: attrs}
+
+	path := filepath.Join(t.TempDir(), "megamon.db")
+	now := t0
+	e := &SQLiteExporter{Path: path, now: func() time.Time { return now }}
+	require.NoError(t, e.Export(context.Background(), report))
+	now = t0.Add(10 * time.Second)
+	require.NoError(t, e.Export(context.Background(), report))
+	require.NoError(t, e.Close())
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM summaries`).Scan(&count))
+	require.Equal(t, 4, count)
+
+	rows, err := db.Query(`SELECT ts, up, jobset_name, spot, availability, interruption_count, up_time_seconds,
+		json_extract(summary, '$.interruptionCount')
+		FROM summaries WHERE kind = 'jobset' AND uid = 'uid-1' ORDER BY ts`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	type row struct {
+		ts                string
+		up                bool
+		jobSetName        string
+		spot              bool
+		availability      float64
+		interruptionCount int
+		upTimeSeconds     float64
+		jsonInterruptions int
+	}
+	var got []row
+	for rows.Next() {
+		var r row
+		require.NoError(t, rows.Scan(&r.ts, &r.up, &r.jobSetName, &r.spot, &r.availability,
+			&r.interruptionCount, &r.upTimeSeconds, &r.jsonInterruptions))
+		got = append(got, r)
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, []row{
+		{"2021-01-02T03:04:05Z", true, "train", true, 0.5, 2, 60, 2},
+		{"2021-01-02T03:04:15Z", true, "train", true, 0.5, 2, 60, 2},
+	}, got)
+
+	var nodesUp bool
+	require.NoError(t, db.QueryRow(`SELECT up FROM summaries WHERE kind = 'jobset-nodes' LIMIT 1`).Scan(&nodesUp))
+	require.False(t, nodesUp)
+}
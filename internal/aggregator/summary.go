@@ -0,0 +1,146 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"example.com/megamon/internal/k8sutils"
+	"example.com/megamon/internal/records"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+var (
+	DefaultJobSetEventsConfigMapRef = types.NamespacedName{
+		Namespace: "megamon-system",
+		Name:      "megamon-jobset-events",
+	}
+	DefaultJobSetNodeEventsConfigMapRef = types.NamespacedName{
+		Namespace: "megamon-system",
+		Name:      "megamon-jobset-node-events",
+	}
+	DefaultJobEventsConfigMapRef = types.NamespacedName{
+		Namespace: "megamon-system",
+		Name:      "megamon-job-events",
+	}
+)
+
+// EntityKind is the kind of entity that is summarized.
+type EntityKind = records.Kind
+
+const (
+	// EntityJobSet is the upness of the JobSet's Jobs.
+	EntityJobSet = records.KindJobSet
+	// EntityJobSetNodes is the upness of the Nodes a JobSet runs on.
+	EntityJobSetNodes = records.KindJobSetNodes
+)
+
+// EntityKey identifies a summarized entity.
+type EntityKey struct {
+	Kind EntityKind
+	types.NamespacedName
+}
+
+// ParseEntityKey parses keys of the form <kind>/<namespace>/<name>.
+func ParseEntityKey(s string) (EntityKey, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return EntityKey{}, fmt.Errorf("invalid entity key %q, expected <kind>/<namespace>/<name>", s)
+	}
+	key := EntityKey{
+		Kind:           EntityKind(parts[0]),
+		NamespacedName: types.NamespacedName{Namespace: parts[1], Name: parts[2]},
+	}
+	switch key.Kind {
+	case EntityJobSet, EntityJobSetNodes:
+	default:
+		return EntityKey{}, fmt.Errorf("invalid entity kind %q", parts[0])
+	}
+	return key, nil
+}
+
+func (k EntityKey) String() string {
+	return string(k.Kind) + "/" + k.Namespace + "/" + k.Name
+}
+
+// SummaryFor computes the current summary of a single entity on demand,
+// reading the recorded events from the default event ConfigMaps. The
+// ConfigMaps are not modified.
+func SummaryFor(ctx context.Context, c client.Client, key EntityKey) (records.EventSummary, error) {
+	a := &Aggregator{
+		Client:                       c,
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+	}
+	return a.SummaryFor(ctx, key)
+}
+
+// SummaryFor computes the current summary of a single entity on demand using
+// the Aggregator's configuration. The event ConfigMaps are not modified.
+func (a *Aggregator) SummaryFor(ctx context.Context, key EntityKey) (records.EventSummary, error) {
+	var js jobset.JobSet
+	if err := a.Get(ctx, key.NamespacedName, &js); err != nil {
+		return records.EventSummary{}, fmt.Errorf("getting jobset: %w", err)
+	}
+	if !a.monitored(&js) {
+		return records.EventSummary{}, fmt.Errorf("jobset %s is not monitored, see the jobset selector and namespaces", key.NamespacedName)
+	}
+
+	var up records.Upness
+	var cmRef types.NamespacedName
+	switch key.Kind {
+	case EntityJobSet:
+		up = jobSetUpness(&js)
+		cmRef = a.JobSetEventsConfigMapRef
+	case EntityJobSetNodes:
+		up = records.Upness{
+			ExpectedCount: k8sutils.GetExpectedNodeCount(&js),
+			Pending:       !k8sutils.IsJobSetExpectedToRun(&js),
+		}
+		var nodeList corev1.NodeList
+		if err := a.List(ctx, &nodeList); err != nil {
+			return records.EventSummary{}, fmt.Errorf("listing nodes: %w", err)
+		}
+		isNodeReady, err := a.nodeReadyFunc(ctx)
+		if err != nil {
+			return records.EventSummary{}, err
+		}
+		for _, node := range nodeList.Items {
+			jsNS, jsName := k8sutils.GetJobSetForNode(&node)
+			if jsNS == js.Namespace && jsName == js.Name && isNodeReady(&node) {
+				up.ReadyCount++
+			}
+		}
+		cmRef = a.JobSetNodeEventsConfigMapRef
+	default:
+		return records.EventSummary{}, fmt.Errorf("invalid entity kind %q", key.Kind)
+	}
+
+	var rec records.EventRecords
+	var cm corev1.ConfigMap
+	if err := a.Get(ctx, cmRef, &cm); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return records.EventSummary{}, fmt.Errorf("failed to get event records configmap: %w", err)
+		}
+	} else {
+		recs, err := k8sutils.GetEventRecordsFromConfigMap(&cm)
+		if err != nil {
+			return records.EventSummary{}, fmt.Errorf("failed to get event records from configmap: %w", err)
+		}
+		rec = recs[string(js.UID)]
+	}
+
+	// Include the current state without persisting it.
+	now := time.Now()
+	rec.UpEvents = append([]records.UpEvent(nil), rec.UpEvents...)
+	if !up.Pending || len(rec.UpEvents) > 0 {
+		records.AppendUpEvent(now, &rec, up.Up())
+	}
+
+	return rec.SummarizeWithOptions(now, a.Settings().SummaryOptions), nil
+}
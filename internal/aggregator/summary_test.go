@@ -0,0 +1,122 @@
+package aggregator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/k8sutils"
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestSummaryFor(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	js := &jobset.JobSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "train", UID: "uid-1"},
+		Spec: jobset.JobSetSpec{
+			ReplicatedJobs: []jobset.ReplicatedJob{{Name: "rj", Replicas: 2}},
+		},
+		Status: jobset.JobSetStatus{
+			ReplicatedJobsStatus: []jobset.ReplicatedJobStatus{{Name: "rj", Ready: 2}},
+		},
+	}
+	node := func(name string, ready corev1.ConditionStatus) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{
+				"google.com/tpu-provisioner-jobset-namespace": "default",
+				"google.com/tpu-provisioner-jobset-name":      "train",
+			}},
+			Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: ready},
+			}},
+		}
+	}
+
+	now := time.Now()
+	history := map[string]records.EventRecords{
+		"uid-1": {UpEvents: []records.UpEvent{
+			{Up: false, Timestamp: now.Add(-2 * time.Hour)},
+			{Up: true, Timestamp: now.Add(-time.Hour)},
+		}},
+	}
+	var cms []*corev1.ConfigMap
+	for _, ref := range []types.NamespacedName{DefaultJobSetEventsConfigMapRef, DefaultJobSetNodeEventsConfigMapRef} {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name}}
+		require.NoError(t, k8sutils.SetEventRecordsInConfigMap(cm, history))
+		cms = append(cms, cm)
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(js, node("node-a", corev1.ConditionTrue), node("node-b", corev1.ConditionFalse), cms[0], cms[1]).
+		Build()
+
+	t.Run("jobset up", func(t *testing.T) {
+		t.Parallel()
+		got, err := SummaryFor(context.Background(), c, EntityKey{
+			Kind:           EntityJobSet,
+			NamespacedName: types.NamespacedName{Namespace: "default", Name: "train"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, 0, got.InterruptionCount)
+		require.Equal(t, time.Hour, got.DownTimeInitial)
+		require.InDelta(t, time.Hour.Seconds(), got.UpTime.Seconds(), 5)
+		require.InDelta(t, time.Hour.Seconds(), got.CurrentUpStreak.Seconds(), 5)
+	})
+
+	t.Run("jobset nodes down", func(t *testing.T) {
+		t.Parallel()
+		got, err := SummaryFor(context.Background(), c, EntityKey{
+			Kind:           EntityJobSetNodes,
+			NamespacedName: types.NamespacedName{Namespace: "default", Name: "train"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, got.InterruptionCount)
+		require.Zero(t, got.CurrentUpStreak)
+
+		// The recorded events are not modified.
+		var cm corev1.ConfigMap
+		require.NoError(t, c.Get(context.Background(), DefaultJobSetNodeEventsConfigMapRef, &cm))
+		recs, err := k8sutils.GetEventRecordsFromConfigMap(&cm)
+		require.NoError(t, err)
+		require.Len(t, recs["uid-1"].UpEvents, 2)
+	})
+
+	t.Run("missing jobset", func(t *testing.T) {
+		t.Parallel()
+		_, err := SummaryFor(context.Background(), c, EntityKey{
+			Kind:           EntityJobSet,
+			NamespacedName: types.NamespacedName{Namespace: "default", Name: "missing"},
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestParseEntityKey(t *testing.T) {
+	t.Parallel()
+
+	key, err := ParseEntityKey("jobset-nodes/default/train")
+	require.NoError(t, err)
+	require.Equal(t, EntityKey{
+		Kind:           EntityJobSetNodes,
+		NamespacedName: types.NamespacedName{Namespace: "default", Name: "train"},
+	}, key)
+	require.Equal(t, "jobset-nodes/default/train", key.String())
+
+	for _, invalid := range []string{"", "jobset/default", "pod/default/train", "jobset//train"} {
+		_, err := ParseEntityKey(invalid)
+		require.Error(t, err, invalid)
+	}
+}
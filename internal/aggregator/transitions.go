@@ -0,0 +1,129 @@
+package aggregator
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/megamon/internal/records"
+)
+
+const (
+	// transitionBufferSize is the number of transitions buffered per
+	// subscriber. Subscribers that fall further behind are dropped.
+	transitionBufferSize = 256
+
+	// eventsKeepAliveInterval is how often a comment is sent on idle event
+	// streams so that proxies do not close them.
+	eventsKeepAliveInterval = 30 * time.Second
+)
+
+// Transition is a change in an entity's state, i.e. a newly recorded
+// records.UpEvent.
+type Transition struct {
+	// Key is the entity's key in the report (the JobSet UID).
+	Key string `json:"key"`
+	records.Attrs
+	Up        bool      `json:"up"`
+	Timestamp time.Time `json:"ts"`
+}
+
+// SubscribeTransitions returns a channel that receives every transition
+// recorded from now on, and a function to unsubscribe. Transitions are never
+// blocked on a slow subscriber: if its buffer is full, the subscriber is
+// dropped and the channel closed, so it can resubscribe and resync from the
+// report.
+func (a *Aggregator) SubscribeTransitions() (<-chan Transition, func()) {
+	ch := make(chan Transition, transitionBufferSize)
+	a.transitionsMtx.Lock()
+	defer a.transitionsMtx.Unlock()
+	if a.transitionSubs == nil {
+		a.transitionSubs = make(map[chan Transition]struct{})
+	}
+	a.transitionSubs[ch] = struct{}{}
+	return ch, func() {
+		a.transitionsMtx.Lock()
+		defer a.transitionsMtx.Unlock()
+		if _, ok := a.transitionSubs[ch]; ok {
+			delete(a.transitionSubs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publishTransitions sends the last event of each of the given entities to
+// the subscribers.
+func (a *Aggregator) publishTransitions(keys []string, recs map[string]records.EventRecords, ups map[string]records.Upness) {
+	a.transitionsMtx.Lock()
+	defer a.transitionsMtx.Unlock()
+	if len(a.transitionSubs) == 0 {
+		return
+	}
+	for _, key := range keys {
+		events := recs[key].UpEvents
+		if len(events) == 0 {
+			continue
+		}
+		last := events[len(events)-1]
+		t := Transition{Key: key, Attrs: ups[key].Attrs, Up: last.Up, Timestamp: last.Timestamp}
+		for ch := range a.transitionSubs {
+			select {
+			case ch <- t:
+			default:
+				log.Printf("dropping slow transition subscriber")
+				delete(a.transitionSubs, ch)
+				close(ch)
+			}
+		}
+	}
+}
+
+// EventsHandler streams transitions to clients as Server-Sent Events, one
+// "transition" event per Transition with its JSON as data. The stream ends
+// when the client disconnects or falls too far behind.
+func (a *Aggregator) EventsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		transitions, unsubscribe := a.SubscribeTransitions()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(eventsKeepAliveInterval)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case t, ok := <-transitions:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(t)
+				if err != nil {
+					log.Printf("failed to encode transition: %v", err)
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "event: transition\ndata: %s\n\n", data); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package aggregator
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestEventsHandler(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&jobset.JobSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "train", UID: "uid-train"},
+			Spec: jobset.JobSetSpec{
+				ReplicatedJobs: []jobset.ReplicatedJob{{Name: "rj", Replicas: 1}},
+			},
+		},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetEventsConfigMapRef.Name,
+		}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultJobSetNodeEventsConfigMapRef.Namespace,
+			Name:      DefaultJobSetNodeEventsConfigMapRef.Name,
+		}},
+	).Build()
+	a := &Aggregator{
+		Client:                       c,
+		JobSetEventsConfigMapRef:     DefaultJobSetEventsConfigMapRef,
+		JobSetNodeEventsConfigMapRef: DefaultJobSetNodeEventsConfigMapRef,
+	}
+
+	srv := httptest.NewServer(a.EventsHandler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// The first aggregation records the JobSet (and its Nodes) as down.
+	require.NoError(t, a.Aggregate(context.Background()))
+
+	scanner := bufio.NewScanner(resp.Body)
+	var got []Transition
+	for len(got) < 2 && scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var tr Transition
+		require.NoError(t, json.Unmarshal([]byte(data), &tr))
+		got = append(got, tr)
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, got, 2)
+	for _, tr := range got {
+		require.Equal(t, "uid-train", tr.Key)
+		require.Equal(t, "train", tr.JobSetName)
+		require.False(t, tr.Up)
+		require.False(t, tr.Timestamp.IsZero())
+	}
+	require.ElementsMatch(t, []records.Kind{records.KindJobSet, records.KindJobSetNodes},
+		[]records.Kind{got[0].Kind, got[1].Kind})
+}
+
+func TestSubscribeTransitionsDropsSlowSubscribers(t *testing.T) {
+	t.Parallel()
+
+	a := &Aggregator{}
+	slow, _ := a.SubscribeTransitions()
+	fast, unsubscribe := a.SubscribeTransitions()
+
+	recs := map[string]records.EventRecords{"abc": {UpEvents: []records.UpEvent{{Up: false}}}}
+	for i := 0; i <= transitionBufferSize; i++ {
+		a.publishTransitions([]string{"abc"}, recs, nil)
+		// Keep the fast subscriber drained.
+		<-fast
+	}
+
+	// The slow subscriber's buffer overflowed, so it was dropped.
+	for range slow {
+	}
+	unsubscribe()
+	_, ok := <-fast
+	require.False(t, ok)
+}
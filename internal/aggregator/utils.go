@@ -1,6 +1,8 @@
 package aggregator
 
 import (
+	"runtime/debug"
+
 	"example.com/megamon/internal/records"
 	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
 )
@@ -33,3 +35,24 @@ func extractJobSetAttrs(js *jobset.JobSet) records.Attrs {
 
 	return attrs
 }
+
+// megamonVersion is the version of the running binary.
+var megamonVersion = buildVersion()
+
+// buildVersion returns the main module version from the build info, or the
+// VCS revision for development builds.
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+	return "(devel)"
+}
@@ -0,0 +1,106 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/megamon/internal/records"
+)
+
+const (
+	// DefaultWatchTimeout is how long a watch request blocks by default.
+	DefaultWatchTimeout = 30 * time.Second
+	// MaxWatchTimeout caps the timeout a watch request can ask for.
+	MaxWatchTimeout = 5 * time.Minute
+
+	// ReportHashHeader is the response header holding the report hash.
+	ReportHashHeader = "X-Report-Hash"
+)
+
+// setReport replaces the report and wakes up watchers if its state changed
+// (see stateHash), so that durations growing every interval do not.
+func (a *Aggregator) setReport(report records.Report) {
+	hash, err := stateHash(report)
+	if err != nil {
+		log.Printf("failed to hash report: %v", err)
+	}
+
+	a.reportMtx.Lock()
+	defer a.reportMtx.Unlock()
+	a.report = report
+	a.reportReady = true
+	a.recordHistory(report)
+	if hash != a.reportHash || err != nil {
+		a.reportHash = hash
+		if a.reportChanged != nil {
+			close(a.reportChanged)
+			a.reportChanged = nil
+		}
+	}
+}
+
+// WatchReport blocks until the report is ready and its hash differs from
+// hash, then returns the report and its hash. It returns false if ctx is done
+// first.
+func (a *Aggregator) WatchReport(ctx context.Context, hash string) (records.Report, string, bool) {
+	for {
+		a.reportMtx.Lock()
+		if a.reportReady && a.reportHash != hash {
+			report, current := a.report, a.reportHash
+			a.reportMtx.Unlock()
+			return report, current, true
+		}
+		if a.reportChanged == nil {
+			a.reportChanged = make(chan struct{})
+		}
+		changed := a.reportChanged
+		a.reportMtx.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return records.Report{}, "", false
+		case <-changed:
+		}
+	}
+}
+
+// WatchHandler serves the report to long-polling clients, e.g. consumers
+// behind NAT that cannot receive pushes. Clients pass the hash of the last
+// report they received (from the ReportHashHeader response header) in the
+// hash query parameter, and the request blocks until the report changes or
+// the timeout (the timeout query parameter, DefaultWatchTimeout by default)
+// expires, in which case it responds with 304 Not Modified.
+func (a *Aggregator) WatchHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		timeout := DefaultWatchTimeout
+		if val := req.URL.Query().Get("timeout"); val != "" {
+			d, err := time.ParseDuration(val)
+			if err != nil || d < 0 {
+				http.Error(w, "invalid timeout", http.StatusBadRequest)
+				return
+			}
+			timeout = min(d, MaxWatchTimeout)
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+		report, hash, ok := a.WatchReport(ctx, req.URL.Query().Get("hash"))
+		if !ok {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(ReportHashHeader, hash)
+		if err := json.NewEncoder(w).Encode(report.Render(records.RenderProfileSummary)); err != nil {
+			log.Printf("failed to write watched report: %v", err)
+		}
+	})
+}
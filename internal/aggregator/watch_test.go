@@ -0,0 +1,121 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchHandler(t *testing.T) {
+	t.Parallel()
+
+	a := &Aggregator{}
+	report := records.NewReport()
+	report.JobSetsUp["abc"] = records.Upness{ExpectedCount: 1}
+	a.setReport(report)
+
+	srv := httptest.NewServer(a.WatchHandler())
+	defer srv.Close()
+
+	watch := func(hash, timeout string) (*http.Response, records.Report) {
+		resp, err := http.Get(srv.URL + "?hash=" + hash + "&timeout=" + timeout)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var r records.Report
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&r))
+		}
+		return resp, r
+	}
+
+	// Without a hash, the current report is returned immediately.
+	resp, got := watch("", "1m")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, int32(0), got.JobSetsUp["abc"].ReadyCount)
+	hash := resp.Header.Get(ReportHashHeader)
+	require.NotEmpty(t, hash)
+
+	// An unchanged report times out.
+	resp, _ = watch(hash, "10ms")
+	require.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	// A new report with the same content does not unblock watchers.
+	report.Timestamp = time.Now()
+	a.setReport(report)
+	resp, _ = watch(hash, "10ms")
+	require.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	// A change unblocks a waiting request.
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	done := make(chan result)
+	go func() {
+		resp, err := http.Get(srv.URL + "?hash=" + hash + "&timeout=1m")
+		done <- result{resp, err}
+	}()
+	select {
+	case <-done:
+		t.Fatal("watch returned before the report changed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	changed := records.NewReport()
+	changed.JobSetsUp["abc"] = records.Upness{ExpectedCount: 1, ReadyCount: 1}
+	a.setReport(changed)
+
+	select {
+	case res := <-done:
+		require.NoError(t, res.err)
+		defer res.resp.Body.Close()
+		require.Equal(t, http.StatusOK, res.resp.StatusCode)
+		require.NotEqual(t, hash, res.resp.Header.Get(ReportHashHeader))
+		var r records.Report
+		require.NoError(t, json.NewDecoder(res.resp.Body).Decode(&r))
+		require.Equal(t, int32(1), r.JobSetsUp["abc"].ReadyCount)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch was not unblocked by the change")
+	}
+}
+
+func TestWatchReportIgnoresDurations(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	tick := func(now time.Time, events []records.UpEvent) records.Report {
+		report := records.NewReport()
+		report.Timestamp = now
+		report.JobSetsUp["abc"] = records.Upness{ExpectedCount: 1, ReadyCount: 1}
+		rec := records.EventRecords{UpEvents: events}
+		report.JobSetEvents = map[string]records.EventRecords{"abc": rec}
+		report.JobSetsUpSummaries["abc"] = records.UpnessSummaryWithAttrs{EventSummary: rec.Summarize(now)}
+		return report
+	}
+	up := []records.UpEvent{{Up: false, Timestamp: t0}, {Up: true, Timestamp: t0.Add(time.Minute)}}
+
+	a := &Aggregator{}
+	a.setReport(tick(t0.Add(time.Hour), up))
+	_, hash, ok := a.WatchReport(context.Background(), "")
+	require.True(t, ok)
+
+	// The uptime grows, but nothing transitioned.
+	a.setReport(tick(t0.Add(2*time.Hour), up))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, ok = a.WatchReport(ctx, hash)
+	require.False(t, ok)
+
+	// A down and up in between leaves the upness as is, but not the events.
+	bounced := append(up, records.UpEvent{Up: false, Timestamp: t0.Add(90 * time.Minute)}, records.UpEvent{Up: true, Timestamp: t0.Add(100 * time.Minute)})
+	a.setReport(tick(t0.Add(2*time.Hour), bounced))
+	_, changed, ok := a.WatchReport(context.Background(), hash)
+	require.True(t, ok)
+	require.NotEqual(t, hash, changed)
+}
@@ -0,0 +1,133 @@
+package aggregator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"example.com/megamon/internal/records"
+)
+
+// DefaultWebhookTimeout bounds each webhook request by default.
+const DefaultWebhookTimeout = 10 * time.Second
+
+// WebhookExporter POSTs the report as JSON to a URL, e.g. to feed incident
+// tooling.
+type WebhookExporter struct {
+	URL string
+	// Headers are set on every request, e.g. an Authorization header.
+	Headers map[string]string
+	// Timeout bounds each request so that a slow endpoint does not hold up
+	// the aggregation loop, defaults to DefaultWebhookTimeout.
+	Timeout time.Duration
+
+	// MinNewInterruptions, if set, only posts reports once the fleet
+	// interruption count grew by at least this much since the last posted
+	// report, instead of on every aggregation. The first report only sets
+	// the baseline.
+	MinNewInterruptions int
+	// OnProvisioningStuck also posts reports in which a JobSet newly became
+	// ProvisioningStuck, regardless of MinNewInterruptions.
+	OnProvisioningStuck bool
+
+	Profile records.RenderProfile
+
+	HTTPClient *http.Client
+
+	mtx sync.Mutex
+	// lastInterruptions is the fleet interruption count of the last posted
+	// report, or of the baseline.
+	lastInterruptions int
+	baselined         bool
+	// lastStuck are the JobSets that were ProvisioningStuck in the last
+	// posted report.
+	lastStuck map[string]bool
+}
+
+func (e *WebhookExporter) RenderProfile() records.RenderProfile {
+	return e.Profile
+}
+
+func (e *WebhookExporter) Export(ctx context.Context, r records.Report) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	interruptions := r.Fleet.InterruptionCount
+	stuck, newlyStuck := e.provisioningStuck(r)
+	if e.MinNewInterruptions > 0 && !newlyStuck {
+		// Deleted entities take their interruptions with them.
+		if !e.baselined || interruptions < e.lastInterruptions {
+			e.lastInterruptions, e.baselined = interruptions, true
+			return nil
+		}
+		if interruptions-e.lastInterruptions < e.MinNewInterruptions {
+			return nil
+		}
+	}
+
+	jsn, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(jsn))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, val := range e.Headers {
+		req.Header.Set(name, val)
+	}
+
+	c := e.HTTPClient
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting report: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("posting report: unexpected status %s: %s", resp.Status, msg)
+	}
+
+	// Only advance past interruptions that were delivered, so that a failed
+	// post is retried with the next report.
+	e.lastInterruptions, e.baselined = interruptions, true
+	e.lastStuck = stuck
+	return nil
+}
+
+// provisioningStuck returns the JobSets of r that are ProvisioningStuck, and
+// whether any of them was not in the last posted report. It returns nil
+// unless OnProvisioningStuck is set.
+func (e *WebhookExporter) provisioningStuck(r records.Report) (map[string]bool, bool) {
+	if !e.OnProvisioningStuck {
+		return nil, false
+	}
+	stuck := make(map[string]bool)
+	var newlyStuck bool
+	for key, s := range r.JobSetsUpSummaries {
+		if !s.ProvisioningStuck {
+			continue
+		}
+		stuck[key] = true
+		if !e.lastStuck[key] {
+			newlyStuck = true
+		}
+	}
+	return stuck, newlyStuck
+}
@@ -0,0 +1,133 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookExporter(t *testing.T) {
+	t.Parallel()
+
+	var mtx sync.Mutex
+	var posted []records.Report
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer token" ||
+			r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var report records.Report
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		posted = append(posted, report)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	count := func() int {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(posted)
+	}
+
+	report := func(interruptions int) records.Report {
+		r := records.NewReport()
+		r.Fleet.InterruptionCount = interruptions
+		return r
+	}
+
+	e := &WebhookExporter{
+		URL:        srv.URL,
+		Headers:    map[string]string{"Authorization": "Bearer token"},
+		HTTPClient: srv.Client(),
+	}
+	require.NoError(t, e.Export(context.Background(), report(0)))
+	require.NoError(t, e.Export(context.Background(), report(0)))
+	require.Equal(t, 2, count())
+
+	// Only post once enough new interruptions were recorded.
+	e = &WebhookExporter{
+		URL:                 srv.URL,
+		Headers:             map[string]string{"Authorization": "Bearer token"},
+		MinNewInterruptions: 2,
+		HTTPClient:          srv.Client(),
+	}
+	for _, interruptions := range []int{3, 4, 5, 6} {
+		require.NoError(t, e.Export(context.Background(), report(interruptions)))
+	}
+	require.Equal(t, 3, count())
+	require.Equal(t, 5, posted[2].Fleet.InterruptionCount)
+
+	// JobSets newly stuck provisioning are posted regardless of the
+	// interruptions.
+	stuckReport := func(interruptions int, stuck ...string) records.Report {
+		r := report(interruptions)
+		for _, key := range stuck {
+			var s records.UpnessSummaryWithAttrs
+			s.ProvisioningStuck = true
+			r.JobSetsUpSummaries[key] = s
+		}
+		return r
+	}
+	stuckExporter := &WebhookExporter{
+		URL:                 srv.URL,
+		Headers:             map[string]string{"Authorization": "Bearer token"},
+		MinNewInterruptions: 2,
+		OnProvisioningStuck: true,
+		HTTPClient:          srv.Client(),
+	}
+	before := count()
+	require.NoError(t, stuckExporter.Export(context.Background(), stuckReport(0)))
+	require.NoError(t, stuckExporter.Export(context.Background(), stuckReport(0, "ns.a")))
+	require.NoError(t, stuckExporter.Export(context.Background(), stuckReport(0, "ns.a")))
+	require.NoError(t, stuckExporter.Export(context.Background(), stuckReport(0, "ns.a", "ns.b")))
+	require.Equal(t, before+2, count())
+
+	// Failed posts return an error and are retried with the next report.
+	mtx.Lock()
+	status = http.StatusInternalServerError
+	mtx.Unlock()
+	require.ErrorContains(t, e.Export(context.Background(), report(7)), "500")
+	mtx.Lock()
+	status = http.StatusAccepted
+	mtx.Unlock()
+	require.NoError(t, e.Export(context.Background(), report(7)))
+	require.Equal(t, 7, posted[len(posted)-1].Fleet.InterruptionCount)
+}
+
+func TestWebhookExporterTimeout(t *testing.T) {
+	t.Parallel()
+
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	e := &WebhookExporter{URL: srv.URL, Timeout: 10 * time.Millisecond, HTTPClient: srv.Client()}
+	start := time.Now()
+	require.ErrorIs(t, e.Export(context.Background(), records.NewReport()), context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	// Cancellation of the aggregation is respected as well.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	e.Timeout = time.Minute
+	require.ErrorIs(t, e.Export(ctx, records.NewReport()), context.Canceled)
+}
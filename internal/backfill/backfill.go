@@ -0,0 +1,147 @@
+// Package backfill seeds event records with history from before megamon was
+// installed.
+package backfill
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"example.com/megamon/internal/k8sutils"
+	"example.com/megamon/internal/records"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// NodeImporter replays historical Node Ready/NotReady transitions from Cloud
+// Logging into the JobSet Node event records.
+type NodeImporter struct {
+	client.Client
+
+	Logging LoggingClient
+	// Filter defaults to DefaultNodeReadyFilter.
+	Filter     string
+	Start, End time.Time
+
+	JobSetNodeEventsConfigMapRef types.NamespacedName
+}
+
+// Import backfills the records of the currently active JobSets. Nodes are
+// attributed to JobSets using their current labels, and all Nodes are assumed
+// to be NotReady until their first logged transition.
+func (i *NodeImporter) Import(ctx context.Context) error {
+	var jobsetList jobset.JobSetList
+	if err := i.List(ctx, &jobsetList); err != nil {
+		return fmt.Errorf("listing jobsets: %w", err)
+	}
+	// map[<ns>/<name>]<uid>
+	uidMap := map[string]string{}
+	expected := map[string]int32{}
+	for _, js := range jobsetList.Items {
+		if !k8sutils.IsJobSetActive(&js) || !k8sutils.IsJobSetExpectedToRun(&js) {
+			continue
+		}
+		uid := string(js.UID)
+		uidMap[js.Namespace+"/"+js.Name] = uid
+		expected[uid] = k8sutils.GetExpectedNodeCount(&js)
+	}
+
+	var nodeList corev1.NodeList
+	if err := i.List(ctx, &nodeList); err != nil {
+		return fmt.Errorf("listing nodes: %w", err)
+	}
+	// map[<node>]<jobset-uid>
+	nodeJobSet := map[string]string{}
+	for _, node := range nodeList.Items {
+		jsNS, jsName := k8sutils.GetJobSetForNode(&node)
+		if uid, ok := uidMap[jsNS+"/"+jsName]; ok {
+			nodeJobSet[node.Name] = uid
+		}
+	}
+
+	filter := i.Filter
+	if filter == "" {
+		filter = DefaultNodeReadyFilter
+	}
+	entries, err := i.Logging.ListEntries(ctx, filter, i.Start, i.End)
+	if err != nil {
+		return err
+	}
+
+	history := replay(entries, nodeJobSet, expected)
+
+	var cm corev1.ConfigMap
+	if err := i.Get(ctx, i.JobSetNodeEventsConfigMapRef, &cm); err != nil {
+		return fmt.Errorf("failed to get event records configmap: %w", err)
+	}
+	recs, err := k8sutils.GetEventRecordsFromConfigMap(&cm)
+	if err != nil {
+		return fmt.Errorf("failed to get event records from configmap: %w", err)
+	}
+
+	var changed bool
+	for uid, events := range history {
+		rec := recs[uid]
+		if records.BackfillEvents(&rec, events) {
+			recs[uid] = rec
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	if err := k8sutils.SetEventRecordsInConfigMap(&cm, recs); err != nil {
+		return fmt.Errorf("failed to set event records in configmap: %w", err)
+	}
+	if err := i.Update(ctx, &cm); err != nil {
+		return fmt.Errorf("failed to update events configmap: %w", err)
+	}
+	return nil
+}
+
+// replay converts Node transitions into JobSet Node up events.
+func replay(entries []LogEntry, nodeJobSet map[string]string, expected map[string]int32) map[string][]records.UpEvent {
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].Timestamp.Before(entries[b].Timestamp)
+	})
+
+	ready := map[string]bool{}
+	readyCount := map[string]int32{}
+	history := map[string][]records.UpEvent{}
+
+	for _, e := range entries {
+		uid, ok := nodeJobSet[e.NodeName]
+		if !ok {
+			continue
+		}
+		var isReady bool
+		switch e.Reason {
+		case "NodeReady":
+			isReady = true
+		case "NodeNotReady":
+			isReady = false
+		default:
+			continue
+		}
+
+		if ready[e.NodeName] != isReady {
+			ready[e.NodeName] = isReady
+			if isReady {
+				readyCount[uid]++
+			} else {
+				readyCount[uid]--
+			}
+		}
+
+		rec := records.EventRecords{UpEvents: history[uid]}
+		up := records.Upness{ExpectedCount: expected[uid], ReadyCount: readyCount[uid]}
+		records.AppendUpEvent(e.Timestamp, &rec, up.Up())
+		history[uid] = rec.UpEvents
+	}
+
+	return history
+}
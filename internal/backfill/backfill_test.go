@@ -0,0 +1,157 @@
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/k8sutils"
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+type fakeLoggingClient struct {
+	entries []LogEntry
+	filter  string
+}
+
+func (c *fakeLoggingClient) ListEntries(_ context.Context, filter string, start, end time.Time) ([]LogEntry, error) {
+	c.filter = filter
+	var out []LogEntry
+	for _, e := range c.entries {
+		if !e.Timestamp.Before(start) && e.Timestamp.Before(end) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func TestNodeImporter(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	require.NoError(t, err)
+	at := func(h int) time.Time { return t0.Add(time.Duration(h) * time.Hour) }
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, jobset.AddToScheme(scheme))
+
+	js := &jobset.JobSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "train", UID: "uid-1"},
+		Spec: jobset.JobSetSpec{
+			ReplicatedJobs: []jobset.ReplicatedJob{{Name: "rj", Replicas: 2}},
+		},
+	}
+	node := func(name string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"google.com/tpu-provisioner-jobset-namespace": "default",
+				"google.com/tpu-provisioner-jobset-name":      "train",
+			},
+		}}
+	}
+
+	// megamon was installed at hour 10 and observed the JobSet nodes as up.
+	existing := map[string]records.EventRecords{
+		"uid-1": {UpEvents: []records.UpEvent{
+			{Up: false, Timestamp: at(10)},
+			{Up: true, Timestamp: at(10)},
+		}},
+	}
+	cmRef := types.NamespacedName{Namespace: "megamon-system", Name: "megamon-jobset-node-events"}
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: cmRef.Namespace, Name: cmRef.Name}}
+	require.NoError(t, k8sutils.SetEventRecordsInConfigMap(cm, existing))
+
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(js, node("node-a"), node("node-b"), cm).
+		Build()
+
+	logging := &fakeLoggingClient{entries: []LogEntry{
+		{Timestamp: at(1), NodeName: "node-a", Reason: "NodeReady"},
+		{Timestamp: at(2), NodeName: "node-b", Reason: "NodeReady"},
+		{Timestamp: at(4), NodeName: "node-b", Reason: "NodeNotReady"},
+		// Unknown node and reason are ignored.
+		{Timestamp: at(4), NodeName: "other", Reason: "NodeNotReady"},
+		{Timestamp: at(5), NodeName: "node-a", Reason: "Rebooted"},
+		{Timestamp: at(5), NodeName: "node-b", Reason: "NodeReady"},
+		// Outside of the time range.
+		{Timestamp: at(12), NodeName: "node-b", Reason: "NodeNotReady"},
+	}}
+
+	imp := &NodeImporter{
+		Client:                       c,
+		Logging:                      logging,
+		Start:                        at(0),
+		End:                          at(11),
+		JobSetNodeEventsConfigMapRef: cmRef,
+	}
+	require.NoError(t, imp.Import(context.Background()))
+	require.Equal(t, DefaultNodeReadyFilter, logging.filter)
+
+	var got corev1.ConfigMap
+	require.NoError(t, c.Get(context.Background(), cmRef, &got))
+	recs, err := k8sutils.GetEventRecordsFromConfigMap(&got)
+	require.NoError(t, err)
+	require.Equal(t, []records.UpEvent{
+		{Up: false, Timestamp: at(1), Backfilled: true},
+		{Up: true, Timestamp: at(2), Backfilled: true},
+		{Up: false, Timestamp: at(4), Backfilled: true},
+		{Up: true, Timestamp: at(5), Backfilled: true},
+	}, recs["uid-1"].UpEvents)
+
+	// Importing again is a no-op.
+	require.NoError(t, imp.Import(context.Background()))
+	var again corev1.ConfigMap
+	require.NoError(t, c.Get(context.Background(), cmRef, &again))
+	require.Equal(t, got.Data, again.Data)
+}
+
+func TestRESTLoggingClient(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	require.NoError(t, err)
+
+	var requests []listEntriesRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v2/entries:list", r.URL.Path)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var req listEntriesRequest
+		require.NoError(t, json.Unmarshal(body, &req))
+		requests = append(requests, req)
+
+		if req.PageToken == "" {
+			w.Write([]byte(`{"entries":[{"timestamp":"2021-01-01T01:00:00Z","resource":{"labels":{"node_name":"node-a"}},"jsonPayload":{"reason":"NodeReady"}}],"nextPageToken":"p2"}`))
+			return
+		}
+		w.Write([]byte(`{"entries":[{"timestamp":"2021-01-01T02:00:00Z","jsonPayload":{"reason":"NodeNotReady","involvedObject":{"name":"node-b"}}}]}`))
+	}))
+	defer srv.Close()
+
+	c := &RESTLoggingClient{HTTPClient: srv.Client(), Endpoint: srv.URL, Project: "my-project"}
+	entries, err := c.ListEntries(context.Background(), "my-filter", t0, t0.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []LogEntry{
+		{Timestamp: t0.Add(time.Hour), NodeName: "node-a", Reason: "NodeReady"},
+		{Timestamp: t0.Add(2 * time.Hour), NodeName: "node-b", Reason: "NodeNotReady"},
+	}, entries)
+
+	require.Len(t, requests, 2)
+	require.Equal(t, []string{"projects/my-project"}, requests[0].ResourceNames)
+	require.Equal(t, `(my-filter) AND timestamp>="2021-01-01T00:00:00Z" AND timestamp<"2021-01-01T01:00:00Z"`, requests[0].Filter)
+	require.Equal(t, "p2", requests[1].PageToken)
+}
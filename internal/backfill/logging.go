@@ -0,0 +1,125 @@
+package backfill
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultNodeReadyFilter selects the Kubernetes Node Ready/NotReady events
+// that GKE exports to Cloud Logging.
+const DefaultNodeReadyFilter = `logName:"logs/events" AND jsonPayload.involvedObject.kind="Node" AND jsonPayload.reason=("NodeReady" OR "NodeNotReady")`
+
+// LogEntry is a Node event read from Cloud Logging.
+type LogEntry struct {
+	Timestamp time.Time
+	NodeName  string
+	Reason    string
+}
+
+// LoggingClient lists Node events from Cloud Logging.
+type LoggingClient interface {
+	ListEntries(ctx context.Context, filter string, start, end time.Time) ([]LogEntry, error)
+}
+
+// RESTLoggingClient lists entries using the Cloud Logging v2 REST API.
+type RESTLoggingClient struct {
+	// HTTPClient must be authenticated, e.g. with Application Default
+	// Credentials (see google.DefaultClient).
+	HTTPClient *http.Client
+	// Endpoint defaults to https://logging.googleapis.com.
+	Endpoint string
+	Project  string
+}
+
+type listEntriesRequest struct {
+	ResourceNames []string `json:"resourceNames"`
+	Filter        string   `json:"filter"`
+	OrderBy       string   `json:"orderBy"`
+	PageSize      int      `json:"pageSize"`
+	PageToken     string   `json:"pageToken,omitempty"`
+}
+
+type listEntriesResponse struct {
+	Entries []struct {
+		Timestamp time.Time `json:"timestamp"`
+		Resource  struct {
+			Labels map[string]string `json:"labels"`
+		} `json:"resource"`
+		JSONPayload struct {
+			Reason         string `json:"reason"`
+			InvolvedObject struct {
+				Name string `json:"name"`
+			} `json:"involvedObject"`
+		} `json:"jsonPayload"`
+	} `json:"entries"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+func (c *RESTLoggingClient) ListEntries(ctx context.Context, filter string, start, end time.Time) ([]LogEntry, error) {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = "https://logging.googleapis.com"
+	}
+
+	req := listEntriesRequest{
+		ResourceNames: []string{"projects/" + c.Project},
+		Filter: fmt.Sprintf(`(%s) AND timestamp>=%q AND timestamp<%q`, filter,
+			start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339)),
+		OrderBy:  "timestamp asc",
+		PageSize: 1000,
+	}
+
+	var entries []LogEntry
+	for {
+		body, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/v2/entries:list", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+
+		resp, err := c.HTTPClient.Do(httpReq)
+		if err != nil {
+			return nil, fmt.Errorf("listing log entries: %w", err)
+		}
+		var page listEntriesResponse
+		err = decodeResponse(resp, &page)
+		if err != nil {
+			return nil, fmt.Errorf("listing log entries: %w", err)
+		}
+
+		for _, e := range page.Entries {
+			name := e.Resource.Labels["node_name"]
+			if name == "" {
+				name = e.JSONPayload.InvolvedObject.Name
+			}
+			entries = append(entries, LogEntry{
+				Timestamp: e.Timestamp,
+				NodeName:  name,
+				Reason:    e.JSONPayload.Reason,
+			})
+		}
+
+		if page.NextPageToken == "" {
+			return entries, nil
+		}
+		req.PageToken = page.NextPageToken
+	}
+}
+
+func decodeResponse(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, msg)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+
+	"example.com/megamon/internal/aggregator"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// SettingsUpdater is implemented by the Aggregator.
+type SettingsUpdater interface {
+	UpdateSettings(aggregator.Settings) error
+}
+
+// ConfigReconciler hot-reloads the Aggregator settings from a ConfigMap (see
+// aggregator.ParseSettings for the keys). Invalid configs are logged and not
+// applied. Deleting the ConfigMap reverts to the Defaults.
+type ConfigReconciler struct {
+	client.Client
+
+	Ref      types.NamespacedName
+	Defaults aggregator.Settings
+	Target   SettingsUpdater
+}
+
+func (r *ConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	var cm corev1.ConfigMap
+	if err := r.Get(ctx, req.NamespacedName, &cm); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+		log.Info("config removed, reverting to defaults")
+		return ctrl.Result{}, r.Target.UpdateSettings(r.Defaults)
+	}
+
+	settings, err := aggregator.ParseSettings(cm.Data, r.Defaults)
+	if err != nil {
+		// Retrying will not fix an invalid config, wait for the next update.
+		log.Error(err, "invalid config, keeping current settings")
+		return ctrl.Result{}, nil
+	}
+	if err := r.Target.UpdateSettings(settings); err != nil {
+		return ctrl.Result{}, err
+	}
+	log.Info("applied config", "interval", settings.Interval)
+
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("config").
+		For(&corev1.ConfigMap{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(o client.Object) bool {
+			return o.GetNamespace() == r.Ref.Namespace && o.GetName() == r.Ref.Name
+		}))).
+		Complete(r)
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/aggregator"
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestConfigReconciler(t *testing.T) {
+	t.Parallel()
+
+	ref := types.NamespacedName{Namespace: "megamon-system", Name: "megamon-config"}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name},
+		Data: map[string]string{
+			aggregator.SettingsKeyInterval:          "30s",
+			aggregator.SettingsKeyAtRiskBurstCount:  "5",
+			aggregator.SettingsKeyAtRiskBurstWindow: "2h",
+		},
+	}
+	c := fake.NewClientBuilder().WithObjects(cm).Build()
+
+	defaults := aggregator.Settings{
+		Interval: 10 * time.Second,
+		SummaryOptions: records.SummaryOptions{
+			AtRisk: records.AtRiskOptions{MinUpStreak: time.Hour},
+		},
+	}
+	agg := &aggregator.Aggregator{Interval: defaults.Interval, SummaryOptions: defaults.SummaryOptions}
+	r := &ConfigReconciler{Client: c, Ref: ref, Defaults: defaults, Target: agg}
+
+	reconcile := func() {
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: ref})
+		require.NoError(t, err)
+	}
+
+	reconcile()
+	require.Equal(t, aggregator.Settings{
+		Interval: 30 * time.Second,
+		SummaryOptions: records.SummaryOptions{
+			AtRisk: records.AtRiskOptions{MinUpStreak: time.Hour, BurstCount: 5, BurstWindow: 2 * time.Hour},
+		},
+	}, agg.Settings())
+
+	// Updated values are applied.
+	cm.Data[aggregator.SettingsKeyInterval] = "1m"
+	require.NoError(t, c.Update(context.Background(), cm))
+	reconcile()
+	require.Equal(t, time.Minute, agg.Settings().Interval)
+
+	// Invalid values are not applied.
+	for _, invalid := range []string{"soon", "-1s", "10ms"} {
+		cm.Data[aggregator.SettingsKeyInterval] = invalid
+		require.NoError(t, c.Update(context.Background(), cm))
+		reconcile()
+		require.Equal(t, time.Minute, agg.Settings().Interval, invalid)
+	}
+
+	// Deleting the config reverts to the defaults.
+	require.NoError(t, c.Delete(context.Background(), cm))
+	reconcile()
+	require.Equal(t, defaults, agg.Settings())
+}
@@ -3,10 +3,13 @@ package controller
 import (
 	"context"
 
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
 )
 
@@ -14,11 +17,16 @@ import (
 type JobSetReconciler struct {
 	Disabled bool
 
+	// Selector and Namespaces, if set, restrict the watch to the matching
+	// JobSets.
+	Selector   labels.Selector
+	Namespaces []string
+
 	client.Client
 	Scheme *runtime.Scheme
 }
 
-// +kubebuilder:rbac:groups=jobset.x-k8s.io,resources=jobsets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=jobset.x-k8s.io,resources=jobsets,verbs=get;list;watch;patch
 // +kubebuilder:rbac:groups=jobset.x-k8s.io,resources=jobsets/status,verbs=get
 
 func (r *JobSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -34,7 +42,23 @@ func (r *JobSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 // SetupWithManager sets up the controller with the Manager.
 func (r *JobSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&jobset.JobSet{}).
+		For(&jobset.JobSet{}, builder.WithPredicates(predicate.NewPredicateFuncs(r.matches))).
 		Named("jobset").
 		Complete(r)
 }
+
+// matches returns whether o matches the Selector and Namespaces.
+func (r *JobSetReconciler) matches(o client.Object) bool {
+	if r.Selector != nil && !r.Selector.Matches(labels.Set(o.GetLabels())) {
+		return false
+	}
+	if len(r.Namespaces) == 0 {
+		return true
+	}
+	for _, ns := range r.Namespaces {
+		if ns == o.GetNamespace() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestJobSetReconcilerMatches(t *testing.T) {
+	t.Parallel()
+
+	ml := &jobset.JobSet{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "ml"}}}
+	system := &jobset.JobSet{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"system": "true"}}}
+
+	r := &JobSetReconciler{}
+	require.True(t, r.matches(ml), "without a selector")
+	require.True(t, r.matches(system), "without a selector")
+
+	selector, err := labels.Parse("team=ml,!system")
+	require.NoError(t, err)
+	r.Selector = selector
+	require.True(t, r.matches(ml))
+	require.False(t, r.matches(system))
+
+	r.Namespaces = []string{"team-a", "team-b"}
+	require.False(t, r.matches(ml), "in the default namespace")
+	ml.Namespace = "team-b"
+	require.True(t, r.matches(ml))
+}
@@ -2,17 +2,94 @@ package controller
 
 import (
 	"context"
+	"sync"
+	"time"
 
+	"example.com/megamon/internal/k8sutils"
+	"example.com/megamon/internal/metrics"
+	"example.com/megamon/internal/records"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-// JobSetReconciler reconciles a Guestbook object
+const (
+	ScalingEventScaleUp   = "scale-up"
+	ScalingEventScaleDown = "scale-down"
+)
+
+// maxScalingEventsPerPool bounds the scaling events kept per node pool.
+const maxScalingEventsPerPool = 100
+
+// ScalingEvent is a Node addition or removal in a node pool that was not
+// caused by an interruption.
+type ScalingEvent struct {
+	Type      string
+	Node      string
+	Timestamp time.Time
+}
+
+// NodeReconciler classifies Node interruptions by type (termination,
+// maintenance, live-migration) and counts them. It also records node pool
+// scaling events so that capacity changes can be told apart from faults, and
+// up and down events of each Node from its conditions.
 type NodeReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// InterruptionSignals are used to classify interruptions.
+	// Defaults to k8sutils.DefaultNodeInterruptionSignals.
+	InterruptionSignals []k8sutils.NodeInterruptionSignal
+
+	// VersionLabel is the Node label holding the node pool version, which is
+	// recorded with each interruption to correlate interruptions with
+	// upgrades. Defaults to the kubelet version if empty or not set on a Node.
+	VersionLabel string
+
+	// ClusterName, if set, is used to derive the node pool of Nodes that
+	// lack the node pool label (see k8sutils.GetNodePoolWithFallback).
+	ClusterName string
+
+	// UpConditions decide whether a Node is up, e.g. to additionally count
+	// a Node as down while NetworkUnavailable. Defaults to
+	// k8sutils.DefaultNodeUpConditions.
+	UpConditions []k8sutils.NodeUpCondition
+
+	// MinStateChangeInterval debounces Nodes that oscillate between up and
+	// down, see records.ReconcileOptions.MinStateChangeInterval.
+	MinStateChangeInterval time.Duration
+
+	// DeletedNodeRetention keeps the events of a deleted Node, ending in a
+	// down event at its deletion, for this long so that JobSet
+	// interruptions can still be attributed to it once the Node is gone
+	// (see aggregator.Aggregator.InterruptionCauseWindow). Zero forgets
+	// deleted Nodes immediately.
+	DeletedNodeRetention time.Duration
+
+	mtx sync.Mutex
+	// nodeInterruptions is the last observed interruption type per Node.
+	nodeInterruptions           map[string]string
+	interruptionCounts          map[string]int
+	interruptionCountsByVersion map[string]int
+
+	// startTime is when the first Node was reconciled. Nodes created before
+	// then are part of the initial sync, not scale-ups.
+	startTime time.Time
+	// nodePools is the node pool of each known Node.
+	nodePools     map[string]string
+	scalingEvents map[string][]ScalingEvent
+	scalingCounts map[string]map[string]int
+	// nodeEvents are the up and down events of each known Node.
+	nodeEvents map[string]records.EventRecords
+	// nodeEventPools is the node pool of each Node in nodeEvents, which
+	// unlike nodePools is retained with the events of deleted Nodes.
+	nodeEventPools map[string]string
+	// deletedNodes are the deletion times of the deleted Nodes whose events
+	// are retained, see DeletedNodeRetention.
+	deletedNodes map[string]time.Time
 }
 
 // +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;update;patch
@@ -21,9 +98,208 @@ type NodeReconciler struct {
 // +kubebuilder:rbac:groups="",resources=nodes/status,verbs=get
 
 func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var node corev1.Node
+	if err := r.Get(ctx, req.NamespacedName, &node); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			return r.forget(ctx, req.Name), nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	signals := r.InterruptionSignals
+	if signals == nil {
+		signals = k8sutils.DefaultNodeInterruptionSignals
+	}
+	typ, _ := k8sutils.GetNodeInterruptionType(&node, signals)
+	upConditions := r.UpConditions
+	if upConditions == nil {
+		upConditions = k8sutils.DefaultNodeUpConditions
+	}
+	up := k8sutils.IsNodeUp(&node, upConditions)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.nodeInterruptions == nil {
+		r.nodeInterruptions = make(map[string]string)
+		r.interruptionCounts = make(map[string]int)
+		r.interruptionCountsByVersion = make(map[string]int)
+		r.nodePools = make(map[string]string)
+		r.scalingEvents = make(map[string][]ScalingEvent)
+		r.scalingCounts = make(map[string]map[string]int)
+		r.nodeEvents = make(map[string]records.EventRecords)
+		r.nodeEventPools = make(map[string]string)
+		r.startTime = time.Now()
+	}
+	nodePool, _ := k8sutils.GetNodePoolWithFallback(&node, r.ClusterName)
+	if _, known := r.nodePools[node.Name]; !known && node.CreationTimestamp.Time.After(r.startTime) {
+		r.recordScalingEvent(ctx, nodePool, ScalingEventScaleUp, node.Name, node.CreationTimestamp.Time)
+	}
+	r.nodePools[node.Name] = nodePool
+	delete(r.deletedNodes, node.Name)
+
+	// Only count the transition into a new interruption type so that repeated
+	// reconciles of the same Node are not double counted.
+	if typ != "" && typ != r.nodeInterruptions[node.Name] {
+		version := k8sutils.GetNodePoolVersion(&node, r.VersionLabel)
+		r.interruptionCounts[typ]++
+		r.interruptionCountsByVersion[version]++
+		metrics.NodeInterruptionCount.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("kind", string(records.KindNode)),
+			attribute.String("interruption.type", typ),
+			attribute.String("node.pool", nodePool),
+			attribute.String("node.pool.version", version),
+		))
+	}
+	if typ == "" {
+		delete(r.nodeInterruptions, node.Name)
+	} else {
+		r.nodeInterruptions[node.Name] = typ
+	}
+
+	// Nodes linger NotReady during repairs, so they go down and up
+	// independent of their deletion. Nodes start in their state when first
+	// seen rather than provisioning.
+	now := time.Now()
+	rec := r.nodeEvents[node.Name]
+	n := len(rec.UpEvents)
+	if n == 0 {
+		rec.UpEvents = append(rec.UpEvents, records.UpEvent{Up: up, Timestamp: now})
+	} else if n == 1 || now.Sub(rec.UpEvents[n-1].Timestamp) >= r.MinStateChangeInterval {
+		records.AppendUpEvent(now, &rec, up)
+	}
+	r.nodeEvents[node.Name] = rec
+	r.nodeEventPools[node.Name] = nodePool
+
 	return ctrl.Result{}, nil
 }
 
+// forget forgets the deleted Node name. Its events are retained for
+// DeletedNodeRetention, after which the returned result requeues it to drop
+// them.
+func (r *NodeReconciler) forget(ctx context.Context, name string) ctrl.Result {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	now := time.Now()
+	if deletedAt, ok := r.deletedNodes[name]; ok {
+		if remaining := r.DeletedNodeRetention - now.Sub(deletedAt); remaining > 0 {
+			return ctrl.Result{RequeueAfter: remaining}
+		}
+		delete(r.deletedNodes, name)
+		delete(r.nodeEvents, name)
+		delete(r.nodeEventPools, name)
+		return ctrl.Result{}
+	}
+
+	// Removal of a Node that was not interrupted is a scale-down.
+	if nodePool, ok := r.nodePools[name]; ok {
+		if _, interrupted := r.nodeInterruptions[name]; !interrupted {
+			r.recordScalingEvent(ctx, nodePool, ScalingEventScaleDown, name, now)
+		}
+	}
+	delete(r.nodeInterruptions, name)
+	delete(r.nodePools, name)
+
+	rec, ok := r.nodeEvents[name]
+	if !ok || r.DeletedNodeRetention <= 0 {
+		delete(r.nodeEvents, name)
+		delete(r.nodeEventPools, name)
+		return ctrl.Result{}
+	}
+	records.AppendUpEvent(now, &rec, false)
+	r.nodeEvents[name] = rec
+	if r.deletedNodes == nil {
+		r.deletedNodes = make(map[string]time.Time)
+	}
+	r.deletedNodes[name] = now
+	return ctrl.Result{RequeueAfter: r.DeletedNodeRetention}
+}
+
+// InterruptionCounts returns the number of observed Node interruptions by type.
+func (r *NodeReconciler) InterruptionCounts() map[string]int {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	counts := make(map[string]int, len(r.interruptionCounts))
+	for typ, n := range r.interruptionCounts {
+		counts[typ] = n
+	}
+	return counts
+}
+
+// InterruptionCountsByVersion returns the number of observed Node
+// interruptions by node pool version.
+func (r *NodeReconciler) InterruptionCountsByVersion() map[string]int {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	counts := make(map[string]int, len(r.interruptionCountsByVersion))
+	for version, n := range r.interruptionCountsByVersion {
+		counts[version] = n
+	}
+	return counts
+}
+
+// NodeEvents returns the up and down events of each known Node, including
+// recently deleted ones, see DeletedNodeRetention.
+func (r *NodeReconciler) NodeEvents() map[string]records.EventRecords {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	events := make(map[string]records.EventRecords, len(r.nodeEvents))
+	for name, rec := range r.nodeEvents {
+		rec.UpEvents = append([]records.UpEvent(nil), rec.UpEvents...)
+		events[name] = rec
+	}
+	return events
+}
+
+// NodePools returns the node pool of each Node in NodeEvents, from the
+// Node's own labels (see k8sutils.GetNodePoolWithFallback).
+func (r *NodeReconciler) NodePools() map[string]string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	pools := make(map[string]string, len(r.nodeEventPools))
+	for name, pool := range r.nodeEventPools {
+		pools[name] = pool
+	}
+	return pools
+}
+
+func (r *NodeReconciler) recordScalingEvent(ctx context.Context, nodePool, typ, node string, ts time.Time) {
+	events := append(r.scalingEvents[nodePool], ScalingEvent{Type: typ, Node: node, Timestamp: ts})
+	if len(events) > maxScalingEventsPerPool {
+		events = events[len(events)-maxScalingEventsPerPool:]
+	}
+	r.scalingEvents[nodePool] = events
+	if r.scalingCounts[nodePool] == nil {
+		r.scalingCounts[nodePool] = make(map[string]int)
+	}
+	r.scalingCounts[nodePool][typ]++
+	metrics.NodePoolScalingEventCount.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("kind", string(records.KindNodePool)),
+		attribute.String("scaling.type", typ),
+		attribute.String("node.pool", nodePool),
+	))
+}
+
+// ScalingEvents returns the most recent scaling events for a node pool.
+func (r *NodeReconciler) ScalingEvents(nodePool string) []ScalingEvent {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]ScalingEvent(nil), r.scalingEvents[nodePool]...)
+}
+
+// ScalingCounts returns the number of scaling events by node pool and type.
+func (r *NodeReconciler) ScalingCounts() map[string]map[string]int {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	counts := make(map[string]map[string]int, len(r.scalingCounts))
+	for pool, byType := range r.scalingCounts {
+		counts[pool] = make(map[string]int, len(byType))
+		for typ, n := range byType {
+			counts[pool][typ] = n
+		}
+	}
+	return counts
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *NodeReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
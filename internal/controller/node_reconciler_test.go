@@ -0,0 +1,308 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/k8sutils"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNodeReconcilerInterruptionTypes(t *testing.T) {
+	t.Parallel()
+
+	liveMigrationSignal := k8sutils.NodeInterruptionSignal{
+		Type:       k8sutils.NodeInterruptionLiveMigration,
+		Annotation: "example.com/live-migration",
+	}
+	nodes := []*corev1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "terminating"},
+			Spec: corev1.NodeSpec{Taints: []corev1.Taint{
+				{Key: "cloud.google.com/impending-node-termination", Effect: corev1.TaintEffectNoSchedule},
+			}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "maintenance", Labels: map[string]string{
+				"cloud.google.com/active-node-maintenance": "true",
+			}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "migrating", Annotations: map[string]string{
+				"example.com/live-migration": "true",
+			}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "healthy", Labels: map[string]string{
+				"cloud.google.com/active-node-maintenance": "false",
+			}},
+		},
+	}
+
+	builder := fake.NewClientBuilder()
+	for _, n := range nodes {
+		builder = builder.WithObjects(n)
+	}
+	r := &NodeReconciler{
+		Client:              builder.Build(),
+		InterruptionSignals: append(append([]k8sutils.NodeInterruptionSignal{}, k8sutils.DefaultNodeInterruptionSignals...), liveMigrationSignal),
+	}
+
+	// Reconcile twice to ensure repeated reconciles are not double counted.
+	for i := 0; i < 2; i++ {
+		for _, n := range nodes {
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: n.Name}})
+			require.NoError(t, err)
+		}
+	}
+
+	require.Equal(t, map[string]int{
+		k8sutils.NodeInterruptionTermination:   1,
+		k8sutils.NodeInterruptionMaintenance:   1,
+		k8sutils.NodeInterruptionLiveMigration: 1,
+	}, r.InterruptionCounts())
+
+	// A deleted node is forgotten without being counted.
+	_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "deleted"}})
+	require.NoError(t, err)
+	require.Len(t, r.InterruptionCounts(), 3)
+}
+
+func TestNodeReconcilerScalingEvents(t *testing.T) {
+	t.Parallel()
+
+	poolLabels := map[string]string{"cloud.google.com/gke-nodepool": "pool-a"}
+	existing := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "existing", Labels: poolLabels}}
+	removed := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "removed", Labels: poolLabels}}
+	terminated := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "terminated", Labels: poolLabels},
+		Spec: corev1.NodeSpec{Taints: []corev1.Taint{
+			{Key: "cloud.google.com/impending-node-termination", Effect: corev1.TaintEffectNoSchedule},
+		}},
+	}
+	c := fake.NewClientBuilder().WithObjects(existing, removed, terminated).Build()
+	r := &NodeReconciler{Client: c}
+
+	reconcile := func(name string) {
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: name}})
+		require.NoError(t, err)
+	}
+
+	// Nodes present at startup are not scale-ups.
+	for _, n := range []string{"existing", "removed", "terminated"} {
+		reconcile(n)
+	}
+	require.Empty(t, r.ScalingCounts())
+
+	// A Node created after startup is a scale-up.
+	added := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:              "added",
+		Labels:            poolLabels,
+		CreationTimestamp: metav1.NewTime(time.Now().Add(time.Minute)),
+	}}
+	require.NoError(t, c.Create(context.Background(), added))
+	reconcile("added")
+	reconcile("added")
+
+	// Removing a healthy Node is a scale-down, removing an interrupted Node
+	// is not.
+	require.NoError(t, c.Delete(context.Background(), removed))
+	require.NoError(t, c.Delete(context.Background(), terminated))
+	reconcile("removed")
+	reconcile("terminated")
+
+	require.Equal(t, map[string]map[string]int{
+		"pool-a": {ScalingEventScaleUp: 1, ScalingEventScaleDown: 1},
+	}, r.ScalingCounts())
+	require.Equal(t, map[string]int{k8sutils.NodeInterruptionTermination: 1}, r.InterruptionCounts())
+
+	events := r.ScalingEvents("pool-a")
+	require.Len(t, events, 2)
+	require.Equal(t, ScalingEventScaleUp, events[0].Type)
+	require.Equal(t, "added", events[0].Node)
+	require.Equal(t, ScalingEventScaleDown, events[1].Type)
+	require.Equal(t, "removed", events[1].Node)
+}
+
+func TestNodeReconcilerInterruptionsByVersion(t *testing.T) {
+	t.Parallel()
+
+	node := func(name, version string, labels map[string]string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			Spec: corev1.NodeSpec{Taints: []corev1.Taint{
+				{Key: "cloud.google.com/impending-node-termination", Effect: corev1.TaintEffectNoSchedule},
+			}},
+			Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{KubeletVersion: version}},
+		}
+	}
+	nodes := []*corev1.Node{
+		node("old-1", "v1.29.1-gke.100", nil),
+		node("old-2", "v1.29.1-gke.100", nil),
+		node("new-1", "v1.30.2-gke.200", nil),
+		// The label takes precedence over the kubelet version.
+		node("labelled", "v1.29.1-gke.100", map[string]string{"example.com/pool-version": "v1.30.2-gke.200"}),
+	}
+	builder := fake.NewClientBuilder()
+	for _, n := range nodes {
+		builder = builder.WithObjects(n)
+	}
+	r := &NodeReconciler{Client: builder.Build(), VersionLabel: "example.com/pool-version"}
+
+	for i := 0; i < 2; i++ {
+		for _, n := range nodes {
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: n.Name}})
+			require.NoError(t, err)
+		}
+	}
+
+	require.Equal(t, map[string]int{
+		"v1.29.1-gke.100": 2,
+		"v1.30.2-gke.200": 2,
+	}, r.InterruptionCountsByVersion())
+}
+
+func TestNodeReconcilerUpEvents(t *testing.T) {
+	t.Parallel()
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node"},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+			{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+			{Type: corev1.NodeNetworkUnavailable, Status: corev1.ConditionFalse},
+		}},
+	}
+	cl := fake.NewClientBuilder().WithObjects(node).WithStatusSubresource(node).Build()
+	r := &NodeReconciler{
+		Client: cl,
+		UpConditions: append([]k8sutils.NodeUpCondition{
+			{Type: corev1.NodeNetworkUnavailable, Status: corev1.ConditionFalse},
+		}, k8sutils.DefaultNodeUpConditions...),
+	}
+	reconcile := func() []bool {
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "node"}})
+		require.NoError(t, err)
+		var ups []bool
+		for _, e := range r.NodeEvents()["node"].UpEvents {
+			ups = append(ups, e.Up)
+		}
+		return ups
+	}
+	setCondition := func(typ corev1.NodeConditionType, status corev1.ConditionStatus) {
+		for i := range node.Status.Conditions {
+			if node.Status.Conditions[i].Type == typ {
+				node.Status.Conditions[i].Status = status
+			}
+		}
+		require.NoError(t, cl.Status().Update(context.Background(), node))
+	}
+
+	// A Node that is already up is not recorded as provisioning.
+	require.Equal(t, []bool{true}, reconcile())
+	require.Equal(t, []bool{true}, reconcile())
+
+	// The Node lingers NotReady, e.g. during a repair.
+	setCondition(corev1.NodeReady, corev1.ConditionUnknown)
+	require.Equal(t, []bool{true, false}, reconcile())
+	require.Equal(t, []bool{true, false}, reconcile())
+	setCondition(corev1.NodeReady, corev1.ConditionTrue)
+	require.Equal(t, []bool{true, false, true}, reconcile())
+
+	// Any of the configured conditions takes the Node down.
+	setCondition(corev1.NodeNetworkUnavailable, corev1.ConditionTrue)
+	require.Equal(t, []bool{true, false, true, false}, reconcile())
+
+	// Without DeletedNodeRetention, a deleted Node is forgotten.
+	require.NoError(t, cl.Delete(context.Background(), node))
+	_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "node"}})
+	require.NoError(t, err)
+	require.NotContains(t, r.NodeEvents(), "node")
+	require.NotContains(t, r.NodePools(), "node")
+}
+
+func TestNodeReconcilerDeletedNode(t *testing.T) {
+	t.Parallel()
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "node",
+			Labels: map[string]string{"cloud.google.com/gke-nodepool": "pool-a"},
+		},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+			{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+		}},
+	}
+	cl := fake.NewClientBuilder().WithObjects(node).Build()
+	r := &NodeReconciler{Client: cl, DeletedNodeRetention: time.Hour}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "node"}}
+	ups := func() []bool {
+		var ups []bool
+		for _, e := range r.NodeEvents()["node"].UpEvents {
+			ups = append(ups, e.Up)
+		}
+		return ups
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, []bool{true}, ups())
+
+	// The deleted Node goes down and is kept to attribute interruptions.
+	require.NoError(t, cl.Delete(context.Background(), node))
+	res, err := r.Reconcile(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, res.RequeueAfter)
+	require.Equal(t, []bool{true, false}, ups())
+	require.Equal(t, map[string]string{"node": "pool-a"}, r.NodePools())
+
+	// Requeues within the retention keep it.
+	res, err = r.Reconcile(context.Background(), req)
+	require.NoError(t, err)
+	require.Positive(t, res.RequeueAfter)
+	require.Equal(t, []bool{true, false}, ups())
+
+	// It is forgotten once the retention has passed.
+	r.deletedNodes["node"] = time.Now().Add(-time.Hour)
+	res, err = r.Reconcile(context.Background(), req)
+	require.NoError(t, err)
+	require.Zero(t, res.RequeueAfter)
+	require.NotContains(t, r.NodeEvents(), "node")
+	require.NotContains(t, r.NodePools(), "node")
+}
+
+func TestNodeReconcilerMinStateChangeInterval(t *testing.T) {
+	t.Parallel()
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node"},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+			{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+		}},
+	}
+	cl := fake.NewClientBuilder().WithObjects(node).WithStatusSubresource(node).Build()
+	r := &NodeReconciler{Client: cl, MinStateChangeInterval: time.Hour}
+	reconcile := func(status corev1.ConditionStatus) []bool {
+		node.Status.Conditions[0].Status = status
+		require.NoError(t, cl.Status().Update(context.Background(), node))
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "node"}})
+		require.NoError(t, err)
+		var ups []bool
+		for _, e := range r.NodeEvents()["node"].UpEvents {
+			ups = append(ups, e.Up)
+		}
+		return ups
+	}
+
+	require.Equal(t, []bool{true}, reconcile(corev1.ConditionTrue))
+	// The first state change is never delayed.
+	require.Equal(t, []bool{true, false}, reconcile(corev1.ConditionUnknown))
+	// Changes within the interval of the previous one are not recorded.
+	require.Equal(t, []bool{true, false}, reconcile(corev1.ConditionTrue))
+	require.Equal(t, []bool{true, false}, reconcile(corev1.ConditionFalse))
+}
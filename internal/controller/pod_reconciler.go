@@ -2,6 +2,8 @@ package controller
 
 import (
 	"context"
+	"sort"
+	"sync"
 
 	"example.com/megamon/internal/k8sutils"
 	batchv1 "k8s.io/api/batch/v1"
@@ -12,18 +14,31 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-const (
-	jobScheduledNodePoolLabel = "megamon.tbd/scheduled-node-pool"
-)
-
-// PodReconciler watches for JobSet Job leader Pods and labels the Job once Node scheduling
-// has occurred to keep track of dynamic Job-to-NodePool relationships.
+// PodReconciler watches for JobSet Job leader Pods and records the distinct
+// node pools and Nodes each JobSet has run on once Node scheduling has
+// occurred, see JobSetNodePools and JobSetNodes.
 type PodReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// ContainerName is the main (training) container of the leader Pod. If
+	// set, only its readiness is considered, otherwise the Pod's Ready
+	// condition is used.
+	ContainerName string
+
+	// ClusterName, if set, is used to derive the node pool of Nodes that
+	// lack the node pool label (see k8sutils.GetNodePoolWithFallback).
+	ClusterName string
+
+	nodePoolsMtx sync.Mutex
+	// nodePools are the node pools by JobSet UID.
+	nodePools map[string]map[string]struct{}
+	// nodes are the node pools by Node name by JobSet UID.
+	nodes map[string]map[string]string
 }
 
 // +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch
 
 func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	//log := log.FromContext(ctx)
@@ -33,12 +48,16 @@ func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 	if err := r.Get(ctx, req.NamespacedName, &pod); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	// Only record once the leader is running on the Node pool.
+	if !k8sutils.IsPodReady(&pod, r.ContainerName) {
+		return ctrl.Result{}, nil
+	}
 
 	var node corev1.Node
 	if err := r.Get(ctx, client.ObjectKey{Name: pod.Spec.NodeName}, &node); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
-	nodePool, ok := k8sutils.GetNodePool(&node)
+	nodePool, ok := k8sutils.GetNodePoolWithFallback(&node, r.ClusterName)
 	if !ok {
 		return ctrl.Result{}, nil
 	}
@@ -58,14 +77,101 @@ func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 	if err := r.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: jobRef.Name}, &job); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
-	if job.Labels == nil {
-		job.Labels = make(map[string]string)
-	}
-	job.Labels[jobScheduledNodePoolLabel] = nodePool
+	r.recordNode(&job, node.Name, nodePool)
 
 	return ctrl.Result{}, nil
 }
 
+func (r *PodReconciler) recordNode(job *batchv1.Job, node, nodePool string) {
+	var jobSetUID string
+	for _, ref := range job.OwnerReferences {
+		if ref.Kind == "JobSet" {
+			jobSetUID = string(ref.UID)
+			break
+		}
+	}
+	if jobSetUID == "" {
+		return
+	}
+
+	r.nodePoolsMtx.Lock()
+	defer r.nodePoolsMtx.Unlock()
+	if r.nodePools == nil {
+		r.nodePools = map[string]map[string]struct{}{}
+	}
+	if r.nodePools[jobSetUID] == nil {
+		r.nodePools[jobSetUID] = map[string]struct{}{}
+	}
+	r.nodePools[jobSetUID][nodePool] = struct{}{}
+
+	if r.nodes == nil {
+		r.nodes = map[string]map[string]string{}
+	}
+	if r.nodes[jobSetUID] == nil {
+		r.nodes[jobSetUID] = map[string]string{}
+	}
+	r.nodes[jobSetUID][node] = nodePool
+}
+
+// JobSetNodePools returns the sorted node pools that the leader Pods of the
+// given JobSets (by UID) have run on.
+func (r *PodReconciler) JobSetNodePools(keys []string) map[string][]string {
+	r.nodePoolsMtx.Lock()
+	defer r.nodePoolsMtx.Unlock()
+
+	out := make(map[string][]string, len(keys))
+	for _, key := range keys {
+		pools, ok := r.nodePools[key]
+		if !ok {
+			continue
+		}
+		for pool := range pools {
+			out[key] = append(out[key], pool)
+		}
+		sort.Strings(out[key])
+	}
+	return out
+}
+
+// JobSetNodes returns the node pool of each Node that the leader Pods of the
+// given JobSets (by UID) have run on, by Node name.
+func (r *PodReconciler) JobSetNodes(keys []string) map[string]map[string]string {
+	r.nodePoolsMtx.Lock()
+	defer r.nodePoolsMtx.Unlock()
+
+	out := make(map[string]map[string]string, len(keys))
+	for _, key := range keys {
+		nodes, ok := r.nodes[key]
+		if !ok {
+			continue
+		}
+		out[key] = make(map[string]string, len(nodes))
+		for node, pool := range nodes {
+			out[key][node] = pool
+		}
+	}
+	return out
+}
+
+// Prune forgets all JobSets but the given ones (by UID), e.g. deleted ones.
+func (r *PodReconciler) Prune(keys []string) {
+	r.nodePoolsMtx.Lock()
+	defer r.nodePoolsMtx.Unlock()
+
+	keptPools := make(map[string]map[string]struct{}, len(keys))
+	keptNodes := make(map[string]map[string]string, len(keys))
+	for _, key := range keys {
+		if pools, ok := r.nodePools[key]; ok {
+			keptPools[key] = pools
+		}
+		if nodes, ok := r.nodes[key]; ok {
+			keptNodes[key] = nodes
+		}
+	}
+	r.nodePools = keptPools
+	r.nodes = keptNodes
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *PodReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPodReconcilerContainerReadiness(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		containerName string
+		expRecorded   bool
+	}{
+		"pod readiness": {
+			expRecorded: false,
+		},
+		"main container readiness": {
+			containerName: "trainer",
+			expRecorded:   true,
+		},
+		"missing container": {
+			containerName: "other",
+			expRecorded:   false,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+				Namespace:       "default",
+				Name:            "train-rj-0",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "JobSet", Name: "train", UID: "js-uid"}},
+			}}
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+				Name:   "node-a",
+				Labels: map[string]string{"cloud.google.com/gke-nodepool": "pool-a"},
+			}}
+			// The trainer is ready but the sidecar is not, so the Pod is not
+			// Ready overall.
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:       "default",
+					Name:            "train-rj-0-0",
+					OwnerReferences: []metav1.OwnerReference{{Kind: "Job", Name: job.Name}},
+				},
+				Spec: corev1.PodSpec{NodeName: node.Name},
+				Status: corev1.PodStatus{
+					Conditions: []corev1.PodCondition{
+						{Type: corev1.PodReady, Status: corev1.ConditionFalse},
+					},
+					ContainerStatuses: []corev1.ContainerStatus{
+						{Name: "trainer", Ready: true},
+						{Name: "sidecar", Ready: false},
+					},
+				},
+			}
+
+			cl := fake.NewClientBuilder().WithObjects(job, node, pod).Build()
+			r := &PodReconciler{Client: cl, ContainerName: c.containerName}
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}})
+			require.NoError(t, err)
+
+			if c.expRecorded {
+				require.Equal(t, map[string][]string{"js-uid": {"pool-a"}}, r.JobSetNodePools([]string{"js-uid"}))
+			} else {
+				require.Empty(t, r.JobSetNodePools([]string{"js-uid"}))
+			}
+		})
+	}
+}
+
+func TestPodReconcilerNodePoolFallback(t *testing.T) {
+	t.Parallel()
+
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Namespace:       "default",
+		Name:            "train-rj-0",
+		OwnerReferences: []metav1.OwnerReference{{Kind: "JobSet", Name: "train", UID: "js-uid"}},
+	}}
+	// The Node has just joined and lacks the node pool label.
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Spec:       corev1.NodeSpec{ProviderID: "gce://proj/us-central2-b/gke-prod-pool-a-1a2b3c4d-x7yz"},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "train-rj-0-0",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Job", Name: job.Name}},
+		},
+		Spec: corev1.PodSpec{NodeName: node.Name},
+		Status: corev1.PodStatus{Conditions: []corev1.PodCondition{
+			{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+		}},
+	}
+
+	cl := fake.NewClientBuilder().WithObjects(job, node, pod).Build()
+	r := &PodReconciler{Client: cl, ClusterName: "prod"}
+	_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}})
+	require.NoError(t, err)
+
+	require.Equal(t, map[string][]string{"js-uid": {"pool-a"}}, r.JobSetNodePools([]string{"js-uid"}))
+}
+
+func TestPodReconcilerJobSetNodePools(t *testing.T) {
+	t.Parallel()
+
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Namespace:       "default",
+		Name:            "train-rj-0",
+		OwnerReferences: []metav1.OwnerReference{{Kind: "JobSet", Name: "train", UID: "js-uid"}},
+	}}
+	nodeA := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node-a",
+		Labels: map[string]string{"cloud.google.com/gke-nodepool": "pool-b"},
+	}}
+	nodeB := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node-b",
+		Labels: map[string]string{"cloud.google.com/gke-nodepool": "pool-a"},
+	}}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "train-rj-0-0",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Job", Name: job.Name}},
+		},
+		Spec: corev1.PodSpec{NodeName: nodeA.Name},
+		Status: corev1.PodStatus{Conditions: []corev1.PodCondition{
+			{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+		}},
+	}
+
+	cl := fake.NewClientBuilder().WithObjects(job, nodeA, nodeB, pod).Build()
+	r := &PodReconciler{Client: cl}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}}
+	_, err := r.Reconcile(context.Background(), req)
+	require.NoError(t, err)
+
+	// The Pod is recreated on another node pool.
+	require.NoError(t, cl.Delete(context.Background(), pod))
+	pod = pod.DeepCopy()
+	pod.ResourceVersion = ""
+	pod.Spec.NodeName = nodeB.Name
+	require.NoError(t, cl.Create(context.Background(), pod))
+	_, err = r.Reconcile(context.Background(), req)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string][]string{"js-uid": {"pool-a", "pool-b"}}, r.JobSetNodePools([]string{"js-uid", "other"}))
+	require.Equal(t, map[string]map[string]string{"js-uid": {"node-a": "pool-b", "node-b": "pool-a"}}, r.JobSetNodes([]string{"js-uid", "other"}))
+
+	// Reading has no side effects.
+	require.Equal(t, map[string][]string{"js-uid": {"pool-a", "pool-b"}}, r.JobSetNodePools([]string{"js-uid"}))
+
+	// Pruned JobSets are forgotten.
+	r.Prune([]string{"other"})
+	require.Empty(t, r.JobSetNodePools([]string{"js-uid"}))
+	require.Empty(t, r.JobSetNodes([]string{"js-uid"}))
+}
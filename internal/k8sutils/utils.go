@@ -1,14 +1,109 @@
 package k8sutils
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"example.com/megamon/internal/records"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
 )
 
+const (
+	// JobSetLastCheckpointAnnotation is set by training workloads to the
+	// RFC3339 timestamp of their most recent checkpoint.
+	JobSetLastCheckpointAnnotation = "megamon.example.com/last-checkpoint"
+	// JobSetStepAnnotation is set by training workloads to their current
+	// training step.
+	JobSetStepAnnotation = "megamon.example.com/step"
+	// JobSetAvailabilityAnnotation is set by megamon to the JobSet's current
+	// availability (0 to 1).
+	JobSetAvailabilityAnnotation = "megamon.example.com/availability"
+	// JobSetRecentInterruptionsAnnotation is set by megamon to a comma
+	// separated list of the RFC3339 timestamps of the JobSet's most recent
+	// interruptions, newest first.
+	JobSetRecentInterruptionsAnnotation = "megamon.example.com/recent-interruptions"
+	// JobSetSLOTargetAnnotation overrides the default SLO target for a
+	// JobSet, as a fraction between 0 and 1 (exclusive), e.g. "0.99".
+	JobSetSLOTargetAnnotation = "megamon.example.com/slo-target"
+	// JobSetSLOWindowAnnotation overrides the default SLO window for a
+	// JobSet, as a Go duration, e.g. "168h".
+	JobSetSLOWindowAnnotation = "megamon.example.com/slo-window"
+	// JobSetCoordinatorAnnotation designates the replicated Job running the
+	// JobSet's coordinator (head) by name, e.g. "head". Interruptions while it
+	// is not ready are recorded with records.SeverityCoordinator.
+	JobSetCoordinatorAnnotation = "megamon.example.com/coordinator"
+)
+
+const (
+	NodeInterruptionTermination   = "termination"
+	NodeInterruptionMaintenance   = "maintenance"
+	NodeInterruptionLiveMigration = "live-migration"
+)
+
+// NodeInterruptionSignal maps a Node taint, label or annotation to an
+// interruption type. Only one of Taint, Label or Annotation should be set.
+// An empty Value matches any value.
+type NodeInterruptionSignal struct {
+	Type string
+
+	Taint      string
+	Label      string
+	Annotation string
+	Value      string
+}
+
+// DefaultNodeInterruptionSignals are the signals GKE sets on Nodes ahead of
+// terminations and host maintenance. GKE does not mark live migrations on the
+// Node object, so live migration signals need to be configured explicitly.
+var DefaultNodeInterruptionSignals = []NodeInterruptionSignal{
+	{Type: NodeInterruptionTermination, Taint: "cloud.google.com/impending-node-termination"},
+	{Type: NodeInterruptionMaintenance, Label: "cloud.google.com/active-node-maintenance", Value: "true"},
+}
+
+// GetNodeInterruptionType returns the type of the first signal that matches
+// the Node.
+func GetNodeInterruptionType(node *corev1.Node, signals []NodeInterruptionSignal) (string, bool) {
+	for _, s := range signals {
+		if s.matches(node) {
+			return s.Type, true
+		}
+	}
+	return "", false
+}
+
+func (s NodeInterruptionSignal) matches(node *corev1.Node) bool {
+	matchValue := func(val string, ok bool) bool {
+		return ok && (s.Value == "" || s.Value == val)
+	}
+	switch {
+	case s.Taint != "":
+		for _, t := range node.Spec.Taints {
+			if t.Key == s.Taint && (s.Value == "" || s.Value == t.Value) {
+				return true
+			}
+		}
+		return false
+	case s.Label != "":
+		val, ok := node.Labels[s.Label]
+		return matchValue(val, ok)
+	case s.Annotation != "":
+		val, ok := node.Annotations[s.Annotation]
+		return matchValue(val, ok)
+	}
+	return false
+}
+
 func GetNodePool(node *corev1.Node) (string, bool) {
 	if node.Labels == nil {
 		return "", false
@@ -17,6 +112,61 @@ func GetNodePool(node *corev1.Node) (string, bool) {
 	return val, ok
 }
 
+// GetNodePoolWithFallback is like GetNodePool, but if the node pool label is
+// missing or empty (GKE Nodes can transiently lack it right after joining)
+// and clusterName is set, it derives the node pool from the Node's GCE
+// provider ID instead, see GetNodePoolFromProviderID.
+func GetNodePoolWithFallback(node *corev1.Node, clusterName string) (string, bool) {
+	if val, ok := GetNodePool(node); ok && val != "" {
+		return val, true
+	}
+	if clusterName == "" {
+		return "", false
+	}
+	return GetNodePoolFromProviderID(node, clusterName)
+}
+
+// GetNodePoolFromProviderID derives the node pool from the instance name in
+// the Node's GCE provider ID (gce://<project>/<zone>/<instance>). GKE names
+// instances gke-<cluster>-<pool>-<instance group hash>-<suffix>, which is
+// only unambiguous if the cluster name is known. Names that GKE truncated
+// (long cluster and pool names) do not resolve.
+func GetNodePoolFromProviderID(node *corev1.Node, clusterName string) (string, bool) {
+	path, ok := strings.CutPrefix(node.Spec.ProviderID, "gce://")
+	if !ok {
+		return "", false
+	}
+	parts := strings.Split(path, "/")
+	if len(parts) != 3 {
+		return "", false
+	}
+	rest, ok := strings.CutPrefix(parts[2], "gke-"+clusterName+"-")
+	if !ok {
+		return "", false
+	}
+	// Strip the instance group hash and instance suffix.
+	for i := 0; i < 2; i++ {
+		idx := strings.LastIndex(rest, "-")
+		if idx <= 0 {
+			return "", false
+		}
+		rest = rest[:idx]
+	}
+	return rest, true
+}
+
+// GetNodePoolVersion returns the version of the Node's node pool from the
+// given label, falling back to the kubelet version (which GKE keeps in sync
+// with the node pool version) if the label is empty or not set.
+func GetNodePoolVersion(node *corev1.Node, label string) string {
+	if label != "" {
+		if val, ok := node.Labels[label]; ok && val != "" {
+			return val
+		}
+	}
+	return node.Status.NodeInfo.KubeletVersion
+}
+
 func IsJobSetActive(js *jobset.JobSet) bool {
 	for _, c := range js.Status.Conditions {
 		if c.Status == metav1.ConditionTrue {
@@ -29,6 +179,17 @@ func IsJobSetActive(js *jobset.JobSet) bool {
 	return true
 }
 
+// IsJobSetExpectedToRun returns whether the JobSet is expected to have running
+// replicas: it is not suspended (including when created suspended, before the
+// Suspended condition is set) and has at least one replica.
+func IsJobSetExpectedToRun(js *jobset.JobSet) bool {
+	if js.Spec.Suspend != nil && *js.Spec.Suspend {
+		return false
+	}
+	specReplicas, _ := GetJobSetReplicas(js)
+	return specReplicas > 0
+}
+
 func GetJobSetReplicas(js *jobset.JobSet) (int32, int32) {
 	var specifiedReplicas int32
 	var readyReplicas int32
@@ -44,6 +205,107 @@ func GetJobSetReplicas(js *jobset.JobSet) (int32, int32) {
 	return specifiedReplicas, readyReplicas
 }
 
+// GetReplicatedJobReplicas returns the specified and ready replicas of each
+// replicated Job of the JobSet, by replicated Job name.
+func GetReplicatedJobReplicas(js *jobset.JobSet) (specified, ready map[string]int32) {
+	specified = make(map[string]int32, len(js.Spec.ReplicatedJobs))
+	ready = make(map[string]int32, len(js.Spec.ReplicatedJobs))
+	for _, rj := range js.Spec.ReplicatedJobs {
+		specified[rj.Name] = rj.Replicas
+	}
+	for _, rjs := range js.Status.ReplicatedJobsStatus {
+		if _, ok := specified[rjs.Name]; ok {
+			ready[rjs.Name] = rjs.Ready
+		}
+	}
+	return specified, ready
+}
+
+// GetJobSetCoordinatorReady returns whether all replicas of the JobSet's
+// coordinator replicated Job (see JobSetCoordinatorAnnotation) are ready. ok
+// is false if the JobSet does not designate an existing coordinator.
+func GetJobSetCoordinatorReady(js *jobset.JobSet) (ready bool, ok bool) {
+	name := js.Annotations[JobSetCoordinatorAnnotation]
+	if name == "" {
+		return false, false
+	}
+	var replicas int32
+	for _, rj := range js.Spec.ReplicatedJobs {
+		if rj.Name == name {
+			replicas, ok = rj.Replicas, true
+			break
+		}
+	}
+	if !ok {
+		return false, false
+	}
+	for _, rjs := range js.Status.ReplicatedJobsStatus {
+		if rjs.Name == name {
+			return rjs.Ready >= replicas, true
+		}
+	}
+	return replicas == 0, true
+}
+
+func GetJobSetLastCheckpoint(js *jobset.JobSet) (time.Time, bool) {
+	val, ok := js.Annotations[JobSetLastCheckpointAnnotation]
+	if !ok {
+		return time.Time{}, false
+	}
+	ts, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return ts, true
+}
+
+// GetJobSetStep returns the current training step reported by the workload.
+func GetJobSetStep(js *jobset.JobSet) (int64, bool) {
+	val, ok := js.Annotations[JobSetStepAnnotation]
+	if !ok {
+		return 0, false
+	}
+	step, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || step < 0 {
+		return 0, false
+	}
+	return step, true
+}
+
+// GetJobSetSLO returns the SLO set by the JobSet's annotations. Fields
+// without an annotation are left zero, to be filled in from the defaults.
+func GetJobSetSLO(js *jobset.JobSet) (records.SLO, error) {
+	var slo records.SLO
+	if val, ok := js.Annotations[JobSetSLOTargetAnnotation]; ok {
+		target, err := strconv.ParseFloat(val, 64)
+		if err != nil || target <= 0 || target >= 1 {
+			return records.SLO{}, fmt.Errorf("invalid %s annotation %q: must be a number between 0 and 1 (exclusive)", JobSetSLOTargetAnnotation, val)
+		}
+		slo.Target = target
+	}
+	if val, ok := js.Annotations[JobSetSLOWindowAnnotation]; ok {
+		window, err := time.ParseDuration(val)
+		if err != nil || window <= 0 {
+			return records.SLO{}, fmt.Errorf("invalid %s annotation %q: must be a positive duration", JobSetSLOWindowAnnotation, val)
+		}
+		slo.Window = window
+	}
+	return slo, nil
+}
+
+// GetJobSetRestartBudget returns the number of restarts left before the
+// JobSet fails, or false if the JobSet has no failure policy.
+func GetJobSetRestartBudget(js *jobset.JobSet) (int32, bool) {
+	if js.Spec.FailurePolicy == nil {
+		return 0, false
+	}
+	remaining := js.Spec.FailurePolicy.MaxRestarts - js.Status.RestartsCountTowardsMax
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true
+}
+
 func GetJobSetForNode(node *corev1.Node) (string, string) {
 	if node.Labels == nil {
 		return "", ""
@@ -68,6 +330,48 @@ func GetExpectedNodeCount(js *jobset.JobSet) int32 {
 	return count
 }
 
+// IsPodRunning returns whether the Pod is running and not being deleted.
+func IsPodRunning(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil
+}
+
+// IsPodReady returns whether the Pod is ready. If containerName is set, only
+// the readiness of that container is considered so that sidecars do not
+// affect the result.
+func IsPodReady(pod *corev1.Pod, containerName string) bool {
+	if containerName != "" {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Name == containerName {
+				return cs.Ready
+			}
+		}
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// IsJobReady returns whether all Pods of the Job are ready or have
+// succeeded, as the JobSet controller counts ready Jobs.
+func IsJobReady(job *batchv1.Job) bool {
+	pods := int32(1)
+	if job.Spec.Parallelism != nil {
+		pods = *job.Spec.Parallelism
+	}
+	if job.Spec.Completions != nil && *job.Spec.Completions < pods {
+		pods = *job.Spec.Completions
+	}
+	var ready int32
+	if job.Status.Ready != nil {
+		ready = *job.Status.Ready
+	}
+	return job.Status.Succeeded+ready >= pods
+}
+
 func IsNodeReady(node *corev1.Node) bool {
 	for _, c := range node.Status.Conditions {
 		if c.Type == corev1.NodeReady && c.Status == corev1.ConditionTrue {
@@ -77,6 +381,48 @@ func IsNodeReady(node *corev1.Node) bool {
 	return false
 }
 
+// NodeUpCondition is a Node condition that must have Status for the Node to
+// count as up.
+type NodeUpCondition struct {
+	Type   corev1.NodeConditionType
+	Status corev1.ConditionStatus
+}
+
+// DefaultNodeUpConditions only require the Node to be Ready.
+var DefaultNodeUpConditions = []NodeUpCondition{
+	{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+}
+
+// IsNodeUp returns whether all of the given conditions have their status. A
+// missing condition is not met.
+func IsNodeUp(node *corev1.Node, conditions []NodeUpCondition) bool {
+	for _, want := range conditions {
+		met := false
+		for _, c := range node.Status.Conditions {
+			if c.Type == want.Type {
+				met = c.Status == want.Status
+				break
+			}
+		}
+		if !met {
+			return false
+		}
+	}
+	return true
+}
+
+// IsNodeDegraded returns whether any of the given conditions, e.g. an
+// accelerator health condition set by a device plugin or node problem
+// detector, is true.
+func IsNodeDegraded(node *corev1.Node, conditions []corev1.NodeConditionType) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Status == corev1.ConditionTrue && slices.Contains(conditions, c.Type) {
+			return true
+		}
+	}
+	return false
+}
+
 func GetEventRecordsFromConfigMap(cm *corev1.ConfigMap) (map[string]records.EventRecords, error) {
 	recs := make(map[string]records.EventRecords)
 	if cm.Data == nil {
@@ -92,6 +438,91 @@ func GetEventRecordsFromConfigMap(cm *corev1.ConfigMap) (map[string]records.Even
 	return recs, nil
 }
 
+const (
+	// CompressedReportKeySuffix is appended to the report key to name the
+	// key holding the gzip compressed, base64 encoded report.
+	CompressedReportKeySuffix = ".json.gz"
+	// ReportCompressionKeySuffix is appended to the report key to name the
+	// key that is set to ReportCompressionGzip while the report is stored
+	// compressed.
+	ReportCompressionKeySuffix = ".compression"
+	ReportCompressionGzip      = "gzip"
+)
+
+func GetReportFromConfigMap(cm *corev1.ConfigMap, key string) (records.Report, error) {
+	var report records.Report
+	data, err := GetReportJSONFromConfigMap(cm, key)
+	if err != nil {
+		return report, err
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// GetReportJSONFromConfigMap returns the JSON report stored under key,
+// transparently decompressing it (see SetReportJSONInConfigMap).
+func GetReportJSONFromConfigMap(cm *corev1.ConfigMap, key string) ([]byte, error) {
+	if cm.Data[key+ReportCompressionKeySuffix] != ReportCompressionGzip {
+		data, ok := cm.Data[key]
+		if !ok {
+			return nil, fmt.Errorf("key %q not found in configmap %s/%s", key, cm.Namespace, cm.Name)
+		}
+		return []byte(data), nil
+	}
+
+	compressedKey := key + CompressedReportKeySuffix
+	data, ok := cm.Data[compressedKey]
+	if !ok {
+		return nil, fmt.Errorf("key %q not found in configmap %s/%s", compressedKey, cm.Namespace, cm.Name)
+	}
+	compressed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", compressedKey, err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing %s: %w", compressedKey, err)
+	}
+	defer r.Close()
+	jsn, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing %s: %w", compressedKey, err)
+	}
+	return jsn, nil
+}
+
+// SetReportJSONInConfigMap stores the JSON report under key or, with
+// compress, gzip compressed and base64 encoded under
+// key+CompressedReportKeySuffix to stay below the ConfigMap size limit for
+// large reports. The other representation is removed so that readers never
+// see a stale report.
+func SetReportJSONInConfigMap(cm *corev1.ConfigMap, key string, jsn []byte, compress bool) error {
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	if !compress {
+		cm.Data[key] = string(jsn)
+		delete(cm.Data, key+CompressedReportKeySuffix)
+		delete(cm.Data, key+ReportCompressionKeySuffix)
+		return nil
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(jsn); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	cm.Data[key+CompressedReportKeySuffix] = base64.StdEncoding.EncodeToString(buf.Bytes())
+	cm.Data[key+ReportCompressionKeySuffix] = ReportCompressionGzip
+	delete(cm.Data, key)
+	return nil
+}
+
 func SetEventRecordsInConfigMap(cm *corev1.ConfigMap, recs map[string]records.EventRecords) error {
 	cm.Data = make(map[string]string)
 	for k, rec := range recs {
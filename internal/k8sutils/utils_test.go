@@ -0,0 +1,267 @@
+package k8sutils
+
+import (
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestGetJobSetLastCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]struct {
+		annotations map[string]string
+		expTime     time.Time
+		expOK       bool
+	}{
+		"missing": {
+			annotations: nil,
+		},
+		"malformed": {
+			annotations: map[string]string{JobSetLastCheckpointAnnotation: "yesterday"},
+		},
+		"valid": {
+			annotations: map[string]string{JobSetLastCheckpointAnnotation: "2021-01-01T00:00:00Z"},
+			expTime:     t0,
+			expOK:       true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			js := &jobset.JobSet{ObjectMeta: metav1.ObjectMeta{Annotations: c.annotations}}
+			gotTime, gotOK := GetJobSetLastCheckpoint(js)
+			require.Equal(t, c.expOK, gotOK)
+			require.True(t, c.expTime.Equal(gotTime), "expected %v, got %v", c.expTime, gotTime)
+		})
+	}
+}
+
+func TestIsJobSetExpectedToRun(t *testing.T) {
+	t.Parallel()
+
+	suspend := true
+	cases := map[string]struct {
+		spec jobset.JobSetSpec
+		exp  bool
+	}{
+		"running": {
+			spec: jobset.JobSetSpec{ReplicatedJobs: []jobset.ReplicatedJob{{Replicas: 2}}},
+			exp:  true,
+		},
+		"suspended": {
+			spec: jobset.JobSetSpec{
+				Suspend:        &suspend,
+				ReplicatedJobs: []jobset.ReplicatedJob{{Replicas: 2}},
+			},
+		},
+		"zero replicas": {
+			spec: jobset.JobSetSpec{ReplicatedJobs: []jobset.ReplicatedJob{{Replicas: 0}}},
+		},
+		"no replicated jobs": {},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, c.exp, IsJobSetExpectedToRun(&jobset.JobSet{Spec: c.spec}))
+		})
+	}
+}
+
+func TestGetJobSetStep(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		annotations map[string]string
+		expStep     int64
+		expOK       bool
+	}{
+		"missing": {},
+		"malformed": {
+			annotations: map[string]string{JobSetStepAnnotation: "ten"},
+		},
+		"negative": {
+			annotations: map[string]string{JobSetStepAnnotation: "-1"},
+		},
+		"valid": {
+			annotations: map[string]string{JobSetStepAnnotation: "12345"},
+			expStep:     12345,
+			expOK:       true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			js := &jobset.JobSet{ObjectMeta: metav1.ObjectMeta{Annotations: c.annotations}}
+			gotStep, gotOK := GetJobSetStep(js)
+			require.Equal(t, c.expOK, gotOK)
+			require.Equal(t, c.expStep, gotStep)
+		})
+	}
+}
+
+func TestGetJobSetRestartBudget(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		policy       *jobset.FailurePolicy
+		restarts     int32
+		expRemaining int32
+		expOK        bool
+	}{
+		"no failure policy": {},
+		"unused": {
+			policy:       &jobset.FailurePolicy{MaxRestarts: 3},
+			expRemaining: 3,
+			expOK:        true,
+		},
+		"consumed restarts": {
+			policy:       &jobset.FailurePolicy{MaxRestarts: 3},
+			restarts:     2,
+			expRemaining: 1,
+			expOK:        true,
+		},
+		"exhausted": {
+			policy:       &jobset.FailurePolicy{MaxRestarts: 3},
+			restarts:     4,
+			expRemaining: 0,
+			expOK:        true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			js := &jobset.JobSet{
+				Spec:   jobset.JobSetSpec{FailurePolicy: c.policy},
+				Status: jobset.JobSetStatus{RestartsCountTowardsMax: c.restarts},
+			}
+			gotRemaining, gotOK := GetJobSetRestartBudget(js)
+			require.Equal(t, c.expOK, gotOK)
+			require.Equal(t, c.expRemaining, gotRemaining)
+		})
+	}
+}
+
+func TestGetJobSetSLO(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		annotations map[string]string
+		exp         records.SLO
+		expErr      bool
+	}{
+		"missing": {},
+		"target only": {
+			annotations: map[string]string{JobSetSLOTargetAnnotation: "0.99"},
+			exp:         records.SLO{Target: 0.99},
+		},
+		"both": {
+			annotations: map[string]string{JobSetSLOTargetAnnotation: "0.95", JobSetSLOWindowAnnotation: "168h"},
+			exp:         records.SLO{Target: 0.95, Window: 168 * time.Hour},
+		},
+		"malformed target": {
+			annotations: map[string]string{JobSetSLOTargetAnnotation: "99%"},
+			expErr:      true,
+		},
+		"target out of range": {
+			annotations: map[string]string{JobSetSLOTargetAnnotation: "1"},
+			expErr:      true,
+		},
+		"malformed window": {
+			annotations: map[string]string{JobSetSLOWindowAnnotation: "7d"},
+			expErr:      true,
+		},
+		"negative window": {
+			annotations: map[string]string{JobSetSLOWindowAnnotation: "-1h"},
+			expErr:      true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			js := &jobset.JobSet{ObjectMeta: metav1.ObjectMeta{Annotations: c.annotations}}
+			got, err := GetJobSetSLO(js)
+			if c.expErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.exp, got)
+		})
+	}
+}
+
+func TestGetNodePoolWithFallback(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		labels      map[string]string
+		providerID  string
+		clusterName string
+		expPool     string
+		expOK       bool
+	}{
+		"label": {
+			labels:      map[string]string{"cloud.google.com/gke-nodepool": "pool-a"},
+			providerID:  "gce://proj/us-central2-b/gke-prod-pool-b-1a2b3c4d-x7yz",
+			clusterName: "prod",
+			expPool:     "pool-a",
+			expOK:       true,
+		},
+		"provider id": {
+			providerID:  "gce://proj/us-central2-b/gke-prod-tpu-v5-pool-1a2b3c4d-x7yz",
+			clusterName: "prod",
+			expPool:     "tpu-v5-pool",
+			expOK:       true,
+		},
+		"empty label": {
+			labels:      map[string]string{"cloud.google.com/gke-nodepool": ""},
+			providerID:  "gce://proj/us-central2-b/gke-prod-pool-a-1a2b3c4d-x7yz",
+			clusterName: "prod",
+			expPool:     "pool-a",
+			expOK:       true,
+		},
+		"no cluster name": {
+			providerID: "gce://proj/us-central2-b/gke-prod-pool-a-1a2b3c4d-x7yz",
+		},
+		"other cluster": {
+			providerID:  "gce://proj/us-central2-b/gke-staging-pool-a-1a2b3c4d-x7yz",
+			clusterName: "prod",
+		},
+		"not gce": {
+			providerID:  "aws:///us-east-1a/i-0123456789",
+			clusterName: "prod",
+		},
+		"malformed instance": {
+			providerID:  "gce://proj/us-central2-b/gke-prod-x7yz",
+			clusterName: "prod",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Labels: c.labels},
+				Spec:       corev1.NodeSpec{ProviderID: c.providerID},
+			}
+			gotPool, gotOK := GetNodePoolWithFallback(node, c.clusterName)
+			require.Equal(t, c.expOK, gotOK)
+			require.Equal(t, c.expPool, gotPool)
+		})
+	}
+}
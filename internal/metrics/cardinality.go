@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+
+	"example.com/megamon/internal/records"
+)
+
+// entityLimiter admits up to max entities. Admitted entities keep their slot
+// for as long as they are reported so that series do not flap between the
+// per-entity and overflow series, unless evictOldest is set.
+type entityLimiter struct {
+	max int
+	// evictOldest admits new entities by evicting the admitted entities
+	// that were first seen earliest, rather than summing the new entities
+	// into the overflow series.
+	evictOldest bool
+
+	mtx      sync.Mutex
+	admitted map[string]bool
+	// seen is the order in which the reported entities were first seen, with
+	// evictOldest. Entities are forgotten once they are no longer reported.
+	seen    map[string]uint64
+	seq     uint64
+	evicted int64
+}
+
+// admit returns the admitted entities and the number of overflowed ones.
+func (l *entityLimiter) admit(keys []string) (map[string]bool, int) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	admitted := make(map[string]bool, len(keys))
+	if l.max <= 0 {
+		for _, key := range keys {
+			admitted[key] = true
+		}
+		l.admitted = admitted
+		return admitted, 0
+	}
+
+	if l.evictOldest {
+		return l.admitNewest(keys)
+	}
+
+	for _, key := range keys {
+		if l.admitted[key] {
+			admitted[key] = true
+		}
+	}
+	var overflowed int
+	for _, key := range keys {
+		if admitted[key] {
+			continue
+		}
+		if len(admitted) < l.max {
+			admitted[key] = true
+		} else {
+			overflowed++
+		}
+	}
+	// The returned map is not modified after this point.
+	l.admitted = admitted
+	return admitted, overflowed
+}
+
+// admitNewest admits the max most recently first seen entities, counting the
+// previously admitted entities that lost their slot as evicted.
+func (l *entityLimiter) admitNewest(keys []string) (map[string]bool, int) {
+	seen := make(map[string]uint64, len(keys))
+	for _, key := range keys {
+		n, ok := l.seen[key]
+		if !ok {
+			l.seq++
+			n = l.seq
+		}
+		seen[key] = n
+	}
+	l.seen = seen
+
+	newest := append([]string(nil), keys...)
+	sort.Slice(newest, func(i, j int) bool { return seen[newest[i]] > seen[newest[j]] })
+	admitted := make(map[string]bool, min(len(newest), l.max))
+	for _, key := range newest[:min(len(newest), l.max)] {
+		admitted[key] = true
+	}
+	for key := range l.admitted {
+		if _, ok := seen[key]; ok && !admitted[key] {
+			l.evicted++
+		}
+	}
+	l.admitted = admitted
+	return admitted, len(keys) - len(admitted)
+}
+
+// evictedCount returns the total number of evictions.
+func (l *entityLimiter) evictedCount() int64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.evicted
+}
+
+// entityKeys returns the sorted keys of all entities in the report.
+func entityKeys(report records.Report) []string {
+	set := map[string]struct{}{}
+	for key := range report.JobSetsUp {
+		set[key] = struct{}{}
+	}
+	for key := range report.JobSetNodesUp {
+		set[key] = struct{}{}
+	}
+	for key := range report.JobSetsUpSummaries {
+		set[key] = struct{}{}
+	}
+	for key := range report.JobSetNodesUpSummaries {
+		set[key] = struct{}{}
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type overflowTotals struct {
+	up, nodesUp   int64
+	jobset, nodes overflowSummary
+}
+
+// overflowSummary holds the additive fields of summed EventSummaries.
+type overflowSummary struct {
+	records.EventSummary
+	atRisk   int64
+	alerting int64
+	stuck    int64
+}
+
+func (s *overflowSummary) add(o records.EventSummary) {
+	s.InterruptionCount += o.InterruptionCount
+	s.CoordinatorInterruptionCount += o.CoordinatorInterruptionCount
+	s.NodeInterruptionCount += o.NodeInterruptionCount
+	s.RecoveryCount += o.RecoveryCount
+	s.UpTime += o.UpTime
+	s.EffectiveUpTime += o.EffectiveUpTime
+	s.DegradedTime += o.DegradedTime
+	s.DownTime += o.DownTime
+	s.DownTimeInitial += o.DownTimeInitial
+	s.TotalDownTimeBetweenRecovery += o.TotalDownTimeBetweenRecovery
+	s.TotalUpTimeBetweenInterruption += o.TotalUpTimeBetweenInterruption
+	s.ProvisioningRetryCount += o.ProvisioningRetryCount
+	s.atRisk += boolToInt64(o.AtRisk)
+	s.alerting += boolToInt64(o.Alerting)
+	s.stuck += boolToInt64(o.ProvisioningStuck)
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityLimiter(t *testing.T) {
+	t.Parallel()
+
+	l := &entityLimiter{max: 2}
+
+	admitted, overflowed := l.admit([]string{"a", "b", "c"})
+	require.Equal(t, map[string]bool{"a": true, "b": true}, admitted)
+	require.Equal(t, 1, overflowed)
+
+	// Admitted entities keep their slot even if new entities sort first.
+	admitted, overflowed = l.admit([]string{"0", "a", "b", "c"})
+	require.Equal(t, map[string]bool{"a": true, "b": true}, admitted)
+	require.Equal(t, 2, overflowed)
+
+	// Slots of removed entities are freed.
+	admitted, overflowed = l.admit([]string{"0", "b", "c"})
+	require.Equal(t, map[string]bool{"0": true, "b": true}, admitted)
+	require.Equal(t, 1, overflowed)
+
+	unlimited := &entityLimiter{}
+	admitted, overflowed = unlimited.admit([]string{"a", "b", "c"})
+	require.Len(t, admitted, 3)
+	require.Zero(t, overflowed)
+}
+
+func TestEntityLimiterEvictOldest(t *testing.T) {
+	t.Parallel()
+
+	l := &entityLimiter{max: 2, evictOldest: true}
+
+	admitted, overflowed := l.admit([]string{"a", "b"})
+	require.Equal(t, map[string]bool{"a": true, "b": true}, admitted)
+	require.Zero(t, overflowed)
+	require.Zero(t, l.evictedCount())
+
+	// New entities evict the entities first seen earliest.
+	admitted, overflowed = l.admit([]string{"a", "b", "c"})
+	require.Equal(t, map[string]bool{"b": true, "c": true}, admitted)
+	require.Equal(t, 1, overflowed)
+	require.Equal(t, int64(1), l.evictedCount())
+
+	// Repeated admissions of the same entities are stable.
+	admitted, _ = l.admit([]string{"a", "b", "c"})
+	require.Equal(t, map[string]bool{"b": true, "c": true}, admitted)
+	require.Equal(t, int64(1), l.evictedCount())
+
+	// Removed entities are not evictions, and their slot is freed for the
+	// newest overflowed entity.
+	admitted, overflowed = l.admit([]string{"a", "b"})
+	require.Equal(t, map[string]bool{"a": true, "b": true}, admitted)
+	require.Zero(t, overflowed)
+	require.Equal(t, int64(1), l.evictedCount())
+
+	// Entities that were removed are new when they reappear.
+	admitted, _ = l.admit([]string{"a", "b", "c"})
+	require.Equal(t, map[string]bool{"b": true, "c": true}, admitted)
+	require.Equal(t, int64(2), l.evictedCount())
+}
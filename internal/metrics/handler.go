@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/megamon/internal/records"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	// initTime and initReporter are set by Init, for the created timestamps.
+	initTime     time.Time
+	initReporter Reporter
+)
+
+// Handler serves the metrics registered by Init, like promhttp.Handler. With
+// CreatedTimestamps, clients that accept OpenMetrics are served a _created
+// line for every counter.
+func Handler() http.Handler {
+	if !CreatedTimestamps {
+		return promhttp.Handler()
+	}
+	return promhttp.InstrumentMetricHandler(promclient.DefaultRegisterer, createdHandler(promclient.DefaultGatherer))
+}
+
+// createdHandler serves the gathered metrics with created timestamps on all
+// counters, which promhttp does not support.
+func createdHandler(g promclient.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mfs, err := g.Gather()
+		if err != nil {
+			http.Error(w, "error gathering metrics: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		setCreatedTimestamps(mfs, entityCreationTimes(), initTime)
+
+		format := expfmt.NegotiateIncludingOpenMetrics(req.Header)
+		w.Header().Set("Content-Type", string(format))
+		enc := expfmt.NewEncoder(w, format, expfmt.WithCreatedLines())
+		for _, mf := range mfs {
+			if err := enc.Encode(mf); err != nil {
+				log.Printf("failed to encode metric family %s: %v", mf.GetName(), err)
+				return
+			}
+		}
+		if closer, ok := enc.(expfmt.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Printf("failed to encode metrics: %v", err)
+			}
+		}
+	})
+}
+
+// entityKey identifies an entity by the labels of its series.
+type entityKey struct {
+	kind, namespace, name string
+}
+
+// entityCreationTimes returns the time of the first recorded event of every
+// entity in the current report.
+func entityCreationTimes() map[entityKey]time.Time {
+	created := map[entityKey]time.Time{}
+	if initReporter == nil {
+		return created
+	}
+	report := initReporter.Report()
+	at := report.Timestamp
+	if at.IsZero() {
+		at = now()
+	}
+	for _, summaries := range []map[string]records.UpnessSummaryWithAttrs{report.JobSetsUpSummaries, report.JobSetNodesUpSummaries} {
+		for _, s := range summaries {
+			if s.Lifetime <= 0 {
+				continue
+			}
+			created[entityKey{string(s.Attrs.Kind), s.Attrs.JobSetNamespace, s.Attrs.JobSetName}] = at.Add(-s.Lifetime)
+		}
+	}
+	return created
+}
+
+// setCreatedTimestamps sets the created timestamp of every counter that does
+// not have one: the entity's creation time for per-entity series and def
+// (the process start) otherwise.
+func setCreatedTimestamps(mfs []*dto.MetricFamily, entities map[entityKey]time.Time, def time.Time) {
+	for _, mf := range mfs {
+		if mf.GetType() != dto.MetricType_COUNTER {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			if m.GetCounter() == nil || m.GetCounter().GetCreatedTimestamp() != nil {
+				continue
+			}
+			var key entityKey
+			for _, l := range m.GetLabel() {
+				switch l.GetName() {
+				case "kind":
+					key.kind = l.GetValue()
+				case "jobset_namespace":
+					key.namespace = l.GetValue()
+				case "jobset_name":
+					key.name = l.GetValue()
+				}
+			}
+			created := def
+			if t, ok := entities[key]; ok {
+				created = t
+			}
+			m.Counter.CreatedTimestamp = timestamppb.New(created)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatedTimestamps(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	require.NoError(t, err)
+	now = func() time.Time { return t0 }
+
+	report := records.NewReport()
+	report.Timestamp = t0.Add(3 * time.Hour)
+	attrs := records.Attrs{Kind: records.KindJobSet, JobSetName: "js", JobSetNamespace: "ns"}
+	report.JobSetsUp["abc"] = records.Upness{Attrs: attrs}
+	report.JobSetsUpSummaries["abc"] = records.UpnessSummaryWithAttrs{
+		Attrs: attrs,
+		EventSummary: records.EventSummary{
+			InterruptionCount: 1,
+			UpTime:            time.Hour,
+			Lifetime:          2 * time.Hour,
+		},
+	}
+
+	reg := prometheus.NewRegistry()
+	shutdown := initWithRegisterer(staticReporter(report), reg)
+	defer shutdown()
+	NodeInterruptionCount.Add(context.Background(), 1)
+
+	srv := httptest.NewServer(createdHandler(reg))
+	defer srv.Close()
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Contains(t, resp.Header.Get("Content-Type"), "application/openmetrics-text")
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	// map[<series>]<value>
+	samples := map[string]float64{}
+	counterFamilies := map[string]bool{}
+	for _, line := range strings.Split(string(body), "\n") {
+		if family, ok := strings.CutPrefix(line, "# TYPE "); ok && strings.HasSuffix(family, " counter") {
+			counterFamilies[strings.TrimSuffix(family, " counter")] = true
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		require.NoError(t, err, line)
+		samples[line[:i]] = v
+	}
+
+	var counters int
+	for series := range samples {
+		name, labels, _ := strings.Cut(series, "{")
+		family, ok := strings.CutSuffix(name, "_total")
+		if !ok || !counterFamilies[family] {
+			continue
+		}
+		counters++
+		created := family + "_created{" + labels
+		require.Contains(t, samples, created, "counter %s has no created timestamp", series)
+
+		want := t0
+		if strings.Contains(labels, `jobset_name="js"`) {
+			// Created when the JobSet was first seen.
+			want = t0.Add(time.Hour)
+		}
+		require.Equal(t, float64(want.Unix()), samples[created], series)
+	}
+	require.Greater(t, counters, 1)
+}
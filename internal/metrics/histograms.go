@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/megamon/internal/records"
+	promclient "github.com/prometheus/client_golang/prometheus"
+)
+
+// histogramLabels are the labels of the duration histograms, matching the
+// attributes of the OpenTelemetry series (see OTELAttrs).
+var histogramLabels = []string{"kind", "jobset_namespace", "jobset_name", "tpu_topology", "tpu_accelerator", "spot"}
+
+// durationHistograms exposes the distribution of each entity's recovery and
+// up times as Prometheus histograms. The OpenTelemetry SDK has no
+// asynchronous histograms, so these are collected directly from the report
+// and are not pushed over OTLP.
+type durationHistograms struct {
+	reporter Reporter
+	limiter  *entityLimiter
+	buckets  []float64
+
+	sections []durationHistogramSection
+}
+
+type durationHistogramSection struct {
+	desc      *promclient.Desc
+	kind      records.Kind
+	summaries func(records.Report) map[string]records.UpnessSummaryWithAttrs
+	durations func(records.EventSummary) []time.Duration
+}
+
+func newDurationHistograms(r Reporter, limiter *entityLimiter) *durationHistograms {
+	h := &durationHistograms{
+		reporter: r,
+		limiter:  limiter,
+		buckets:  slices.Clone(DurationBuckets),
+	}
+	slices.Sort(h.buckets)
+	jobSets := func(r records.Report) map[string]records.UpnessSummaryWithAttrs { return r.JobSetsUpSummaries }
+	nodes := func(r records.Report) map[string]records.UpnessSummaryWithAttrs { return r.JobSetNodesUpSummaries }
+	recoveries := func(s records.EventSummary) []time.Duration { return s.DownTimeBetweenRecoveryDurations }
+	upTimes := func(s records.EventSummary) []time.Duration { return s.UpTimeBetweenInterruptionDurations }
+	for _, s := range []struct {
+		name, help string
+		kind       records.Kind
+		summaries  func(records.Report) map[string]records.UpnessSummaryWithAttrs
+		durations  func(records.EventSummary) []time.Duration
+	}{
+		{"jobset_recovery_duration_seconds", "Distribution of the time a JobSet took to recover from each interruption.", records.KindJobSet, jobSets, recoveries},
+		{"jobset_interruption_interval_seconds", "Distribution of the time a JobSet was up before each interruption.", records.KindJobSet, jobSets, upTimes},
+		{"jobset_nodes_recovery_duration_seconds", "Distribution of the time a JobSets Nodes took to recover from each interruption.", records.KindJobSetNodes, nodes, recoveries},
+		{"jobset_nodes_interruption_interval_seconds", "Distribution of the time a JobSets Nodes were up before each interruption.", records.KindJobSetNodes, nodes, upTimes},
+	} {
+		name := strings.ReplaceAll(Prefix, ".", "_") + "_" + s.name
+		if len(Allowlist) > 0 && !slices.Contains(Allowlist, name) {
+			continue
+		}
+		h.sections = append(h.sections, durationHistogramSection{
+			desc:      promclient.NewDesc(promclient.BuildFQName(Namespace, "", name), s.help, histogramLabels, nil),
+			kind:      s.kind,
+			summaries: s.summaries,
+			durations: s.durations,
+		})
+	}
+	return h
+}
+
+func (h *durationHistograms) Describe(ch chan<- *promclient.Desc) {
+	for _, s := range h.sections {
+		ch <- s.desc
+	}
+}
+
+func (h *durationHistograms) Collect(ch chan<- promclient.Metric) {
+	if len(h.sections) == 0 {
+		return
+	}
+	report := h.reporter.Report().WithoutShortLived(MinLifetime)
+	admitted, _ := h.limiter.admit(entityKeys(report))
+	for _, s := range h.sections {
+		// Bucket counts are additive, so overflowed entities are summed.
+		overflow := newDurationHistogram(h.buckets)
+		for key, summary := range s.summaries(report) {
+			durations := s.durations(summary.EventSummary)
+			if len(durations) == 0 {
+				continue
+			}
+			if !admitted[key] {
+				overflow.observe(durations)
+				continue
+			}
+			hist := newDurationHistogram(h.buckets)
+			hist.observe(durations)
+			ch <- hist.metric(s.desc, summary.Attrs)
+		}
+		if overflow.count > 0 {
+			ch <- overflow.metric(s.desc, records.Attrs{
+				Kind:            s.kind,
+				JobSetNamespace: OverflowLabel,
+				JobSetName:      OverflowLabel,
+			})
+		}
+	}
+}
+
+type durationHistogram struct {
+	upperBounds []float64
+	// counts are the non-cumulative counts per bucket.
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newDurationHistogram(upperBounds []float64) *durationHistogram {
+	return &durationHistogram{upperBounds: upperBounds, counts: make([]uint64, len(upperBounds))}
+}
+
+func (h *durationHistogram) observe(durations []time.Duration) {
+	for _, d := range durations {
+		v := d.Seconds()
+		h.count++
+		h.sum += v
+		if i, _ := slices.BinarySearch(h.upperBounds, v); i < len(h.upperBounds) {
+			h.counts[i]++
+		}
+	}
+}
+
+func (h *durationHistogram) metric(desc *promclient.Desc, attrs records.Attrs) promclient.Metric {
+	buckets := make(map[float64]uint64, len(h.upperBounds))
+	var cumulative uint64
+	for i, bound := range h.upperBounds {
+		cumulative += h.counts[i]
+		buckets[bound] = cumulative
+	}
+	var spot string
+	if attrs.Spot {
+		spot = strconv.FormatBool(attrs.Spot)
+	}
+	return promclient.MustNewConstHistogram(desc, h.count, h.sum, buckets,
+		string(attrs.Kind),
+		attrs.JobSetNamespace,
+		attrs.JobSetName,
+		attrs.TPUTopology,
+		attrs.TPUAccelerator,
+		spot,
+	)
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDurationHistograms(t *testing.T) {
+	defer func(buckets []float64, max int) { DurationBuckets, MaxEntities = buckets, max }(DurationBuckets, MaxEntities)
+	DurationBuckets = []float64{3600, 300}
+	MaxEntities = 1
+
+	report := records.NewReport()
+	for key, durations := range map[string][]time.Duration{
+		"a": {time.Minute, 5 * time.Minute, 2 * time.Hour},
+		"b": {10 * time.Minute},
+		"c": {30 * time.Minute},
+	} {
+		attrs := records.Attrs{Kind: records.KindJobSet, JobSetNamespace: "ns", JobSetName: key}
+		report.JobSetsUp[key] = records.Upness{Attrs: attrs}
+		report.JobSetsUpSummaries[key] = records.UpnessSummaryWithAttrs{
+			Attrs:        attrs,
+			EventSummary: records.EventSummary{DownTimeBetweenRecoveryDurations: durations},
+		}
+	}
+
+	reg := prometheus.NewRegistry()
+	shutdown := initWithRegisterer(staticReporter(report), reg)
+	defer shutdown()
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	// map[<jobset_name>]<histogram>
+	got := map[string]*dto.Histogram{}
+	for _, f := range families {
+		// Entities without up times have no interruption interval series.
+		require.NotEqual(t, "megamon_jobset_interruption_interval_seconds", f.GetName())
+		if f.GetName() != "megamon_jobset_recovery_duration_seconds" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "jobset_name" {
+					got[l.GetValue()] = m.GetHistogram()
+				}
+			}
+		}
+	}
+	require.Len(t, got, 2)
+
+	// The first entity (by key) is admitted, the others are summed into the
+	// overflow series.
+	a := got["a"]
+	require.Equal(t, uint64(3), a.GetSampleCount())
+	require.Equal(t, (126 * time.Minute).Seconds(), a.GetSampleSum())
+	require.Equal(t, 300.0, a.GetBucket()[0].GetUpperBound())
+	require.Equal(t, uint64(2), a.GetBucket()[0].GetCumulativeCount())
+	require.Equal(t, uint64(2), a.GetBucket()[1].GetCumulativeCount())
+
+	overflow := got[OverflowLabel]
+	require.Equal(t, uint64(2), overflow.GetSampleCount())
+	require.Equal(t, uint64(0), overflow.GetBucket()[0].GetCumulativeCount())
+	require.Equal(t, uint64(2), overflow.GetBucket()[1].GetCumulativeCount())
+}
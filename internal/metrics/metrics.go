@@ -2,42 +2,188 @@ package metrics
 
 import (
 	"context"
+	"encoding/json"
 	"log"
+	"strings"
+	"time"
 
 	"example.com/megamon/internal/records"
+	promclient "github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
 	metricsdk "go.opentelemetry.io/otel/sdk/metric"
 )
 
 var (
-	AggregationDuration metric.Float64Histogram
-	Prefix              = "megamon"
+	AggregationDuration       metric.Float64Histogram = noop.Float64Histogram{}
+	AggregationFailureCount   metric.Int64Counter     = noop.Int64Counter{}
+	AggregationTimeoutCount   metric.Int64Counter     = noop.Int64Counter{}
+	LastAggregationTimestamp  metric.Float64Gauge     = noop.Float64Gauge{}
+	ExporterDuration          metric.Float64Histogram = noop.Float64Histogram{}
+	ExporterUp                metric.Int64Gauge       = noop.Int64Gauge{}
+	NodeInterruptionCount     metric.Int64Counter     = noop.Int64Counter{}
+	NodePoolScalingEventCount metric.Int64Counter     = noop.Int64Counter{}
+	// Prefix is the subsystem that all metric names start with. Must be set
+	// before Init.
+	Prefix = "megamon"
+	// Namespace, if set, is prepended to all exposed metric names, e.g.
+	// "company" exposes megamon_jobset_up as company_megamon_jobset_up. Must
+	// be set before Init.
+	Namespace = ""
+
+	// MaxEntities caps the number of distinct entities (JobSets) exported
+	// with per-entity labels. Entities beyond the cap are summed into a single
+	// OverflowLabel series. Zero means unlimited. Must be set before Init.
+	// Entities that are no longer reported lose their series and slot.
+	MaxEntities = 0
+
+	// EvictOldestEntities makes new entities beyond MaxEntities take the
+	// per-entity series of the entities first seen earliest, which move to
+	// the overflow series, e.g. to keep recent CI JobSets visible. By
+	// default, entities keep their series for as long as they are reported.
+	// Must be set before Init.
+	EvictOldestEntities = false
+
+	// MinLifetime excludes entities that have existed for less than this
+	// (e.g. smoke tests) from the per-entity metrics. Zero includes all
+	// entities. Must be set before Init.
+	MinLifetime time.Duration
+
+	// TimeInState enables the per-entity time in current state gauges, which
+	// are computed to the time of each scrape rather than the last
+	// aggregation. Must be set before Init.
+	TimeInState = false
+
+	// Allowlist, if set, limits the exported metric families to these names,
+	// as exposed but without the Namespace, e.g. megamon_jobset_up or
+	// megamon_jobset_up_time_seconds_total. Other metrics are dropped when
+	// they are registered. Must be set before Init.
+	Allowlist []string
+
+	// OTLP, if its Endpoint is set, additionally pushes all metrics to an
+	// OpenTelemetry Collector over OTLP/gRPC. Must be set before Init.
+	OTLP OTLPOptions
+
+	// CreatedTimestamps makes Handler expose a created timestamp for every
+	// counter, so that OpenMetrics consumers can detect resets precisely:
+	// the first event of the entity for per-entity series, the time of Init
+	// otherwise. Must be set before Init.
+	CreatedTimestamps = false
+
+	// DurationBuckets are the upper bounds, in seconds, of the histograms of
+	// the individual recovery and up times of each entity. Must be set
+	// before Init.
+	DurationBuckets = []float64{60, 300, 900, 1800, 3600, 2 * 3600, 6 * 3600, 12 * 3600, 24 * 3600}
+
+	// FleetReportInfoMaxBytes, if set, exposes the report as JSON in the
+	// report label of a single fleet.report.info gauge, for setups that can
+	// only scrape metrics. Reports larger than this are reduced to the fleet
+	// summary and the truncated label is set. Must be set before Init.
+	FleetReportInfoMaxBytes = 0
+
+	// now is overridden in tests.
+	now = time.Now
 )
 
-func initMeterProvider() *metricsdk.MeterProvider {
+// OTLPOptions configures the periodic OTLP/gRPC metrics export.
+type OTLPOptions struct {
+	// Endpoint is the host:port of the collector, e.g. otel-collector:4317.
+	Endpoint string
+	// Insecure disables TLS.
+	Insecure bool
+	// Headers are sent with every export, e.g. for authentication.
+	Headers map[string]string
+	// Interval is the export interval, defaults to 60s.
+	Interval time.Duration
+}
+
+// OverflowLabel is the jobset.namespace and jobset.name of the series that
+// overflowed entities are summed into.
+const OverflowLabel = "__overflow__"
+
+func initMeterProvider(reg promclient.Registerer) *metricsdk.MeterProvider {
 	// Create a Prometheus exporter
-	exporter, err := prometheus.New()
+	opts := []prometheus.Option{prometheus.WithRegisterer(reg)}
+	if Namespace != "" {
+		opts = append(opts, prometheus.WithNamespace(Namespace))
+	}
+	exporter, err := prometheus.New(opts...)
 	if err != nil {
 		log.Fatalf("failed to initialize prometheus exporter: %v", err)
 	}
 
 	// Create a MeterProvider and register it globally
-	provider := metricsdk.NewMeterProvider(metricsdk.WithReader(exporter))
+	providerOpts := []metricsdk.Option{metricsdk.WithReader(exporter)}
+	if OTLP.Endpoint != "" {
+		providerOpts = append(providerOpts, metricsdk.WithReader(otlpReader(OTLP)))
+	}
+	if len(Allowlist) > 0 {
+		providerOpts = append(providerOpts, metricsdk.WithView(allowlistView(Allowlist)))
+	}
+	provider := metricsdk.NewMeterProvider(providerOpts...)
 	otel.SetMeterProvider(provider)
 
 	return provider
 }
 
+// otlpReader returns a reader that periodically pushes to the collector.
+// Shutting down the MeterProvider flushes it.
+func otlpReader(o OTLPOptions) metricsdk.Reader {
+	opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(o.Endpoint)}
+	if o.Insecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+	if len(o.Headers) > 0 {
+		opts = append(opts, otlpmetricgrpc.WithHeaders(o.Headers))
+	}
+	exporter, err := otlpmetricgrpc.New(context.Background(), opts...)
+	if err != nil {
+		log.Fatalf("failed to initialize otlp exporter: %v", err)
+	}
+	var readerOpts []metricsdk.PeriodicReaderOption
+	if o.Interval > 0 {
+		readerOpts = append(readerOpts, metricsdk.WithInterval(o.Interval))
+	}
+	return metricsdk.NewPeriodicReader(exporter, readerOpts...)
+}
+
+// allowlistView drops all instruments whose exposed names are not in names.
+func allowlistView(names []string) metricsdk.View {
+	allowed := map[string]bool{}
+	for _, name := range names {
+		allowed[name] = true
+		// Match the instrument name, which lacks the unit and counter
+		// suffixes that the Prometheus exporter adds.
+		base := strings.TrimSuffix(name, "_total")
+		base = strings.TrimSuffix(base, "_seconds")
+		allowed[base] = true
+	}
+	return func(inst metricsdk.Instrument) (metricsdk.Stream, bool) {
+		if allowed[strings.ReplaceAll(inst.Name, ".", "_")] {
+			return metricsdk.Stream{}, false
+		}
+		return metricsdk.Stream{Aggregation: metricsdk.AggregationDrop{}}, true
+	}
+}
+
 type Reporter interface {
 	Report() records.Report
 }
 
+// Init registers all metrics with the default Prometheus registry.
 func Init(r Reporter) func() {
+	return initWithRegisterer(r, promclient.DefaultRegisterer)
+}
+
+func initWithRegisterer(r Reporter, reg promclient.Registerer) func() {
+	initTime, initReporter = now(), r
+
 	// Initialize the OpenTelemetry Prometheus exporter and meter provider
-	provider := initMeterProvider()
+	provider := initMeterProvider(reg)
 
 	meter := otel.Meter("megamon")
 
@@ -49,6 +195,44 @@ func Init(r Reporter) func() {
 	)
 	fatal(err)
 
+	AggregationFailureCount, err = meter.Int64Counter(Prefix+".aggregation.failure.count",
+		metric.WithDescription("Total number of failed aggregations."),
+	)
+	fatal(err)
+
+	AggregationTimeoutCount, err = meter.Int64Counter(Prefix+".aggregation.timeout.count",
+		metric.WithDescription("Total number of aggregations cancelled for exceeding their timeout, included in the failed aggregations."),
+	)
+	fatal(err)
+
+	LastAggregationTimestamp, err = meter.Float64Gauge(Prefix+".last.aggregation.timestamp",
+		metric.WithDescription("Unix time of the last successful aggregation, to alert on a stuck aggregator."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
+	ExporterDuration, err = meter.Float64Histogram(Prefix+".exporter.duration",
+		metric.WithDescription("Duration of each Export call, by exporter."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30, 60),
+	)
+	fatal(err)
+
+	ExporterUp, err = meter.Int64Gauge(Prefix+".exporter.up",
+		metric.WithDescription("Whether the last Export call succeeded (1) or failed (0), by exporter. Only reported by the aggregating (leader) instance."),
+	)
+	fatal(err)
+
+	NodeInterruptionCount, err = meter.Int64Counter(Prefix+".node.interruption.count",
+		metric.WithDescription("Total number of Node interruptions by type (termination, maintenance, live-migration), node pool and node pool version."),
+	)
+	fatal(err)
+
+	NodePoolScalingEventCount, err = meter.Int64Counter(Prefix+".nodepool.scaling.event.count",
+		metric.WithDescription("Total number of Node additions and removals not caused by interruptions, by node pool and type (scale-up, scale-down)."),
+	)
+	fatal(err)
+
 	// Jobset //
 
 	jobsetUp, err := meter.Int64ObservableGauge(Prefix+".jobset.up",
@@ -56,12 +240,29 @@ func Init(r Reporter) func() {
 	)
 	fatal(err)
 
+	jobsetRestartBudgetRemaining, err := meter.Int64ObservableGauge(Prefix+".jobset.restart.budget.remaining",
+		metric.WithDescription("Number of restarts left before a JobSet fails (only for JobSets with a failure policy)."),
+	)
+	fatal(err)
+
 	jobsetUpTime, err := meter.Float64ObservableCounter(Prefix+".jobset.up.time",
 		metric.WithDescription("Total time JobSet has been up."),
 		metric.WithUnit("s"),
 	)
 	fatal(err)
 
+	jobsetEffectiveUpTime, err := meter.Float64ObservableCounter(Prefix+".jobset.effective.up.time",
+		metric.WithDescription("Total time JobSet has been up, excluding the settle period after each recovery."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
+	jobsetDegradedTime, err := meter.Float64ObservableCounter(Prefix+".jobset.degraded.time",
+		metric.WithDescription("Total time a JobSet has been up but degraded by unhealthy accelerators."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
 	// Note: Technically this could be a counter if we are fully certain that the value
 	// will never decrease. In practice, this caused issues where this value was being
 	// reported inaccurately. It is possible that this was because the timeseries was
@@ -77,6 +278,16 @@ func Init(r Reporter) func() {
 	)
 	fatal(err)
 
+	jobsetCoordinatorInterruptionCount, err := meter.Int64ObservableCounter(Prefix+".jobset.coordinator.interruption.count",
+		metric.WithDescription("Total number of interruptions of a JobSet's coordinator, for JobSets that designate one."),
+	)
+	fatal(err)
+
+	jobsetInterruptionCauseCount, err := meter.Int64ObservableCounter(Prefix+".jobset.interruption.cause.count",
+		metric.WithDescription("Total number of interruptions for a JobSet by cause: node for interruptions attributed to a Node going down, unknown otherwise."),
+	)
+	fatal(err)
+
 	jobsetRecoveryCount, err := meter.Int64ObservableCounter(Prefix+".jobset.recovery.count",
 		metric.WithDescription("Total number of recoveries for a JobSet."),
 	)
@@ -88,6 +299,17 @@ func Init(r Reporter) func() {
 	)
 	fatal(err)
 
+	jobsetNodePools, err := meter.Int64ObservableGauge(Prefix+".jobset.nodepools",
+		metric.WithDescription("The node pools that a JobSet's Pods have run on (1 per node pool), if node pool Job labelling is enabled."),
+	)
+	fatal(err)
+
+	jobsetProvisioning, err := meter.Float64ObservableGauge(Prefix+".jobset.provisioning",
+		metric.WithDescription("Time elapsed before a JobSet first came up, i.e. the time to ready, which is not counted as interruption downtime."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
 	jobsetDownTimeBetweenRecovery, err := meter.Float64ObservableGauge(Prefix+".jobset.down.time.between.recovery",
 		metric.WithDescription("Total time spent down between being all interruptions and recoveries."),
 		metric.WithUnit("s"),
@@ -124,6 +346,75 @@ func Init(r Reporter) func() {
 	)
 	fatal(err)
 
+	// MTBF and MTTR alias the means between interruption and recovery under
+	// their conventional reliability names.
+	jobsetMTBF, err := meter.Float64ObservableGauge(Prefix+".jobset.mtbf",
+		metric.WithDescription("Mean time between failures (interruptions) of a JobSet, same as jobset.up.time.between.interruption.mean."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
+	jobsetMTTR, err := meter.Float64ObservableGauge(Prefix+".jobset.mttr",
+		metric.WithDescription("Mean time to recovery of a JobSet across completed recoveries, same as jobset.down.time.between.recovery.mean."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
+	jobsetMeanLostWork, err := meter.Float64ObservableGauge(Prefix+".jobset.mean.lost.work",
+		metric.WithDescription("Mean time between the last checkpoint and an interruption for a JobSet."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
+	jobsetAvailability, err := meter.Float64ObservableGauge(Prefix+".jobset.availability",
+		metric.WithDescription("Fraction of time a JobSet has been up (0 to 1)."),
+	)
+	fatal(err)
+
+	jobsetInterruptionsPerHour, err := meter.Float64ObservableGauge(Prefix+".jobset.interruptions.per.hour",
+		metric.WithDescription("Rate of JobSet interruptions per hour of up time."),
+	)
+	fatal(err)
+
+	// Named as exposed rather than with a unit, which would append the
+	// _seconds suffix after "remaining".
+	jobsetErrorBudgetRemaining, err := meter.Float64ObservableGauge(Prefix+".jobset.error.budget.seconds.remaining",
+		metric.WithDescription("Downtime in seconds a JobSet can still have before exceeding its SLO error budget, negative once exceeded. Only for JobSets with an SLO."),
+	)
+	fatal(err)
+
+	jobsetCurrentUpStreak, err := meter.Float64ObservableGauge(Prefix+".jobset.current.up.streak",
+		metric.WithDescription("Time since a JobSet last recovered (or first came up), zero while down."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
+	jobsetProvisioningRetryCount, err := meter.Int64ObservableCounter(Prefix+".jobset.provisioning.retry.count",
+		metric.WithDescription("Total number of failed provisioning attempts before a JobSet was first up."),
+	)
+	fatal(err)
+
+	jobsetProvisioningStuck, err := meter.Int64ObservableGauge(Prefix+".jobset.provisioning.stuck",
+		metric.WithDescription("Whether a JobSet has never come up and has been provisioning for longer than the provisioning SLA (0 or 1)."),
+	)
+	fatal(err)
+
+	jobsetAtRisk, err := meter.Int64ObservableGauge(Prefix+".jobset.at.risk",
+		metric.WithDescription("Whether a JobSet is at risk of being interrupted again (0 or 1)."),
+	)
+	fatal(err)
+
+	jobsetAlerting, err := meter.Int64ObservableGauge(Prefix+".jobset.alerting",
+		metric.WithDescription("Whether the interruption alert of a JobSet is firing (0 or 1), latched with hysteresis."),
+	)
+	fatal(err)
+
+	jobsetTimeInState, err := meter.Float64ObservableGauge(Prefix+".jobset.time.in.state",
+		metric.WithDescription("Time since a JobSet last changed state (up or down), as of the scrape."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
 	// Jobset Nodes //
 
 	jobsetNodesUp, err := meter.Int64ObservableGauge(Prefix+".jobset.nodes.up",
@@ -137,6 +428,12 @@ func Init(r Reporter) func() {
 	)
 	fatal(err)
 
+	jobsetNodesDegradedTime, err := meter.Float64ObservableCounter(Prefix+".jobset.nodes.degraded.time",
+		metric.WithDescription("Total time a JobSets Nodes have been up but degraded by unhealthy accelerators."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
 	jobsetNodesDownTime, err := meter.Float64ObservableGauge(Prefix+".jobset.nodes.down.time",
 		metric.WithDescription("Total time a JobSets Nodes have not all been Ready (up)."),
 		metric.WithUnit("s"),
@@ -189,16 +486,219 @@ func Init(r Reporter) func() {
 	)
 	fatal(err)
 
+	jobsetNodesMTBF, err := meter.Float64ObservableGauge(Prefix+".jobset.nodes.mtbf",
+		metric.WithDescription("Mean time between failures (interruptions) of a JobSets Nodes, same as jobset.nodes.up.time.between.interruption.mean."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
+	jobsetNodesMTTR, err := meter.Float64ObservableGauge(Prefix+".jobset.nodes.mttr",
+		metric.WithDescription("Mean time to recovery of a JobSets Nodes across completed recoveries, same as jobset.nodes.down.time.interruption.mean."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
 	jobsetNodesDownTimeInitial, err := meter.Float64ObservableGauge(Prefix+".jobset.nodes.down.time.initial",
 		metric.WithDescription("Time elapsed before all JobSet Nodes are Ready (up) for the first time."),
 		metric.WithUnit("s"),
 	)
 	fatal(err)
 
+	jobsetNodesProvisioningRetryCount, err := meter.Int64ObservableCounter(Prefix+".jobset.nodes.provisioning.retry.count",
+		metric.WithDescription("Total number of failed provisioning attempts before all of a JobSets Nodes were first up."),
+	)
+	fatal(err)
+
+	jobsetNodesAvailability, err := meter.Float64ObservableGauge(Prefix+".jobset.nodes.availability",
+		metric.WithDescription("Fraction of time all of a JobSets Nodes have been up (0 to 1)."),
+	)
+	fatal(err)
+
+	jobsetNodesInterruptionsPerHour, err := meter.Float64ObservableGauge(Prefix+".jobset.nodes.interruptions.per.hour",
+		metric.WithDescription("Rate of JobSet Nodes interruptions per hour of up time."),
+	)
+	fatal(err)
+
+	jobsetNodesAtRisk, err := meter.Int64ObservableGauge(Prefix+".jobset.nodes.at.risk",
+		metric.WithDescription("Whether a JobSets Nodes are at risk of being interrupted again (0 or 1)."),
+	)
+	fatal(err)
+
+	jobsetNodesAlerting, err := meter.Int64ObservableGauge(Prefix+".jobset.nodes.alerting",
+		metric.WithDescription("Whether the interruption alert of a JobSets Nodes is firing (0 or 1), latched with hysteresis."),
+	)
+	fatal(err)
+
+	jobsetNodesTimeInState, err := meter.Float64ObservableGauge(Prefix+".jobset.nodes.time.in.state",
+		metric.WithDescription("Time since a JobSets Nodes last changed state (up or down), as of the scrape."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
+	// Replicated Jobs //
+
+	jobUp, err := meter.Int64ObservableGauge(Prefix+".job.up",
+		metric.WithDescription("Whether all replicas of a JobSet's replicated Job are in a Ready status (0 or 1)."),
+	)
+	fatal(err)
+
+	jobUpTime, err := meter.Float64ObservableCounter(Prefix+".job.up.time",
+		metric.WithDescription("Total time a replicated Job has been up."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
+	jobDownTime, err := meter.Float64ObservableGauge(Prefix+".job.down.time",
+		metric.WithDescription("Total time a replicated Job has not been fully up."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
+	jobInterruptionCount, err := meter.Int64ObservableCounter(Prefix+".job.interruption.count",
+		metric.WithDescription("Total number of interruptions for a replicated Job."),
+	)
+	fatal(err)
+
+	jobRecoveryCount, err := meter.Int64ObservableCounter(Prefix+".job.recovery.count",
+		metric.WithDescription("Total number of recoveries for a replicated Job."),
+	)
+	fatal(err)
+
+	jobAvailability, err := meter.Float64ObservableGauge(Prefix+".job.availability",
+		metric.WithDescription("Fraction of time a replicated Job has been up (0 to 1)."),
+	)
+	fatal(err)
+
+	// Fleet //
+
+	fleetInterruptions, err := meter.Int64ObservableGauge(Prefix+".fleet.interruptions",
+		metric.WithDescription("Number of interruptions across all JobSets and their Nodes."),
+	)
+	fatal(err)
+
+	fleetIncidents, err := meter.Int64ObservableGauge(Prefix+".fleet.incidents",
+		metric.WithDescription("Number of distinct incidents across all JobSets and their Nodes, counting correlated JobSet and Node interruptions once."),
+	)
+	fatal(err)
+
+	// Namespace //
+
+	namespaceJobSets, err := meter.Int64ObservableGauge(Prefix+".namespace.jobsets",
+		metric.WithDescription("Number of JobSets in a namespace. Only exported with namespace summaries enabled."),
+	)
+	fatal(err)
+
+	namespaceUpTime, err := meter.Float64ObservableGauge(Prefix+".namespace.up.time",
+		metric.WithDescription("Total time the JobSets of a namespace have been up."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
+	namespaceDownTime, err := meter.Float64ObservableGauge(Prefix+".namespace.down.time",
+		metric.WithDescription("Total time the JobSets of a namespace have been down."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
+	namespaceAvailability, err := meter.Float64ObservableGauge(Prefix+".namespace.availability",
+		metric.WithDescription("Availability of the JobSets of a namespace, weighted by their lifetime (0 to 1)."),
+	)
+	fatal(err)
+
+	namespaceInterruptions, err := meter.Int64ObservableGauge(Prefix+".namespace.interruptions",
+		metric.WithDescription("Number of interruptions across the JobSets of a namespace and their Nodes."),
+	)
+	fatal(err)
+
+	namespaceIncidents, err := meter.Int64ObservableGauge(Prefix+".namespace.incidents",
+		metric.WithDescription("Number of distinct incidents across the JobSets of a namespace and their Nodes."),
+	)
+	fatal(err)
+
+	// Node pool //
+
+	nodePoolNodes, err := meter.Int64ObservableGauge(Prefix+".nodepool.nodes",
+		metric.WithDescription("Number of Nodes of a node pool. Only exported with node pool summaries enabled."),
+	)
+	fatal(err)
+
+	nodePoolInterruptionCount, err := meter.Int64ObservableGauge(Prefix+".nodepool.interruption.count",
+		metric.WithDescription("Number of interruptions across the Nodes of a node pool."),
+	)
+	fatal(err)
+
+	nodePoolRecoveryCount, err := meter.Int64ObservableGauge(Prefix+".nodepool.recovery.count",
+		metric.WithDescription("Number of recoveries across the Nodes of a node pool."),
+	)
+	fatal(err)
+
+	nodePoolUpTime, err := meter.Float64ObservableGauge(Prefix+".nodepool.up.time",
+		metric.WithDescription("Total time the Nodes of a node pool have been up."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
+	nodePoolDownTime, err := meter.Float64ObservableGauge(Prefix+".nodepool.down.time",
+		metric.WithDescription("Total time the Nodes of a node pool have been down."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
+	nodePoolAvailability, err := meter.Float64ObservableGauge(Prefix+".nodepool.availability",
+		metric.WithDescription("Availability of the Nodes of a node pool, weighted by their lifetime (0 to 1)."),
+	)
+	fatal(err)
+
+	nodePoolMTBF, err := meter.Float64ObservableGauge(Prefix+".nodepool.mtbf",
+		metric.WithDescription("Mean time between failures of the Nodes of a node pool."),
+		metric.WithUnit("s"),
+	)
+	fatal(err)
+
+	entitiesMeetingSLO, err := meter.Int64ObservableGauge(Prefix+".entities.meeting.slo",
+		metric.WithDescription("Number of JobSets with an SLO that have error budget remaining."),
+	)
+	fatal(err)
+
+	entitiesTotal, err := meter.Int64ObservableGauge(Prefix+".entities.total",
+		metric.WithDescription("Number of JobSets with an SLO."),
+	)
+	fatal(err)
+
+	fleetReportInfo, err := meter.Int64ObservableGauge(Prefix+".fleet.report.info",
+		metric.WithDescription("The report as JSON in the report label, always 1. Only exported if enabled."),
+	)
+	fatal(err)
+
+	overflowEntities, err := meter.Int64ObservableGauge(Prefix+".metrics.overflow.entities",
+		metric.WithDescription("Number of entities exported in the overflow series because the entity cap was exceeded."),
+	)
+	fatal(err)
+
+	evictedEntities, err := meter.Int64ObservableCounter(Prefix+".metrics.evicted.entities",
+		metric.WithDescription("Total number of entities moved to the overflow series to make room for newer entities."),
+	)
+	fatal(err)
+
+	limiter := &entityLimiter{max: MaxEntities, evictOldest: EvictOldestEntities}
+
+	histograms := newDurationHistograms(r, limiter)
+	if err := reg.Register(histograms); err != nil {
+		log.Fatalf("failed to register duration histograms: %v", err)
+	}
+
 	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
-		report := r.Report()
+		report := r.Report().WithoutShortLived(MinLifetime)
+		scrapeTime := now()
+
+		admitted, overflowed := limiter.admit(entityKeys(report))
+		var overflow overflowTotals
 
-		for _, jobsetReport := range report.JobSetsUp {
+		for key, jobsetReport := range report.JobSetsUp {
+			if !admitted[key] {
+				overflow.up += boolToInt64(jobsetReport.Up())
+				continue
+			}
 			val := int64(0)
 			if jobsetReport.Up() {
 				val = 1
@@ -206,9 +706,23 @@ func Init(r Reporter) func() {
 			o.ObserveInt64(jobsetUp, val, metric.WithAttributes(
 				OTELAttrs(jobsetReport.Attrs)...,
 			))
+			if d, ok := timeInState(report.JobSetEvents[key], scrapeTime); TimeInState && ok {
+				o.ObserveFloat64(jobsetTimeInState, d.Seconds(), metric.WithAttributes(
+					OTELAttrs(jobsetReport.Attrs)...,
+				))
+			}
+			if jobsetReport.RestartBudgetRemaining != nil {
+				o.ObserveInt64(jobsetRestartBudgetRemaining, int64(*jobsetReport.RestartBudgetRemaining), metric.WithAttributes(
+					OTELAttrs(jobsetReport.Attrs)...,
+				))
+			}
 		}
 
-		for _, jobsetNodeReport := range report.JobSetNodesUp {
+		for key, jobsetNodeReport := range report.JobSetNodesUp {
+			if !admitted[key] {
+				overflow.nodesUp += boolToInt64(jobsetNodeReport.Up())
+				continue
+			}
 			val := int64(0)
 			if jobsetNodeReport.Up() {
 				val = 1
@@ -216,16 +730,45 @@ func Init(r Reporter) func() {
 			o.ObserveInt64(jobsetNodesUp, val, metric.WithAttributes(
 				OTELAttrs(jobsetNodeReport.Attrs)...,
 			))
+			if d, ok := timeInState(report.JobSetNodeEvents[key], scrapeTime); TimeInState && ok {
+				o.ObserveFloat64(jobsetNodesTimeInState, d.Seconds(), metric.WithAttributes(
+					OTELAttrs(jobsetNodeReport.Attrs)...,
+				))
+			}
 		}
 
-		for _, summary := range report.JobSetsUpSummaries {
+		for key, nodePools := range report.JobSetNodePools {
+			if !admitted[key] {
+				continue
+			}
+			commonAttrs := OTELAttrs(report.JobSetsUp[key].Attrs)
+			for _, nodePool := range nodePools {
+				o.ObserveInt64(jobsetNodePools, 1, metric.WithAttributes(append(commonAttrs, attribute.String("node.pool", nodePool))...))
+			}
+		}
+
+		for key, summary := range report.JobSetsUpSummaries {
+			if !admitted[key] {
+				overflow.jobset.add(summary.EventSummary)
+				continue
+			}
 			commonAttrs := OTELAttrs(summary.Attrs)
 			o.ObserveInt64(jobsetInterruptionCount, int64(summary.InterruptionCount), metric.WithAttributes(commonAttrs...))
+			o.ObserveInt64(jobsetCoordinatorInterruptionCount, int64(summary.CoordinatorInterruptionCount), metric.WithAttributes(commonAttrs...))
+			observeInterruptionCauses(o, jobsetInterruptionCauseCount, summary.EventSummary, commonAttrs)
 			o.ObserveInt64(jobsetRecoveryCount, int64(summary.RecoveryCount), metric.WithAttributes(commonAttrs...))
 			o.ObserveFloat64(jobsetUpTime, summary.UpTime.Seconds(), metric.WithAttributes(commonAttrs...))
+			o.ObserveFloat64(jobsetEffectiveUpTime, summary.EffectiveUpTime.Seconds(), metric.WithAttributes(commonAttrs...))
+			o.ObserveFloat64(jobsetDegradedTime, summary.DegradedTime.Seconds(), metric.WithAttributes(commonAttrs...))
 			o.ObserveFloat64(jobsetDownTime, summary.DownTime.Seconds(), metric.WithAttributes(commonAttrs...))
+			o.ObserveFloat64(jobsetAvailability, summary.Availability, metric.WithAttributes(commonAttrs...))
+			o.ObserveFloat64(jobsetInterruptionsPerHour, summary.InterruptionsPerHour, metric.WithAttributes(commonAttrs...))
+			if summary.SLO.Target > 0 {
+				o.ObserveFloat64(jobsetErrorBudgetRemaining, summary.ErrorBudgetRemainingTime.Seconds(), metric.WithAttributes(commonAttrs...))
+			}
 			if summary.DownTimeInitial != 0 {
 				o.ObserveFloat64(jobsetDownTimeInitial, summary.DownTimeInitial.Seconds(), metric.WithAttributes(commonAttrs...))
+				o.ObserveFloat64(jobsetProvisioning, summary.DownTimeInitial.Seconds(), metric.WithAttributes(commonAttrs...))
 			}
 			// TTR
 			if summary.TotalDownTimeBetweenRecovery != 0 {
@@ -233,6 +776,7 @@ func Init(r Reporter) func() {
 			}
 			if summary.MeanDownTimeBetweenRecovery != 0 {
 				o.ObserveFloat64(jobsetDownTimeBetweenRecoveryMean, summary.MeanDownTimeBetweenRecovery.Seconds(), metric.WithAttributes(commonAttrs...))
+				o.ObserveFloat64(jobsetMTTR, summary.MeanDownTimeBetweenRecovery.Seconds(), metric.WithAttributes(commonAttrs...))
 			}
 			if summary.LatestDownTimeBetweenRecovery != 0 {
 				o.ObserveFloat64(jobsetDownTimeBetweenRecoveryLatest, summary.LatestDownTimeBetweenRecovery.Seconds(), metric.WithAttributes(commonAttrs...))
@@ -243,17 +787,36 @@ func Init(r Reporter) func() {
 			}
 			if summary.MeanUpTimeBetweenInterruption != 0 {
 				o.ObserveFloat64(jobsetUpTimeBetweenInterruptionMean, summary.MeanUpTimeBetweenInterruption.Seconds(), metric.WithAttributes(commonAttrs...))
+				o.ObserveFloat64(jobsetMTBF, summary.MeanUpTimeBetweenInterruption.Seconds(), metric.WithAttributes(commonAttrs...))
 			}
 			if summary.LatestUpTimeBetweenInterruption != 0 {
 				o.ObserveFloat64(jobsetUpTimeBetweenInterruptionLatest, summary.LatestUpTimeBetweenInterruption.Seconds(), metric.WithAttributes(commonAttrs...))
 			}
+			if summary.MeanLostWorkPerInterruption != 0 {
+				o.ObserveFloat64(jobsetMeanLostWork, summary.MeanLostWorkPerInterruption.Seconds(), metric.WithAttributes(commonAttrs...))
+			}
+			o.ObserveFloat64(jobsetCurrentUpStreak, summary.CurrentUpStreak.Seconds(), metric.WithAttributes(commonAttrs...))
+			o.ObserveInt64(jobsetAtRisk, boolToInt64(summary.AtRisk), metric.WithAttributes(commonAttrs...))
+			o.ObserveInt64(jobsetAlerting, boolToInt64(summary.Alerting), metric.WithAttributes(commonAttrs...))
+			o.ObserveInt64(jobsetProvisioningRetryCount, int64(summary.ProvisioningRetryCount), metric.WithAttributes(commonAttrs...))
+			o.ObserveInt64(jobsetProvisioningStuck, boolToInt64(summary.ProvisioningStuck), metric.WithAttributes(commonAttrs...))
 		}
-		for _, summary := range report.JobSetNodesUpSummaries {
+		for key, summary := range report.JobSetNodesUpSummaries {
+			if !admitted[key] {
+				overflow.nodes.add(summary.EventSummary)
+				continue
+			}
 			commonAttrs := OTELAttrs(summary.Attrs)
 			o.ObserveInt64(jobsetNodesInterruptionCount, int64(summary.InterruptionCount), metric.WithAttributes(commonAttrs...))
 			o.ObserveInt64(jobsetNodesRecoveryCount, int64(summary.RecoveryCount), metric.WithAttributes(commonAttrs...))
 			o.ObserveFloat64(jobsetNodesUpTime, summary.UpTime.Seconds(), metric.WithAttributes(commonAttrs...))
+			o.ObserveFloat64(jobsetNodesDegradedTime, summary.DegradedTime.Seconds(), metric.WithAttributes(commonAttrs...))
 			o.ObserveFloat64(jobsetNodesDownTime, summary.DownTime.Seconds(), metric.WithAttributes(commonAttrs...))
+			o.ObserveFloat64(jobsetNodesAvailability, summary.Availability, metric.WithAttributes(commonAttrs...))
+			o.ObserveFloat64(jobsetNodesInterruptionsPerHour, summary.InterruptionsPerHour, metric.WithAttributes(commonAttrs...))
+			o.ObserveInt64(jobsetNodesAtRisk, boolToInt64(summary.AtRisk), metric.WithAttributes(commonAttrs...))
+			o.ObserveInt64(jobsetNodesAlerting, boolToInt64(summary.Alerting), metric.WithAttributes(commonAttrs...))
+			o.ObserveInt64(jobsetNodesProvisioningRetryCount, int64(summary.ProvisioningRetryCount), metric.WithAttributes(commonAttrs...))
 			if summary.DownTimeInitial != 0 {
 				o.ObserveFloat64(jobsetNodesDownTimeInitial, summary.DownTimeInitial.Seconds(), metric.WithAttributes(commonAttrs...))
 			}
@@ -263,6 +826,7 @@ func Init(r Reporter) func() {
 			}
 			if summary.MeanDownTimeBetweenRecovery != 0 {
 				o.ObserveFloat64(jobsetNodesDownTimeBetweenInterruptionMean, summary.MeanDownTimeBetweenRecovery.Seconds(), metric.WithAttributes(commonAttrs...))
+				o.ObserveFloat64(jobsetNodesMTTR, summary.MeanDownTimeBetweenRecovery.Seconds(), metric.WithAttributes(commonAttrs...))
 			}
 			if summary.LatestDownTimeBetweenRecovery != 0 {
 				o.ObserveFloat64(jobsetNodesDownTimeBetweenRecoveryLatest, summary.LatestDownTimeBetweenRecovery.Seconds(), metric.WithAttributes(commonAttrs...))
@@ -273,28 +837,174 @@ func Init(r Reporter) func() {
 			}
 			if summary.MeanUpTimeBetweenInterruption != 0 {
 				o.ObserveFloat64(jobsetNodesUpTimeBetweenInterruptionMean, summary.MeanUpTimeBetweenInterruption.Seconds(), metric.WithAttributes(commonAttrs...))
+				o.ObserveFloat64(jobsetNodesMTBF, summary.MeanUpTimeBetweenInterruption.Seconds(), metric.WithAttributes(commonAttrs...))
 			}
 			if summary.LatestUpTimeBetweenInterruption != 0 {
 				o.ObserveFloat64(jobsetNodesUpTimeBetweenInterruptionLatest, summary.LatestUpTimeBetweenInterruption.Seconds(), metric.WithAttributes(commonAttrs...))
 			}
 		}
 
+		// Replicated Jobs are admitted with their JobSet.
+		for key, jobReport := range report.JobsUp {
+			if !admitted[records.JobSetKeyOfJob(key)] {
+				continue
+			}
+			o.ObserveInt64(jobUp, boolToInt64(jobReport.Up()), metric.WithAttributes(
+				OTELAttrs(jobReport.Attrs)...,
+			))
+		}
+		for key, summary := range report.JobsUpSummaries {
+			if !admitted[records.JobSetKeyOfJob(key)] {
+				continue
+			}
+			commonAttrs := OTELAttrs(summary.Attrs)
+			o.ObserveInt64(jobInterruptionCount, int64(summary.InterruptionCount), metric.WithAttributes(commonAttrs...))
+			o.ObserveInt64(jobRecoveryCount, int64(summary.RecoveryCount), metric.WithAttributes(commonAttrs...))
+			o.ObserveFloat64(jobUpTime, summary.UpTime.Seconds(), metric.WithAttributes(commonAttrs...))
+			o.ObserveFloat64(jobDownTime, summary.DownTime.Seconds(), metric.WithAttributes(commonAttrs...))
+			o.ObserveFloat64(jobAvailability, summary.Availability, metric.WithAttributes(commonAttrs...))
+		}
+
+		o.ObserveInt64(fleetInterruptions, int64(report.Fleet.InterruptionCount))
+		o.ObserveInt64(fleetIncidents, int64(report.Fleet.IncidentCount))
+		for ns, summary := range report.Namespaces {
+			attrs := metric.WithAttributes(OTELAttrs(records.Attrs{Kind: records.KindNamespace, JobSetNamespace: ns})...)
+			o.ObserveInt64(namespaceJobSets, int64(summary.JobSetCount), attrs)
+			o.ObserveFloat64(namespaceUpTime, summary.JobSets.UpTime.Seconds(), attrs)
+			o.ObserveFloat64(namespaceDownTime, summary.JobSets.DownTime.Seconds(), attrs)
+			o.ObserveFloat64(namespaceAvailability, summary.JobSets.Availability, attrs)
+			o.ObserveInt64(namespaceInterruptions, int64(summary.Fleet.InterruptionCount), attrs)
+			o.ObserveInt64(namespaceIncidents, int64(summary.Fleet.IncidentCount), attrs)
+		}
+		for pool, summary := range report.NodePools {
+			attrs := metric.WithAttributes(append(OTELAttrs(records.Attrs{Kind: records.KindNodePool}), attribute.String("node.pool", pool))...)
+			o.ObserveInt64(nodePoolNodes, int64(summary.NodeCount), attrs)
+			o.ObserveInt64(nodePoolInterruptionCount, int64(summary.Nodes.InterruptionCount), attrs)
+			o.ObserveInt64(nodePoolRecoveryCount, int64(summary.Nodes.RecoveryCount), attrs)
+			o.ObserveFloat64(nodePoolUpTime, summary.Nodes.UpTime.Seconds(), attrs)
+			o.ObserveFloat64(nodePoolDownTime, summary.Nodes.DownTime.Seconds(), attrs)
+			o.ObserveFloat64(nodePoolAvailability, summary.Nodes.Availability, attrs)
+			o.ObserveFloat64(nodePoolMTBF, summary.Nodes.MeanUpTimeBetweenInterruption.Seconds(), attrs)
+		}
+		meetingSLO, withSLO := report.SLOCompliance()
+		o.ObserveInt64(entitiesMeetingSLO, int64(meetingSLO))
+		o.ObserveInt64(entitiesTotal, int64(withSLO))
+		if FleetReportInfoMaxBytes > 0 {
+			if info, truncated, ok := reportInfo(report, FleetReportInfoMaxBytes); ok {
+				o.ObserveInt64(fleetReportInfo, 1, metric.WithAttributes(
+					attribute.String("report", info),
+					attribute.Bool("truncated", truncated),
+				))
+			}
+		}
+
+		// Only additive values are exported for the overflow series so that
+		// totals across all series remain correct.
+		o.ObserveInt64(overflowEntities, int64(overflowed))
+		o.ObserveInt64(evictedEntities, limiter.evictedCount())
+		if overflowed > 0 {
+			overflowAttrs := func(kind records.Kind) metric.MeasurementOption {
+				return metric.WithAttributes(OTELAttrs(records.Attrs{
+					Kind:            kind,
+					JobSetNamespace: OverflowLabel,
+					JobSetName:      OverflowLabel,
+				})...)
+			}
+			attrs := overflowAttrs(records.KindJobSet)
+			o.ObserveInt64(jobsetUp, overflow.up, attrs)
+			o.ObserveInt64(jobsetInterruptionCount, int64(overflow.jobset.InterruptionCount), attrs)
+			o.ObserveInt64(jobsetCoordinatorInterruptionCount, int64(overflow.jobset.CoordinatorInterruptionCount), attrs)
+			observeInterruptionCauses(o, jobsetInterruptionCauseCount, overflow.jobset.EventSummary, OTELAttrs(records.Attrs{
+				Kind:            records.KindJobSet,
+				JobSetNamespace: OverflowLabel,
+				JobSetName:      OverflowLabel,
+			}))
+			o.ObserveInt64(jobsetRecoveryCount, int64(overflow.jobset.RecoveryCount), attrs)
+			o.ObserveFloat64(jobsetUpTime, overflow.jobset.UpTime.Seconds(), attrs)
+			o.ObserveFloat64(jobsetEffectiveUpTime, overflow.jobset.EffectiveUpTime.Seconds(), attrs)
+			o.ObserveFloat64(jobsetDegradedTime, overflow.jobset.DegradedTime.Seconds(), attrs)
+			o.ObserveFloat64(jobsetDownTime, overflow.jobset.DownTime.Seconds(), attrs)
+			o.ObserveFloat64(jobsetDownTimeInitial, overflow.jobset.DownTimeInitial.Seconds(), attrs)
+			o.ObserveFloat64(jobsetProvisioning, overflow.jobset.DownTimeInitial.Seconds(), attrs)
+			o.ObserveFloat64(jobsetDownTimeBetweenRecovery, overflow.jobset.TotalDownTimeBetweenRecovery.Seconds(), attrs)
+			o.ObserveFloat64(jobsetUpTimeBetweenInterruption, overflow.jobset.TotalUpTimeBetweenInterruption.Seconds(), attrs)
+			o.ObserveInt64(jobsetAtRisk, overflow.jobset.atRisk, attrs)
+			o.ObserveInt64(jobsetAlerting, overflow.jobset.alerting, attrs)
+			o.ObserveInt64(jobsetProvisioningRetryCount, int64(overflow.jobset.ProvisioningRetryCount), attrs)
+			o.ObserveInt64(jobsetProvisioningStuck, overflow.jobset.stuck, attrs)
+
+			attrs = overflowAttrs(records.KindJobSetNodes)
+			o.ObserveInt64(jobsetNodesUp, overflow.nodesUp, attrs)
+			o.ObserveInt64(jobsetNodesInterruptionCount, int64(overflow.nodes.InterruptionCount), attrs)
+			o.ObserveInt64(jobsetNodesRecoveryCount, int64(overflow.nodes.RecoveryCount), attrs)
+			o.ObserveFloat64(jobsetNodesUpTime, overflow.nodes.UpTime.Seconds(), attrs)
+			o.ObserveFloat64(jobsetNodesDegradedTime, overflow.nodes.DegradedTime.Seconds(), attrs)
+			o.ObserveFloat64(jobsetNodesDownTime, overflow.nodes.DownTime.Seconds(), attrs)
+			o.ObserveFloat64(jobsetNodesDownTimeInitial, overflow.nodes.DownTimeInitial.Seconds(), attrs)
+			o.ObserveFloat64(jobsetNodesDownTimeBetweenRecovery, overflow.nodes.TotalDownTimeBetweenRecovery.Seconds(), attrs)
+			o.ObserveFloat64(jobsetNodesUpTimeBetweenInterruption, overflow.nodes.TotalUpTimeBetweenInterruption.Seconds(), attrs)
+			o.ObserveInt64(jobsetNodesAtRisk, overflow.nodes.atRisk, attrs)
+			o.ObserveInt64(jobsetNodesAlerting, overflow.nodes.alerting, attrs)
+			o.ObserveInt64(jobsetNodesProvisioningRetryCount, int64(overflow.nodes.ProvisioningRetryCount), attrs)
+		}
+
 		return nil
 	},
+		overflowEntities,
+		evictedEntities,
+		fleetInterruptions,
+		fleetIncidents,
+		fleetReportInfo,
+		namespaceJobSets,
+		namespaceUpTime,
+		namespaceDownTime,
+		namespaceAvailability,
+		namespaceInterruptions,
+		namespaceIncidents,
+		nodePoolNodes,
+		nodePoolInterruptionCount,
+		nodePoolRecoveryCount,
+		nodePoolUpTime,
+		nodePoolDownTime,
+		nodePoolAvailability,
+		nodePoolMTBF,
+		entitiesMeetingSLO,
+		entitiesTotal,
 		jobsetUp,
+		jobsetRestartBudgetRemaining,
+		jobsetTimeInState,
 		jobsetUpTime,
+		jobsetEffectiveUpTime,
+		jobsetDegradedTime,
 		jobsetUpTimeBetweenInterruption,
 		jobsetUpTimeBetweenInterruptionMean,
 		jobsetUpTimeBetweenInterruptionLatest,
 		jobsetDownTime,
 		jobsetDownTimeInitial,
+		jobsetProvisioning,
+		jobsetNodePools,
 		jobsetDownTimeBetweenRecovery,
 		jobsetDownTimeBetweenRecoveryMean,
 		jobsetDownTimeBetweenRecoveryLatest,
 		jobsetInterruptionCount,
+		jobsetCoordinatorInterruptionCount,
+		jobsetInterruptionCauseCount,
 		jobsetRecoveryCount,
+		jobsetMTBF,
+		jobsetMTTR,
+		jobsetMeanLostWork,
+		jobsetAvailability,
+		jobsetInterruptionsPerHour,
+		jobsetErrorBudgetRemaining,
+		jobsetCurrentUpStreak,
+		jobsetAtRisk,
+		jobsetAlerting,
+		jobsetProvisioningRetryCount,
+		jobsetProvisioningStuck,
 		jobsetNodesUp,
+		jobsetNodesTimeInState,
 		jobsetNodesUpTime,
+		jobsetNodesDegradedTime,
 		jobsetNodesUpTimeBetweenInterruption,
 		jobsetNodesUpTimeBetweenInterruptionMean,
 		jobsetNodesUpTimeBetweenInterruptionLatest,
@@ -303,8 +1013,21 @@ func Init(r Reporter) func() {
 		jobsetNodesDownTimeBetweenRecovery,
 		jobsetNodesDownTimeBetweenInterruptionMean,
 		jobsetNodesDownTimeBetweenRecoveryLatest,
+		jobsetNodesMTBF,
+		jobsetNodesMTTR,
 		jobsetNodesInterruptionCount,
 		jobsetNodesRecoveryCount,
+		jobsetNodesAvailability,
+		jobsetNodesInterruptionsPerHour,
+		jobsetNodesAtRisk,
+		jobsetNodesAlerting,
+		jobsetNodesProvisioningRetryCount,
+		jobUp,
+		jobUpTime,
+		jobDownTime,
+		jobInterruptionCount,
+		jobRecoveryCount,
+		jobAvailability,
 	)
 	if err != nil {
 		log.Fatalf("failed to register callback: %v", err)
@@ -312,6 +1035,7 @@ func Init(r Reporter) func() {
 
 	// Return a function that can be used to shutdown the provider.
 	return func() {
+		reg.Unregister(histograms)
 		if err := provider.Shutdown(context.Background()); err != nil {
 			log.Printf("failed to shutdown MeterProvider: %v", err)
 		}
@@ -320,12 +1044,21 @@ func Init(r Reporter) func() {
 
 func OTELAttrs(attrs records.Attrs) []attribute.KeyValue {
 	var otelAttrs []attribute.KeyValue
+	if attrs.Kind != "" {
+		otelAttrs = append(otelAttrs, attribute.String("kind", string(attrs.Kind)))
+	}
 	if attrs.JobSetNamespace != "" {
 		otelAttrs = append(otelAttrs, attribute.String("jobset.namespace", attrs.JobSetNamespace))
 	}
 	if attrs.JobSetName != "" {
 		otelAttrs = append(otelAttrs, attribute.String("jobset.name", attrs.JobSetName))
 	}
+	if attrs.ReplicatedJobName != "" {
+		otelAttrs = append(otelAttrs, attribute.String("replicatedjob.name", attrs.ReplicatedJobName))
+	}
+	if attrs.JobIndex != "" {
+		otelAttrs = append(otelAttrs, attribute.String("job.index", attrs.JobIndex))
+	}
 	if attrs.TPUTopology != "" {
 		otelAttrs = append(otelAttrs, attribute.String("tpu.topology", attrs.TPUTopology))
 	}
@@ -338,6 +1071,58 @@ func OTELAttrs(attrs records.Attrs) []attribute.KeyValue {
 	return otelAttrs
 }
 
+// observeInterruptionCauses observes the interruptions of summary by cause,
+// see records.EventSummary.NodeInterruptionCount.
+func observeInterruptionCauses(o metric.Observer, counter metric.Int64Observable, summary records.EventSummary, attrs []attribute.KeyValue) {
+	for cause, n := range map[string]int{
+		"node":    summary.NodeInterruptionCount,
+		"unknown": summary.InterruptionCount - summary.NodeInterruptionCount,
+	} {
+		o.ObserveInt64(counter, int64(n), metric.WithAttributes(append(attrs[:len(attrs):len(attrs)], attribute.String("interruption.cause", cause))...))
+	}
+}
+
+// timeInState returns the time since the last event, or false if there are
+// no events.
+func timeInState(rec records.EventRecords, now time.Time) (time.Duration, bool) {
+	if len(rec.UpEvents) == 0 {
+		return 0, false
+	}
+	return now.Sub(rec.UpEvents[len(rec.UpEvents)-1].Timestamp), true
+}
+
+// reportInfo returns the summary rendering of the report as JSON, or only
+// its fleet summary if that exceeds maxBytes. It returns false if neither
+// fits.
+func reportInfo(report records.Report, maxBytes int) (string, bool, bool) {
+	jsn, err := json.Marshal(report.Render(records.RenderProfileSummary))
+	if err != nil {
+		log.Printf("failed to encode report info: %v", err)
+		return "", false, false
+	}
+	if len(jsn) <= maxBytes {
+		return string(jsn), false, true
+	}
+	jsn, err = json.Marshal(records.Report{
+		Timestamp:      report.Timestamp,
+		ClusterName:    report.ClusterName,
+		MegamonVersion: report.MegamonVersion,
+		Fleet:          report.Fleet,
+	})
+	if err != nil || len(jsn) > maxBytes {
+		log.Printf("report info exceeds %d bytes, not exported", maxBytes)
+		return "", false, false
+	}
+	return string(jsn), true, true
+}
+
+func boolToInt64(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 func fatal(err error) {
 	if err != nil {
 		panic(err)
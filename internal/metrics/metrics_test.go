@@ -0,0 +1,501 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/megamon/internal/records"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type staticReporter records.Report
+
+func (r staticReporter) Report() records.Report {
+	return records.Report(r)
+}
+
+// Init registers with the default Prometheus registry, so it can only be
+// called once per test binary.
+func TestInitExposedNames(t *testing.T) {
+	report := records.NewReport()
+	report.JobSetsUpSummaries["abc"] = records.UpnessSummaryWithAttrs{
+		Attrs: records.Attrs{JobSetName: "js", JobSetNamespace: "ns"},
+		EventSummary: records.EventSummary{
+			InterruptionCount:             1,
+			NodeInterruptionCount:         1,
+			DownTimeInitial:               20 * time.Minute,
+			MeanLostWorkPerInterruption:   10 * time.Minute,
+			CurrentUpStreak:               time.Hour,
+			AtRisk:                        true,
+			ProvisioningRetryCount:        3,
+			ProvisioningStuck:             true,
+			Availability:                  0.75,
+			InterruptionsPerHour:          0.5,
+			MeanUpTimeBetweenInterruption: 2 * time.Hour,
+			MeanDownTimeBetweenRecovery:   5 * time.Minute,
+			SLO:                           records.SLO{Target: 0.99},
+			ErrorBudgetRemainingTime:      -90 * time.Second,
+		},
+	}
+
+	remaining := int32(2)
+	report.JobSetsUp["abc"] = records.Upness{
+		Attrs:                  records.Attrs{JobSetName: "js", JobSetNamespace: "ns"},
+		RestartBudgetRemaining: &remaining,
+	}
+	report.JobSetNodePools = map[string][]string{"abc": {"pool-a"}}
+	jobAttrs := records.Attrs{Kind: records.KindJob, JobSetName: "js", JobSetNamespace: "ns", ReplicatedJobName: "workers", JobIndex: "0"}
+	report.JobsUp = map[string]records.Upness{records.JobKey("abc", "workers", 0): {Attrs: jobAttrs, ExpectedCount: 1, ReadyCount: 1}}
+	report.JobsUpSummaries = map[string]records.UpnessSummaryWithAttrs{
+		records.JobKey("abc", "workers", 0): {Attrs: jobAttrs, EventSummary: records.EventSummary{InterruptionCount: 1}},
+		// Replicated Jobs of JobSets in the overflow series are dropped.
+		records.JobKey("xyz1", "workers", 0): {Attrs: records.Attrs{JobSetName: "xyz1"}, EventSummary: records.EventSummary{InterruptionCount: 1}},
+	}
+
+	// Entities beyond the cap are summed into the overflow series.
+	for key, interruptions := range map[string]int{"xyz1": 2, "xyz2": 3} {
+		attrs := records.Attrs{JobSetName: key, JobSetNamespace: "ns"}
+		report.JobSetsUp[key] = records.Upness{Attrs: attrs}
+		report.JobSetsUpSummaries[key] = records.UpnessSummaryWithAttrs{
+			Attrs: attrs,
+			EventSummary: records.EventSummary{
+				InterruptionCount: interruptions,
+				UpTime:            time.Hour,
+			},
+		}
+	}
+	report.Fleet = records.FleetSummary{InterruptionCount: 4, IncidentCount: 3}
+	report.Namespaces = map[string]records.NamespaceSummary{
+		"ns": {
+			JobSetCount: 3,
+			JobSets:     records.EventSummary{UpTime: 3 * time.Hour, DownTime: time.Hour, Availability: 0.75},
+			Fleet:       records.FleetSummary{InterruptionCount: 2, IncidentCount: 1},
+		},
+	}
+	report.NodePools = map[string]records.NodePoolSummary{
+		"pool-a": {
+			NodeCount: 4,
+			Nodes:     records.EventSummary{InterruptionCount: 3, UpTime: 8 * time.Hour, Availability: 0.9},
+		},
+	}
+	MaxEntities = 1
+
+	shutdown := Init(staticReporter(report))
+	defer shutdown()
+	LastAggregationTimestamp.Record(context.Background(), 1609459200)
+	AggregationFailureCount.Add(context.Background(), 2)
+	AggregationTimeoutCount.Add(context.Background(), 1)
+	ExporterUp.Record(context.Background(), 1)
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+
+	// map[<metric>/<jobset_name>]<value>
+	got := map[string]float64{}
+	// map[<jobset_name>/<interruption_cause>]<value>
+	causes := map[string]float64{}
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			var name, cause string
+			for _, l := range m.GetLabel() {
+				switch l.GetName() {
+				case "jobset_name":
+					name = l.GetValue()
+				case "interruption_cause":
+					cause = l.GetValue()
+				}
+			}
+			if f.GetName() == "megamon_jobset_interruption_cause_count_total" {
+				causes[name+"/"+cause] = m.GetCounter().GetValue()
+			}
+			key := f.GetName() + "/" + name
+			switch {
+			case m.GetGauge() != nil:
+				got[key] = m.GetGauge().GetValue()
+			case m.GetCounter() != nil:
+				got[key] = m.GetCounter().GetValue()
+			}
+		}
+	}
+	require.Contains(t, got, "megamon_jobset_mean_lost_work_seconds/js")
+	require.Equal(t, (10 * time.Minute).Seconds(), got["megamon_jobset_mean_lost_work_seconds/js"])
+	require.Equal(t, time.Hour.Seconds(), got["megamon_jobset_current_up_streak_seconds/js"])
+	require.Equal(t, 2.0, got["megamon_jobset_restart_budget_remaining/js"])
+	require.Equal(t, 1.0, got["megamon_jobset_at_risk/js"])
+	require.Equal(t, 0.75, got["megamon_jobset_availability/js"])
+	require.Equal(t, 0.5, got["megamon_jobset_interruptions_per_hour/js"])
+	require.Equal(t, (2 * time.Hour).Seconds(), got["megamon_jobset_mtbf_seconds/js"])
+	require.Equal(t, (5 * time.Minute).Seconds(), got["megamon_jobset_mttr_seconds/js"])
+	require.Equal(t, -90.0, got["megamon_jobset_error_budget_seconds_remaining/js"])
+	require.Equal(t, 3.0, got["megamon_jobset_provisioning_retry_count_total/js"])
+	require.Equal(t, 1.0, got["megamon_jobset_provisioning_stuck/js"])
+	require.Equal(t, (20 * time.Minute).Seconds(), got["megamon_jobset_provisioning_seconds/js"])
+	require.Equal(t, 1.0, got["megamon_jobset_nodepools/js"])
+	require.Equal(t, map[string]float64{
+		"js/node":                  1,
+		"js/unknown":               0,
+		OverflowLabel + "/node":    0,
+		OverflowLabel + "/unknown": 5,
+	}, causes)
+	require.Equal(t, 1.0, got["megamon_job_up/js"])
+	require.Equal(t, 1.0, got["megamon_job_interruption_count_total/js"])
+	require.NotContains(t, got, "megamon_job_interruption_count_total/xyz1")
+	require.Equal(t, 4.0, got["megamon_fleet_interruptions/"])
+	require.Equal(t, 3.0, got["megamon_fleet_incidents/"])
+	require.Equal(t, 3.0, got["megamon_namespace_jobsets/"])
+	require.Equal(t, (3 * time.Hour).Seconds(), got["megamon_namespace_up_time_seconds/"])
+	require.Equal(t, time.Hour.Seconds(), got["megamon_namespace_down_time_seconds/"])
+	require.Equal(t, 0.75, got["megamon_namespace_availability/"])
+	require.Equal(t, 2.0, got["megamon_namespace_interruptions/"])
+	require.Equal(t, 1.0, got["megamon_namespace_incidents/"])
+	require.Equal(t, 4.0, got["megamon_nodepool_nodes/"])
+	require.Equal(t, 3.0, got["megamon_nodepool_interruption_count/"])
+	require.Equal(t, (8 * time.Hour).Seconds(), got["megamon_nodepool_up_time_seconds/"])
+	require.Equal(t, 0.9, got["megamon_nodepool_availability/"])
+	require.Equal(t, 1609459200.0, got["megamon_last_aggregation_timestamp_seconds/"])
+	require.Equal(t, 2.0, got["megamon_aggregation_failure_count_total/"])
+	require.Equal(t, 1.0, got["megamon_aggregation_timeout_count_total/"])
+	require.Equal(t, 1.0, got["megamon_exporter_up/"])
+
+	require.Equal(t, 2.0, got["megamon_metrics_overflow_entities/"])
+	require.Contains(t, got, "megamon_metrics_evicted_entities_total/")
+	require.Equal(t, 5.0, got["megamon_jobset_interruption_count_total/"+OverflowLabel])
+	require.Equal(t, 2*time.Hour.Seconds(), got["megamon_jobset_up_time_seconds_total/"+OverflowLabel])
+	require.Equal(t, 1.0, got["megamon_jobset_interruption_count_total/js"])
+	require.NotContains(t, got, "megamon_jobset_interruption_count_total/xyz1")
+	require.NotContains(t, got, "megamon_jobset_interruption_count_total/xyz2")
+	// Availability is not additive, so it has no overflow series.
+	require.NotContains(t, got, "megamon_jobset_availability/"+OverflowLabel)
+	// Nor is the error budget of JobSets with an SLO.
+	require.NotContains(t, got, "megamon_jobset_error_budget_seconds_remaining/"+OverflowLabel)
+}
+
+func TestInitNamespace(t *testing.T) {
+	defer func(ns, prefix string) { Namespace, Prefix = ns, prefix }(Namespace, Prefix)
+	Namespace = "company"
+	Prefix = "mm"
+
+	report := records.NewReport()
+	attrs := records.Attrs{JobSetName: "js", JobSetNamespace: "ns"}
+	report.JobSetsUp["abc"] = records.Upness{Attrs: attrs}
+	report.JobSetsUpSummaries["abc"] = records.UpnessSummaryWithAttrs{Attrs: attrs}
+	report.JobSetNodesUp["abc"] = records.Upness{Attrs: attrs}
+	report.JobSetNodesUpSummaries["abc"] = records.UpnessSummaryWithAttrs{Attrs: attrs}
+
+	reg := prometheus.NewRegistry()
+	shutdown := initWithRegisterer(staticReporter(report), reg)
+	defer shutdown()
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	var names []string
+	for _, f := range families {
+		// Info metrics added by the exporter are not namespaced.
+		if f.GetName() == "target_info" || f.GetName() == "otel_scope_info" {
+			continue
+		}
+		names = append(names, f.GetName())
+		require.True(t, strings.HasPrefix(f.GetName(), "company_mm_"), f.GetName())
+	}
+	require.Contains(t, names, "company_mm_jobset_up")
+	require.Contains(t, names, "company_mm_jobset_nodes_up")
+}
+
+func TestKindLabels(t *testing.T) {
+	report := records.NewReport()
+	jobSetAttrs := records.Attrs{Kind: records.KindJobSet, JobSetName: "js", JobSetNamespace: "ns"}
+	nodeAttrs := records.Attrs{Kind: records.KindJobSetNodes, JobSetName: "js", JobSetNamespace: "ns"}
+	report.JobSetsUp["abc"] = records.Upness{Attrs: jobSetAttrs}
+	report.JobSetsUpSummaries["abc"] = records.UpnessSummaryWithAttrs{Attrs: jobSetAttrs}
+	report.JobSetNodesUp["abc"] = records.Upness{Attrs: nodeAttrs}
+	report.JobSetNodesUpSummaries["abc"] = records.UpnessSummaryWithAttrs{Attrs: nodeAttrs}
+	report.Namespaces = map[string]records.NamespaceSummary{"ns": {JobSetCount: 1}}
+	report.NodePools = map[string]records.NodePoolSummary{"pool-a": {NodeCount: 1}}
+
+	reg := prometheus.NewRegistry()
+	shutdown := initWithRegisterer(staticReporter(report), reg)
+	defer shutdown()
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	// map[<metric>]<kind>
+	got := map[string]string{}
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "kind" {
+					got[f.GetName()] = l.GetValue()
+				}
+			}
+		}
+	}
+	require.Equal(t, "jobset", got["megamon_jobset_up"])
+	require.Equal(t, "jobset", got["megamon_jobset_interruption_count_total"])
+	require.Equal(t, "jobset-nodes", got["megamon_jobset_nodes_up"])
+	require.Equal(t, "jobset-nodes", got["megamon_jobset_nodes_interruption_count_total"])
+	require.Equal(t, "namespace", got["megamon_namespace_jobsets"])
+	require.Equal(t, "namespace", got["megamon_namespace_availability"])
+	require.Equal(t, "nodepool", got["megamon_nodepool_nodes"])
+	require.Equal(t, "nodepool", got["megamon_nodepool_availability"])
+}
+
+func TestMinLifetime(t *testing.T) {
+	defer func(min time.Duration) { MinLifetime = min }(MinLifetime)
+	MinLifetime = 10 * time.Minute
+
+	report := records.NewReport()
+	for name, lifetime := range map[string]time.Duration{"smoke": time.Minute, "train": time.Hour} {
+		attrs := records.Attrs{JobSetName: name, JobSetNamespace: "ns"}
+		report.JobSetsUp[name] = records.Upness{Attrs: attrs}
+		report.JobSetsUpSummaries[name] = records.UpnessSummaryWithAttrs{
+			Attrs:        attrs,
+			EventSummary: records.EventSummary{Lifetime: lifetime, InterruptionCount: 1},
+		}
+	}
+
+	reg := prometheus.NewRegistry()
+	shutdown := initWithRegisterer(staticReporter(report), reg)
+	defer shutdown()
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	names := map[string]bool{}
+	for _, f := range families {
+		if f.GetName() != "megamon_jobset_up" && f.GetName() != "megamon_jobset_interruption_count_total" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "jobset_name" {
+					names[f.GetName()+"/"+l.GetValue()] = true
+				}
+			}
+		}
+	}
+	require.Equal(t, map[string]bool{
+		"megamon_jobset_up/train":                       true,
+		"megamon_jobset_interruption_count_total/train": true,
+	}, names)
+}
+
+func TestSLOCompliance(t *testing.T) {
+	report := records.NewReport()
+	for name, summary := range map[string]records.EventSummary{
+		"compliant":     {SLO: records.SLO{Target: 0.99, Window: time.Hour}, ErrorBudgetRemaining: 0.5},
+		"exhausted":     {SLO: records.SLO{Target: 0.99, Window: time.Hour}},
+		"non-compliant": {SLO: records.SLO{Target: 0.9, Window: time.Hour}, ErrorBudgetRemaining: -0.25},
+		"no-slo":        {},
+	} {
+		attrs := records.Attrs{JobSetName: name, JobSetNamespace: "ns"}
+		report.JobSetsUp[name] = records.Upness{Attrs: attrs}
+		report.JobSetsUpSummaries[name] = records.UpnessSummaryWithAttrs{Attrs: attrs, EventSummary: summary}
+	}
+
+	reg := prometheus.NewRegistry()
+	shutdown := initWithRegisterer(staticReporter(report), reg)
+	defer shutdown()
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	got := map[string]float64{}
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			if m.GetGauge() != nil {
+				got[f.GetName()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	require.Equal(t, 2.0, got["megamon_entities_meeting_slo"])
+	require.Equal(t, 3.0, got["megamon_entities_total"])
+}
+
+func TestFleetReportInfo(t *testing.T) {
+	defer func(max int) { FleetReportInfoMaxBytes = max }(FleetReportInfoMaxBytes)
+
+	report := records.NewReport()
+	report.ClusterName = "cluster"
+	report.Fleet = records.FleetSummary{InterruptionCount: 2, IncidentCount: 1}
+	attrs := records.Attrs{JobSetName: "js", JobSetNamespace: "ns"}
+	report.JobSetsUp["abc"] = records.Upness{Attrs: attrs, ReadyCount: 1, ExpectedCount: 1}
+	report.JobSetsUpSummaries["abc"] = records.UpnessSummaryWithAttrs{Attrs: attrs}
+
+	info := func(maxBytes int) (map[string]string, bool) {
+		FleetReportInfoMaxBytes = maxBytes
+		reg := prometheus.NewRegistry()
+		shutdown := initWithRegisterer(staticReporter(report), reg)
+		defer shutdown()
+
+		families, err := reg.Gather()
+		require.NoError(t, err)
+		for _, f := range families {
+			if f.GetName() != "megamon_fleet_report_info" {
+				continue
+			}
+			require.Len(t, f.GetMetric(), 1)
+			require.Equal(t, 1.0, f.GetMetric()[0].GetGauge().GetValue())
+			labels := map[string]string{}
+			for _, l := range f.GetMetric()[0].GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			return labels, true
+		}
+		return nil, false
+	}
+
+	labels, ok := info(1 << 20)
+	require.True(t, ok)
+	require.Equal(t, "false", labels["truncated"])
+	var got records.Report
+	require.NoError(t, json.Unmarshal([]byte(labels["report"]), &got))
+	require.Equal(t, "cluster", got.ClusterName)
+	require.Equal(t, report.Fleet, got.Fleet)
+	require.Equal(t, int32(1), got.JobSetsUp["abc"].ReadyCount)
+
+	// Reports over the limit are reduced to the fleet summary.
+	full := len(labels["report"])
+	labels, ok = info(full - 1)
+	require.True(t, ok)
+	require.Equal(t, "true", labels["truncated"])
+	require.LessOrEqual(t, len(labels["report"]), full-1)
+	got = records.Report{}
+	require.NoError(t, json.Unmarshal([]byte(labels["report"]), &got))
+	require.Equal(t, report.Fleet, got.Fleet)
+	require.Empty(t, got.JobSetsUp)
+
+	// Nothing is exported if even that does not fit, or when disabled.
+	_, ok = info(10)
+	require.False(t, ok)
+	_, ok = info(0)
+	require.False(t, ok)
+}
+
+func TestTimeInState(t *testing.T) {
+	defer func(enabled bool, f func() time.Time) { TimeInState, now = enabled, f }(TimeInState, now)
+	TimeInState = true
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	require.NoError(t, err)
+	report := records.NewReport()
+	attrs := records.Attrs{JobSetName: "js", JobSetNamespace: "ns"}
+	report.JobSetsUp["abc"] = records.Upness{Attrs: attrs}
+	report.JobSetEvents = map[string]records.EventRecords{"abc": {UpEvents: []records.UpEvent{
+		{Up: false, Timestamp: t0},
+		{Up: true, Timestamp: t0.Add(time.Minute)},
+	}}}
+
+	reg := prometheus.NewRegistry()
+	shutdown := initWithRegisterer(staticReporter(report), reg)
+	defer shutdown()
+
+	scrape := func(at time.Time) float64 {
+		now = func() time.Time { return at }
+		families, err := reg.Gather()
+		require.NoError(t, err)
+		for _, f := range families {
+			if f.GetName() == "megamon_jobset_time_in_state_seconds" {
+				return f.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		t.Fatal("megamon_jobset_time_in_state_seconds not found")
+		return 0
+	}
+	require.Equal(t, (4 * time.Minute).Seconds(), scrape(t0.Add(5*time.Minute)))
+	require.Equal(t, (9 * time.Minute).Seconds(), scrape(t0.Add(10*time.Minute)))
+}
+
+func TestAllowlist(t *testing.T) {
+	defer func(allowlist []string) { Allowlist = allowlist }(Allowlist)
+	Allowlist = []string{"megamon_jobset_up", "megamon_jobset_up_time_seconds_total", "megamon_entities_total"}
+
+	report := records.NewReport()
+	attrs := records.Attrs{JobSetName: "js", JobSetNamespace: "ns"}
+	report.JobSetsUp["abc"] = records.Upness{Attrs: attrs}
+	report.JobSetsUpSummaries["abc"] = records.UpnessSummaryWithAttrs{
+		Attrs:        attrs,
+		EventSummary: records.EventSummary{InterruptionCount: 1, UpTime: time.Hour},
+	}
+	report.JobSetNodesUp["abc"] = records.Upness{Attrs: attrs}
+
+	reg := prometheus.NewRegistry()
+	shutdown := initWithRegisterer(staticReporter(report), reg)
+	defer shutdown()
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	var names []string
+	for _, f := range families {
+		if f.GetName() == "target_info" || f.GetName() == "otel_scope_info" {
+			continue
+		}
+		names = append(names, f.GetName())
+	}
+	require.ElementsMatch(t, []string{"megamon_jobset_up", "megamon_jobset_up_time_seconds_total", "megamon_entities_total"}, names)
+}
+
+// fakeCollector records the metric names and headers of OTLP exports.
+type fakeCollector struct {
+	collectormetrics.UnimplementedMetricsServiceServer
+
+	mtx     sync.Mutex
+	names   map[string]bool
+	headers metadata.MD
+}
+
+func (c *fakeCollector) Export(ctx context.Context, req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.headers, _ = metadata.FromIncomingContext(ctx)
+	for _, rm := range req.GetResourceMetrics() {
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				c.names[m.GetName()] = true
+			}
+		}
+	}
+	return &collectormetrics.ExportMetricsServiceResponse{}, nil
+}
+
+func TestOTLP(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	collector := &fakeCollector{names: map[string]bool{}}
+	srv := grpc.NewServer()
+	collectormetrics.RegisterMetricsServiceServer(srv, collector)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	defer func(o OTLPOptions) { OTLP = o }(OTLP)
+	OTLP = OTLPOptions{
+		Endpoint: lis.Addr().String(),
+		Insecure: true,
+		Headers:  map[string]string{"x-token": "secret"},
+		Interval: time.Hour,
+	}
+
+	report := records.NewReport()
+	attrs := records.Attrs{JobSetName: "js", JobSetNamespace: "ns"}
+	report.JobSetsUp["abc"] = records.Upness{Attrs: attrs}
+	report.JobSetsUpSummaries["abc"] = records.UpnessSummaryWithAttrs{
+		Attrs:        attrs,
+		EventSummary: records.EventSummary{InterruptionCount: 1, UpTime: time.Hour},
+	}
+
+	// Shutting down flushes the pending export despite the long interval.
+	shutdown := initWithRegisterer(staticReporter(report), prometheus.NewRegistry())
+	shutdown()
+
+	collector.mtx.Lock()
+	defer collector.mtx.Unlock()
+	require.True(t, collector.names["megamon.jobset.up"])
+	require.True(t, collector.names["megamon.jobset.interruption.count"])
+	require.Equal(t, []string{"secret"}, collector.headers.Get("x-token"))
+}
@@ -0,0 +1,324 @@
+package records
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// CompactedEvents holds what summaries need of the events that were
+// compacted away: their first and last event and the totals of the intervals
+// between them. It is kept in the records so that long-lived entities don't
+// accumulate events forever.
+type CompactedEvents struct {
+	// Count is the number of compacted events.
+	Count int     `json:"count"`
+	First UpEvent `json:"first"`
+	Last  UpEvent `json:"last"`
+
+	DownTime        time.Duration `json:"downTime"`
+	DownTimeInitial time.Duration `json:"downTimeInitial"`
+	UpTime          time.Duration `json:"upTime"`
+	DegradedTime    time.Duration `json:"degradedTime,omitempty"`
+	// OutageDownTime is the downtime within the outages known when
+	// compacting, of which OutageDownTimeInitial is while provisioning.
+	OutageDownTime        time.Duration `json:"outageDownTime,omitempty"`
+	OutageDownTimeInitial time.Duration `json:"outageDownTimeInitial,omitempty"`
+
+	InterruptionCount            int `json:"interruptionCount"`
+	RecoveryCount                int `json:"recoveryCount"`
+	CoordinatorInterruptionCount int `json:"coordinatorInterruptionCount,omitempty"`
+	DegradedInterruptionCount    int `json:"degradedInterruptionCount,omitempty"`
+	NodeInterruptionCount        int `json:"nodeInterruptionCount,omitempty"`
+
+	TotalDownTimeBetweenRecovery    time.Duration `json:"totalDownTimeBetweenRecovery"`
+	TotalUpTimeBetweenInterruption  time.Duration `json:"totalUpTimeBetweenInterruption"`
+	LatestDownTimeBetweenRecovery   time.Duration `json:"latestDownTimeBetweenRecovery"`
+	LatestUpTimeBetweenInterruption time.Duration `json:"latestUpTimeBetweenInterruption"`
+	// The distributions of the intervals are kept for the percentiles, in
+	// constant space. The first up interval is kept as is, since it is not
+	// preceded by a recovery, see SummaryOptions.SettlePeriod.
+	DownTimeBetweenRecoverySketch   DurationSketch `json:"downTimeBetweenRecoverySketch,omitempty"`
+	UpTimeBetweenInterruptionSketch DurationSketch `json:"upTimeBetweenInterruptionSketch,omitempty"`
+	FirstUpTimeBetweenInterruption  time.Duration  `json:"firstUpTimeBetweenInterruption,omitempty"`
+	SqDownTimeBetweenRecovery       float64        `json:"sqDownTimeBetweenRecovery,omitempty"`
+	SqUpTimeBetweenInterruption     float64        `json:"sqUpTimeBetweenInterruption,omitempty"`
+	// RecentRecoveries holds at most RecoveryTrendWindow recoveries.
+	RecentRecoveries []time.Duration `json:"recentRecoveries,omitempty"`
+
+	// DownTimeBetweenRecoveryDurations and
+	// UpTimeBetweenInterruptionDurations are the individual intervals of
+	// records compacted before the sketches. They are only read, and
+	// replaced by the sketches when compacting again.
+	DownTimeBetweenRecoveryDurations   []time.Duration `json:"downTimeBetweenRecoveryDurations,omitempty"`
+	UpTimeBetweenInterruptionDurations []time.Duration `json:"upTimeBetweenInterruptionDurations,omitempty"`
+
+	TotalLostWork time.Duration `json:"totalLostWork,omitempty"`
+	LostWorkCount int           `json:"lostWorkCount,omitempty"`
+
+	BackfilledEvents int `json:"backfilledEvents,omitempty"`
+	SkewedEvents     int `json:"skewedEvents,omitempty"`
+	MalformedEvents  int `json:"malformedEvents,omitempty"`
+	FlaggedEvents    int `json:"flaggedEvents,omitempty"`
+}
+
+// DurationSketch counts durations in fixed log-scale buckets, so that the
+// distribution of any number of durations takes constant space. Bucket 0
+// holds the durations under a second, and bucket i > 0 the durations from
+// 2^((i-1)/8) up to 2^(i/8) seconds, up to durationSketchMaxBucket. Durations
+// are approximated by the geometric middle of their bucket, within 4.5%.
+//
+// Percentiles over compacted intervals are therefore approximate, unlike the
+// counts and totals that Compact keeps exactly. Restoring a sketch expands it
+// into one duration per interval, so summarizing takes time and memory linear
+// in the number of compacted intervals, though the records do not grow.
+type DurationSketch map[int]int
+
+// durationSketchMaxBucket is the last bucket of a DurationSketch, which
+// holds everything from about 136 years.
+const durationSketchMaxBucket = 8 * 32
+
+// durationSketchBucket returns the bucket of d.
+func durationSketchBucket(d time.Duration) int {
+	if d < time.Second {
+		return 0
+	}
+	return min(int(math.Floor(8*math.Log2(d.Seconds())))+1, durationSketchMaxBucket)
+}
+
+// newDurationSketch returns the sketch of ds, nil if ds is empty.
+func newDurationSketch(ds []time.Duration) DurationSketch {
+	if len(ds) == 0 {
+		return nil
+	}
+	sketch := DurationSketch{}
+	for _, d := range ds {
+		sketch[durationSketchBucket(d)]++
+	}
+	return sketch
+}
+
+// durations returns the approximated durations of the sketch, shortest
+// first.
+func (sketch DurationSketch) durations() []time.Duration {
+	buckets := make([]int, 0, len(sketch))
+	var n int
+	for b, count := range sketch {
+		buckets = append(buckets, b)
+		n += count
+	}
+	sort.Ints(buckets)
+	ds := make([]time.Duration, 0, n)
+	for _, b := range buckets {
+		d := time.Second / 2
+		if b > 0 {
+			d = time.Duration(math.Exp2((float64(b)-0.5)/8) * float64(time.Second))
+		}
+		for i := 0; i < sketch[b]; i++ {
+			ds = append(ds, d)
+		}
+	}
+	return ds
+}
+
+// count returns the number of compacted events, zero for nil.
+func (c *CompactedEvents) count() int {
+	if c == nil {
+		return 0
+	}
+	return c.Count
+}
+
+// interruptionCount returns the number of compacted interruptions, zero for
+// nil.
+func (c *CompactedEvents) interruptionCount() int {
+	if c == nil {
+		return 0
+	}
+	return c.InterruptionCount
+}
+
+// EventCount returns the number of events of r, including the compacted ones.
+func (r *EventRecords) EventCount() int {
+	return r.Compacted.count() + len(r.UpEvents)
+}
+
+// firstEvent returns the first event of r, including the compacted ones. r
+// must have events.
+func (r *EventRecords) firstEvent() UpEvent {
+	if r.Compacted != nil {
+		return r.Compacted.First
+	}
+	return r.UpEvents[0]
+}
+
+// interruption returns whether UpEvents[i] is an interruption (a transition
+// from up to down), taking the compacted events into account for the first
+// one.
+func (r *EventRecords) interruption(i int) bool {
+	if r.UpEvents[i].Up {
+		return false
+	}
+	if i > 0 {
+		return r.UpEvents[i-1].Up
+	}
+	return r.Compacted != nil && r.Compacted.Last.Up
+}
+
+// Compact folds the events of rec before the given time into rec.Compacted.
+// The last of them, which the system was still in at that time, is kept
+// along with all later events, and so are the degraded events.
+//
+// Summaries of the compacted records are the same as before for any time
+// after before. The exceptions are what is computed over a trailing window
+// that reaches before it (interruption bursts, alerts and windowed error
+// budgets, whose compacted downtime is only known in total), and outages
+// that were not yet known when compacting. Compacted interruptions are
+// neither listed nor counted by step range, and the percentiles and the
+// settle periods of the effective uptime are approximated over the
+// compacted intervals, see DurationSketch.
+//
+// Records with malformed events (see DataQuality.MalformedEvents) before the
+// given time are not compacted, since the count of compacted events would not
+// match. It returns whether rec changed.
+func Compact(rec *EventRecords, before time.Time, outages []Outage) bool {
+	k := -1
+	for _, e := range rec.UpEvents {
+		if !e.Timestamp.Before(before) {
+			break
+		}
+		k++
+	}
+	if k <= 0 {
+		return false
+	}
+
+	var s Summarizer
+	s.Update(&EventRecords{UpEvents: rec.UpEvents[:k], Compacted: rec.Compacted})
+	if s.skipped > 0 {
+		return false
+	}
+	c := s.compact(outages)
+
+	j := -1
+	for _, e := range rec.DegradedEvents {
+		if !e.Timestamp.Before(before) {
+			break
+		}
+		j++
+	}
+	if j > 0 {
+		c.DegradedTime += degradedTime(rec.DegradedEvents[:j], rec.DegradedEvents[j].Timestamp)
+		rec.DegradedEvents = append([]DegradedEvent(nil), rec.DegradedEvents[j:]...)
+	}
+
+	rec.Compacted = c
+	rec.UpEvents = append([]UpEvent(nil), rec.UpEvents[k:]...)
+	return true
+}
+
+// compact returns the state of the Summarizer as compacted events.
+func (s *Summarizer) compact(outages []Outage) *CompactedEvents {
+	c := &CompactedEvents{
+		Count: s.n,
+		First: s.first,
+		Last:  s.last,
+
+		DownTime:        s.summary.DownTime,
+		DownTimeInitial: s.summary.DownTimeInitial,
+		UpTime:          s.summary.UpTime,
+
+		InterruptionCount:            s.summary.InterruptionCount,
+		RecoveryCount:                s.summary.RecoveryCount,
+		CoordinatorInterruptionCount: s.summary.CoordinatorInterruptionCount,
+		DegradedInterruptionCount:    s.summary.DegradedInterruptionCount,
+		NodeInterruptionCount:        s.summary.NodeInterruptionCount,
+
+		TotalDownTimeBetweenRecovery:    s.summary.TotalDownTimeBetweenRecovery,
+		TotalUpTimeBetweenInterruption:  s.summary.TotalUpTimeBetweenInterruption,
+		LatestDownTimeBetweenRecovery:   s.summary.LatestDownTimeBetweenRecovery,
+		LatestUpTimeBetweenInterruption: s.summary.LatestUpTimeBetweenInterruption,
+		DownTimeBetweenRecoverySketch:   newDurationSketch(s.summary.DownTimeBetweenRecoveryDurations),
+		SqDownTimeBetweenRecovery:       s.sqDownTimeBetweenRecovery,
+		SqUpTimeBetweenInterruption:     s.sqUpTimeBetweenInterruption,
+		RecentRecoveries:                append([]time.Duration(nil), s.recentRecoveries...),
+
+		TotalLostWork: s.totalLostWork,
+		LostWorkCount: s.lostWorkCount,
+
+		BackfilledEvents: s.quality.BackfilledEvents,
+		SkewedEvents:     s.quality.SkewedEvents,
+		MalformedEvents:  s.quality.MalformedEvents,
+		FlaggedEvents:    s.flaggedEvents,
+	}
+	if ups := s.summary.UpTimeBetweenInterruptionDurations; len(ups) > 0 {
+		c.FirstUpTimeBetweenInterruption = ups[0]
+		c.UpTimeBetweenInterruptionSketch = newDurationSketch(ups[1:])
+	}
+	if s.compacted != nil {
+		c.DegradedTime = s.compacted.DegradedTime
+		c.OutageDownTime = s.compacted.OutageDownTime
+		c.OutageDownTimeInitial = s.compacted.OutageDownTimeInitial
+	}
+	if len(outages) > 0 {
+		// Up to the last event, so without the trailing open interval.
+		c.OutageDownTime = s.outageDownTime(s.last.Timestamp, SummaryOptions{Outages: outages})
+		c.OutageDownTimeInitial = c.OutageDownTime - s.outageDownTime(s.last.Timestamp, SummaryOptions{Outages: outages, ExcludeProvisioning: true})
+	}
+	return c
+}
+
+// restore starts the Summarizer from compacted events.
+func (s *Summarizer) restore(c *CompactedEvents) {
+	if c == nil {
+		return
+	}
+	cc := *c
+	s.compacted = &cc
+	s.n = c.Count
+	s.first = c.First
+	s.last = c.Last
+	s.tail = c.Last
+	s.summary = EventSummary{
+		DownTime:        c.DownTime,
+		DownTimeInitial: c.DownTimeInitial,
+		UpTime:          c.UpTime,
+
+		InterruptionCount:            c.InterruptionCount,
+		RecoveryCount:                c.RecoveryCount,
+		CoordinatorInterruptionCount: c.CoordinatorInterruptionCount,
+		DegradedInterruptionCount:    c.DegradedInterruptionCount,
+		NodeInterruptionCount:        c.NodeInterruptionCount,
+
+		TotalDownTimeBetweenRecovery:    c.TotalDownTimeBetweenRecovery,
+		TotalUpTimeBetweenInterruption:  c.TotalUpTimeBetweenInterruption,
+		LatestDownTimeBetweenRecovery:   c.LatestDownTimeBetweenRecovery,
+		LatestUpTimeBetweenInterruption: c.LatestUpTimeBetweenInterruption,
+	}
+	switch {
+	case len(c.DownTimeBetweenRecoveryDurations) > 0:
+		s.summary.DownTimeBetweenRecoveryDurations = append([]time.Duration(nil), c.DownTimeBetweenRecoveryDurations...)
+	case c.RecoveryCount > 0:
+		s.summary.DownTimeBetweenRecoveryDurations = c.DownTimeBetweenRecoverySketch.durations()
+	}
+	switch {
+	case len(c.UpTimeBetweenInterruptionDurations) > 0:
+		s.summary.UpTimeBetweenInterruptionDurations = append([]time.Duration(nil), c.UpTimeBetweenInterruptionDurations...)
+	case c.InterruptionCount > 0:
+		s.summary.UpTimeBetweenInterruptionDurations = append([]time.Duration{c.FirstUpTimeBetweenInterruption}, c.UpTimeBetweenInterruptionSketch.durations()...)
+	}
+	s.sqDownTimeBetweenRecovery = c.SqDownTimeBetweenRecovery
+	s.sqUpTimeBetweenInterruption = c.SqUpTimeBetweenInterruption
+	s.recentRecoveries = append([]time.Duration(nil), c.RecentRecoveries...)
+	s.totalLostWork = c.TotalLostWork
+	s.lostWorkCount = c.LostWorkCount
+	s.quality = DataQuality{
+		BackfilledEvents: c.BackfilledEvents,
+		SkewedEvents:     c.SkewedEvents,
+		MalformedEvents:  c.MalformedEvents,
+	}
+	s.flaggedEvents = c.FlaggedEvents
+	// The last compacted event starts the interval to the first remaining
+	// one.
+	s.events = []UpEvent{{Up: c.Last.Up, Timestamp: c.Last.Timestamp}}
+}
@@ -1,20 +1,97 @@
 package records
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
 const JobSetRecordsAnnotationKey = "megamon.tbd/records"
 
 type EventRecords struct {
+	// UpEvents alternate between down and up. This is owned by the recording
+	// layer: AppendUpEvent only appends state changes, and reconciling drops
+	// repeated states of records written otherwise (see dedupUpEvents). The
+	// Summarizer counts any that remain as DataQuality.MalformedEvents.
 	UpEvents []UpEvent `json:"upEvents"`
+
+	// ProvisioningRetries counts the times the system partially provisioned
+	// and then lost all readiness again before ever being up.
+	ProvisioningRetries int `json:"provisioningRetries,omitempty"`
+	// ProvisioningPartial is set while the system is partially ready before
+	// ever being up.
+	ProvisioningPartial bool `json:"provisioningPartial,omitempty"`
+
+	// DegradedEvents record when the system became degraded (up, but with
+	// unhealthy accelerators, see Upness.Degraded) and when it stopped being
+	// degraded, either by recovering or by going down.
+	DegradedEvents []DegradedEvent `json:"degradedEvents,omitempty"`
+
+	// Compacted carries forward the events that were compacted away, see
+	// Compact. UpEvents and DegradedEvents continue where it leaves off.
+	Compacted *CompactedEvents `json:"compacted,omitempty"`
+}
+
+type DegradedEvent struct {
+	Degraded  bool      `json:"degraded"`
+	Timestamp time.Time `json:"ts"`
+}
+
+// degraded returns whether the system is currently recorded as degraded.
+func (r *EventRecords) degraded() bool {
+	n := len(r.DegradedEvents)
+	return n > 0 && r.DegradedEvents[n-1].Degraded
 }
 
 type UpEvent struct {
 	Up        bool      `json:"up"`
 	Timestamp time.Time `json:"ts"`
+
+	// LastCheckpoint is the last checkpoint time reported by the workload
+	// when the event was recorded (only set on down events).
+	LastCheckpoint *time.Time `json:"lastCheckpoint,omitempty"`
+	// Step is the training step reported by the workload when the event was
+	// recorded (only set on down events).
+	Step *int64 `json:"step,omitempty"`
+
+	// Backfilled is set on events reconstructed from historical data (see
+	// BackfillEvents) rather than observed live.
+	Backfilled bool `json:"backfilled,omitempty"`
+
+	// Severity classifies the interruption (only set on down events of
+	// entities with a designated coordinator).
+	Severity Severity `json:"severity,omitempty"`
+
+	// Degraded is set on down events that interrupted a degraded system,
+	// i.e. interruptions that accelerator health signals preceded.
+	Degraded bool `json:"degraded,omitempty"`
+
+	// Cause is the likely cause of the interruption (only set on down events
+	// that were correlated with one, see ReconcileOptions.AttributeCause).
+	Cause *InterruptionCause `json:"cause,omitempty"`
 }
 
+// InterruptionCause is the likely cause of an interruption: a Node that the
+// entity ran on went down at about the same time.
+type InterruptionCause struct {
+	Node     string `json:"node"`
+	NodePool string `json:"nodePool,omitempty"`
+}
+
+// Severity classifies an interruption by the part of the workload that went
+// down.
+type Severity string
+
+const (
+	// SeverityWorker is an interruption of workers only, with the
+	// coordinator still running.
+	SeverityWorker Severity = "worker"
+	// SeverityCoordinator is an interruption of the coordinator (head),
+	// which typically means a restart of the whole workload.
+	SeverityCoordinator Severity = "coordinator"
+)
+
 type UpnessSummaryWithAttrs struct {
 	Attrs
 	EventSummary
@@ -23,16 +100,35 @@ type UpnessSummaryWithAttrs struct {
 type EventSummary struct {
 	// DownTimeInitial is the time spent before the system was up.
 	DownTimeInitial time.Duration `json:"downTimeProvisioned"`
+	// DownTimeUnprovisioned is the part of DownTime after the system was
+	// first up, i.e. the time lost to interruptions rather than to
+	// provisioning.
+	DownTimeUnprovisioned time.Duration `json:"downTimeUnprovisioned"`
 
 	// InterruptionCount is the number of times that the system has gone down after being up.
 	InterruptionCount int `json:"interruptionCount"`
 	// RecoveryCount is the number of times that the system has recovered from a down state.
 	RecoveryCount int `json:"recoveryCount"`
+	// CoordinatorInterruptionCount is the number of interruptions with
+	// SeverityCoordinator, included in InterruptionCount.
+	CoordinatorInterruptionCount int `json:"coordinatorInterruptionCount"`
+	// DegradedInterruptionCount is the number of interruptions of a degraded
+	// system, included in InterruptionCount.
+	DegradedInterruptionCount int `json:"degradedInterruptionCount"`
+	// NodeInterruptionCount is the number of interruptions attributed to a
+	// Node going down (see UpEvent.Cause), included in InterruptionCount.
+	NodeInterruptionCount int `json:"nodeInterruptionCount"`
 
 	// DownTime is the total time spent in the down state.
 	DownTime time.Duration `json:"downTime"`
 	// UpTime is the total time spent in an up state.
 	UpTime time.Duration `json:"upTime"`
+	// EffectiveUpTime is UpTime without the settle period after each
+	// recovery (see SummaryOptions.SettlePeriod), i.e. the productive time.
+	EffectiveUpTime time.Duration `json:"effectiveUpTime"`
+	// DegradedTime is the part of UpTime spent degraded, see
+	// EventRecords.DegradedEvents.
+	DegradedTime time.Duration `json:"degradedTime"`
 
 	TotalDownTimeBetweenRecovery time.Duration `json:"totalDownTimeBetweenRecovery"`
 	// TotalUpTimeBetweenInterruption - Total Time Between Interruption
@@ -43,62 +139,491 @@ type EventSummary struct {
 	// LatestUpTimeBetweenInterruption - Last Time Between Interruption
 	LatestUpTimeBetweenInterruption time.Duration `json:"latestUpTimeBetweenInterruption"`
 
-	// MeanDownTimeBetweenRecovery - Mean Time To Recovery
+	// MeanDownTimeBetweenRecovery - Mean Time To Recovery, i.e. the MTTR.
+	// Only completed recoveries (RecoveryCount) are included, so an ongoing
+	// down interval does not count until the entity is up again.
 	MeanDownTimeBetweenRecovery time.Duration `json:"meanDownTimeBetweenRecovery"`
-	// MeanUpTimeBetweenInterruption - Mean Time Between Interruption
+	// MeanUpTimeBetweenInterruption - Mean Time Between Interruption, i.e.
+	// the MTBF (failures being interruptions, see InterruptionCount).
 	MeanUpTimeBetweenInterruption time.Duration `json:"meanUpTimeBetweenInterruption"`
+
+	// The percentiles of the completed intervals are not skewed by outliers
+	// like the means. They are nearest-rank percentiles, i.e. always one of
+	// the intervals, so with a single interval they are all equal to it.
+	P50DownTimeBetweenRecovery   time.Duration `json:"p50DownTimeBetweenRecovery"`
+	P90DownTimeBetweenRecovery   time.Duration `json:"p90DownTimeBetweenRecovery"`
+	P99DownTimeBetweenRecovery   time.Duration `json:"p99DownTimeBetweenRecovery"`
+	P50UpTimeBetweenInterruption time.Duration `json:"p50UpTimeBetweenInterruption"`
+	P90UpTimeBetweenInterruption time.Duration `json:"p90UpTimeBetweenInterruption"`
+	P99UpTimeBetweenInterruption time.Duration `json:"p99UpTimeBetweenInterruption"`
+
+	// DownTimeBetweenRecoveryDurations and UpTimeBetweenInterruptionDurations
+	// are the individual completed intervals that the totals and means are
+	// computed from, oldest first, e.g. for histograms. Compacted intervals
+	// come first, approximated and shortest first (except the first up
+	// interval), see DurationSketch. They grow with the number of
+	// interruptions, so they are not included in reports.
+	DownTimeBetweenRecoveryDurations   []time.Duration `json:"-"`
+	UpTimeBetweenInterruptionDurations []time.Duration `json:"-"`
+
+	// The duration-weighted means weight each interval by its own length
+	// (sum(d^2) / sum(d)), i.e. the expected length of the interval that a
+	// randomly chosen moment falls into. Unlike the arithmetic means above,
+	// they are dominated by long intervals and are insensitive to many short
+	// blips.
+	WeightedMeanDownTimeBetweenRecovery   time.Duration `json:"weightedMeanDownTimeBetweenRecovery"`
+	WeightedMeanUpTimeBetweenInterruption time.Duration `json:"weightedMeanUpTimeBetweenInterruption"`
+
+	// MeanLostWorkPerInterruption is the mean time between the last checkpoint
+	// and the interruption, across interruptions with a known checkpoint.
+	MeanLostWorkPerInterruption time.Duration `json:"meanLostWorkPerInterruption"`
+
+	// Availability is the fraction of time spent up (0 to 1).
+	Availability float64 `json:"availability"`
+	// OutageDownTime is the part of DownTime that fell within global outages
+	// (see SummaryOptions.Outages), which is excluded from Availability.
+	OutageDownTime time.Duration `json:"outageDownTime"`
+
+	// CurrentUpStreak is the time since the last recovery (or initial up),
+	// if the system is currently up. Zero when down.
+	CurrentUpStreak time.Duration `json:"currentUpStreak"`
+	// Down is set when the last recorded event is down, i.e. the system is
+	// currently down (including while provisioning), as opposed to the
+	// cumulative DownTime.
+	Down bool `json:"down"`
+
+	// RecoveryTrend is the least-squares slope of the most recent recovery
+	// times (up to RecoveryTrendWindow), i.e. the average change in recovery
+	// time from one recovery to the next. It is positive when recoveries are
+	// getting slower and negative when they are getting faster. Zero with
+	// fewer than two recoveries.
+	RecoveryTrend time.Duration `json:"recoveryTrend"`
+
+	// SLO is the effective SLO the error budget fields are computed for.
+	SLO SLO `json:"slo"`
+	// ErrorBudgetRemaining is the fraction of the SLO window's error budget
+	// that is left (negative once exceeded). Zero without an SLO.
+	ErrorBudgetRemaining float64 `json:"errorBudgetRemaining"`
+	// ErrorBudgetRemainingTime is the downtime left before the error budget
+	// is exceeded (negative once exceeded). Zero without an SLO.
+	ErrorBudgetRemainingTime time.Duration `json:"errorBudgetRemainingTime"`
+	// BurnRate is the rate at which the error budget was consumed over the
+	// SLO window (or the lifetime, if shorter), relative to the rate that
+	// would exactly exhaust it at the end of the window. Zero without an SLO.
+	BurnRate float64 `json:"burnRate"`
+
+	// Lifetime is the time since the first recorded event.
+	Lifetime time.Duration `json:"lifetime"`
+	// InterruptionsPerDay is InterruptionCount normalized over the Lifetime,
+	// in interruptions per day. Zero for lifetimes shorter than
+	// MinInterruptionRateLifetime, which would give meaninglessly high rates.
+	InterruptionsPerDay float64 `json:"interruptionsPerDay"`
+	// InterruptionsPerHour is InterruptionCount normalized over the UpTime,
+	// in interruptions per hour of being up, so that it can be alerted on
+	// regardless of how long the system has been running. Zero for uptimes
+	// shorter than MinInterruptionRateUpTime, which would give meaninglessly
+	// high rates.
+	InterruptionsPerHour float64 `json:"interruptionsPerHour"`
+
+	// ProvisioningRetryCount is the number of failed provisioning attempts
+	// before the system was up for the first time.
+	ProvisioningRetryCount int `json:"provisioningRetryCount"`
+	// ProvisioningStuck is set when the system has never been up and has
+	// been provisioning for longer than SummaryOptions.ProvisioningSLA.
+	ProvisioningStuck bool `json:"provisioningStuck,omitempty"`
+
+	// DataQuality flags events that make the summary less trustworthy.
+	DataQuality DataQuality `json:"dataQuality"`
+
+	// AtRisk is set when the system is likely to be interrupted again, see
+	// AtRiskOptions.
+	AtRisk bool `json:"atRisk"`
+
+	// InterruptionsInWindow is the number of interruptions within the
+	// alerting window. Zero without AlertOptions.
+	InterruptionsInWindow int `json:"interruptionsInWindow"`
+	// Alerting is the latched alert state, see AlertOptions.
+	Alerting bool `json:"alerting"`
 }
 
-func (r *EventRecords) Summarize(now time.Time) EventSummary {
-	var summary EventSummary
+// SummaryOptions tunes how derived summary fields are computed.
+type SummaryOptions struct {
+	// ExcludeProvisioning excludes the initial provisioning time
+	// (DownTimeInitial) from the availability computation. It is still
+	// reported as part of DownTime and DownTimeInitial.
+	ExcludeProvisioning bool
+
+	AtRisk AtRiskOptions
 
-	n := len(r.UpEvents)
-	if n == 0 {
-		return summary
+	Alert AlertOptions
+
+	// SettlePeriod is the time after each recovery that the workload needs
+	// to become productive again (e.g. to reload a checkpoint), which is
+	// not counted towards EffectiveUpTime.
+	SettlePeriod time.Duration
+
+	// SLO is the default SLO, used for entities that do not define their
+	// own (see Upness.SLO).
+	SLO SLO
+
+	// Outages are windows during which a shared dependency (e.g. the
+	// scheduler) was down cluster-wide. Downtime within them is not held
+	// against entities' availability.
+	Outages []Outage
+
+	// ProvisioningSLA is the time within which entities are expected to
+	// come up for the first time, after which they are flagged as
+	// ProvisioningStuck. Zero disables the check.
+	ProvisioningSLA time.Duration
+}
+
+// DataQuality counts the events of an entity that are less trustworthy, so
+// that consumers can discount low-confidence summaries. An event can be
+// counted under more than one issue.
+type DataQuality struct {
+	// BackfilledEvents were reconstructed from historical data.
+	BackfilledEvents int `json:"backfilledEvents"`
+	// SkewedEvents have a timestamp before the previous event, or a last
+	// checkpoint after the event itself.
+	SkewedEvents int `json:"skewedEvents"`
+	// MalformedEvents are out of sequence, repeating the previous state. They
+	// are merged into the state they repeat, which keeps its timestamp, as
+	// ReconcileEvents does when it rewrites the records.
+	MalformedEvents int `json:"malformedEvents"`
+	// Confidence is the fraction of events without any issue (1 without
+	// events).
+	Confidence float64 `json:"confidence"`
+}
+
+// Outage is a global outage window.
+type Outage struct {
+	Start time.Time `json:"start"`
+	// End is zero while the outage is ongoing.
+	End time.Time `json:"end,omitempty"`
+}
+
+// ParseOutages parses comma separated start/end pairs of RFC 3339
+// timestamps, e.g. "2024-01-01T00:00:00Z/2024-01-01T01:30:00Z". An empty end
+// marks an ongoing outage.
+func ParseOutages(s string) ([]Outage, error) {
+	var outages []Outage
+	for _, val := range strings.Split(s, ",") {
+		val = strings.TrimSpace(val)
+		if val == "" {
+			continue
+		}
+		start, end, ok := strings.Cut(val, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid outage %q, expected start/end", val)
+		}
+		var o Outage
+		var err error
+		if o.Start, err = time.Parse(time.RFC3339, start); err != nil {
+			return nil, fmt.Errorf("invalid outage start: %w", err)
+		}
+		if end != "" {
+			if o.End, err = time.Parse(time.RFC3339, end); err != nil {
+				return nil, fmt.Errorf("invalid outage end: %w", err)
+			}
+			if !o.End.After(o.Start) {
+				return nil, fmt.Errorf("outage %q ends before it starts", val)
+			}
+		}
+		outages = append(outages, o)
+	}
+	return outages, nil
+}
+
+// SLO is an availability objective over a trailing window. A zero Target
+// disables error budget reporting.
+type SLO struct {
+	// Target is the objective for the fraction of time up, e.g. 0.99.
+	Target float64 `json:"target,omitempty"`
+	// Window is the trailing window the objective applies to. Zero applies
+	// it to the whole run, i.e. the lifetime of the entity, so that the
+	// error budget grows as the run goes on.
+	Window time.Duration `json:"window,omitempty"`
+}
+
+// Validate returns an error if the SLO has a target but is not usable.
+func (s SLO) Validate() error {
+	if s.Target == 0 {
+		return nil
+	}
+	if s.Target < 0 || s.Target >= 1 {
+		return fmt.Errorf("slo target must be between 0 and 1 (exclusive), got %v", s.Target)
 	}
-	if r.UpEvents[0].Up {
-		// Invalid data.
-		return summary
+	if s.Window < 0 {
+		return fmt.Errorf("slo window must not be negative, got %v", s.Window)
 	}
-	if n == 1 {
-		summary.DownTime = now.Sub(r.UpEvents[0].Timestamp)
-		return summary
+	return nil
+}
+
+// WithDefaults returns the SLO with unset fields taken from d.
+func (s SLO) WithDefaults(d SLO) SLO {
+	if s.Target == 0 {
+		s.Target = d.Target
 	}
-	// Invalid or missing data:
-	if !r.UpEvents[1].Up {
-		return summary
+	if s.Window == 0 {
+		s.Window = d.Window
 	}
+	return s
+}
+
+// AtRiskOptions configures the at-risk classification. An entity is at risk
+// if any of the enabled (non-zero) rules match:
+//
+//   - Short streak: it is up, has been interrupted before, and has been up
+//     for less than MinUpStreak since the last recovery.
+//   - Interruption burst: it was interrupted at least BurstCount times within
+//     the last BurstWindow.
+//   - Slow recovery: its latest recovery took longer than SlowRecovery.
+type AtRiskOptions struct {
+	MinUpStreak time.Duration
 
-	summary.DownTime = r.UpEvents[1].Timestamp.Sub(r.UpEvents[0].Timestamp)
-	summary.DownTimeInitial = r.UpEvents[1].Timestamp.Sub(r.UpEvents[0].Timestamp)
+	BurstCount  int
+	BurstWindow time.Duration
 
-	// up:        ___
-	// down:  ____|
-	// event: 0   1
+	SlowRecovery time.Duration
+}
+
+// AlertOptions configures interruption alerting with hysteresis: an entity
+// starts alerting once it was interrupted more than FireAbove times within
+// the last Window, and only stops once that drops below ClearBelow. The
+// alert state is latched by the Summarizer across summaries. A zero Window
+// disables alerting.
+type AlertOptions struct {
+	Window     time.Duration
+	FireAbove  int
+	ClearBelow int
+}
 
-	if len(r.UpEvents) == 2 {
-		summary.UpTime = now.Sub(r.UpEvents[1].Timestamp)
-		return summary
+// Validate returns an error if the options are inconsistent.
+func (o AlertOptions) Validate() error {
+	if o.Window < 0 {
+		return fmt.Errorf("alert window must not be negative, got %v", o.Window)
+	}
+	if o.FireAbove < 0 || o.ClearBelow < 0 {
+		return fmt.Errorf("alert thresholds must not be negative, got %d and %d", o.FireAbove, o.ClearBelow)
 	}
+	if o.ClearBelow > o.FireAbove {
+		return fmt.Errorf("alert clear threshold %d must not be above the fire threshold %d", o.ClearBelow, o.FireAbove)
+	}
+	return nil
+}
 
-	// up:        _____
-	// down:  ____|   |
-	// event: 0   1   2
-	for i := 2; i < len(r.UpEvents); i++ {
-		if r.UpEvents[i].Up {
+func (r *EventRecords) Summarize(now time.Time) EventSummary {
+	return r.SummarizeWithOptions(now, SummaryOptions{})
+}
+
+func (r *EventRecords) SummarizeWithOptions(now time.Time, opts SummaryOptions) EventSummary {
+	var s Summarizer
+	s.Update(r)
+	return s.Summary(now, opts)
+}
+
+func availability(summary EventSummary, opts SummaryOptions) float64 {
+	downTime := summary.DownTime - summary.OutageDownTime
+	if opts.ExcludeProvisioning {
+		downTime -= summary.DownTimeInitial
+	}
+	total := summary.UpTime + downTime
+	if total <= 0 {
+		return 0
+	}
+	return summary.UpTime.Seconds() / total.Seconds()
+}
+
+// Summarizer computes an EventSummary in a single pass over UpEvents. It can
+// be kept across aggregations and fed only newly appended events via Update,
+// avoiding a full recomputation for long-lived entities.
+type Summarizer struct {
+	// summary holds the totals for all closed intervals.
+	summary EventSummary
+
+	// n counts the events that changed state, from first to last, and
+	// skipped the malformed ones merged into the state they repeat (see
+	// DataQuality.MalformedEvents). tail is the last event fed either way.
+	n       int
+	skipped int
+	first   UpEvent
+	last    UpEvent
+	tail    UpEvent
+
+	totalLostWork time.Duration
+	lostWorkCount int
+
+	// Sums of squared intervals (in seconds^2) for the weighted means.
+	sqDownTimeBetweenRecovery   float64
+	sqUpTimeBetweenInterruption float64
+
+	// interruptions holds the interruption times, for burst detection.
+	interruptions []time.Time
+
+	// events holds all events, for windowed computations.
+	events []UpEvent
+
+	// recentRecoveries holds up to RecoveryTrendWindow of the most recent
+	// recovery times, oldest first.
+	recentRecoveries []time.Duration
+
+	provisioningRetries int
+
+	// degraded are the degraded events of the last Update.
+	degraded []DegradedEvent
+
+	quality       DataQuality
+	flaggedEvents int
+
+	// alerting is the latched alert state, see AlertOptions. It is kept
+	// when the Summarizer starts over.
+	alerting bool
+
+	// compacted are the compacted events the Summarizer started from, if
+	// any. events then starts with the last of them.
+	compacted *CompactedEvents
+}
+
+// Update feeds the events appended to rec since the last call. If rec is
+// not an extension of the previously seen events (e.g. it was rewritten),
+// the Summarizer starts over.
+func (s *Summarizer) Update(rec *EventRecords) {
+	seen := s.n + s.skipped - s.compacted.count()
+	if rec.Compacted.count() != s.compacted.count() || len(rec.UpEvents) < seen ||
+		(seen > 0 && (!sameEvent(rec.firstEvent(), s.first) || !sameEvent(rec.UpEvents[seen-1], s.tail))) {
+		*s = Summarizer{alerting: s.alerting}
+		s.restore(rec.Compacted)
+		seen = 0
+	}
+	for _, e := range rec.UpEvents[seen:] {
+		s.add(e)
+	}
+	s.provisioningRetries = rec.ProvisioningRetries
+	s.degraded = rec.DegradedEvents
+}
+
+// sameEvent also compares whether the events have a Cause, since the cause
+// of the last event can be attributed after it was recorded.
+func sameEvent(a, b UpEvent) bool {
+	return a.Up == b.Up && a.Timestamp.Equal(b.Timestamp) && (a.Cause == nil) == (b.Cause == nil)
+}
+
+func (s *Summarizer) add(e UpEvent) {
+	s.checkQuality(e)
+	s.tail = e
+	if s.n > 0 && e.Up == s.last.Up {
+		// A repeated state is neither a recovery nor an interruption.
+		s.skipped++
+		return
+	}
+	defer func() {
+		if s.n == 0 {
+			s.first = e
+		}
+		s.last = e
+		s.n++
+	}()
+	s.events = append(s.events, UpEvent{Up: e.Up, Timestamp: e.Timestamp})
+
+	switch {
+	case s.n == 0:
+		// Events usually start down, while provisioning. An entity that was
+		// already up when first observed starts up instead, without any
+		// provisioning time:
+		// up:    ____
+		// down:      |
+		// event: 0   1
+	case s.n == 1 && e.Up:
+		// up:        ___
+		// down:  ____|
+		// event: 0   1
+		s.summary.DownTime = e.Timestamp.Sub(s.last.Timestamp)
+		s.summary.DownTimeInitial = e.Timestamp.Sub(s.last.Timestamp)
+	default:
+		// up:        _____
+		// down:  ____|   |
+		// event: 0   1   2
+		if e.Up {
 			// Just transitioned down to up.
-			summary.LatestDownTimeBetweenRecovery = r.UpEvents[i].Timestamp.Sub(r.UpEvents[i-1].Timestamp)
-			summary.DownTime += summary.LatestDownTimeBetweenRecovery
-			summary.TotalDownTimeBetweenRecovery += summary.LatestDownTimeBetweenRecovery
-			summary.RecoveryCount++
+			s.summary.LatestDownTimeBetweenRecovery = e.Timestamp.Sub(s.last.Timestamp)
+			s.summary.DownTime += s.summary.LatestDownTimeBetweenRecovery
+			s.summary.TotalDownTimeBetweenRecovery += s.summary.LatestDownTimeBetweenRecovery
+			s.sqDownTimeBetweenRecovery += squareSeconds(s.summary.LatestDownTimeBetweenRecovery)
+			s.summary.RecoveryCount++
+			s.summary.DownTimeBetweenRecoveryDurations = append(s.summary.DownTimeBetweenRecoveryDurations, s.summary.LatestDownTimeBetweenRecovery)
+			s.recentRecoveries = append(s.recentRecoveries, s.summary.LatestDownTimeBetweenRecovery)
+			if len(s.recentRecoveries) > RecoveryTrendWindow {
+				s.recentRecoveries = s.recentRecoveries[1:]
+			}
 		} else {
 			// Just transitioned up to down.
-			summary.LatestUpTimeBetweenInterruption = r.UpEvents[i].Timestamp.Sub(r.UpEvents[i-1].Timestamp)
-			summary.UpTime += summary.LatestUpTimeBetweenInterruption
-			summary.TotalUpTimeBetweenInterruption += summary.LatestUpTimeBetweenInterruption
-			summary.InterruptionCount++
+			s.summary.LatestUpTimeBetweenInterruption = e.Timestamp.Sub(s.last.Timestamp)
+			s.summary.UpTime += s.summary.LatestUpTimeBetweenInterruption
+			s.summary.TotalUpTimeBetweenInterruption += s.summary.LatestUpTimeBetweenInterruption
+			s.sqUpTimeBetweenInterruption += squareSeconds(s.summary.LatestUpTimeBetweenInterruption)
+			s.summary.InterruptionCount++
+			s.summary.UpTimeBetweenInterruptionDurations = append(s.summary.UpTimeBetweenInterruptionDurations, s.summary.LatestUpTimeBetweenInterruption)
+			if e.Severity == SeverityCoordinator {
+				s.summary.CoordinatorInterruptionCount++
+			}
+			if e.Degraded {
+				s.summary.DegradedInterruptionCount++
+			}
+			if e.Cause != nil {
+				s.summary.NodeInterruptionCount++
+			}
+			s.interruptions = append(s.interruptions, e.Timestamp)
+			if cp := e.LastCheckpoint; cp != nil {
+				s.totalLostWork += lostWork(*cp, s.last.Timestamp, e.Timestamp)
+				s.lostWorkCount++
+			}
 		}
 	}
+}
+
+// checkQuality counts the issues with e, see DataQuality.
+func (s *Summarizer) checkQuality(e UpEvent) {
+	var flagged bool
+	if e.Backfilled {
+		s.quality.BackfilledEvents++
+		flagged = true
+	}
+	if (s.n > 0 && e.Timestamp.Before(s.last.Timestamp)) ||
+		(e.LastCheckpoint != nil && e.LastCheckpoint.After(e.Timestamp)) {
+		s.quality.SkewedEvents++
+		flagged = true
+	}
+	if s.n > 0 && e.Up == s.last.Up {
+		s.quality.MalformedEvents++
+		flagged = true
+	}
+	if flagged {
+		s.flaggedEvents++
+	}
+}
+
+func (s *Summarizer) dataQuality() DataQuality {
+	q := s.quality
+	q.Confidence = 1
+	if n := s.n + s.skipped; n > 0 {
+		q.Confidence = 1 - float64(s.flaggedEvents)/float64(n)
+	}
+	return q
+}
+
+// Summary returns the summary of the events seen so far, with the trailing
+// open interval measured up to now.
+func (s *Summarizer) Summary(now time.Time, opts SummaryOptions) EventSummary {
+	if s.n == 0 {
+		return EventSummary{DataQuality: s.dataQuality()}
+	}
+	summary := s.summary
+	summary.ProvisioningRetryCount = s.provisioningRetries
+	summary.DataQuality = s.dataQuality()
+	summary.Lifetime = now.Sub(s.first.Timestamp)
+	if summary.Lifetime >= MinInterruptionRateLifetime {
+		summary.InterruptionsPerDay = float64(summary.InterruptionCount) / (summary.Lifetime.Hours() / 24)
+	}
 
 	// Calculate means.
 	if summary.InterruptionCount > 0 {
@@ -107,18 +632,443 @@ func (r *EventRecords) Summarize(now time.Time) EventSummary {
 	if summary.RecoveryCount > 0 {
 		summary.MeanDownTimeBetweenRecovery = summary.TotalDownTimeBetweenRecovery / time.Duration(summary.RecoveryCount)
 	}
+	summary.P50DownTimeBetweenRecovery, summary.P90DownTimeBetweenRecovery, summary.P99DownTimeBetweenRecovery = percentiles(summary.DownTimeBetweenRecoveryDurations)
+	summary.P50UpTimeBetweenInterruption, summary.P90UpTimeBetweenInterruption, summary.P99UpTimeBetweenInterruption = percentiles(summary.UpTimeBetweenInterruptionDurations)
+	summary.WeightedMeanUpTimeBetweenInterruption = weightedMean(s.sqUpTimeBetweenInterruption, summary.TotalUpTimeBetweenInterruption)
+	summary.WeightedMeanDownTimeBetweenRecovery = weightedMean(s.sqDownTimeBetweenRecovery, summary.TotalDownTimeBetweenRecovery)
+	summary.RecoveryTrend = slope(s.recentRecoveries)
+	if s.lostWorkCount > 0 {
+		summary.MeanLostWorkPerInterruption = s.totalLostWork / time.Duration(s.lostWorkCount)
+	}
 
 	// Add trailing up/interruption time.
-	lastIdx := len(r.UpEvents) - 1
-	if r.UpEvents[lastIdx].Up {
-		summary.UpTime = summary.UpTime + now.Sub(r.UpEvents[lastIdx].Timestamp)
+	if s.last.Up {
+		summary.UpTime = summary.UpTime + now.Sub(s.last.Timestamp)
+		summary.CurrentUpStreak = now.Sub(s.last.Timestamp)
 	} else {
-		summary.DownTime = summary.DownTime + now.Sub(r.UpEvents[lastIdx].Timestamp)
+		summary.DownTime = summary.DownTime + now.Sub(s.last.Timestamp)
+		summary.Down = true
+	}
+	if summary.UpTime >= MinInterruptionRateUpTime {
+		summary.InterruptionsPerHour = float64(summary.InterruptionCount) / summary.UpTime.Hours()
+	}
+	// Events alternate, so the system was up unless it is still down since
+	// the first event.
+	if s.n > 1 || s.last.Up {
+		summary.DownTimeUnprovisioned = summary.DownTime - summary.DownTimeInitial
+	}
+
+	if len(opts.Outages) > 0 {
+		summary.OutageDownTime = s.outageDownTime(now, opts)
+	}
+	summary.Availability = availability(summary, opts)
+	summary.EffectiveUpTime = s.effectiveUpTime(summary.UpTime, now, opts.SettlePeriod)
+	summary.DegradedTime = degradedTime(s.degraded, now)
+	if s.compacted != nil {
+		summary.DegradedTime += s.compacted.DegradedTime
+	}
+	summary.AtRisk = s.atRisk(summary, now, opts.AtRisk)
+	if opts.ProvisioningSLA > 0 && s.n == 1 && !s.last.Up {
+		summary.ProvisioningStuck = summary.DownTime > opts.ProvisioningSLA
+	}
+	if opts.Alert.Window > 0 {
+		summary.InterruptionsInWindow = s.interruptionsSince(now.Add(-opts.Alert.Window))
+		if summary.InterruptionsInWindow > opts.Alert.FireAbove {
+			s.alerting = true
+		} else if summary.InterruptionsInWindow < opts.Alert.ClearBelow {
+			s.alerting = false
+		}
+		summary.Alerting = s.alerting
+	}
+	if opts.SLO.Target > 0 {
+		summary.SLO = opts.SLO
+		summary.ErrorBudgetRemaining, summary.ErrorBudgetRemainingTime, summary.BurnRate = s.errorBudget(now, opts)
 	}
 
 	return summary
 }
 
+// degradedTime returns the time spent degraded, up to now.
+func degradedTime(events []DegradedEvent, now time.Time) time.Duration {
+	var d time.Duration
+	for i, e := range events {
+		if !e.Degraded {
+			continue
+		}
+		end := now
+		if i+1 < len(events) {
+			end = events[i+1].Timestamp
+		}
+		d += end.Sub(e.Timestamp)
+	}
+	return d
+}
+
+// effectiveUpTime returns upTime without up to settle after each recovery.
+func (s *Summarizer) effectiveUpTime(upTime time.Duration, now time.Time, settle time.Duration) time.Duration {
+	if settle <= 0 {
+		return upTime
+	}
+	// Events alternate, so up events after the first two are recoveries
+	// (whether the first event is down or up), and every up interval but the
+	// first follows one.
+	for i, d := range s.summary.UpTimeBetweenInterruptionDurations {
+		if i > 0 {
+			upTime -= min(settle, d)
+		}
+	}
+	if s.last.Up && s.n > 2 {
+		upTime -= min(settle, now.Sub(s.last.Timestamp))
+	}
+	return upTime
+}
+
+// outageDownTime returns the downtime within the outages. With
+// ExcludeProvisioning, the initial downtime is already excluded and not
+// counted again.
+func (s *Summarizer) outageDownTime(now time.Time, opts SummaryOptions) time.Duration {
+	outages := mergeOutages(opts.Outages, now)
+	var d time.Duration
+	if c := s.compacted; c != nil {
+		d += c.OutageDownTime
+		if opts.ExcludeProvisioning {
+			d -= c.OutageDownTimeInitial
+		}
+	}
+	offset := s.n - len(s.events)
+	for i, e := range s.events {
+		if e.Up || (offset+i == 0 && opts.ExcludeProvisioning) {
+			continue
+		}
+		end := now
+		if i+1 < len(s.events) {
+			end = s.events[i+1].Timestamp
+		}
+		for _, o := range outages {
+			from, to := e.Timestamp, end
+			if o.Start.After(from) {
+				from = o.Start
+			}
+			if o.End.Before(to) {
+				to = o.End
+			}
+			if to.After(from) {
+				d += to.Sub(from)
+			}
+		}
+	}
+	return d
+}
+
+// mergeOutages returns the outages sorted and with overlaps merged, with
+// ongoing outages ending at now.
+func mergeOutages(outages []Outage, now time.Time) []Outage {
+	sorted := make([]Outage, 0, len(outages))
+	for _, o := range outages {
+		if o.End.IsZero() {
+			o.End = now
+		}
+		sorted = append(sorted, o)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+	var merged []Outage
+	for _, o := range sorted {
+		if n := len(merged); n > 0 && !o.Start.After(merged[n-1].End) {
+			if o.End.After(merged[n-1].End) {
+				merged[n-1].End = o.End
+			}
+			continue
+		}
+		merged = append(merged, o)
+	}
+	return merged
+}
+
+// errorBudget returns the remaining error budget, as a fraction and as
+// downtime, and the burn rate over the trailing SLO window, or the whole run
+// without a window.
+func (s *Summarizer) errorBudget(now time.Time, opts SummaryOptions) (remaining float64, remainingTime time.Duration, burnRate float64) {
+	start := s.first.Timestamp
+	window := now.Sub(start)
+	if opts.SLO.Window > 0 {
+		window = opts.SLO.Window
+		if windowStart := now.Add(-window); windowStart.After(start) {
+			start = windowStart
+		}
+	}
+	var down time.Duration
+	end := now
+	offset := s.n - len(s.events)
+	for i := len(s.events) - 1; i >= 0 && end.After(start); i-- {
+		e := s.events[i]
+		from := e.Timestamp
+		if from.Before(start) {
+			from = start
+		}
+		if !e.Up && !(offset+i == 0 && opts.ExcludeProvisioning) && end.After(from) {
+			down += end.Sub(from)
+		}
+		end = e.Timestamp
+	}
+	if c := s.compacted; c != nil && end.After(start) {
+		// The compacted downtime is only known in total.
+		down += c.DownTime
+		if opts.ExcludeProvisioning {
+			down -= c.DownTimeInitial
+		}
+	}
+
+	budget := (1 - opts.SLO.Target) * window.Seconds()
+	remaining = 1
+	if budget > 0 {
+		remaining = 1 - down.Seconds()/budget
+	}
+	remainingTime = time.Duration((budget - down.Seconds()) * float64(time.Second))
+	if elapsed := now.Sub(start).Seconds(); elapsed > 0 {
+		burnRate = down.Seconds() / elapsed / (1 - opts.SLO.Target)
+	}
+	return remaining, remainingTime, burnRate
+}
+
+func (s *Summarizer) atRisk(summary EventSummary, now time.Time, opts AtRiskOptions) bool {
+	if opts.MinUpStreak > 0 && s.last.Up && summary.InterruptionCount > 0 &&
+		summary.CurrentUpStreak < opts.MinUpStreak {
+		return true
+	}
+	if opts.BurstCount > 0 && opts.BurstWindow > 0 &&
+		s.interruptionsSince(now.Add(-opts.BurstWindow)) >= opts.BurstCount {
+		return true
+	}
+	if opts.SlowRecovery > 0 && summary.LatestDownTimeBetweenRecovery > opts.SlowRecovery {
+		return true
+	}
+	return false
+}
+
+// interruptionsSince returns the number of interruptions at or after since.
+func (s *Summarizer) interruptionsSince(since time.Time) int {
+	i := sort.Search(len(s.interruptions), func(i int) bool {
+		return !s.interruptions[i].Before(since)
+	})
+	return len(s.interruptions) - i
+}
+
+// RecentInterruptions returns the times of up to n of the most recent
+// interruptions (transitions from up to down), newest first.
+func (r *EventRecords) RecentInterruptions(n int) []time.Time {
+	var times []time.Time
+	for i := len(r.UpEvents) - 1; i >= 0 && len(times) < n; i-- {
+		if r.interruption(i) {
+			times = append(times, r.UpEvents[i].Timestamp)
+		}
+	}
+	return times
+}
+
+// Incidents returns the start times of the distinct incidents across layers
+// of the same entity (e.g. a JobSet and its Nodes), oldest first. An
+// interruption of a layer within window of the start of an incident that the
+// layer has not yet been interrupted in is attributed to that incident. A zero
+// window counts every interruption as an incident. Compacted interruptions
+// are not included.
+func Incidents(window time.Duration, layers ...EventRecords) []time.Time {
+	type interruption struct {
+		at    time.Time
+		layer int
+	}
+	var all []interruption
+	for layer, rec := range layers {
+		for i := range rec.UpEvents {
+			if rec.interruption(i) {
+				all = append(all, interruption{at: rec.UpEvents[i].Timestamp, layer: layer})
+			}
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].at.Before(all[j].at) })
+
+	var incidents []time.Time
+	var inIncident map[int]bool
+	for _, in := range all {
+		if window > 0 && len(incidents) > 0 && !inIncident[in.layer] && in.at.Sub(incidents[len(incidents)-1]) <= window {
+			inIncident[in.layer] = true
+			continue
+		}
+		incidents = append(incidents, in.at)
+		inIncident = map[int]bool{in.layer: true}
+	}
+	return incidents
+}
+
+// SummarizeFleet rolls up the JobSet and JobSet Nodes event records, keyed by
+// JobSet UID. Correlated interruptions of both layers within window are
+// counted as a single incident.
+func SummarizeFleet(jobSetEvents, jobSetNodeEvents map[string]EventRecords, window time.Duration) FleetSummary {
+	var fleet FleetSummary
+	add := func(key string) {
+		js, nodes := jobSetEvents[key], jobSetNodeEvents[key]
+		fleet.IncidentCount += len(Incidents(window, js, nodes))
+		fleet.InterruptionCount += len(Incidents(0, js, nodes))
+		// Compacted interruptions are only known in total, and are assumed
+		// to be correlated across the layers.
+		fleet.IncidentCount += max(js.Compacted.interruptionCount(), nodes.Compacted.interruptionCount())
+		fleet.InterruptionCount += js.Compacted.interruptionCount() + nodes.Compacted.interruptionCount()
+	}
+	for key := range jobSetEvents {
+		add(key)
+	}
+	for key := range jobSetNodeEvents {
+		if _, ok := jobSetEvents[key]; !ok {
+			add(key)
+		}
+	}
+	return fleet
+}
+
+// RollUp combines the summaries of the parts of an entity, e.g. the
+// replicated Jobs of a JobSet, into a single summary. Counts and durations
+// are summed, so a rolled up interruption is one interruption of any part,
+// and the means and percentiles are recomputed across the parts.
+// Lifetime is summed too, so that UpTime and DownTime still add up to it and
+// rates, e.g. InterruptionsPerDay, are per day of any part. Availability is
+// the mean of the parts weighted by their Lifetime. The entity is at risk or
+// alerting if any part is.
+func RollUp(summaries ...EventSummary) EventSummary {
+	var out EventSummary
+	var weightedAvailability, lifetimes float64
+	for _, s := range summaries {
+		out.DownTimeInitial += s.DownTimeInitial
+		out.DownTimeUnprovisioned += s.DownTimeUnprovisioned
+		out.InterruptionCount += s.InterruptionCount
+		out.RecoveryCount += s.RecoveryCount
+		out.CoordinatorInterruptionCount += s.CoordinatorInterruptionCount
+		out.DegradedInterruptionCount += s.DegradedInterruptionCount
+		out.NodeInterruptionCount += s.NodeInterruptionCount
+		out.ProvisioningRetryCount += s.ProvisioningRetryCount
+		out.DownTime += s.DownTime
+		out.UpTime += s.UpTime
+		out.EffectiveUpTime += s.EffectiveUpTime
+		out.DegradedTime += s.DegradedTime
+		out.OutageDownTime += s.OutageDownTime
+		out.TotalDownTimeBetweenRecovery += s.TotalDownTimeBetweenRecovery
+		out.TotalUpTimeBetweenInterruption += s.TotalUpTimeBetweenInterruption
+		out.DownTimeBetweenRecoveryDurations = append(out.DownTimeBetweenRecoveryDurations, s.DownTimeBetweenRecoveryDurations...)
+		out.UpTimeBetweenInterruptionDurations = append(out.UpTimeBetweenInterruptionDurations, s.UpTimeBetweenInterruptionDurations...)
+		out.Lifetime += s.Lifetime
+		out.AtRisk = out.AtRisk || s.AtRisk
+		out.Alerting = out.Alerting || s.Alerting
+		weightedAvailability += s.Availability * s.Lifetime.Seconds()
+		lifetimes += s.Lifetime.Seconds()
+	}
+	if out.RecoveryCount > 0 {
+		out.MeanDownTimeBetweenRecovery = out.TotalDownTimeBetweenRecovery / time.Duration(out.RecoveryCount)
+	}
+	if out.InterruptionCount > 0 {
+		out.MeanUpTimeBetweenInterruption = out.TotalUpTimeBetweenInterruption / time.Duration(out.InterruptionCount)
+	}
+	out.P50DownTimeBetweenRecovery, out.P90DownTimeBetweenRecovery, out.P99DownTimeBetweenRecovery = percentiles(out.DownTimeBetweenRecoveryDurations)
+	out.P50UpTimeBetweenInterruption, out.P90UpTimeBetweenInterruption, out.P99UpTimeBetweenInterruption = percentiles(out.UpTimeBetweenInterruptionDurations)
+	if lifetimes > 0 {
+		out.Availability = weightedAvailability / lifetimes
+	}
+	if out.Lifetime >= MinInterruptionRateLifetime {
+		out.InterruptionsPerDay = float64(out.InterruptionCount) / (out.Lifetime.Hours() / 24)
+	}
+	if out.UpTime >= MinInterruptionRateUpTime {
+		out.InterruptionsPerHour = float64(out.InterruptionCount) / out.UpTime.Hours()
+	}
+	return out
+}
+
+// InterruptionsByStepRange counts interruptions with a known training step
+// by step range, keyed by the first step of each range of the given width.
+func (r *EventRecords) InterruptionsByStepRange(width int64) map[int64]int {
+	counts := map[int64]int{}
+	if width <= 0 {
+		return counts
+	}
+	for i, e := range r.UpEvents {
+		if !r.interruption(i) || e.Step == nil {
+			continue
+		}
+		counts[*e.Step/width*width]++
+	}
+	return counts
+}
+
+// MinInterruptionRateLifetime is the minimum Lifetime for which
+// EventSummary.InterruptionsPerDay is computed.
+const MinInterruptionRateLifetime = time.Hour
+
+// MinInterruptionRateUpTime is the minimum UpTime for which
+// EventSummary.InterruptionsPerHour is computed.
+const MinInterruptionRateUpTime = time.Hour
+
+// RecoveryTrendWindow is the number of most recent recoveries that
+// EventSummary.RecoveryTrend is computed over.
+const RecoveryTrendWindow = 5
+
+// slope returns the least-squares slope of ds against their index.
+func slope(ds []time.Duration) time.Duration {
+	n := float64(len(ds))
+	if n < 2 {
+		return 0
+	}
+	var sumX, sumY float64
+	for i, d := range ds {
+		sumX += float64(i)
+		sumY += float64(d)
+	}
+	meanX, meanY := sumX/n, sumY/n
+	var num, den float64
+	for i, d := range ds {
+		dx := float64(i) - meanX
+		num += dx * (float64(d) - meanY)
+		den += dx * dx
+	}
+	return time.Duration(num / den)
+}
+
+// percentiles returns the nearest-rank 50th, 90th and 99th percentiles of
+// ds, or zero if ds is empty.
+func percentiles(ds []time.Duration) (p50, p90, p99 time.Duration) {
+	if len(ds) == 0 {
+		return 0, 0, 0
+	}
+	sorted := append([]time.Duration(nil), ds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := func(percent int) time.Duration {
+		// The smallest value with at least percent of the values at or
+		// below it, i.e. at rank ceil(percent/100 * n).
+		return sorted[(percent*len(sorted)+99)/100-1]
+	}
+	return rank(50), rank(90), rank(99)
+}
+
+func squareSeconds(d time.Duration) float64 {
+	return d.Seconds() * d.Seconds()
+}
+
+func weightedMean(sumSq float64, total time.Duration) time.Duration {
+	if total <= 0 {
+		return 0
+	}
+	return time.Duration(sumSq / total.Seconds() * float64(time.Second))
+}
+
+// lostWork returns the work lost by an interruption at interruptedAt given
+// the last checkpoint. Only the current up-period (starting at upAt) can be
+// lost, so older checkpoints are clamped to upAt. A checkpoint after the
+// interruption (clock skew or a bad annotation) counts as no lost work.
+func lostWork(checkpoint, upAt, interruptedAt time.Time) time.Duration {
+	if checkpoint.Before(upAt) {
+		checkpoint = upAt
+	}
+	if checkpoint.After(interruptedAt) {
+		return 0
+	}
+	return interruptedAt.Sub(checkpoint)
+}
+
 func AppendUpEvent(now time.Time, rec *EventRecords, isUp bool) bool {
 	var changed bool
 	if len(rec.UpEvents) == 0 {
@@ -139,12 +1089,206 @@ func AppendUpEvent(now time.Time, rec *EventRecords, isUp bool) bool {
 	return changed
 }
 
+// dedupUpEvents drops the events of rec that repeat the state of the
+// preceding event, e.g. from duplicate reconciles of older versions, keeping
+// the first event of every run since that is when the state began. It returns
+// whether rec changed.
+func dedupUpEvents(rec *EventRecords) bool {
+	var out []UpEvent
+	for i, e := range rec.UpEvents {
+		if i > 0 && e.Up == rec.UpEvents[i-1].Up {
+			if out == nil {
+				out = append([]UpEvent(nil), rec.UpEvents[:i]...)
+			}
+			continue
+		}
+		if out != nil {
+			out = append(out, e)
+		}
+	}
+	if out == nil {
+		return false
+	}
+	rec.UpEvents = out
+	return true
+}
+
+// BackfillEvents prepends historical events that predate the recorded ones.
+// History that overlaps the existing records is ignored. Zero-length states
+// at the seam (e.g. the down/up pair recorded when megamon first observed an
+// already-up entity) and repeated states are dropped so the result alternates.
+// Compacted records are not backfilled, since their history is only known in
+// total.
+func BackfillEvents(rec *EventRecords, history []UpEvent) bool {
+	if rec.Compacted != nil {
+		return false
+	}
+	var older []UpEvent
+	for _, e := range history {
+		if len(rec.UpEvents) > 0 && !e.Timestamp.Before(rec.UpEvents[0].Timestamp) {
+			break
+		}
+		if len(older) == 0 && e.Up {
+			// History always starts in the down state.
+			continue
+		}
+		e.Backfilled = true
+		older = append(older, e)
+	}
+	if len(older) == 0 {
+		return false
+	}
+
+	merged := append(older, rec.UpEvents...)
+	out := make([]UpEvent, 0, len(merged))
+	for i, e := range merged {
+		if i > 0 && i+1 < len(merged) && merged[i+1].Timestamp.Equal(e.Timestamp) {
+			continue
+		}
+		if len(out) > 0 && out[len(out)-1].Up == e.Up {
+			continue
+		}
+		out = append(out, e)
+	}
+	rec.UpEvents = out
+	return true
+}
+
+// trackProvisioning counts provisioning retries: partial readiness followed by
+// no readiness at all, before the first up event.
+func trackProvisioning(rec *EventRecords, up Upness) bool {
+	// Events alternate, so the system has been up if events were compacted.
+	beenUp := rec.Compacted != nil
+	for _, e := range rec.UpEvents {
+		beenUp = beenUp || e.Up
+	}
+	if beenUp {
+		if rec.ProvisioningPartial {
+			rec.ProvisioningPartial = false
+			return true
+		}
+		return false
+	}
+
+	switch {
+	case up.ReadyCount > 0 && !rec.ProvisioningPartial:
+		rec.ProvisioningPartial = true
+		return true
+	case up.ReadyCount == 0 && rec.ProvisioningPartial:
+		rec.ProvisioningPartial = false
+		rec.ProvisioningRetries++
+		return true
+	}
+	return false
+}
+
+// trackDegraded records the start and end of degraded periods. Only an up
+// system can be degraded, so going down ends the period.
+func trackDegraded(now time.Time, rec *EventRecords, up Upness) bool {
+	n := len(rec.UpEvents)
+	degraded := up.Degraded && n > 0 && rec.UpEvents[n-1].Up
+	if degraded == rec.degraded() {
+		return false
+	}
+	rec.DegradedEvents = append(rec.DegradedEvents, DegradedEvent{Degraded: degraded, Timestamp: now})
+	return true
+}
+
+// ReconcileOptions tunes how events are recorded.
+type ReconcileOptions struct {
+	// MinStateChangeInterval debounces entities that oscillate around their
+	// readiness threshold: a state change is only recorded once at least
+	// this long has passed since the previous one. Until then, the entity
+	// keeps its recorded state. The initial events are never delayed.
+	MinStateChangeInterval time.Duration
+
+	// InitializeFromObserved starts the records of entities that have none
+	// in their observed state instead of down. This is meant for the first
+	// reconcile after startup, when an entity that is already up has been
+	// so since before megamon observed it: its records start with an up
+	// event rather than a provisioning window at the process start.
+	InitializeFromObserved bool
+
+	// AttributeCause, if set, is called to find the cause of an entity's
+	// interruption (see UpEvent.Cause) while the entity is still down and
+	// the interruption is at most CauseWindow old, so that causes observed
+	// shortly after the interruption itself are attributed as well. It
+	// returns nil if the cause is unknown.
+	AttributeCause func(key string, at time.Time) *InterruptionCause
+	CauseWindow    time.Duration
+
+	// Retention, if set, compacts the events older than Retention, see
+	// Compact. The compacted downtime within Outages is carried forward.
+	Retention time.Duration
+	Outages   []Outage
+}
+
+// attributeCause sets the Cause of the ongoing interruption of rec, see
+// ReconcileOptions.AttributeCause.
+func attributeCause(now time.Time, key string, rec *EventRecords, opts ReconcileOptions) bool {
+	n := len(rec.UpEvents)
+	// The initial down event is provisioning, not an interruption.
+	if opts.AttributeCause == nil || rec.EventCount() < 2 {
+		return false
+	}
+	last := &rec.UpEvents[n-1]
+	if last.Up || last.Cause != nil || now.Sub(last.Timestamp) > opts.CauseWindow {
+		return false
+	}
+	last.Cause = opts.AttributeCause(key, last.Timestamp)
+	return last.Cause != nil
+}
+
 func ReconcileEvents(now time.Time, ups map[string]Upness, events map[string]EventRecords) bool {
+	return ReconcileEventsWithOptions(now, ups, events, ReconcileOptions{})
+}
+
+func ReconcileEventsWithOptions(now time.Time, ups map[string]Upness, events map[string]EventRecords, opts ReconcileOptions) bool {
 	var changed bool
 
 	for key, up := range ups {
 		rec := events[key]
-		if AppendUpEvent(now, &rec, up.Up()) {
+		if up.Pending && len(rec.UpEvents) == 0 {
+			continue
+		}
+		recChanged := dedupUpEvents(&rec)
+		n := len(rec.UpEvents)
+		if n == 0 && opts.InitializeFromObserved && up.Up() {
+			rec.UpEvents = append(rec.UpEvents, UpEvent{Up: true, Timestamp: now})
+			recChanged = true
+		}
+		// Only the uncompacted events tell whether the previous state change
+		// was recent.
+		debounced := n > 1 && now.Sub(rec.UpEvents[n-1].Timestamp) < opts.MinStateChangeInterval
+		if !debounced && AppendUpEvent(now, &rec, up.Up()) {
+			last := &rec.UpEvents[len(rec.UpEvents)-1]
+			if !last.Up && !up.LastCheckpoint.IsZero() {
+				cp := up.LastCheckpoint
+				last.LastCheckpoint = &cp
+			}
+			if !last.Up && up.Step != nil {
+				step := *up.Step
+				last.Step = &step
+			}
+			if !last.Up {
+				last.Severity = up.Severity
+				last.Degraded = rec.degraded()
+			}
+			recChanged = true
+		}
+		if trackProvisioning(&rec, up) {
+			recChanged = true
+		}
+		if trackDegraded(now, &rec, up) {
+			recChanged = true
+		}
+		if attributeCause(now, key, &rec, opts) {
+			recChanged = true
+		}
+		if opts.Retention > 0 && Compact(&rec, now.Add(-opts.Retention), opts.Outages) {
+			recChanged = true
+		}
+		if recChanged {
 			events[key] = rec
 			changed = true
 		}
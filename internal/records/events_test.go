@@ -1,6 +1,9 @@
 package records
 
 import (
+	"encoding/json"
+	"slices"
+	"sort"
 	"testing"
 	"time"
 
@@ -23,13 +26,62 @@ func TestSummarize(t *testing.T) {
 			records:         EventRecords{},
 			expectedSummary: EventSummary{},
 		},
-		"missing down0": {
+		"initially up": {
 			records: EventRecords{
+				// An entity that was already up when first observed.
+				// up:    _____
+				// down:
+				// event: 0
+				// hrs:     1
 				UpEvents: []UpEvent{
 					{Up: true, Timestamp: t0},
 				},
 			},
-			expectedSummary: EventSummary{},
+			now: t0.Add(time.Hour),
+			expectedSummary: EventSummary{
+				UpTime: time.Hour,
+			},
+		},
+		"initially up, interrupted and recovered": {
+			records: EventRecords{
+				// up:    _____     _____
+				// down:       |___|
+				// event: 0    1   2
+				// hrs:     2    1   1
+				UpEvents: []UpEvent{
+					{Up: true, Timestamp: t0},
+					{Up: false, Timestamp: t0.Add(2 * time.Hour)},
+					{Up: true, Timestamp: t0.Add(3 * time.Hour)},
+				},
+			},
+			now: t0.Add(4 * time.Hour),
+			expectedSummary: EventSummary{
+				UpTime:                          3 * time.Hour,
+				DownTime:                        time.Hour,
+				InterruptionCount:               1,
+				RecoveryCount:                   1,
+				TotalDownTimeBetweenRecovery:    time.Hour,
+				MeanDownTimeBetweenRecovery:     time.Hour,
+				LatestDownTimeBetweenRecovery:   time.Hour,
+				TotalUpTimeBetweenInterruption:  2 * time.Hour,
+				MeanUpTimeBetweenInterruption:   2 * time.Hour,
+				LatestUpTimeBetweenInterruption: 2 * time.Hour,
+				InterruptionsPerDay:             6,
+				InterruptionsPerHour:            1.0 / 3,
+			},
+		},
+		"initially up, repeated up": {
+			// The repeated state is merged into the first one.
+			records: EventRecords{
+				UpEvents: []UpEvent{
+					{Up: true, Timestamp: t0},
+					{Up: true, Timestamp: t0.Add(time.Hour)},
+				},
+			},
+			now: t0.Add(2 * time.Hour),
+			expectedSummary: EventSummary{
+				UpTime: 2 * time.Hour,
+			},
 		},
 		"not up yet": {
 			records: EventRecords{
@@ -101,6 +153,8 @@ func TestSummarize(t *testing.T) {
 				UpTime:                          time.Hour,
 				DownTime:                        time.Hour,
 				InterruptionCount:               1,
+				InterruptionsPerDay:             1 * 24.0 / 2,
+				InterruptionsPerHour:            1,
 				TotalUpTimeBetweenInterruption:  time.Hour,
 				MeanUpTimeBetweenInterruption:   time.Hour,
 				LatestUpTimeBetweenInterruption: time.Hour,
@@ -126,6 +180,8 @@ func TestSummarize(t *testing.T) {
 				UpTime:                          time.Hour,
 				DownTime:                        2 * time.Hour,
 				InterruptionCount:               1,
+				InterruptionsPerDay:             1 * 24.0 / 3,
+				InterruptionsPerHour:            1,
 				TotalUpTimeBetweenInterruption:  time.Hour,
 				MeanUpTimeBetweenInterruption:   time.Hour,
 				LatestUpTimeBetweenInterruption: time.Hour,
@@ -153,6 +209,8 @@ func TestSummarize(t *testing.T) {
 				UpTime:                          time.Hour,
 				DownTime:                        2 * time.Hour,
 				InterruptionCount:               1,
+				InterruptionsPerDay:             1 * 24.0 / 3,
+				InterruptionsPerHour:            1,
 				RecoveryCount:                   1,
 				TotalDownTimeBetweenRecovery:    time.Hour,
 				MeanDownTimeBetweenRecovery:     time.Hour,
@@ -184,6 +242,8 @@ func TestSummarize(t *testing.T) {
 				UpTime:                          2 * time.Hour,
 				DownTime:                        2 * time.Hour,
 				InterruptionCount:               1,
+				InterruptionsPerDay:             1 * 24.0 / 4,
+				InterruptionsPerHour:            1.0 / 2,
 				RecoveryCount:                   1,
 				TotalDownTimeBetweenRecovery:    time.Hour,
 				MeanDownTimeBetweenRecovery:     time.Hour,
@@ -217,6 +277,8 @@ func TestSummarize(t *testing.T) {
 				UpTime:                          time.Hour + 2*time.Hour,
 				DownTime:                        2 * time.Hour,
 				InterruptionCount:               2,
+				InterruptionsPerDay:             2 * 24.0 / 5,
+				InterruptionsPerHour:            2.0 / 3,
 				RecoveryCount:                   1,
 				TotalDownTimeBetweenRecovery:    time.Hour,
 				MeanDownTimeBetweenRecovery:     time.Hour,
@@ -250,6 +312,8 @@ func TestSummarize(t *testing.T) {
 				UpTime:                          time.Hour + 2*time.Hour,
 				DownTime:                        time.Hour + time.Hour + 3*time.Hour,
 				InterruptionCount:               2,
+				InterruptionsPerDay:             2 * 24.0 / 8,
+				InterruptionsPerHour:            2.0 / 3,
 				RecoveryCount:                   1,
 				TotalDownTimeBetweenRecovery:    1 * time.Hour,
 				MeanDownTimeBetweenRecovery:     1 * time.Hour,
@@ -285,6 +349,8 @@ func TestSummarize(t *testing.T) {
 				UpTime:                          time.Hour + 2*time.Hour,
 				DownTime:                        time.Hour + time.Hour + 3*time.Hour,
 				InterruptionCount:               2,
+				InterruptionsPerDay:             2 * 24.0 / 8,
+				InterruptionsPerHour:            2.0 / 3,
 				RecoveryCount:                   2,
 				TotalDownTimeBetweenRecovery:    time.Hour + 3*time.Hour,
 				MeanDownTimeBetweenRecovery:     2 * time.Hour,
@@ -294,6 +360,108 @@ func TestSummarize(t *testing.T) {
 				LatestUpTimeBetweenInterruption: 2 * time.Hour,
 			},
 		},
+		"two interruptions with checkpoints": {
+			// up:         _____   _____
+			// down:   ____|   |___|   |
+			// event:  0   1   2   3   4
+			// hrs:      1   1   1   2
+			// ckpt:         ^       ^
+			records: EventRecords{
+				UpEvents: []UpEvent{
+					{Up: false, Timestamp: t0},
+					{Up: true, Timestamp: t0.Add(time.Hour)},
+					// Checkpointed 10 minutes before interruption 0
+					{Up: false, Timestamp: t0.Add(2 * time.Hour), LastCheckpoint: ptr(t0.Add(2*time.Hour - 10*time.Minute))},
+					{Up: true, Timestamp: t0.Add(3 * time.Hour)},
+					// Checkpointed 30 minutes before interruption 1
+					{Up: false, Timestamp: t0.Add(5 * time.Hour), LastCheckpoint: ptr(t0.Add(5*time.Hour - 30*time.Minute))},
+				},
+			},
+			now: t0.Add(5 * time.Hour),
+			expectedSummary: EventSummary{
+				DownTimeInitial:                 time.Hour,
+				UpTime:                          3 * time.Hour,
+				DownTime:                        2 * time.Hour,
+				InterruptionCount:               2,
+				InterruptionsPerDay:             2 * 24.0 / 5,
+				InterruptionsPerHour:            2.0 / 3,
+				RecoveryCount:                   1,
+				TotalDownTimeBetweenRecovery:    time.Hour,
+				MeanDownTimeBetweenRecovery:     time.Hour,
+				LatestDownTimeBetweenRecovery:   time.Hour,
+				TotalUpTimeBetweenInterruption:  3 * time.Hour,
+				MeanUpTimeBetweenInterruption:   3 * time.Hour / 2,
+				LatestUpTimeBetweenInterruption: 2 * time.Hour,
+				MeanLostWorkPerInterruption:     20 * time.Minute,
+			},
+		},
+		"checkpoint before previous recovery": {
+			// up:         _____   _____
+			// down:   ____|   |___|   |
+			// event:  0   1   2   3   4
+			// hrs:      1   1   1   2
+			// ckpt:         ^
+			records: EventRecords{
+				UpEvents: []UpEvent{
+					{Up: false, Timestamp: t0},
+					{Up: true, Timestamp: t0.Add(time.Hour)},
+					{Up: false, Timestamp: t0.Add(2 * time.Hour), LastCheckpoint: ptr(t0.Add(2*time.Hour - 10*time.Minute))},
+					{Up: true, Timestamp: t0.Add(3 * time.Hour)},
+					// Stale checkpoint from before interruption 0, clamped to recovery 0.
+					{Up: false, Timestamp: t0.Add(5 * time.Hour), LastCheckpoint: ptr(t0.Add(2*time.Hour - 10*time.Minute))},
+				},
+			},
+			now: t0.Add(5 * time.Hour),
+			expectedSummary: EventSummary{
+				DownTimeInitial:                 time.Hour,
+				UpTime:                          3 * time.Hour,
+				DownTime:                        2 * time.Hour,
+				InterruptionCount:               2,
+				InterruptionsPerDay:             2 * 24.0 / 5,
+				InterruptionsPerHour:            2.0 / 3,
+				RecoveryCount:                   1,
+				TotalDownTimeBetweenRecovery:    time.Hour,
+				MeanDownTimeBetweenRecovery:     time.Hour,
+				LatestDownTimeBetweenRecovery:   time.Hour,
+				TotalUpTimeBetweenInterruption:  3 * time.Hour,
+				MeanUpTimeBetweenInterruption:   3 * time.Hour / 2,
+				LatestUpTimeBetweenInterruption: 2 * time.Hour,
+				MeanLostWorkPerInterruption:     (10*time.Minute + 2*time.Hour) / 2,
+			},
+		},
+		"checkpoint after interruption": {
+			// up:         _____   _____
+			// down:   ____|   |___|   |
+			// event:  0   1   2   3   4
+			// hrs:      1   1   1   2
+			records: EventRecords{
+				UpEvents: []UpEvent{
+					{Up: false, Timestamp: t0},
+					{Up: true, Timestamp: t0.Add(time.Hour)},
+					{Up: false, Timestamp: t0.Add(2 * time.Hour), LastCheckpoint: ptr(t0.Add(2*time.Hour - 30*time.Minute))},
+					{Up: true, Timestamp: t0.Add(3 * time.Hour)},
+					// Skewed checkpoint in the future counts as no lost work.
+					{Up: false, Timestamp: t0.Add(5 * time.Hour), LastCheckpoint: ptr(t0.Add(5*time.Hour + time.Minute))},
+				},
+			},
+			now: t0.Add(5 * time.Hour),
+			expectedSummary: EventSummary{
+				DownTimeInitial:                 time.Hour,
+				UpTime:                          3 * time.Hour,
+				DownTime:                        2 * time.Hour,
+				InterruptionCount:               2,
+				InterruptionsPerDay:             2 * 24.0 / 5,
+				InterruptionsPerHour:            2.0 / 3,
+				RecoveryCount:                   1,
+				TotalDownTimeBetweenRecovery:    time.Hour,
+				MeanDownTimeBetweenRecovery:     time.Hour,
+				LatestDownTimeBetweenRecovery:   time.Hour,
+				TotalUpTimeBetweenInterruption:  3 * time.Hour,
+				MeanUpTimeBetweenInterruption:   3 * time.Hour / 2,
+				LatestUpTimeBetweenInterruption: 2 * time.Hour,
+				MeanLostWorkPerInterruption:     15 * time.Minute,
+			},
+		},
 	}
 
 	for name, tc := range cases {
@@ -312,6 +480,16 @@ func TestSummarize(t *testing.T) {
 			require.Equal(t, tc.expectedSummary.TotalUpTimeBetweenInterruption, gotSum.TotalUpTimeBetweenInterruption, "TotalUpTimeBetweenInterruption")
 			require.Equal(t, tc.expectedSummary.MeanUpTimeBetweenInterruption, gotSum.MeanUpTimeBetweenInterruption, "MeanUpTimeBetweenInterruption")
 			require.Equal(t, tc.expectedSummary.LatestUpTimeBetweenInterruption, gotSum.LatestUpTimeBetweenInterruption, "LatestUpTimeBetweenInterruption")
+			require.Equal(t, tc.expectedSummary.MeanLostWorkPerInterruption, gotSum.MeanLostWorkPerInterruption, "MeanLostWorkPerInterruption")
+			require.InDelta(t, tc.expectedSummary.InterruptionsPerDay, gotSum.InterruptionsPerDay, 1e-9, "InterruptionsPerDay")
+			require.InDelta(t, tc.expectedSummary.InterruptionsPerHour, gotSum.InterruptionsPerHour, 1e-9, "InterruptionsPerHour")
+
+			// Incremental summarization must match the full recomputation.
+			var s Summarizer
+			for i := range tc.records.UpEvents {
+				s.Update(&EventRecords{UpEvents: tc.records.UpEvents[:i+1]})
+			}
+			require.Equal(t, gotSum, s.Summary(tc.now, SummaryOptions{}), "incremental summary")
 		})
 	}
 }
@@ -417,6 +595,124 @@ func TestReconcileEvents(t *testing.T) {
 			},
 			expChanged: true,
 		},
+		"up to down with checkpoint": {
+			inputUps: map[string]Upness{
+				"abc": {
+					ExpectedCount:  1,
+					ReadyCount:     0,
+					LastCheckpoint: now.Add(-30 * time.Second),
+				},
+			},
+			inputEvents: map[string]EventRecords{
+				"abc": {
+					UpEvents: []UpEvent{
+						{Up: false, Timestamp: now.Add(-2 * time.Minute)},
+						{Up: true, Timestamp: now.Add(-time.Minute)},
+					},
+				},
+			},
+			expEvents: map[string]EventRecords{
+				"abc": {
+					UpEvents: []UpEvent{
+						{Up: false, Timestamp: now.Add(-2 * time.Minute)},
+						{Up: true, Timestamp: now.Add(-time.Minute)},
+						{Up: false, Timestamp: now, LastCheckpoint: ptr(now.Add(-30 * time.Second))},
+					},
+				},
+			},
+			expChanged: true,
+		},
+		"up to down with step": {
+			inputUps: map[string]Upness{
+				"abc": {
+					ExpectedCount: 1,
+					ReadyCount:    0,
+					Step:          ptr(int64(1200)),
+				},
+			},
+			inputEvents: map[string]EventRecords{
+				"abc": {
+					UpEvents: []UpEvent{
+						{Up: false, Timestamp: now.Add(-2 * time.Minute)},
+						{Up: true, Timestamp: now.Add(-time.Minute)},
+					},
+				},
+			},
+			expEvents: map[string]EventRecords{
+				"abc": {
+					UpEvents: []UpEvent{
+						{Up: false, Timestamp: now.Add(-2 * time.Minute)},
+						{Up: true, Timestamp: now.Add(-time.Minute)},
+						{Up: false, Timestamp: now, Step: ptr(int64(1200))},
+					},
+				},
+			},
+			expChanged: true,
+		},
+		"down to up with step": {
+			inputUps: map[string]Upness{
+				"abc": {
+					ExpectedCount: 1,
+					ReadyCount:    1,
+					Step:          ptr(int64(1200)),
+				},
+			},
+			inputEvents: map[string]EventRecords{
+				"abc": {
+					UpEvents: []UpEvent{
+						{Up: false, Timestamp: now.Add(-time.Minute)},
+					},
+				},
+			},
+			expEvents: map[string]EventRecords{
+				"abc": {
+					UpEvents: []UpEvent{
+						{Up: false, Timestamp: now.Add(-time.Minute)},
+						{Up: true, Timestamp: now},
+					},
+				},
+			},
+			expChanged: true,
+		},
+		"pending without records": {
+			inputUps: map[string]Upness{
+				"abc": {
+					ExpectedCount: 1,
+					ReadyCount:    0,
+					Pending:       true,
+				},
+			},
+			inputEvents: map[string]EventRecords{},
+			expEvents:   map[string]EventRecords{},
+			expChanged:  false,
+		},
+		"pending with records": {
+			inputUps: map[string]Upness{
+				"abc": {
+					ExpectedCount: 1,
+					ReadyCount:    0,
+					Pending:       true,
+				},
+			},
+			inputEvents: map[string]EventRecords{
+				"abc": {
+					UpEvents: []UpEvent{
+						{Up: false, Timestamp: now.Add(-2 * time.Minute)},
+						{Up: true, Timestamp: now.Add(-time.Minute)},
+					},
+				},
+			},
+			expEvents: map[string]EventRecords{
+				"abc": {
+					UpEvents: []UpEvent{
+						{Up: false, Timestamp: now.Add(-2 * time.Minute)},
+						{Up: true, Timestamp: now.Add(-time.Minute)},
+						{Up: false, Timestamp: now},
+					},
+				},
+			},
+			expChanged: true,
+		},
 		"still down": {
 			inputUps: map[string]Upness{
 				"abc": {
@@ -477,3 +773,1928 @@ func TestReconcileEvents(t *testing.T) {
 		})
 	}
 }
+
+func TestReconcileEventsAttributeCause(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The Node is only observed down a minute after the interruption.
+	var nodeDown time.Time
+	opts := ReconcileOptions{
+		CauseWindow: 5 * time.Minute,
+		AttributeCause: func(key string, at time.Time) *InterruptionCause {
+			if d := nodeDown.Sub(at); nodeDown.IsZero() || d < 0 || d > 5*time.Minute {
+				return nil
+			}
+			return &InterruptionCause{Node: "node-a", NodePool: "pool-a"}
+		},
+	}
+	events := map[string]EventRecords{}
+	reconcile := func(now time.Time, ready int32) bool {
+		return ReconcileEventsWithOptions(now, map[string]Upness{"abc": {ExpectedCount: 1, ReadyCount: ready}}, events, opts)
+	}
+	var s Summarizer
+	summarize := func(now time.Time) EventSummary {
+		rec := events["abc"]
+		s.Update(&rec)
+		return s.Summary(now, SummaryOptions{})
+	}
+
+	// Provisioning is not an interruption.
+	nodeDown = t0
+	require.True(t, reconcile(t0, 0))
+	require.Nil(t, events["abc"].UpEvents[0].Cause)
+	require.True(t, reconcile(t0.Add(time.Hour), 1))
+
+	// The cause is attributed once it is observed.
+	nodeDown = time.Time{}
+	require.True(t, reconcile(t0.Add(2*time.Hour), 0))
+	require.Nil(t, events["abc"].UpEvents[2].Cause)
+	require.Equal(t, 0, summarize(t0.Add(2*time.Hour)).NodeInterruptionCount)
+	nodeDown = t0.Add(2*time.Hour + time.Minute)
+	require.True(t, reconcile(t0.Add(2*time.Hour+time.Minute), 0))
+	require.Equal(t, &InterruptionCause{Node: "node-a", NodePool: "pool-a"}, events["abc"].UpEvents[2].Cause)
+	require.False(t, reconcile(t0.Add(2*time.Hour+2*time.Minute), 0))
+	got := summarize(t0.Add(2*time.Hour + 2*time.Minute))
+	require.Equal(t, 1, got.InterruptionCount)
+	require.Equal(t, 1, got.NodeInterruptionCount)
+
+	// Causes observed after the window are not attributed.
+	require.True(t, reconcile(t0.Add(3*time.Hour), 1))
+	require.True(t, reconcile(t0.Add(4*time.Hour), 0))
+	nodeDown = t0.Add(4*time.Hour + 10*time.Minute)
+	require.False(t, reconcile(t0.Add(4*time.Hour+10*time.Minute), 0))
+	got = summarize(t0.Add(4*time.Hour + 10*time.Minute))
+	require.Equal(t, 2, got.InterruptionCount)
+	require.Equal(t, 1, got.NodeInterruptionCount)
+}
+
+func TestReconcileEventsProvisioningRetries(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// down, partial, down, partial, partial, down, up, down, partial, down
+	readyCounts := []int32{0, 1, 0, 2, 3, 0, 4, 0, 1, 0}
+	events := map[string]EventRecords{}
+	var now time.Time
+	for i, ready := range readyCounts {
+		now = t0.Add(time.Duration(i) * time.Minute)
+		ReconcileEvents(now, map[string]Upness{
+			"abc": {ExpectedCount: 4, ReadyCount: ready},
+		}, events)
+	}
+
+	rec := events["abc"]
+	require.Equal(t, 2, rec.ProvisioningRetries)
+	require.False(t, rec.ProvisioningPartial)
+	require.Equal(t, []UpEvent{
+		{Up: false, Timestamp: t0},
+		{Up: true, Timestamp: t0.Add(6 * time.Minute)},
+		{Up: false, Timestamp: t0.Add(7 * time.Minute)},
+	}, rec.UpEvents)
+
+	summary := rec.Summarize(now)
+	require.Equal(t, 2, summary.ProvisioningRetryCount)
+	require.Equal(t, 1, summary.InterruptionCount)
+	require.Equal(t, 9*time.Minute, summary.Lifetime)
+
+	var s Summarizer
+	s.Update(&rec)
+	require.Equal(t, summary, s.Summary(now, SummaryOptions{}))
+
+	// Partial readiness without falling back to zero is not a retry.
+	events = map[string]EventRecords{}
+	for i, ready := range []int32{0, 1, 2, 1, 4} {
+		ReconcileEvents(t0.Add(time.Duration(i)*time.Minute), map[string]Upness{
+			"abc": {ExpectedCount: 4, ReadyCount: ready},
+		}, events)
+	}
+	require.Zero(t, events["abc"].ProvisioningRetries)
+}
+
+func TestReconcileEventsInitializeFromObserved(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	require.NoError(t, err)
+
+	events := map[string]EventRecords{
+		"known": {UpEvents: []UpEvent{{Up: false, Timestamp: t0.Add(-time.Hour)}}},
+	}
+	ups := map[string]Upness{
+		"up":    {ExpectedCount: 1, ReadyCount: 1},
+		"down":  {ExpectedCount: 1},
+		"known": {ExpectedCount: 1, ReadyCount: 1},
+	}
+	require.True(t, ReconcileEventsWithOptions(t0, ups, events, ReconcileOptions{InitializeFromObserved: true}))
+
+	// Entities seen for the first time start in their observed state.
+	require.Equal(t, []UpEvent{{Up: true, Timestamp: t0}}, events["up"].UpEvents)
+	require.Equal(t, []UpEvent{{Up: false, Timestamp: t0}}, events["down"].UpEvents)
+	// Existing records are not affected.
+	require.Equal(t, []UpEvent{
+		{Up: false, Timestamp: t0.Add(-time.Hour)},
+		{Up: true, Timestamp: t0},
+	}, events["known"].UpEvents)
+
+	rec := events["up"]
+	summary := rec.Summarize(t0.Add(time.Hour))
+	require.Zero(t, summary.DownTimeInitial)
+	require.Equal(t, time.Hour, summary.UpTime)
+	require.Equal(t, DataQuality{Confidence: 1}, summary.DataQuality)
+}
+
+func TestReconcileEventsDegraded(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Minutes 0-1 provisioning, 1-3 up, 3-5 degraded, 5-6 up, 6-8 degraded,
+	// 8-10 down (degraded but not up), 10- up.
+	states := []struct {
+		ready    int32
+		degraded bool
+	}{
+		{0, false}, {1, false}, {1, false}, {1, true}, {1, true}, {1, false},
+		{1, true}, {1, true}, {0, true}, {0, true}, {1, false},
+	}
+	events := map[string]EventRecords{}
+	for i, st := range states {
+		ReconcileEvents(t0.Add(time.Duration(i)*time.Minute), map[string]Upness{
+			"abc": {ExpectedCount: 1, ReadyCount: st.ready, Degraded: st.degraded},
+		}, events)
+	}
+
+	rec := events["abc"]
+	require.Equal(t, []DegradedEvent{
+		{Degraded: true, Timestamp: t0.Add(3 * time.Minute)},
+		{Degraded: false, Timestamp: t0.Add(5 * time.Minute)},
+		{Degraded: true, Timestamp: t0.Add(6 * time.Minute)},
+		{Degraded: false, Timestamp: t0.Add(8 * time.Minute)},
+	}, rec.DegradedEvents)
+	require.Equal(t, []UpEvent{
+		{Up: false, Timestamp: t0},
+		{Up: true, Timestamp: t0.Add(time.Minute)},
+		{Up: false, Timestamp: t0.Add(8 * time.Minute), Degraded: true},
+		{Up: true, Timestamp: t0.Add(10 * time.Minute)},
+	}, rec.UpEvents)
+
+	// Degraded time is part of the up time, distinct from the downtime.
+	now := t0.Add(11 * time.Minute)
+	summary := rec.Summarize(now)
+	require.Equal(t, 4*time.Minute, summary.DegradedTime)
+	require.Equal(t, 8*time.Minute, summary.UpTime)
+	require.Equal(t, 3*time.Minute, summary.DownTime)
+	require.Equal(t, 1, summary.InterruptionCount)
+	require.Equal(t, 1, summary.DegradedInterruptionCount)
+
+	var s Summarizer
+	s.Update(&rec)
+	require.Equal(t, summary, s.Summary(now, SummaryOptions{}))
+}
+
+func TestRecentInterruptions(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := EventRecords{UpEvents: []UpEvent{
+		{Up: false, Timestamp: t0},
+		{Up: true, Timestamp: t0.Add(1 * time.Minute)},
+		{Up: false, Timestamp: t0.Add(2 * time.Minute)},
+		{Up: true, Timestamp: t0.Add(3 * time.Minute)},
+		{Up: false, Timestamp: t0.Add(4 * time.Minute)},
+		{Up: true, Timestamp: t0.Add(5 * time.Minute)},
+	}}
+
+	require.Equal(t, []time.Time{t0.Add(4 * time.Minute), t0.Add(2 * time.Minute)}, rec.RecentInterruptions(5))
+	require.Equal(t, []time.Time{t0.Add(4 * time.Minute)}, rec.RecentInterruptions(1))
+	require.Empty(t, rec.RecentInterruptions(0))
+	require.Empty(t, (&EventRecords{UpEvents: rec.UpEvents[:2]}).RecentInterruptions(5))
+}
+
+func TestInterruptionsByStepRange(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := EventRecords{UpEvents: []UpEvent{
+		{Up: false, Timestamp: t0, Step: ptr(int64(0))},
+		{Up: true, Timestamp: t0.Add(1 * time.Minute)},
+		{Up: false, Timestamp: t0.Add(2 * time.Minute), Step: ptr(int64(150))},
+		{Up: true, Timestamp: t0.Add(3 * time.Minute)},
+		{Up: false, Timestamp: t0.Add(4 * time.Minute), Step: ptr(int64(999))},
+		{Up: true, Timestamp: t0.Add(5 * time.Minute)},
+		{Up: false, Timestamp: t0.Add(6 * time.Minute), Step: ptr(int64(1000))},
+		{Up: true, Timestamp: t0.Add(7 * time.Minute)},
+		// Interruptions without a known step are not counted.
+		{Up: false, Timestamp: t0.Add(8 * time.Minute)},
+	}}
+
+	require.Equal(t, map[int64]int{0: 2, 1000: 1}, rec.InterruptionsByStepRange(1000))
+	require.Equal(t, map[int64]int{100: 1, 900: 1, 1000: 1}, rec.InterruptionsByStepRange(100))
+	require.Empty(t, rec.InterruptionsByStepRange(0))
+}
+
+func TestIncidents(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(d time.Duration) time.Time { return t0.Add(d) }
+	nodes := EventRecords{UpEvents: []UpEvent{
+		{Up: false, Timestamp: at(0)},
+		{Up: true, Timestamp: at(time.Hour)},
+		// A Node is terminated...
+		{Up: false, Timestamp: at(2 * time.Hour)},
+		{Up: true, Timestamp: at(2*time.Hour + 10*time.Minute)},
+		// ...and later an unrelated one.
+		{Up: false, Timestamp: at(5 * time.Hour)},
+	}}
+	jobSet := EventRecords{UpEvents: []UpEvent{
+		{Up: false, Timestamp: at(0)},
+		{Up: true, Timestamp: at(time.Hour)},
+		// ...which takes the JobSet down shortly after.
+		{Up: false, Timestamp: at(2*time.Hour + time.Minute)},
+		{Up: true, Timestamp: at(2*time.Hour + 20*time.Minute)},
+		// A second JobSet interruption within the window is a new incident.
+		{Up: false, Timestamp: at(2*time.Hour + 21*time.Minute)},
+		{Up: true, Timestamp: at(3 * time.Hour)},
+	}}
+
+	require.Equal(t, []time.Time{
+		at(2 * time.Hour),
+		at(2*time.Hour + 21*time.Minute),
+		at(5 * time.Hour),
+	}, Incidents(time.Hour, nodes, jobSet))
+	require.Len(t, Incidents(0, nodes, jobSet), 4)
+	require.Len(t, Incidents(time.Hour, jobSet), 2)
+}
+
+func TestSummarizePercentiles(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The "two interruptions two recoveries" scenario: up for 1h and 2h
+	// before the interruptions, down for 1h and 3h before the recoveries.
+	twoAndTwo := []UpEvent{
+		{Up: false, Timestamp: t0},
+		{Up: true, Timestamp: t0.Add(time.Hour)},
+		{Up: false, Timestamp: t0.Add(2 * time.Hour)},
+		{Up: true, Timestamp: t0.Add(3 * time.Hour)},
+		{Up: false, Timestamp: t0.Add(5 * time.Hour)},
+		{Up: true, Timestamp: t0.Add(8 * time.Hour)},
+	}
+
+	cases := map[string]struct {
+		events                 []UpEvent
+		expDown, expUp         [3]time.Duration
+		expMeanDown, expMeanUp time.Duration
+	}{
+		"no interruptions": {
+			events: twoAndTwo[:2],
+		},
+		// A single sample is every percentile.
+		"single interruption single recovery": {
+			events:      twoAndTwo[:4],
+			expDown:     [3]time.Duration{time.Hour, time.Hour, time.Hour},
+			expUp:       [3]time.Duration{time.Hour, time.Hour, time.Hour},
+			expMeanDown: time.Hour,
+			expMeanUp:   time.Hour,
+		},
+		"two interruptions two recoveries": {
+			events:      twoAndTwo,
+			expDown:     [3]time.Duration{time.Hour, 3 * time.Hour, 3 * time.Hour},
+			expUp:       [3]time.Duration{time.Hour, 2 * time.Hour, 2 * time.Hour},
+			expMeanDown: 2 * time.Hour,
+			expMeanUp:   90 * time.Minute,
+		},
+		// An outlier recovery skews the mean but not the median.
+		"two interruptions two recoveries then a long outage": {
+			events: append(append([]UpEvent(nil), twoAndTwo...),
+				UpEvent{Up: false, Timestamp: t0.Add(9 * time.Hour)},
+				UpEvent{Up: true, Timestamp: t0.Add(29 * time.Hour)},
+			),
+			expDown:     [3]time.Duration{3 * time.Hour, 20 * time.Hour, 20 * time.Hour},
+			expUp:       [3]time.Duration{time.Hour, 2 * time.Hour, 2 * time.Hour},
+			expMeanDown: 8 * time.Hour,
+			expMeanUp:   80 * time.Minute,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			rec := EventRecords{UpEvents: tc.events}
+			got := rec.Summarize(tc.events[len(tc.events)-1].Timestamp)
+			require.Equal(t, tc.expDown, [3]time.Duration{got.P50DownTimeBetweenRecovery, got.P90DownTimeBetweenRecovery, got.P99DownTimeBetweenRecovery})
+			require.Equal(t, tc.expUp, [3]time.Duration{got.P50UpTimeBetweenInterruption, got.P90UpTimeBetweenInterruption, got.P99UpTimeBetweenInterruption})
+			require.Equal(t, tc.expMeanDown, got.MeanDownTimeBetweenRecovery)
+			require.Equal(t, tc.expMeanUp, got.MeanUpTimeBetweenInterruption)
+		})
+	}
+}
+
+func TestRollUp(t *testing.T) {
+	t.Parallel()
+
+	// A flaky replicated Job next to a stable one.
+	flaky := EventSummary{
+		InterruptionCount:              2,
+		RecoveryCount:                  2,
+		UpTime:                         3 * time.Hour,
+		DownTime:                       time.Hour,
+		TotalDownTimeBetweenRecovery:   40 * time.Minute,
+		TotalUpTimeBetweenInterruption: 3 * time.Hour,
+		Availability:                   0.75,
+		Lifetime:                       4 * time.Hour,
+		AtRisk:                         true,
+	}
+	stable := EventSummary{
+		UpTime:       2 * time.Hour,
+		Availability: 1,
+		Lifetime:     2 * time.Hour,
+	}
+
+	got := RollUp(flaky, stable)
+	require.Equal(t, 2, got.InterruptionCount)
+	require.Equal(t, 2, got.RecoveryCount)
+	require.Equal(t, 5*time.Hour, got.UpTime)
+	require.Equal(t, time.Hour, got.DownTime)
+	require.Equal(t, 20*time.Minute, got.MeanDownTimeBetweenRecovery)
+	require.Equal(t, 90*time.Minute, got.MeanUpTimeBetweenInterruption)
+	require.InDelta(t, 0.4, got.InterruptionsPerHour, 1e-9)
+	require.InDelta(t, (0.75*4+1*2)/6.0, got.Availability, 1e-9)
+	// The Lifetime of the parts adds up, as their UpTime and DownTime do.
+	require.Equal(t, 6*time.Hour, got.Lifetime)
+	require.Equal(t, got.Lifetime, got.UpTime+got.DownTime)
+	require.Equal(t, 8.0, got.InterruptionsPerDay)
+	require.True(t, got.AtRisk)
+
+	require.Equal(t, EventSummary{}, RollUp())
+}
+
+func TestSummarizeFleet(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One root cause: the Nodes of "abc" go down, followed by the JobSet.
+	nodeEvents := map[string]EventRecords{
+		"abc": {UpEvents: []UpEvent{
+			{Up: false, Timestamp: t0},
+			{Up: true, Timestamp: t0.Add(time.Hour)},
+			{Up: false, Timestamp: t0.Add(2 * time.Hour)},
+		}},
+	}
+	jobSetEvents := map[string]EventRecords{
+		"abc": {UpEvents: []UpEvent{
+			{Up: false, Timestamp: t0},
+			{Up: true, Timestamp: t0.Add(time.Hour)},
+			{Up: false, Timestamp: t0.Add(2*time.Hour + 30*time.Second)},
+		}},
+		// Interruptions of different JobSets are never correlated.
+		"def": {UpEvents: []UpEvent{
+			{Up: false, Timestamp: t0},
+			{Up: true, Timestamp: t0.Add(time.Hour)},
+			{Up: false, Timestamp: t0.Add(2 * time.Hour)},
+		}},
+	}
+
+	require.Equal(t, FleetSummary{InterruptionCount: 3, IncidentCount: 2},
+		SummarizeFleet(jobSetEvents, nodeEvents, 5*time.Minute))
+	require.Equal(t, FleetSummary{InterruptionCount: 3, IncidentCount: 3},
+		SummarizeFleet(jobSetEvents, nodeEvents, 0))
+}
+
+func TestSummarizeNamespaces(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	report := NewReport()
+	for key, ns := range map[string]string{"abc": "team-a", "def": "team-a", "ghi": "team-b"} {
+		attrs := Attrs{JobSetNamespace: ns, JobSetName: key}
+		report.JobSetsUp[key] = Upness{Attrs: attrs}
+		report.JobSetNodesUp[key] = Upness{Attrs: attrs}
+	}
+	report.JobSetsUpSummaries = map[string]UpnessSummaryWithAttrs{
+		"abc": {EventSummary: EventSummary{UpTime: 3 * time.Hour, DownTime: time.Hour, Availability: 0.75, Lifetime: 4 * time.Hour}},
+		"def": {EventSummary: EventSummary{UpTime: time.Hour, DownTime: time.Hour, Availability: 0.5, Lifetime: 2 * time.Hour}},
+		"ghi": {EventSummary: EventSummary{UpTime: time.Hour, Availability: 1, Lifetime: time.Hour}},
+	}
+	report.JobSetNodesUpSummaries = map[string]UpnessSummaryWithAttrs{
+		"abc": {EventSummary: EventSummary{UpTime: 4 * time.Hour, Availability: 1, Lifetime: 4 * time.Hour}},
+	}
+	interrupted := EventRecords{UpEvents: []UpEvent{
+		{Up: false, Timestamp: t0},
+		{Up: true, Timestamp: t0.Add(time.Minute)},
+		{Up: false, Timestamp: t0.Add(time.Hour)},
+	}}
+	report.JobSetEvents = map[string]EventRecords{"abc": interrupted, "def": interrupted, "ghi": interrupted}
+	report.JobSetNodeEvents = map[string]EventRecords{"abc": interrupted}
+
+	got := report.SummarizeNamespaces(5 * time.Minute)
+	require.Len(t, got, 2)
+
+	a := got["team-a"]
+	require.Equal(t, 2, a.JobSetCount)
+	require.Equal(t, 4*time.Hour, a.JobSets.UpTime)
+	require.Equal(t, 2*time.Hour, a.JobSets.DownTime)
+	require.InDelta(t, (0.75*4+0.5*2)/6, a.JobSets.Availability, 1e-9)
+	require.Equal(t, 4*time.Hour, a.JobSetNodes.UpTime)
+	// The JobSet and Nodes of "abc" are interrupted at once.
+	require.Equal(t, FleetSummary{InterruptionCount: 3, IncidentCount: 2}, a.Fleet)
+
+	b := got["team-b"]
+	require.Equal(t, 1, b.JobSetCount)
+	require.Equal(t, 1.0, b.JobSets.Availability)
+	require.Equal(t, FleetSummary{InterruptionCount: 1, IncidentCount: 1}, b.Fleet)
+}
+
+func TestSummarizeNodePools(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	nodeEvents := map[string]EventRecords{
+		"node-a": {UpEvents: []UpEvent{
+			{Up: true, Timestamp: t0},
+			{Up: false, Timestamp: t0.Add(time.Hour)},
+			{Up: true, Timestamp: t0.Add(2 * time.Hour)},
+		}},
+		"node-b": {UpEvents: []UpEvent{
+			{Up: true, Timestamp: t0},
+		}},
+		"node-c": {UpEvents: []UpEvent{
+			{Up: true, Timestamp: t0},
+		}},
+		"node-d": {UpEvents: []UpEvent{
+			{Up: true, Timestamp: t0},
+		}},
+	}
+	nodePools := map[string]string{
+		"node-a": "pool-1",
+		"node-b": "pool-1",
+		"node-c": "pool-2",
+		// Skipped: no node pool.
+		"node-d": "",
+		// Skipped: no events.
+		"node-e": "pool-2",
+	}
+
+	got := SummarizeNodePools(t0.Add(3*time.Hour), nodePools, nodeEvents, SummaryOptions{})
+	require.Len(t, got, 2)
+
+	p1 := got["pool-1"]
+	require.Equal(t, 2, p1.NodeCount)
+	require.Equal(t, 1, p1.Nodes.InterruptionCount)
+	require.Equal(t, 5*time.Hour, p1.Nodes.UpTime)
+	require.Equal(t, time.Hour, p1.Nodes.DownTime)
+
+	p2 := got["pool-2"]
+	require.Equal(t, 1, p2.NodeCount)
+	require.Equal(t, 0, p2.Nodes.InterruptionCount)
+	require.Equal(t, 3*time.Hour, p2.Nodes.UpTime)
+}
+
+func TestReportWithoutShortLived(t *testing.T) {
+	t.Parallel()
+
+	report := NewReport()
+	report.JobSetEvents = map[string]EventRecords{}
+	for key, lifetime := range map[string]time.Duration{"smoke": time.Minute, "train": time.Hour} {
+		report.JobSetsUp[key] = Upness{}
+		report.JobSetNodesUp[key] = Upness{}
+		report.JobSetsUpSummaries[key] = UpnessSummaryWithAttrs{EventSummary: EventSummary{Lifetime: lifetime}}
+		report.JobSetNodesUpSummaries[key] = UpnessSummaryWithAttrs{}
+		report.JobSetEvents[key] = EventRecords{}
+	}
+	// Not yet summarized.
+	report.JobSetsUp["pending"] = Upness{}
+
+	got := report.WithoutShortLived(10 * time.Minute)
+	for _, keys := range [][]string{
+		keysOf(got.JobSetsUp), keysOf(got.JobSetNodesUp),
+		keysOf(got.JobSetsUpSummaries), keysOf(got.JobSetNodesUpSummaries),
+		keysOf(got.JobSetEvents),
+	} {
+		require.Equal(t, []string{"train"}, keys)
+	}
+	require.Nil(t, got.JobSetNodeEvents)
+	// The original report is not modified.
+	require.Len(t, report.JobSetsUp, 3)
+
+	require.Equal(t, report, report.WithoutShortLived(0))
+}
+
+func keysOf[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestSummarizeRecoveryTrend(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// withRecoveries returns records with recoveries taking the given times,
+	// separated by an hour up.
+	withRecoveries := func(recoveries ...time.Duration) EventRecords {
+		ts := t0
+		rec := EventRecords{UpEvents: []UpEvent{
+			{Up: false, Timestamp: ts},
+			{Up: true, Timestamp: ts.Add(time.Minute)},
+		}}
+		ts = ts.Add(time.Minute)
+		for _, d := range recoveries {
+			ts = ts.Add(time.Hour)
+			rec.UpEvents = append(rec.UpEvents, UpEvent{Up: false, Timestamp: ts})
+			ts = ts.Add(d)
+			rec.UpEvents = append(rec.UpEvents, UpEvent{Up: true, Timestamp: ts})
+		}
+		return rec
+	}
+
+	cases := map[string]struct {
+		recoveries []time.Duration
+		exp        time.Duration
+	}{
+		"no recoveries": {},
+		"single recovery": {
+			recoveries: []time.Duration{time.Minute},
+		},
+		"worsening": {
+			recoveries: []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute},
+			exp:        time.Minute,
+		},
+		"improving": {
+			recoveries: []time.Duration{10 * time.Minute, 8 * time.Minute, 6 * time.Minute, 4 * time.Minute},
+			exp:        -2 * time.Minute,
+		},
+		"stable": {
+			recoveries: []time.Duration{5 * time.Minute, 5 * time.Minute, 5 * time.Minute},
+		},
+		"only recent recoveries": {
+			// Older recoveries beyond the window are ignored.
+			recoveries: []time.Duration{time.Hour, 30 * time.Minute, time.Minute, 2 * time.Minute, 3 * time.Minute, 4 * time.Minute, 5 * time.Minute},
+			exp:        time.Minute,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			rec := withRecoveries(c.recoveries...)
+			now := rec.UpEvents[len(rec.UpEvents)-1].Timestamp
+			require.Equal(t, c.exp, rec.Summarize(now).RecoveryTrend)
+
+			var s Summarizer
+			s.Update(&rec)
+			require.Equal(t, c.exp, s.Summary(now, SummaryOptions{}).RecoveryTrend)
+		})
+	}
+}
+
+func TestSummarizeErrorBudget(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10m provisioning, then a 30m interruption 2h in.
+	rec := EventRecords{UpEvents: []UpEvent{
+		{Up: false, Timestamp: t0},
+		{Up: true, Timestamp: t0.Add(10 * time.Minute)},
+		{Up: false, Timestamp: t0.Add(2 * time.Hour)},
+		{Up: true, Timestamp: t0.Add(2*time.Hour + 30*time.Minute)},
+	}}
+	now := t0.Add(4 * time.Hour)
+
+	cases := map[string]struct {
+		opts             SummaryOptions
+		expRemaining     float64
+		expRemainingTime time.Duration
+		expBurnRate      float64
+	}{
+		"no slo": {},
+		"window longer than lifetime": {
+			// 40m down of a 60m budget, over 4h.
+			opts:             SummaryOptions{SLO: SLO{Target: 0.9, Window: 10 * time.Hour}},
+			expRemaining:     1.0 / 3,
+			expRemainingTime: 20 * time.Minute,
+			expBurnRate:      40.0 / 240 / 0.1,
+		},
+		"exclude provisioning": {
+			opts:             SummaryOptions{ExcludeProvisioning: true, SLO: SLO{Target: 0.9, Window: 10 * time.Hour}},
+			expRemaining:     0.5,
+			expRemainingTime: 30 * time.Minute,
+			expBurnRate:      30.0 / 240 / 0.1,
+		},
+		"budget exceeded": {
+			// 30m down of an 18m budget, over 3h.
+			opts:             SummaryOptions{SLO: SLO{Target: 0.9, Window: 3 * time.Hour}},
+			expRemaining:     -2.0 / 3,
+			expRemainingTime: -12 * time.Minute,
+			expBurnRate:      30.0 / 180 / 0.1,
+		},
+		"window after interruptions": {
+			opts:             SummaryOptions{SLO: SLO{Target: 0.9, Window: time.Hour}},
+			expRemaining:     1,
+			expRemainingTime: 6 * time.Minute,
+		},
+		"whole run": {
+			// 40m down of a 24m budget, over the 4h run.
+			opts:             SummaryOptions{SLO: SLO{Target: 0.9}},
+			expRemaining:     -2.0 / 3,
+			expRemainingTime: -16 * time.Minute,
+			expBurnRate:      40.0 / 240 / 0.1,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var s Summarizer
+			s.Update(&rec)
+			summary := s.Summary(now, c.opts)
+			require.InDelta(t, c.expRemaining, summary.ErrorBudgetRemaining, 1e-9)
+			require.InDelta(t, c.expRemainingTime, summary.ErrorBudgetRemainingTime, float64(time.Millisecond))
+			require.InDelta(t, c.expBurnRate, summary.BurnRate, 1e-9)
+		})
+	}
+}
+
+func TestSummarizeInterruptionsPerDayShortLifetime(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := EventRecords{UpEvents: []UpEvent{
+		{Up: false, Timestamp: t0},
+		{Up: true, Timestamp: t0.Add(time.Second)},
+		{Up: false, Timestamp: t0.Add(2 * time.Second)},
+	}}
+	require.Zero(t, rec.Summarize(t0.Add(time.Minute)).InterruptionsPerDay)
+	require.Equal(t, 24.0, rec.Summarize(t0.Add(MinInterruptionRateLifetime)).InterruptionsPerDay)
+}
+
+func TestSummarizeInterruptionsPerHourShortUpTime(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Up for a second before the interruption.
+	rec := EventRecords{UpEvents: []UpEvent{
+		{Up: false, Timestamp: t0},
+		{Up: true, Timestamp: t0.Add(time.Second)},
+		{Up: false, Timestamp: t0.Add(2 * time.Second)},
+	}}
+	require.Zero(t, rec.Summarize(t0.Add(time.Hour)).InterruptionsPerHour)
+	require.Zero(t, RollUp(rec.Summarize(t0.Add(time.Hour))).InterruptionsPerHour)
+
+	// Up for an hour after recovering.
+	rec.UpEvents = append(rec.UpEvents, UpEvent{Up: true, Timestamp: t0.Add(3 * time.Second)})
+	now := t0.Add(3*time.Second + MinInterruptionRateUpTime - time.Second)
+	require.Equal(t, 1.0, rec.Summarize(now).InterruptionsPerHour)
+	require.Equal(t, 1.0, RollUp(rec.Summarize(now)).InterruptionsPerHour)
+}
+
+func TestSummarizeOutages(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1h provisioning, then down from 3h to 5h.
+	rec := EventRecords{UpEvents: []UpEvent{
+		{Up: false, Timestamp: t0},
+		{Up: true, Timestamp: t0.Add(time.Hour)},
+		{Up: false, Timestamp: t0.Add(3 * time.Hour)},
+		{Up: true, Timestamp: t0.Add(5 * time.Hour)},
+	}}
+	now := t0.Add(6 * time.Hour)
+	outage := func(start, end time.Duration) Outage {
+		o := Outage{Start: t0.Add(start)}
+		if end != 0 {
+			o.End = t0.Add(end)
+		}
+		return o
+	}
+
+	cases := map[string]struct {
+		opts            SummaryOptions
+		expOutage       time.Duration
+		expAvailability float64
+	}{
+		"no outages": {
+			expAvailability: 0.5,
+		},
+		"outage within downtime": {
+			opts:            SummaryOptions{Outages: []Outage{outage(3*time.Hour+30*time.Minute, 4*time.Hour+30*time.Minute)}},
+			expOutage:       time.Hour,
+			expAvailability: 3.0 / 5,
+		},
+		"overlapping outages": {
+			opts: SummaryOptions{Outages: []Outage{
+				outage(3*time.Hour+30*time.Minute, 4*time.Hour+30*time.Minute),
+				outage(4*time.Hour, 4*time.Hour+15*time.Minute),
+			}},
+			expOutage:       time.Hour,
+			expAvailability: 3.0 / 5,
+		},
+		"ongoing outage": {
+			opts:            SummaryOptions{Outages: []Outage{outage(4*time.Hour+30*time.Minute, 0)}},
+			expOutage:       30 * time.Minute,
+			expAvailability: 3.0 / 5.5,
+		},
+		"outage during uptime": {
+			opts:            SummaryOptions{Outages: []Outage{outage(90*time.Minute, 2*time.Hour)}},
+			expAvailability: 0.5,
+		},
+		"exclude provisioning": {
+			// Only the overlap with the interruption counts, the
+			// provisioning time is excluded already.
+			opts: SummaryOptions{
+				ExcludeProvisioning: true,
+				Outages:             []Outage{outage(30*time.Minute, 4*time.Hour)},
+			},
+			expOutage:       time.Hour,
+			expAvailability: 3.0 / 4,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			summary := rec.SummarizeWithOptions(now, c.opts)
+			require.Equal(t, c.expOutage, summary.OutageDownTime)
+			require.InDelta(t, c.expAvailability, summary.Availability, 1e-9)
+			require.Equal(t, 3*time.Hour, summary.DownTime)
+		})
+	}
+}
+
+func TestParseOutages(t *testing.T) {
+	t.Parallel()
+
+	outages, err := ParseOutages("2021-01-01T00:00:00Z/2021-01-01T01:00:00Z, 2021-01-02T00:00:00Z/")
+	require.NoError(t, err)
+	require.Equal(t, []Outage{
+		{Start: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC)},
+		{Start: time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}, outages)
+
+	for _, val := range []string{
+		"2021-01-01T00:00:00Z",
+		"yesterday/today",
+		"2021-01-01T01:00:00Z/2021-01-01T00:00:00Z",
+	} {
+		_, err := ParseOutages(val)
+		require.Error(t, err, val)
+	}
+}
+
+func TestSummarizeDataQuality(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(h int) time.Time { return t0.Add(time.Duration(h) * time.Hour) }
+	late := at(10)
+
+	cases := map[string]struct {
+		events []UpEvent
+		exp    DataQuality
+	}{
+		"no events": {
+			exp: DataQuality{Confidence: 1},
+		},
+		"clean": {
+			events: []UpEvent{{Up: false, Timestamp: at(0)}, {Up: true, Timestamp: at(1)}, {Up: false, Timestamp: at(2)}},
+			exp:    DataQuality{Confidence: 1},
+		},
+		"backfilled": {
+			events: []UpEvent{
+				{Up: false, Timestamp: at(0), Backfilled: true},
+				{Up: true, Timestamp: at(1), Backfilled: true},
+				{Up: false, Timestamp: at(2)},
+				{Up: true, Timestamp: at(3)},
+			},
+			exp: DataQuality{BackfilledEvents: 2, Confidence: 0.5},
+		},
+		"skewed": {
+			events: []UpEvent{
+				{Up: false, Timestamp: at(0)},
+				{Up: true, Timestamp: at(2)},
+				// Before the previous event.
+				{Up: false, Timestamp: at(1)},
+				{Up: true, Timestamp: at(3)},
+				// Checkpoint after the interruption.
+				{Up: false, Timestamp: at(4), LastCheckpoint: &late},
+			},
+			exp: DataQuality{SkewedEvents: 2, Confidence: 0.6},
+		},
+		"initially up": {
+			events: []UpEvent{{Up: true, Timestamp: at(0)}, {Up: false, Timestamp: at(1)}},
+			exp:    DataQuality{Confidence: 1},
+		},
+		"malformed": {
+			events: []UpEvent{
+				{Up: false, Timestamp: at(0)},
+				{Up: true, Timestamp: at(1)},
+				{Up: true, Timestamp: at(2)},
+				{Up: false, Timestamp: at(3), Backfilled: true},
+			},
+			exp: DataQuality{MalformedEvents: 1, BackfilledEvents: 1, Confidence: 0.5},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			rec := EventRecords{UpEvents: c.events}
+			got := rec.Summarize(at(5)).DataQuality
+			require.Equal(t, c.exp.BackfilledEvents, got.BackfilledEvents, "BackfilledEvents")
+			require.Equal(t, c.exp.SkewedEvents, got.SkewedEvents, "SkewedEvents")
+			require.Equal(t, c.exp.MalformedEvents, got.MalformedEvents, "MalformedEvents")
+			require.InDelta(t, c.exp.Confidence, got.Confidence, 1e-9, "Confidence")
+		})
+	}
+}
+
+func TestSummarizeMalformedLate(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h int) time.Time { return t0.Add(time.Duration(h) * time.Hour) }
+	// Repeats after the third event are merged into the state they repeat,
+	// rather than counted as recoveries or interruptions.
+	for name, ups := range map[string][]bool{
+		"up":   {false, true, false, true, true, false},
+		"down": {false, true, false, false, true, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var rec EventRecords
+			for i, up := range ups {
+				rec.UpEvents = append(rec.UpEvents, UpEvent{Up: up, Timestamp: at(i)})
+			}
+			deduped := EventRecords{UpEvents: append([]UpEvent(nil), rec.UpEvents...)}
+			require.True(t, dedupUpEvents(&deduped))
+
+			got := rec.Summarize(at(len(ups)))
+			want := deduped.Summarize(at(len(ups)))
+			require.Equal(t, 1, got.DataQuality.MalformedEvents)
+			require.Equal(t, 5.0/6, got.DataQuality.Confidence)
+			got.DataQuality = want.DataQuality
+			require.Equal(t, want, got)
+			require.Equal(t, 2, got.InterruptionCount)
+			require.Equal(t, 1, got.RecoveryCount)
+
+			// Incremental updates past the repeat agree.
+			var s Summarizer
+			s.Update(&EventRecords{UpEvents: rec.UpEvents[:5]})
+			s.Update(&rec)
+			require.Equal(t, rec.Summarize(at(len(ups))), s.Summary(at(len(ups)), SummaryOptions{}))
+		})
+	}
+}
+
+func TestSLOWithDefaults(t *testing.T) {
+	t.Parallel()
+
+	def := SLO{Target: 0.99, Window: 720 * time.Hour}
+	require.Equal(t, def, SLO{}.WithDefaults(def))
+	require.Equal(t, SLO{Target: 0.9, Window: 720 * time.Hour}, SLO{Target: 0.9}.WithDefaults(def))
+	require.Equal(t, SLO{Target: 0.9, Window: time.Hour}, SLO{Target: 0.9, Window: time.Hour}.WithDefaults(def))
+}
+
+func TestBackfillEvents(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(h int) time.Time { return t0.Add(time.Duration(h) * time.Hour) }
+
+	cases := map[string]struct {
+		existing   []UpEvent
+		history    []UpEvent
+		exp        []UpEvent
+		expChanged bool
+	}{
+		"no history": {
+			existing:   []UpEvent{{Up: false, Timestamp: at(5)}},
+			exp:        []UpEvent{{Up: false, Timestamp: at(5)}},
+			expChanged: false,
+		},
+		"empty records": {
+			history:    []UpEvent{{Up: false, Timestamp: at(0)}, {Up: true, Timestamp: at(1)}},
+			exp:        []UpEvent{{Up: false, Timestamp: at(0), Backfilled: true}, {Up: true, Timestamp: at(1), Backfilled: true}},
+			expChanged: true,
+		},
+		"history overlapping records is ignored": {
+			existing:   []UpEvent{{Up: false, Timestamp: at(1)}},
+			history:    []UpEvent{{Up: false, Timestamp: at(2)}, {Up: true, Timestamp: at(3)}},
+			exp:        []UpEvent{{Up: false, Timestamp: at(1)}},
+			expChanged: false,
+		},
+		"leading up history is skipped": {
+			existing: []UpEvent{{Up: false, Timestamp: at(5)}},
+			history: []UpEvent{
+				{Up: true, Timestamp: at(0)},
+				{Up: false, Timestamp: at(1)},
+				{Up: true, Timestamp: at(2)},
+			},
+			exp: []UpEvent{
+				{Up: false, Timestamp: at(1), Backfilled: true},
+				{Up: true, Timestamp: at(2), Backfilled: true},
+				{Up: false, Timestamp: at(5)},
+			},
+			expChanged: true,
+		},
+		"history ending down merges with initial down": {
+			existing: []UpEvent{{Up: false, Timestamp: at(5)}, {Up: true, Timestamp: at(6)}},
+			history:  []UpEvent{{Up: false, Timestamp: at(0)}, {Up: true, Timestamp: at(1)}, {Up: false, Timestamp: at(2)}},
+			exp: []UpEvent{
+				{Up: false, Timestamp: at(0), Backfilled: true},
+				{Up: true, Timestamp: at(1), Backfilled: true},
+				{Up: false, Timestamp: at(2), Backfilled: true},
+				{Up: true, Timestamp: at(6)},
+			},
+			expChanged: true,
+		},
+		"zero length initial down is dropped": {
+			existing: []UpEvent{{Up: false, Timestamp: at(5)}, {Up: true, Timestamp: at(5)}},
+			history:  []UpEvent{{Up: false, Timestamp: at(0)}, {Up: true, Timestamp: at(1)}},
+			exp: []UpEvent{
+				{Up: false, Timestamp: at(0), Backfilled: true},
+				{Up: true, Timestamp: at(1), Backfilled: true},
+			},
+			expChanged: true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			rec := EventRecords{UpEvents: c.existing}
+			changed := BackfillEvents(&rec, c.history)
+			require.Equal(t, c.expChanged, changed)
+			require.Equal(t, c.exp, rec.UpEvents)
+		})
+	}
+}
+
+func TestSummarizeCurrentUpStreak(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := t0.Add(6 * time.Hour)
+
+	cases := map[string]struct {
+		records EventRecords
+		exp     time.Duration
+	}{
+		"empty": {
+			exp: 0,
+		},
+		"never up": {
+			records: EventRecords{UpEvents: []UpEvent{{Up: false, Timestamp: t0}}},
+			exp:     0,
+		},
+		"up since provisioning": {
+			records: EventRecords{UpEvents: []UpEvent{
+				{Up: false, Timestamp: t0},
+				{Up: true, Timestamp: t0.Add(2 * time.Hour)},
+			}},
+			exp: 4 * time.Hour,
+		},
+		"up since recovery": {
+			records: EventRecords{UpEvents: []UpEvent{
+				{Up: false, Timestamp: t0},
+				{Up: true, Timestamp: t0.Add(2 * time.Hour)},
+				{Up: false, Timestamp: t0.Add(4 * time.Hour)},
+				{Up: true, Timestamp: t0.Add(5 * time.Hour)},
+			}},
+			exp: time.Hour,
+		},
+		"currently down": {
+			records: EventRecords{UpEvents: []UpEvent{
+				{Up: false, Timestamp: t0},
+				{Up: true, Timestamp: t0.Add(2 * time.Hour)},
+				{Up: false, Timestamp: t0.Add(4 * time.Hour)},
+			}},
+			exp: 0,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got := c.records.Summarize(now)
+			require.Equal(t, c.exp, got.CurrentUpStreak)
+		})
+	}
+}
+
+func TestSummarizeDown(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := t0.Add(6 * time.Hour)
+
+	cases := map[string]struct {
+		records EventRecords
+		exp     bool
+	}{
+		"empty": {},
+		"never up": {
+			records: EventRecords{UpEvents: []UpEvent{{Up: false, Timestamp: t0}}},
+			exp:     true,
+		},
+		"last event up": {
+			records: EventRecords{UpEvents: []UpEvent{
+				{Up: false, Timestamp: t0},
+				{Up: true, Timestamp: t0.Add(2 * time.Hour)},
+				{Up: false, Timestamp: t0.Add(4 * time.Hour)},
+				{Up: true, Timestamp: t0.Add(5 * time.Hour)},
+			}},
+		},
+		"last event down": {
+			records: EventRecords{UpEvents: []UpEvent{
+				{Up: false, Timestamp: t0},
+				{Up: true, Timestamp: t0.Add(2 * time.Hour)},
+				{Up: false, Timestamp: t0.Add(4 * time.Hour)},
+			}},
+			exp: true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got := c.records.Summarize(now)
+			require.Equal(t, c.exp, got.Down)
+		})
+	}
+}
+
+func TestSummarizeProvisioning(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := t0.Add(6 * time.Hour)
+
+	cases := map[string]struct {
+		records        EventRecords
+		expProvisioned time.Duration
+		expInterrupted time.Duration
+	}{
+		"still provisioning": {
+			records: EventRecords{UpEvents: []UpEvent{{Up: false, Timestamp: t0}}},
+		},
+		"up since provisioning": {
+			records: EventRecords{UpEvents: []UpEvent{
+				{Up: false, Timestamp: t0},
+				{Up: true, Timestamp: t0.Add(2 * time.Hour)},
+			}},
+			expProvisioned: 2 * time.Hour,
+		},
+		"recovered": {
+			records: EventRecords{UpEvents: []UpEvent{
+				{Up: false, Timestamp: t0},
+				{Up: true, Timestamp: t0.Add(2 * time.Hour)},
+				{Up: false, Timestamp: t0.Add(3 * time.Hour)},
+				{Up: true, Timestamp: t0.Add(4 * time.Hour)},
+			}},
+			expProvisioned: 2 * time.Hour,
+			expInterrupted: time.Hour,
+		},
+		"currently down": {
+			records: EventRecords{UpEvents: []UpEvent{
+				{Up: false, Timestamp: t0},
+				{Up: true, Timestamp: t0.Add(2 * time.Hour)},
+				{Up: false, Timestamp: t0.Add(3 * time.Hour)},
+				{Up: true, Timestamp: t0.Add(4 * time.Hour)},
+				{Up: false, Timestamp: t0.Add(5 * time.Hour)},
+			}},
+			expProvisioned: 2 * time.Hour,
+			expInterrupted: 2 * time.Hour,
+		},
+		"initially up": {
+			records: EventRecords{UpEvents: []UpEvent{
+				{Up: true, Timestamp: t0},
+				{Up: false, Timestamp: t0.Add(5 * time.Hour)},
+			}},
+			expInterrupted: time.Hour,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got := c.records.Summarize(now)
+			require.Equal(t, c.expProvisioned, got.DownTimeInitial, "DownTimeInitial")
+			require.Equal(t, c.expInterrupted, got.DownTimeUnprovisioned, "DownTimeUnprovisioned")
+		})
+	}
+}
+
+func TestSummarizeProvisioningStuck(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := SummaryOptions{ProvisioningSLA: time.Hour}
+
+	cases := map[string]struct {
+		records  EventRecords
+		now      time.Time
+		expStuck bool
+	}{
+		"within the SLA": {
+			records: EventRecords{UpEvents: []UpEvent{{Up: false, Timestamp: t0}}},
+			now:     t0.Add(time.Hour),
+		},
+		"past the SLA": {
+			records:  EventRecords{UpEvents: []UpEvent{{Up: false, Timestamp: t0}}},
+			now:      t0.Add(time.Hour + time.Second),
+			expStuck: true,
+		},
+		"up late": {
+			records: EventRecords{UpEvents: []UpEvent{
+				{Up: false, Timestamp: t0},
+				{Up: true, Timestamp: t0.Add(2 * time.Hour)},
+			}},
+			now: t0.Add(3 * time.Hour),
+		},
+		"interrupted after coming up": {
+			records: EventRecords{UpEvents: []UpEvent{
+				{Up: false, Timestamp: t0},
+				{Up: true, Timestamp: t0.Add(time.Minute)},
+				{Up: false, Timestamp: t0.Add(2 * time.Minute)},
+			}},
+			now: t0.Add(3 * time.Hour),
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, c.expStuck, c.records.SummarizeWithOptions(c.now, opts).ProvisioningStuck)
+			// Disabled without an SLA.
+			require.False(t, c.records.Summarize(c.now).ProvisioningStuck)
+		})
+	}
+}
+
+func TestSummarizeWeightedMeans(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Skewed up intervals of 1h, 1h and 10h, each followed by a 1m, 1m and
+	// 58m recovery.
+	var events []UpEvent
+	ts := t0
+	add := func(up bool, after time.Duration) {
+		ts = ts.Add(after)
+		events = append(events, UpEvent{Up: up, Timestamp: ts})
+	}
+	add(false, 0)
+	add(true, time.Hour)
+	add(false, time.Hour)
+	add(true, time.Minute)
+	add(false, time.Hour)
+	add(true, time.Minute)
+	add(false, 10*time.Hour)
+	add(true, 58*time.Minute)
+
+	rec := EventRecords{UpEvents: events}
+	got := rec.Summarize(ts)
+
+	require.Equal(t, 4*time.Hour, got.MeanUpTimeBetweenInterruption)
+	require.Equal(t, 17*time.Hour/2, got.WeightedMeanUpTimeBetweenInterruption)
+
+	require.Equal(t, 20*time.Minute, got.MeanDownTimeBetweenRecovery)
+	// (1 + 1 + 58*58) / 60 minutes.
+	require.Equal(t, 3366*time.Minute/60, got.WeightedMeanDownTimeBetweenRecovery)
+
+	// Equal intervals have equal means.
+	rec = EventRecords{UpEvents: events[:5]}
+	got = rec.Summarize(ts)
+	require.Equal(t, got.MeanUpTimeBetweenInterruption, got.WeightedMeanUpTimeBetweenInterruption)
+}
+
+func TestSummarizeIntervalDurations(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := EventRecords{UpEvents: []UpEvent{
+		{Up: false, Timestamp: t0},
+		{Up: true, Timestamp: t0.Add(time.Minute)},
+		{Up: false, Timestamp: t0.Add(time.Hour)},
+		{Up: true, Timestamp: t0.Add(time.Hour + 5*time.Minute)},
+		{Up: false, Timestamp: t0.Add(3 * time.Hour)},
+	}}
+	// The initial provisioning and the ongoing recovery are not included.
+	got := rec.Summarize(t0.Add(4 * time.Hour))
+	require.Equal(t, []time.Duration{5 * time.Minute}, got.DownTimeBetweenRecoveryDurations)
+	require.Equal(t, []time.Duration{59 * time.Minute, 115 * time.Minute}, got.UpTimeBetweenInterruptionDurations)
+
+	// Incremental updates extend the previous durations.
+	var s Summarizer
+	s.Update(&EventRecords{UpEvents: rec.UpEvents[:3]})
+	before := s.Summary(t0.Add(4*time.Hour), SummaryOptions{})
+	s.Update(&rec)
+	require.Equal(t, []time.Duration{59 * time.Minute}, before.UpTimeBetweenInterruptionDurations)
+	require.Equal(t, got.UpTimeBetweenInterruptionDurations, s.Summary(t0.Add(4*time.Hour), SummaryOptions{}).UpTimeBetweenInterruptionDurations)
+}
+
+func TestSummarizeAtRisk(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(m int) time.Time { return t0.Add(time.Duration(m) * time.Minute) }
+	opts := AtRiskOptions{
+		MinUpStreak:  time.Hour,
+		BurstCount:   3,
+		BurstWindow:  time.Hour,
+		SlowRecovery: 30 * time.Minute,
+	}
+
+	cases := map[string]struct {
+		events []UpEvent
+		now    time.Time
+		opts   AtRiskOptions
+		exp    bool
+	}{
+		"healthy": {
+			events: []UpEvent{
+				{Up: false, Timestamp: at(0)},
+				{Up: true, Timestamp: at(10)},
+				{Up: false, Timestamp: at(100)},
+				{Up: true, Timestamp: at(110)},
+			},
+			now:  at(300),
+			opts: opts,
+			exp:  false,
+		},
+		"freshly provisioned is not at risk": {
+			events: []UpEvent{
+				{Up: false, Timestamp: at(0)},
+				{Up: true, Timestamp: at(10)},
+			},
+			now:  at(20),
+			opts: opts,
+			exp:  false,
+		},
+		"short streak since recovery": {
+			events: []UpEvent{
+				{Up: false, Timestamp: at(0)},
+				{Up: true, Timestamp: at(10)},
+				{Up: false, Timestamp: at(100)},
+				{Up: true, Timestamp: at(110)},
+			},
+			now:  at(130),
+			opts: opts,
+			exp:  true,
+		},
+		"interruption burst": {
+			events: []UpEvent{
+				{Up: false, Timestamp: at(0)},
+				{Up: true, Timestamp: at(10)},
+				{Up: false, Timestamp: at(200)},
+				{Up: true, Timestamp: at(201)},
+				{Up: false, Timestamp: at(220)},
+				{Up: true, Timestamp: at(221)},
+				{Up: false, Timestamp: at(240)},
+			},
+			now:  at(250),
+			opts: AtRiskOptions{BurstCount: 3, BurstWindow: time.Hour},
+			exp:  true,
+		},
+		"interruptions spread out": {
+			events: []UpEvent{
+				{Up: false, Timestamp: at(0)},
+				{Up: true, Timestamp: at(10)},
+				{Up: false, Timestamp: at(100)},
+				{Up: true, Timestamp: at(101)},
+				{Up: false, Timestamp: at(200)},
+				{Up: true, Timestamp: at(201)},
+				{Up: false, Timestamp: at(300)},
+			},
+			now:  at(310),
+			opts: AtRiskOptions{BurstCount: 3, BurstWindow: time.Hour},
+			exp:  false,
+		},
+		"slow recovery": {
+			events: []UpEvent{
+				{Up: false, Timestamp: at(0)},
+				{Up: true, Timestamp: at(10)},
+				{Up: false, Timestamp: at(100)},
+				{Up: true, Timestamp: at(200)},
+			},
+			now:  at(400),
+			opts: opts,
+			exp:  true,
+		},
+		"rules disabled": {
+			events: []UpEvent{
+				{Up: false, Timestamp: at(0)},
+				{Up: true, Timestamp: at(10)},
+				{Up: false, Timestamp: at(100)},
+				{Up: true, Timestamp: at(200)},
+			},
+			now: at(210),
+			exp: false,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			rec := EventRecords{UpEvents: c.events}
+			got := rec.SummarizeWithOptions(c.now, SummaryOptions{AtRisk: c.opts})
+			require.Equal(t, c.exp, got.AtRisk)
+		})
+	}
+}
+
+func TestSummarizerUpdateRewritten(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := EventRecords{
+		UpEvents: []UpEvent{
+			{Up: false, Timestamp: t0},
+			{Up: true, Timestamp: t0.Add(time.Hour)},
+			{Up: false, Timestamp: t0.Add(2 * time.Hour)},
+		},
+	}
+	var s Summarizer
+	s.Update(&rec)
+
+	// Records that are not an extension of the previous ones start over.
+	rewritten := EventRecords{
+		UpEvents: []UpEvent{
+			{Up: false, Timestamp: t0.Add(time.Hour)},
+			{Up: true, Timestamp: t0.Add(3 * time.Hour)},
+			{Up: false, Timestamp: t0.Add(4 * time.Hour)},
+			{Up: true, Timestamp: t0.Add(5 * time.Hour)},
+		},
+	}
+	s.Update(&rewritten)
+
+	now := t0.Add(6 * time.Hour)
+	require.Equal(t, rewritten.Summarize(now), s.Summary(now, SummaryOptions{}))
+}
+
+func TestSummarizeEffectiveUpTime(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(m int) time.Time { return t0.Add(time.Duration(m) * time.Minute) }
+	rec := EventRecords{UpEvents: []UpEvent{
+		{Up: false, Timestamp: at(0)},
+		{Up: true, Timestamp: at(10)},
+		{Up: false, Timestamp: at(70)},
+		// Interrupted again before settling.
+		{Up: true, Timestamp: at(80)},
+		{Up: false, Timestamp: at(85)},
+		{Up: true, Timestamp: at(100)},
+	}}
+
+	cases := map[string]struct {
+		settle       time.Duration
+		expEffective time.Duration
+	}{
+		"no settle period": {
+			expEffective: 125 * time.Minute,
+		},
+		"settle period after recoveries": {
+			settle: 10 * time.Minute,
+			// The initial up is not a recovery, the first recovery only
+			// lasted 5m, and the second one settled fully.
+			expEffective: (125 - 5 - 10) * time.Minute,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got := rec.SummarizeWithOptions(at(160), SummaryOptions{SettlePeriod: c.settle})
+			require.Equal(t, 125*time.Minute, got.UpTime)
+			require.Equal(t, c.expEffective, got.EffectiveUpTime)
+		})
+	}
+}
+
+func TestSummarizerAlertHysteresis(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(m int) time.Time { return t0.Add(time.Duration(m) * time.Minute) }
+	opts := SummaryOptions{Alert: AlertOptions{Window: time.Hour, FireAbove: 2, ClearBelow: 1}}
+	events := []UpEvent{
+		{Up: false, Timestamp: at(0)},
+		{Up: true, Timestamp: at(5)},
+		{Up: false, Timestamp: at(10)},
+		{Up: true, Timestamp: at(11)},
+		{Up: false, Timestamp: at(20)},
+		{Up: true, Timestamp: at(21)},
+		{Up: false, Timestamp: at(30)},
+		{Up: true, Timestamp: at(31)},
+	}
+
+	steps := []struct {
+		name           string
+		events         int
+		now            time.Time
+		expInWindow    int
+		expAlerting    bool
+		expFreshAlerts bool
+	}{
+		{name: "at fire threshold", events: 6, now: at(25), expInWindow: 2},
+		{name: "above fire threshold fires", events: 8, now: at(35), expInWindow: 3, expAlerting: true, expFreshAlerts: true},
+		{name: "between thresholds stays firing", events: 8, now: at(75), expInWindow: 2, expAlerting: true},
+		{name: "at clear threshold stays firing", events: 8, now: at(85), expInWindow: 1, expAlerting: true},
+		{name: "below clear threshold clears", events: 8, now: at(95), expInWindow: 0},
+	}
+
+	var s Summarizer
+	for _, step := range steps {
+		rec := EventRecords{UpEvents: events[:step.events]}
+		s.Update(&rec)
+		got := s.Summary(step.now, opts)
+		require.Equal(t, step.expInWindow, got.InterruptionsInWindow, step.name)
+		require.Equal(t, step.expAlerting, got.Alerting, step.name)
+
+		// Without the latched state, only the fire threshold applies.
+		fresh := rec.SummarizeWithOptions(step.now, opts)
+		require.Equal(t, step.expFreshAlerts, fresh.Alerting, step.name)
+	}
+}
+
+func TestAlertOptionsValidate(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, AlertOptions{}.Validate())
+	require.NoError(t, AlertOptions{Window: time.Hour, FireAbove: 3, ClearBelow: 1}.Validate())
+	require.Error(t, AlertOptions{Window: -time.Hour}.Validate())
+	require.Error(t, AlertOptions{Window: time.Hour, FireAbove: -1}.Validate())
+	require.Error(t, AlertOptions{Window: time.Hour, FireAbove: 1, ClearBelow: 3}.Validate())
+}
+
+func flappyRecords(n int) EventRecords {
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	rec := EventRecords{UpEvents: make([]UpEvent, n)}
+	for i := range rec.UpEvents {
+		rec.UpEvents[i] = UpEvent{Up: i%2 == 1, Timestamp: t0.Add(time.Duration(i) * time.Minute)}
+	}
+	return rec
+}
+
+func BenchmarkSummarize(b *testing.B) {
+	rec := flappyRecords(50000)
+	now := rec.UpEvents[len(rec.UpEvents)-1].Timestamp.Add(time.Minute)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rec.Summarize(now)
+	}
+}
+
+func BenchmarkSummarizerUpdate(b *testing.B) {
+	rec := flappyRecords(50000)
+	now := rec.UpEvents[len(rec.UpEvents)-1].Timestamp.Add(time.Minute)
+	var s Summarizer
+	s.Update(&rec)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Update(&rec)
+		s.Summary(now, SummaryOptions{})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestSummarizeAvailability(t *testing.T) {
+	t.Parallel()
+
+	t0, err := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// up:         _____   _____
+	// down:   ____|   |___|
+	// event:  0   1   2   3
+	// hrs:      2   2   1   1
+	records := EventRecords{
+		UpEvents: []UpEvent{
+			{Up: false, Timestamp: t0},
+			{Up: true, Timestamp: t0.Add(2 * time.Hour)},
+			{Up: false, Timestamp: t0.Add(4 * time.Hour)},
+			{Up: true, Timestamp: t0.Add(5 * time.Hour)},
+		},
+	}
+	now := t0.Add(6 * time.Hour)
+
+	cases := map[string]struct {
+		records EventRecords
+		opts    SummaryOptions
+		exp     float64
+	}{
+		"empty": {
+			exp: 0,
+		},
+		"with provisioning": {
+			records: records,
+			exp:     3.0 / 6.0,
+		},
+		"without provisioning": {
+			records: records,
+			opts:    SummaryOptions{ExcludeProvisioning: true},
+			exp:     3.0 / 4.0,
+		},
+		"not up yet without provisioning": {
+			records: EventRecords{UpEvents: []UpEvent{{Up: false, Timestamp: t0}}},
+			opts:    SummaryOptions{ExcludeProvisioning: true},
+			exp:     0,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got := c.records.SummarizeWithOptions(now, c.opts)
+			require.InDelta(t, c.exp, got.Availability, 1e-9)
+		})
+	}
+}
+
+func TestCompact(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(m int) time.Time { return t0.Add(time.Duration(m) * time.Minute) }
+	cp := at(60)
+	rec := EventRecords{
+		UpEvents: []UpEvent{
+			{Up: false, Timestamp: at(0)},
+			{Up: true, Timestamp: at(10)},
+			{Up: false, Timestamp: at(70), LastCheckpoint: &cp, Severity: SeverityCoordinator, Cause: &InterruptionCause{Node: "n1"}},
+			{Up: true, Timestamp: at(80)},
+			{Up: false, Timestamp: at(200), Degraded: true},
+			{Up: true, Timestamp: at(230), Backfilled: true},
+			{Up: false, Timestamp: at(300)},
+			{Up: true, Timestamp: at(310)},
+		},
+		DegradedEvents: []DegradedEvent{
+			{Degraded: true, Timestamp: at(100)},
+			{Degraded: false, Timestamp: at(150)},
+			{Degraded: true, Timestamp: at(240)},
+			{Degraded: false, Timestamp: at(300)},
+		},
+	}
+	outages := []Outage{{Start: at(75), End: at(85)}, {Start: at(305)}}
+
+	optsCases := map[string]SummaryOptions{
+		"defaults": {},
+		"settle and outages": {
+			SettlePeriod: 30 * time.Minute,
+			Outages:      outages,
+		},
+		"exclude provisioning with lifetime SLO": {
+			ExcludeProvisioning: true,
+			Outages:             outages,
+			SLO:                 SLO{Target: 0.9},
+		},
+		"SLO window within retention": {
+			SLO: SLO{Target: 0.9, Window: time.Hour},
+		},
+	}
+	for name, opts := range optsCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			for cutoff := 0; cutoff <= 320; cutoff += 5 {
+				compacted := rec
+				Compact(&compacted, at(cutoff), opts.Outages)
+				// Compacting again later carries the totals forward.
+				again := compacted
+				Compact(&again, at(cutoff+45), opts.Outages)
+
+				for _, now := range []time.Time{at(cutoff + 60), at(400)} {
+					if now.Before(at(310)) {
+						continue
+					}
+					// Windowed fields are only kept while the retention
+					// covers the window.
+					covered := func(m int) bool { return !now.Add(-opts.SLO.Window).Before(at(m)) }
+					want := rec.SummarizeWithOptions(now, opts)
+					if covered(cutoff) {
+						requireCompactedSummary(t, want, compacted.SummarizeWithOptions(now, opts), "cutoff %d, now %v", cutoff, now)
+					}
+					if covered(cutoff + 45) {
+						requireCompactedSummary(t, want, again.SummarizeWithOptions(now, opts), "cutoff %d and %d, now %v", cutoff, cutoff+45, now)
+					}
+				}
+				require.Equal(t, rec.EventCount(), compacted.EventCount(), "cutoff %d", cutoff)
+				if cutoff <= 300 {
+					// The latest interruption is not compacted yet.
+					require.Equal(t, rec.RecentInterruptions(1), compacted.RecentInterruptions(1), "cutoff %d", cutoff)
+				}
+				require.Equal(t,
+					SummarizeFleet(map[string]EventRecords{"a": rec}, nil, 0),
+					SummarizeFleet(map[string]EventRecords{"a": compacted}, nil, 0), "cutoff %d", cutoff)
+			}
+		})
+	}
+}
+
+// requireCompactedSummary requires got, a summary of compacted records, to be
+// want but for the intervals approximated by DurationSketch.
+func requireCompactedSummary(t *testing.T, want, got EventSummary, msgAndArgs ...any) {
+	t.Helper()
+	approx := func(w, g *time.Duration) {
+		if *w == 0 {
+			require.Zero(t, *g, msgAndArgs...)
+		} else {
+			require.InEpsilon(t, float64(*w), float64(*g), 0.045, msgAndArgs...)
+		}
+		*g = *w
+	}
+	for _, p := range [][2]*time.Duration{
+		{&want.P50DownTimeBetweenRecovery, &got.P50DownTimeBetweenRecovery},
+		{&want.P90DownTimeBetweenRecovery, &got.P90DownTimeBetweenRecovery},
+		{&want.P99DownTimeBetweenRecovery, &got.P99DownTimeBetweenRecovery},
+		{&want.P50UpTimeBetweenInterruption, &got.P50UpTimeBetweenInterruption},
+		{&want.P90UpTimeBetweenInterruption, &got.P90UpTimeBetweenInterruption},
+		{&want.P99UpTimeBetweenInterruption, &got.P99UpTimeBetweenInterruption},
+	} {
+		approx(p[0], p[1])
+	}
+	for _, p := range [][2]*[]time.Duration{
+		{&want.DownTimeBetweenRecoveryDurations, &got.DownTimeBetweenRecoveryDurations},
+		{&want.UpTimeBetweenInterruptionDurations, &got.UpTimeBetweenInterruptionDurations},
+	} {
+		w, g := slices.Clone(*p[0]), slices.Clone(*p[1])
+		slices.Sort(w)
+		slices.Sort(g)
+		require.Len(t, g, len(w), msgAndArgs...)
+		for i := range w {
+			approx(&w[i], &g[i])
+		}
+		*p[1] = *p[0]
+	}
+	require.Equal(t, want, got, msgAndArgs...)
+}
+
+func TestCompactJSON(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	rec := EventRecords{UpEvents: []UpEvent{
+		{Up: false, Timestamp: t0},
+		{Up: true, Timestamp: t0.Add(time.Minute)},
+		{Up: false, Timestamp: t0.Add(time.Hour)},
+		{Up: true, Timestamp: t0.Add(2 * time.Hour)},
+	}}
+	now := t0.Add(3 * time.Hour)
+	want := rec.Summarize(now)
+
+	require.True(t, Compact(&rec, t0.Add(90*time.Minute), nil))
+	require.Len(t, rec.UpEvents, 2)
+	require.Equal(t, 2, rec.Compacted.Count)
+
+	data, err := json.Marshal(rec)
+	require.NoError(t, err)
+	var got EventRecords
+	require.NoError(t, json.Unmarshal(data, &got))
+	requireCompactedSummary(t, want, got.Summarize(now))
+
+	require.False(t, Compact(&got, t0.Add(90*time.Minute), nil), "nothing left to compact")
+}
+
+func TestCompactConstantSize(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	intervals := []time.Duration{time.Minute, 10 * time.Minute, time.Hour, 3 * time.Hour, 90 * time.Second}
+	var rec EventRecords
+	at := t0
+	sizes := map[int]int{}
+	for i := 0; i < 2000; i++ {
+		rec.UpEvents = append(rec.UpEvents, UpEvent{Up: i%2 == 1, Timestamp: at})
+		at = at.Add(intervals[i%len(intervals)])
+		if (i+1)%100 == 0 {
+			require.True(t, Compact(&rec, at, nil))
+			data, err := json.Marshal(rec.Compacted)
+			require.NoError(t, err)
+			sizes[i+1] = len(data)
+		}
+	}
+	require.Equal(t, 2000, rec.EventCount())
+	// Only the digits of the counts and totals grow.
+	require.Less(t, sizes[2000]-sizes[200], 100, "sizes %v", sizes)
+	require.Len(t, rec.Summarize(at).DownTimeBetweenRecoveryDurations, 999)
+}
+
+func TestCompactPercentilesApproximate(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	var rec EventRecords
+	at := t0
+	for _, down := range []time.Duration{100 * time.Second, 200 * time.Second, 300 * time.Second} {
+		rec.UpEvents = append(rec.UpEvents, UpEvent{Up: false, Timestamp: at}, UpEvent{Up: true, Timestamp: at.Add(down)})
+		at = at.Add(down + time.Hour)
+	}
+	now := at
+	want := rec.Summarize(now)
+	require.True(t, Compact(&rec, now, nil))
+	got := rec.Summarize(now)
+
+	// Counts and totals are kept exactly.
+	require.Equal(t, want.RecoveryCount, got.RecoveryCount)
+	require.Equal(t, want.TotalDownTimeBetweenRecovery, got.TotalDownTimeBetweenRecovery)
+	require.Equal(t, want.MeanDownTimeBetweenRecovery, got.MeanDownTimeBetweenRecovery)
+	// Percentiles are not, but within the precision of DurationSketch.
+	require.NotEqual(t, want.P50DownTimeBetweenRecovery, got.P50DownTimeBetweenRecovery)
+	require.InEpsilon(t, float64(want.P50DownTimeBetweenRecovery), float64(got.P50DownTimeBetweenRecovery), 0.045)
+	// The sketch expands into one duration per compacted interval.
+	require.Len(t, got.DownTimeBetweenRecoveryDurations, got.RecoveryCount)
+}
+
+func TestCompactLegacyDurations(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	rec := EventRecords{
+		UpEvents: []UpEvent{{Up: false, Timestamp: t0.Add(4 * time.Hour)}, {Up: true, Timestamp: t0.Add(5 * time.Hour)}},
+		// Compacted from down at t0, up at 1h, down at 2h, up at 3h.
+		Compacted: &CompactedEvents{
+			Count: 4,
+			First: UpEvent{Up: false, Timestamp: t0},
+			Last:  UpEvent{Up: true, Timestamp: t0.Add(3 * time.Hour)},
+
+			DownTime:                           2 * time.Hour,
+			DownTimeInitial:                    time.Hour,
+			UpTime:                             time.Hour,
+			InterruptionCount:                  1,
+			RecoveryCount:                      1,
+			TotalDownTimeBetweenRecovery:       time.Hour,
+			TotalUpTimeBetweenInterruption:     time.Hour,
+			LatestDownTimeBetweenRecovery:      time.Hour,
+			LatestUpTimeBetweenInterruption:    time.Hour,
+			DownTimeBetweenRecoveryDurations:   []time.Duration{time.Hour},
+			UpTimeBetweenInterruptionDurations: []time.Duration{time.Hour},
+		},
+	}
+	now := t0.Add(6 * time.Hour)
+	want := rec.Summarize(now)
+	require.Equal(t, []time.Duration{time.Hour, time.Hour}, want.DownTimeBetweenRecoveryDurations)
+	require.Equal(t, []time.Duration{time.Hour, time.Hour}, want.UpTimeBetweenInterruptionDurations)
+
+	// Compacting again replaces the durations by the sketches.
+	require.True(t, Compact(&rec, now, nil))
+	require.Nil(t, rec.Compacted.DownTimeBetweenRecoveryDurations)
+	require.Nil(t, rec.Compacted.UpTimeBetweenInterruptionDurations)
+	requireCompactedSummary(t, want, rec.Summarize(now))
+}
+
+func TestSummarizerUpdateCompacted(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	rec := EventRecords{UpEvents: []UpEvent{
+		{Up: false, Timestamp: t0},
+		{Up: true, Timestamp: t0.Add(time.Minute)},
+		{Up: false, Timestamp: t0.Add(time.Hour)},
+	}}
+	var s Summarizer
+	s.Update(&rec)
+
+	Compact(&rec, t0.Add(90*time.Minute), nil)
+	s.Update(&rec)
+	AppendUpEvent(t0.Add(2*time.Hour), &rec, true)
+	s.Update(&rec)
+
+	now := t0.Add(3 * time.Hour)
+	require.Equal(t, rec.Summarize(now), s.Summary(now, SummaryOptions{}))
+	require.Equal(t, 1, s.Summary(now, SummaryOptions{}).RecoveryCount)
+}
+
+func TestReconcileEventsRetention(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := map[string]EventRecords{}
+	opts := ReconcileOptions{Retention: time.Hour}
+	for i := 0; i < 10; i++ {
+		ready := int32(i % 2)
+		ReconcileEventsWithOptions(t0.Add(time.Duration(i)*30*time.Minute), map[string]Upness{"a": {ReadyCount: ready, ExpectedCount: 1}}, events, opts)
+	}
+	rec := events["a"]
+	require.Equal(t, 10, rec.EventCount())
+	require.Len(t, rec.UpEvents, 4, "events within the last hour, and the one before it")
+	require.Equal(t, 4, rec.Summarize(t0.Add(5*time.Hour)).InterruptionCount)
+}
+
+func TestReconcileEventsDedup(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h int) time.Time { return t0.Add(time.Duration(h) * time.Hour) }
+	deduped := []UpEvent{
+		{Up: false, Timestamp: at(0)},
+		{Up: true, Timestamp: at(1)},
+		{Up: false, Timestamp: at(3)},
+		{Up: true, Timestamp: at(4)},
+	}
+	events := map[string]EventRecords{"a": {UpEvents: []UpEvent{
+		{Up: false, Timestamp: at(0)},
+		{Up: true, Timestamp: at(1)},
+		{Up: true, Timestamp: at(2)},
+		{Up: false, Timestamp: at(3)},
+		{Up: false, Timestamp: at(3)},
+		{Up: true, Timestamp: at(4)},
+		{Up: true, Timestamp: at(5)},
+	}}}
+	rec := events["a"]
+	require.Equal(t, 3, rec.Summarize(at(6)).DataQuality.MalformedEvents)
+
+	ups := map[string]Upness{"a": {ReadyCount: 1, ExpectedCount: 1}}
+	require.True(t, ReconcileEvents(at(6), ups, events))
+	require.Equal(t, deduped, events["a"].UpEvents)
+	require.False(t, ReconcileEvents(at(6), ups, events))
+
+	want := (&EventRecords{UpEvents: deduped}).Summarize(at(6))
+	rec = events["a"]
+	got := rec.Summarize(at(6))
+	require.Equal(t, want, got)
+	require.Equal(t, 1, got.InterruptionCount)
+	require.Equal(t, 1, got.RecoveryCount)
+	require.Equal(t, 4*time.Hour, got.UpTime)
+	require.Zero(t, got.DataQuality.MalformedEvents)
+}
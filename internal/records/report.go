@@ -1,7 +1,19 @@
 package records
 
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReportSchemaVersion is the version of the JSON shape of Report. Bump it
+// whenever the shape changes incompatibly, so that consumers detect reports
+// they do not understand instead of misparsing them.
+const ReportSchemaVersion = 1
+
 func NewReport() Report {
 	return Report{
+		SchemaVersion:          ReportSchemaVersion,
 		JobSetsUp:              make(map[string]Upness),
 		JobSetsUpSummaries:     make(map[string]UpnessSummaryWithAttrs),
 		JobSetNodesUp:          make(map[string]Upness),
@@ -10,14 +22,283 @@ func NewReport() Report {
 }
 
 type Report struct {
+	// SchemaVersion is the ReportSchemaVersion the report was written with.
+	SchemaVersion int `json:"schemaVersion"`
+
+	// Timestamp is the time the summaries were computed at. Exporters use it
+	// as the current time when set so that all sinks agree for a given tick.
+	Timestamp time.Time `json:"timestamp"`
+
+	// ClusterName and MegamonVersion identify where the report came from,
+	// so that reports archived from several clusters can be attributed.
+	ClusterName    string `json:"clusterName"`
+	MegamonVersion string `json:"megamonVersion"`
+
 	JobSetsUp              map[string]Upness                 `json:"jobSetsUp"`
 	JobSetsUpSummaries     map[string]UpnessSummaryWithAttrs `json:"jobSetsUpSummaries"`
 	JobSetNodesUp          map[string]Upness                 `json:"jobSetNodesUp"`
 	JobSetNodesUpSummaries map[string]UpnessSummaryWithAttrs `json:"jobSetNodesUpSummaries"`
-	// TODO: NodePool based upness and summaries.
+	// JobSetNodePools are the sorted node pools that the Pods of each JobSet
+	// have run on, to correlate interruptions with node pools. Only set
+	// while the Pods of JobSets are tracked, i.e. with node pool Job
+	// labelling or interruption cause attribution enabled.
+	JobSetNodePools map[string][]string `json:"jobSetNodePools,omitempty"`
+	// JobSetInterruptionsByStepRange counts the interruptions of each JobSet
+	// by training step range, see EventRecords.InterruptionsByStepRange, but
+	// for compacted interruptions. Only set if a step range width is
+	// configured.
+	JobSetInterruptionsByStepRange map[string]map[int64]int `json:"jobSetInterruptionsByStepRange,omitempty"`
+	// JobsUp and JobsUpSummaries are the upness of each replica of each
+	// replicated Job of a JobSet, keyed by JobKey, so that a single flaky
+	// replica stands out. JobSetJobsUpSummaries rolls them up per JobSet
+	// (see RollUp). Only set while replicated Job events are tracked.
+	JobsUp                map[string]Upness                 `json:"jobsUp,omitempty"`
+	JobsUpSummaries       map[string]UpnessSummaryWithAttrs `json:"jobsUpSummaries,omitempty"`
+	JobSetJobsUpSummaries map[string]UpnessSummaryWithAttrs `json:"jobSetJobsUpSummaries,omitempty"`
+
+	// Fleet rolls up the summaries of all entities.
+	Fleet FleetSummary `json:"fleet"`
+	// Namespaces rolls up the JobSets of each namespace, keyed by namespace.
+	// Only set if enabled, see SummarizeNamespaces.
+	Namespaces map[string]NamespaceSummary `json:"namespaces,omitempty"`
+	// NodePools rolls up all Nodes by their node pool, keyed by node pool. Only set if enabled, see SummarizeNodePools.
+	NodePools map[string]NodePoolSummary `json:"nodePools,omitempty"`
+
+	// JobSetEvents and JobSetNodeEvents hold the raw event records. They are
+	// only included when rendering with the RenderProfileFull profile.
+	JobSetEvents     map[string]EventRecords `json:"jobSetEvents,omitempty"`
+	JobSetNodeEvents map[string]EventRecords `json:"jobSetNodeEvents,omitempty"`
+	JobEvents        map[string]EventRecords `json:"jobEvents,omitempty"`
+}
+
+// JobKey is the key of a replica (by index) of a replicated Job of the
+// JobSet with the given UID in Report.JobsUp, Report.JobsUpSummaries and
+// Report.JobEvents.
+func JobKey(jobSetUID, replicatedJobName string, index int) string {
+	return jobSetUID + "/" + replicatedJobName + "/" + strconv.Itoa(index)
+}
+
+// JobSetKeyOfJob returns the JobSet UID of a JobKey.
+func JobSetKeyOfJob(key string) string {
+	uid, _, _ := strings.Cut(key, "/")
+	return uid
+}
+
+// RenderProfile selects how much detail is included in a rendered Report.
+type RenderProfile string
+
+const (
+	// RenderProfileSummary includes upness and summaries only (default).
+	RenderProfileSummary RenderProfile = "summary"
+	// RenderProfileFull additionally includes the raw event records.
+	RenderProfileFull RenderProfile = "full"
+)
+
+// Render returns a copy of the report with the detail for the given profile.
+func (r Report) Render(p RenderProfile) Report {
+	if p == RenderProfileFull {
+		return r
+	}
+	r.JobSetEvents = nil
+	r.JobSetNodeEvents = nil
+	r.JobEvents = nil
+	return r
+}
+
+// FleetSummary rolls up interruptions across all entities and layers.
+type FleetSummary struct {
+	// InterruptionCount is the total number of interruptions recorded at
+	// the JobSet and JobSet Nodes layers.
+	InterruptionCount int `json:"interruptionCount"`
+	// IncidentCount is the number of distinct incidents, counting
+	// interruptions of different layers of the same JobSet that are
+	// correlated in time (e.g. Nodes going down, followed by their JobSet)
+	// once.
+	IncidentCount int `json:"incidentCount"`
+}
+
+// NamespaceSummary rolls up the JobSets of a namespace.
+type NamespaceSummary struct {
+	// JobSetCount is the number of JobSets in the namespace.
+	JobSetCount int `json:"jobSetCount"`
+	// JobSets and JobSetNodes roll up the summaries of the JobSets at each
+	// layer (see RollUp): uptime and downtime are summed and availability
+	// is averaged, weighted by Lifetime.
+	JobSets     EventSummary `json:"jobSets"`
+	JobSetNodes EventSummary `json:"jobSetNodes"`
+	// Fleet counts the interruptions and incidents of the namespace, see
+	// SummarizeFleet.
+	Fleet FleetSummary `json:"fleet"`
+}
+
+// SummarizeNamespaces rolls up the JobSets of the report by namespace, with
+// their event records grouped by namespace for the incidents (see
+// SummarizeFleet for the window).
+func (r Report) SummarizeNamespaces(window time.Duration) map[string]NamespaceSummary {
+	byNamespace := map[string][]string{}
+	for key, up := range r.JobSetsUp {
+		byNamespace[up.JobSetNamespace] = append(byNamespace[up.JobSetNamespace], key)
+	}
+
+	out := make(map[string]NamespaceSummary, len(byNamespace))
+	for ns, keys := range byNamespace {
+		var jobSets, jobSetNodes []EventSummary
+		jobSetEvents := make(map[string]EventRecords, len(keys))
+		jobSetNodeEvents := make(map[string]EventRecords, len(keys))
+		for _, key := range keys {
+			if s, ok := r.JobSetsUpSummaries[key]; ok {
+				jobSets = append(jobSets, s.EventSummary)
+			}
+			if s, ok := r.JobSetNodesUpSummaries[key]; ok {
+				jobSetNodes = append(jobSetNodes, s.EventSummary)
+			}
+			if rec, ok := r.JobSetEvents[key]; ok {
+				jobSetEvents[key] = rec
+			}
+			if rec, ok := r.JobSetNodeEvents[key]; ok {
+				jobSetNodeEvents[key] = rec
+			}
+		}
+		out[ns] = NamespaceSummary{
+			JobSetCount: len(keys),
+			JobSets:     RollUp(jobSets...),
+			JobSetNodes: RollUp(jobSetNodes...),
+			Fleet:       SummarizeFleet(jobSetEvents, jobSetNodeEvents, window),
+		}
+	}
+	return out
+}
+
+// NodePoolSummary rolls up the Nodes of a node pool.
+type NodePoolSummary struct {
+	// NodeCount is the number of Nodes of the node pool.
+	NodeCount int `json:"nodeCount"`
+	// Nodes rolls up the summaries of the Nodes (see RollUp): an
+	// interruption is one of any Node, uptime and downtime are summed and
+	// availability is averaged, weighted by Lifetime.
+	Nodes EventSummary `json:"nodes"`
+}
+
+// SummarizeNodePools rolls up the events of each Node by node pool, given the
+// node pool of each Node (see k8sutils.GetNodePool). Nodes without a node pool
+// or events are skipped.
+func SummarizeNodePools(now time.Time, nodePools map[string]string, nodeEvents map[string]EventRecords, opts SummaryOptions) map[string]NodePoolSummary {
+	byPool := map[string][]EventSummary{}
+	for node, pool := range nodePools {
+		rec, ok := nodeEvents[node]
+		if pool == "" || !ok || len(rec.UpEvents) == 0 {
+			continue
+		}
+		byPool[pool] = append(byPool[pool], rec.SummarizeWithOptions(now, opts))
+	}
+
+	out := make(map[string]NodePoolSummary, len(byPool))
+	for pool, summaries := range byPool {
+		out[pool] = NodePoolSummary{
+			NodeCount: len(summaries),
+			Nodes:     RollUp(summaries...),
+		}
+	}
+	return out
+}
+
+// Kind is the kind of entity that upness is tracked for, e.g. a JobSet or the
+// Nodes it runs on.
+type Kind string
+
+const (
+	// KindJobSet is the upness of a JobSet's Jobs.
+	KindJobSet Kind = "jobset"
+	// KindJobSetNodes is the upness of the Nodes a JobSet runs on.
+	KindJobSetNodes Kind = "jobset-nodes"
+	// KindNode is the upness of a single Node.
+	KindNode Kind = "node"
+	// KindNodePool is the upness of a node pool.
+	KindNodePool Kind = "nodepool"
+	// KindJob is the upness of a single replicated Job of a JobSet.
+	KindJob Kind = "job"
+	// KindNamespace is the upness of the JobSets in a namespace.
+	KindNamespace Kind = "namespace"
+)
+
+// WithoutShortLived returns a copy of the report without the entities that
+// have existed for less than min, by the longest Lifetime of their summaries.
+// Entities without summaries are excluded. A zero min returns the report as is.
+func (r Report) WithoutShortLived(min time.Duration) Report {
+	if min <= 0 {
+		return r
+	}
+	lifetimes := map[string]time.Duration{}
+	for _, summaries := range []map[string]UpnessSummaryWithAttrs{r.JobSetsUpSummaries, r.JobSetNodesUpSummaries} {
+		for key, s := range summaries {
+			if s.Lifetime > lifetimes[key] {
+				lifetimes[key] = s.Lifetime
+			}
+		}
+	}
+	keep := func(key string) bool { return lifetimes[key] >= min }
+
+	out := r
+	out.JobSetsUp = filterKeys(r.JobSetsUp, keep)
+	out.JobSetNodesUp = filterKeys(r.JobSetNodesUp, keep)
+	out.JobSetsUpSummaries = filterKeys(r.JobSetsUpSummaries, keep)
+	out.JobSetNodesUpSummaries = filterKeys(r.JobSetNodesUpSummaries, keep)
+	if r.JobSetNodePools != nil {
+		out.JobSetNodePools = filterKeys(r.JobSetNodePools, keep)
+	}
+	if r.JobSetInterruptionsByStepRange != nil {
+		out.JobSetInterruptionsByStepRange = filterKeys(r.JobSetInterruptionsByStepRange, keep)
+	}
+	keepJob := func(key string) bool { return keep(JobSetKeyOfJob(key)) }
+	if r.JobsUp != nil {
+		out.JobsUp = filterKeys(r.JobsUp, keepJob)
+	}
+	if r.JobsUpSummaries != nil {
+		out.JobsUpSummaries = filterKeys(r.JobsUpSummaries, keepJob)
+	}
+	if r.JobSetJobsUpSummaries != nil {
+		out.JobSetJobsUpSummaries = filterKeys(r.JobSetJobsUpSummaries, keep)
+	}
+	if r.JobEvents != nil {
+		out.JobEvents = filterKeys(r.JobEvents, keepJob)
+	}
+	if r.JobSetEvents != nil {
+		out.JobSetEvents = filterKeys(r.JobSetEvents, keep)
+	}
+	if r.JobSetNodeEvents != nil {
+		out.JobSetNodeEvents = filterKeys(r.JobSetNodeEvents, keep)
+	}
+	return out
+}
+
+// SLOCompliance returns the number of JobSets with an SLO and how many of
+// them are meeting it, i.e. have error budget remaining.
+func (r Report) SLOCompliance() (meeting, total int) {
+	for _, s := range r.JobSetsUpSummaries {
+		if s.SLO.Target == 0 {
+			continue
+		}
+		total++
+		if s.ErrorBudgetRemaining >= 0 {
+			meeting++
+		}
+	}
+	return meeting, total
+}
+
+func filterKeys[V any](m map[string]V, keep func(string) bool) map[string]V {
+	out := make(map[string]V, len(m))
+	for k, v := range m {
+		if keep(k) {
+			out[k] = v
+		}
+	}
+	return out
 }
 
 type Attrs struct {
+	Kind Kind `json:"kind,omitempty"`
+
 	JobSetName      string `json:"jobsetName"`
 	JobSetNamespace string `json:"jobsetNamespace"`
 
@@ -26,12 +307,45 @@ type Attrs struct {
 	Spot           bool   `json:"spot"`
 
 	NodePoolName string `json:"nodePoolName"`
+
+	// ReplicatedJobName and JobIndex, the replica of the replicated Job,
+	// are set for KindJob.
+	ReplicatedJobName string `json:"replicatedJobName,omitempty"`
+	JobIndex          string `json:"jobIndex,omitempty"`
 }
 
 type Upness struct {
 	ReadyCount    int32 `json:"readyCount"`
 	ExpectedCount int32 `json:"expectedCount"`
 	Attrs
+
+	// LastCheckpoint is the last checkpoint time reported by the workload.
+	LastCheckpoint time.Time `json:"-"`
+	// Step is the current training step reported by the workload (nil if
+	// unknown).
+	Step *int64 `json:"-"`
+
+	// Pending is set while the entity is not yet expected to be running, e.g.
+	// a JobSet created suspended or with zero replicas. No events are recorded
+	// for an entity until it is no longer pending.
+	Pending bool `json:"-"`
+
+	// SLO is the entity's own SLO; unset fields fall back to the default
+	// SLO (see SummaryOptions.SLO).
+	SLO SLO `json:"-"`
+
+	// Severity is the severity of an interruption recorded while the entity
+	// is down, see UpEvent.Severity. Empty without a designated coordinator.
+	Severity Severity `json:"-"`
+
+	// Degraded is set while accelerator health signals (e.g. GPU XID errors
+	// surfaced as Node conditions) are reported for an entity that is up.
+	// Degradation often precedes an interruption.
+	Degraded bool `json:"degraded,omitempty"`
+
+	// RestartBudgetRemaining is the number of restarts left before the
+	// JobSet fails (nil if the JobSet has no failure policy).
+	RestartBudgetRemaining *int32 `json:"restartBudgetRemaining,omitempty"`
 }
 
 func (up Upness) Up() bool {